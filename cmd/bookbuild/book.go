@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/pgn"
+	"github.com/samwestmoreland/chessengine/internal/polyglot"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// stats are the counts for a move, from the point of view of the side that played it.
+type stats struct {
+	games, wins, draws, losses int
+	// ratingSum is the total rating of the players who played the move in rated games, of which
+	// there were rated.
+	ratingSum, rated int
+}
+
+// points returns the points the move scored, counting two for a win and one for a draw.
+func (s *stats) points() int {
+	return 2*s.wins + s.draws
+}
+
+// node is a position in the book, with the moves played from it.
+type node struct {
+	pos   *position.Position
+	moves map[move.Move]*stats
+}
+
+// book accumulates the moves played in games, by position.
+type book struct {
+	// maxPlies is how far into each game to go, or 0 for the whole game.
+	maxPlies  int
+	positions map[uint64]*node
+	games     int
+}
+
+func newBook(maxPlies int) *book {
+	return &book{maxPlies: maxPlies, positions: make(map[uint64]*node)}
+}
+
+// add counts the moves of a game's main line.
+func (b *book) add(g *pgn.Game) error {
+	pos, err := g.StartPosition()
+	if err != nil {
+		return err
+	}
+
+	var ratings [2]int
+	for i, tag := range []string{"WhiteElo", "BlackElo"} {
+		ratings[i], _ = strconv.Atoi(g.Tag(tag))
+	}
+
+	b.games++
+
+	for ply, m := range g.MainLine() {
+		if b.maxPlies > 0 && ply >= b.maxPlies {
+			break
+		}
+
+		key := polyglot.Key(pos)
+
+		n, ok := b.positions[key]
+		if !ok {
+			n = &node{pos: pos, moves: make(map[move.Move]*stats)}
+			b.positions[key] = n
+		}
+
+		s, ok := n.moves[m]
+		if !ok {
+			s = &stats{}
+			n.moves[m] = s
+		}
+
+		side := 0
+		if !pos.WhiteToMove {
+			side = 1
+		}
+
+		s.games++
+
+		switch {
+		case g.Result == pgn.Drawn:
+			s.draws++
+		case g.Result == pgn.WhiteWins && side == 0, g.Result == pgn.BlackWins && side == 1:
+			s.wins++
+		case g.Result == pgn.WhiteWins, g.Result == pgn.BlackWins:
+			s.losses++
+		}
+
+		if ratings[side] > 0 {
+			s.ratingSum += ratings[side]
+			s.rated++
+		}
+
+		pos = movegen.MakeMove(pos, m, false)
+	}
+
+	return nil
+}
+
+// prune drops moves played in fewer than minGames games, and positions left with no moves.
+func (b *book) prune(minGames int) {
+	for key, n := range b.positions {
+		for m, s := range n.moves {
+			if s.games < minGames {
+				delete(n.moves, m)
+			}
+		}
+
+		if len(n.moves) == 0 {
+			delete(b.positions, key)
+		}
+	}
+}
+
+// moves returns the number of moves in the book.
+func (b *book) moves() int {
+	ret := 0
+	for _, n := range b.positions {
+		ret += len(n.moves)
+	}
+
+	return ret
+}
+
+// bookMove is a move of a position with its statistics and weight.
+type bookMove struct {
+	move   move.Move
+	stats  *stats
+	weight uint16
+}
+
+// sortedMoves returns the moves of a position, most often played first. Weights are the points
+// each move scored, scaled down if need be so that the largest fits in 16 bits.
+func (n *node) sortedMoves() []bookMove {
+	ret := make([]bookMove, 0, len(n.moves))
+	maxPoints := 0
+
+	for m, s := range n.moves {
+		ret = append(ret, bookMove{move: m, stats: s})
+		maxPoints = max(maxPoints, s.points())
+	}
+
+	for i := range ret {
+		points := ret[i].stats.points()
+		if maxPoints > 0xffff {
+			points = points * 0xffff / maxPoints
+		}
+
+		ret[i].weight = uint16(points)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].stats.games != ret[j].stats.games {
+			return ret[i].stats.games > ret[j].stats.games
+		}
+
+		return ret[i].move < ret[j].move
+	})
+
+	return ret
+}
+
+// sortedPositions returns the positions of the book, most often reached first.
+func (b *book) sortedPositions() []uint64 {
+	games := make(map[uint64]int, len(b.positions))
+	keys := make([]uint64, 0, len(b.positions))
+
+	for key, n := range b.positions {
+		keys = append(keys, key)
+
+		for _, s := range n.moves {
+			games[key] += s.games
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if games[keys[i]] != games[keys[j]] {
+			return games[keys[i]] > games[keys[j]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+func (b *book) writePolyglot(w io.Writer) error {
+	entries := make([]polyglot.Entry, 0, b.moves())
+
+	for key, n := range b.positions {
+		for _, m := range n.sortedMoves() {
+			entries = append(entries, polyglot.Entry{
+				Key:    key,
+				Move:   polyglot.EncodeMove(m.move),
+				Weight: m.weight,
+			})
+		}
+	}
+
+	return polyglot.Write(w, entries)
+}
+
+// Position is a position of the book as exported to JSON.
+type Position struct {
+	FEN   string `json:"fen"`
+	Key   string `json:"key"`
+	Moves []Move `json:"moves"`
+}
+
+// Move is a move of a position as exported to JSON. Score is the fraction of the points available
+// that the move scored in games with a result, and AverageRating is omitted if none of the games
+// it was played in were rated.
+type Move struct {
+	Move          string   `json:"move"`
+	SAN           string   `json:"san"`
+	Games         int      `json:"games"`
+	Wins          int      `json:"wins"`
+	Draws         int      `json:"draws"`
+	Losses        int      `json:"losses"`
+	Score         float64  `json:"score"`
+	AverageRating *float64 `json:"average_rating,omitempty"`
+	Weight        uint16   `json:"weight"`
+}
+
+// export returns the book's positions and moves in the form they are exported in.
+func (b *book) export() []Position {
+	ret := make([]Position, 0, len(b.positions))
+
+	for _, key := range b.sortedPositions() {
+		n := b.positions[key]
+		p := Position{FEN: n.pos.FEN(), Key: fmt.Sprintf("%016x", key)}
+
+		for _, m := range n.sortedMoves() {
+			s := m.stats
+			out := Move{
+				Move:   strings.ToLower(m.move.String()),
+				SAN:    movegen.SAN(n.pos, m.move),
+				Games:  s.games,
+				Wins:   s.wins,
+				Draws:  s.draws,
+				Losses: s.losses,
+				Weight: m.weight,
+			}
+
+			if decided := s.wins + s.draws + s.losses; decided > 0 {
+				out.Score = float64(s.points()) / float64(2*decided)
+			}
+
+			if s.rated > 0 {
+				rating := float64(s.ratingSum) / float64(s.rated)
+				out.AverageRating = &rating
+			}
+
+			p.Moves = append(p.Moves, out)
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+func (b *book) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(b.export())
+}
+
+// writeCSV writes a row for every move, after a header row.
+func (b *book) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"fen", "key", "move", "san", "games", "wins", "draws", "losses", "score", "average_rating", "weight"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, p := range b.export() {
+		for _, m := range p.Moves {
+			rating := ""
+			if m.AverageRating != nil {
+				rating = strconv.FormatFloat(*m.AverageRating, 'f', 0, 64)
+			}
+
+			row := []string{
+				p.FEN, p.Key, m.Move, m.SAN,
+				strconv.Itoa(m.Games), strconv.Itoa(m.Wins), strconv.Itoa(m.Draws), strconv.Itoa(m.Losses),
+				strconv.FormatFloat(m.Score, 'f', 3, 64), rating, strconv.Itoa(int(m.Weight)),
+			}
+
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
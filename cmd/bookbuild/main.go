@@ -0,0 +1,126 @@
+// Command bookbuild makes an opening book from PGN files of games.
+//
+// Every game's main line is replayed up to -depth plies, and each move played is counted in the
+// position it was played from, with how the games it was played in ended and the average rating
+// of the players who played it. Moves played in fewer than -min-games games are left out, so a
+// book made from a large archive isn't mostly one-off moves.
+//
+//	go run ./cmd/bookbuild -depth 16 -min-games 5 -output book.bin -csv book.csv games/*.pgn
+//
+// The book is written in the Polyglot format to -output, for use with the engine's BookFile
+// option, with each move weighted by the points it scored for the side that played it: two for a
+// win and one for a draw. Moves that scored nothing are kept, with a weight of zero, so they are
+// in the book but never played. The counts behind the weights can be written to -json or -csv, to
+// see what a book holds and decide what to cut from it.
+//
+// Games that can't be read are reported and skipped. Games without a result still count towards
+// how often a move was played, but not towards its wins, draws and losses.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/pgn"
+)
+
+func main() {
+	output := flag.String("output", "", "file to write the Polyglot book to")
+	jsonPath := flag.String("json", "", "file to write the move statistics to as JSON")
+	csvPath := flag.String("csv", "", "file to write the move statistics to as CSV")
+	depth := flag.Int("depth", 20, "number of plies of each game to add to the book, or 0 for all")
+	minGames := flag.Int("min-games", 1, "number of games a move must have been played in to be kept")
+	flag.Parse()
+
+	if flag.NArg() == 0 || *output == "" && *jsonPath == "" && *csvPath == "" {
+		log.Fatal("usage: bookbuild [-output book.bin] [-json book.json] [-csv book.csv] [flags] games.pgn...")
+	}
+
+	if err := movegen.Initialise(); err != nil {
+		log.Fatal(err)
+	}
+
+	b := newBook(*depth)
+
+	for _, path := range flag.Args() {
+		if err := addFile(b, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	b.prune(*minGames)
+
+	log.Printf("%d games, %d positions, %d moves", b.games, len(b.positions), b.moves())
+
+	writers := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{*output, b.writePolyglot},
+		{*jsonPath, b.writeJSON},
+		{*csvPath, b.writeCSV},
+	}
+
+	for _, w := range writers {
+		if w.path == "" {
+			continue
+		}
+
+		if err := writeFile(w.path, w.write); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// addFile adds the games of a PGN file to the book, logging and skipping any that can't be read.
+func addFile(b *book, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r := pgn.NewReader(f)
+
+	for {
+		g, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var gameErr *pgn.GameError
+		if errors.As(err, &gameErr) {
+			log.Printf("%s: %v", path, err)
+
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		if err := b.add(g); err != nil {
+			log.Printf("%s: skipping game: %v", path, err)
+		}
+	}
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,370 @@
+// Command epdtest scores the engine on test suites such as WAC and STS, which are EPD files of
+// positions with the best moves to find (bm) or the moves to avoid (am).
+//
+// Every position is searched with the same limit, given by -time, -depth or -nodes, and passes if
+// the engine plays one of its best moves and none of its moves to avoid. Suites whose c0 operation
+// gives points for several moves, as STS does with c0 "Qd2=10, Qe1=7, Rb1=3", are also scored by
+// the points of the move played. The time and nodes to solution are those of the first iteration
+// after which the engine's choice stayed correct.
+//
+// Positions are searched in parallel. With -json the results are written as JSON, which is handy
+// for tracking regressions between commits:
+//
+//	go run ./cmd/epdtest -time 1s -json wac.epd > wac.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/epd"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// Result is the outcome of one position.
+type Result struct {
+	ID     string `json:"id"`
+	FEN    string `json:"fen"`
+	Move   string `json:"move"`
+	Passed bool   `json:"passed"`
+	// Points and MaxPoints are from the c0 point values if there are any, and otherwise 1 or 0
+	// out of 1.
+	Points    int    `json:"points"`
+	MaxPoints int    `json:"max_points"`
+	Depth     int    `json:"depth"`
+	Nodes     uint64 `json:"nodes"`
+	TimeMS    int64  `json:"time_ms"`
+	// SolvedMS and SolvedNodes are when the engine settled on a passing move, and are omitted
+	// if it didn't.
+	SolvedMS    *int64  `json:"solved_ms,omitempty"`
+	SolvedNodes *uint64 `json:"solved_nodes,omitempty"`
+}
+
+// Summary is the outcome of a whole suite.
+type Summary struct {
+	Positions int      `json:"positions"`
+	Passed    int      `json:"passed"`
+	Points    int      `json:"points"`
+	MaxPoints int      `json:"max_points"`
+	Nodes     uint64   `json:"nodes"`
+	TimeMS    int64    `json:"time_ms"`
+	Results   []Result `json:"results"`
+}
+
+// test is a position to search, with what's needed to score the move played.
+type test struct {
+	id     string
+	pos    *position.Position
+	best   []move.Move
+	avoid  []move.Move
+	points map[move.Move]int
+}
+
+func main() {
+	moveTime := flag.Duration("time", 0, "time to search each position for")
+	depth := flag.Int("depth", 0, "depth to search each position to")
+	nodes := flag.Uint64("nodes", 0, "number of nodes to search in each position")
+	numWorkers := flag.Int("workers", runtime.GOMAXPROCS(0), "number of positions to search at once")
+	jsonOutput := flag.Bool("json", false, "write the results as JSON")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: epdtest [flags] suite.epd...")
+	}
+
+	limits := engine.Limits{MoveTime: *moveTime, Depth: *depth, Nodes: *nodes}
+	if limits == (engine.Limits{}) {
+		limits.MoveTime = time.Second
+	}
+
+	if err := movegen.Initialise(); err != nil {
+		log.Fatal(err)
+	}
+
+	var tests []test
+
+	for _, path := range flag.Args() {
+		suite, err := load(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tests = append(tests, suite...)
+	}
+
+	summary := run(tests, limits, *numWorkers)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(summary); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	printSummary(summary)
+}
+
+// load reads the positions of a suite, naming any that have no id after the file and line.
+func load(path string) ([]test, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	records, err := epd.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	tests := make([]test, 0, len(records))
+
+	for i, r := range records {
+		t := test{
+			id:     r.Ops.ID(),
+			pos:    r.Position,
+			best:   r.Ops.BestMoves(),
+			avoid:  r.Ops.AvoidMoves(),
+			points: parsePoints(r.Position, r.Ops.Comment(0)),
+		}
+
+		if t.id == "" {
+			t.id = fmt.Sprintf("%s:%d", path, i+1)
+		}
+
+		if len(t.best) == 0 && len(t.avoid) == 0 && len(t.points) == 0 {
+			log.Printf("%s has no bm or am operation, skipping", t.id)
+
+			continue
+		}
+
+		tests = append(tests, t)
+	}
+
+	return tests, nil
+}
+
+// parsePoints parses the point values of an STS comment, such as "Qd2=10, Qe1=7, Rb1=3". It
+// returns nil if the comment isn't a list of points.
+func parsePoints(pos *position.Position, comment string) map[move.Move]int {
+	if !strings.Contains(comment, "=") {
+		return nil
+	}
+
+	ret := make(map[move.Move]int)
+
+	for _, item := range strings.Split(comment, ",") {
+		san, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil
+		}
+
+		// Promotions such as e8=Q=10 have an = of their own.
+		if i := strings.LastIndex(value, "="); i >= 0 {
+			san, value = san+"="+value[:i], value[i+1:]
+		}
+
+		points, err := strconv.Atoi(value)
+		if err != nil {
+			return nil
+		}
+
+		m, err := movegen.ParseSAN(pos, san)
+		if err != nil {
+			return nil
+		}
+
+		ret[m] = points
+	}
+
+	return ret
+}
+
+// run searches every position using a pool of workers, each with its own engine.
+func run(tests []test, limits engine.Limits, numWorkers int) Summary {
+	results := make([]Result, len(tests))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range max(numWorkers, 1) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			e, err := engine.NewEngine()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for i := range jobs {
+				results[i] = tests[i].run(e, limits)
+			}
+		}()
+	}
+
+	for i := range tests {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	summary := Summary{Positions: len(results), Results: results}
+
+	for _, r := range results {
+		if r.Passed {
+			summary.Passed++
+		}
+
+		summary.Points += r.Points
+		summary.MaxPoints += r.MaxPoints
+		summary.Nodes += r.Nodes
+		summary.TimeMS += r.TimeMS
+	}
+
+	return summary
+}
+
+// run searches the position and scores the move played.
+func (t *test) run(e *engine.Engine, limits engine.Limits) Result {
+	ret := Result{ID: t.id, FEN: t.pos.FEN()}
+
+	var (
+		solved      bool
+		solvedTime  time.Duration
+		solvedNodes uint64
+		last        engine.Info
+	)
+
+	best := e.Search(context.Background(), t.pos, limits, func(info engine.Info) {
+		last = info
+
+		if len(info.PV) == 0 {
+			return
+		}
+
+		passed, _ := t.score(info.PV[0])
+
+		switch {
+		case passed && !solved:
+			solved, solvedTime, solvedNodes = true, info.Time, info.Nodes
+		case !passed:
+			solved = false
+		}
+	})
+
+	ret.Depth, ret.Nodes, ret.TimeMS = last.Depth, last.Nodes, last.Time.Milliseconds()
+
+	ret.MaxPoints = 1
+	if len(t.points) > 0 {
+		ret.MaxPoints = maxPoints(t.points)
+	}
+
+	if best == 0 {
+		return ret
+	}
+
+	ret.Move = movegen.SAN(t.pos, best)
+	ret.Passed, ret.Points = t.score(best)
+
+	if ret.Passed && solved {
+		ms := solvedTime.Milliseconds()
+		ret.SolvedMS, ret.SolvedNodes = &ms, &solvedNodes
+	}
+
+	return ret
+}
+
+// score returns whether a move passes and the points it earns.
+func (t *test) score(m move.Move) (bool, int) {
+	passed := len(t.best) == 0 || contains(t.best, m)
+	passed = passed && !contains(t.avoid, m)
+
+	if len(t.points) > 0 {
+		// Suites with points are scored by them alone, so the best move is the one worth most.
+		points := t.points[m]
+		if len(t.best) == 0 && len(t.avoid) == 0 {
+			passed = points == maxPoints(t.points)
+		}
+
+		return passed, points
+	}
+
+	if passed {
+		return true, 1
+	}
+
+	return false, 0
+}
+
+func maxPoints(points map[move.Move]int) int {
+	ret := 0
+	for _, p := range points {
+		ret = max(ret, p)
+	}
+
+	return ret
+}
+
+func contains(moves []move.Move, m move.Move) bool {
+	for _, other := range moves {
+		if other == m {
+			return true
+		}
+	}
+
+	return false
+}
+
+func printSummary(s Summary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "id\tresult\tmove\tpoints\tdepth\tnodes\ttime\tsolved\t")
+
+	for _, r := range s.Results {
+		result := "fail"
+		if r.Passed {
+			result = "pass"
+		}
+
+		solved := "-"
+		if r.SolvedMS != nil {
+			solved = fmt.Sprintf("%dms/%d", *r.SolvedMS, *r.SolvedNodes)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%d\t%d\t%dms\t%s\t\n",
+			r.ID, result, r.Move, r.Points, r.MaxPoints, r.Depth, r.Nodes, r.TimeMS, solved)
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+
+	percent := 0.0
+	if s.MaxPoints > 0 {
+		percent = 100 * float64(s.Points) / float64(s.MaxPoints)
+	}
+
+	fmt.Printf("\npassed %d/%d, points %d/%d (%.1f%%), %d nodes in %v\n",
+		s.Passed, s.Positions, s.Points, s.MaxPoints, percent, s.Nodes,
+		(time.Duration(s.TimeMS) * time.Millisecond).Round(time.Millisecond))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math/bits"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+	"github.com/samwestmoreland/chessengine/internal/tables"
+)
+
+// candidateTester tests candidate magics for a piece on a square. Every configuration of blockers
+// and the attacks it gives are worked out once, up front, and each candidate hashes them into the
+// same table. Rather than clearing the table between candidates, each slot is stamped with the
+// epoch, the number of the candidate that last wrote it, and a slot with an older stamp counts as
+// empty.
+type candidateTester struct {
+	// quickReject turns on rejecting candidates that don't look as if they'll work before trying
+	// them. The ones it rejects are mostly ones that map many configurations with the same attacks
+	// to one slot, which leave gaps in the table that other squares' tables can use, so it's off
+	// when packing.
+	quickReject bool
+
+	mask     bb.Bitboard
+	blockers []bb.Bitboard
+	attacks  []bb.Bitboard
+
+	table  []bb.Bitboard
+	stamps []uint32
+	epoch  uint32
+
+	// indices are the slots the last candidate that worked wrote to, in the order it wrote them,
+	// and entries the attacks it wrote to each, so that its table can be fitted into a shared one.
+	indices []int
+	entries []bb.Bitboard
+}
+
+func newCandidateTester(piece int, square sq.Square, quickReject bool) *candidateTester {
+	mask := tables.MaskBishopAttacks(square)
+	if piece == rook {
+		mask = tables.MaskRookAttacks(square)
+	}
+
+	configs := 1 << bb.CountBits(mask)
+
+	ret := &candidateTester{
+		quickReject: quickReject,
+		mask:        mask,
+		blockers:    make([]bb.Bitboard, configs),
+		attacks:     make([]bb.Bitboard, configs),
+		table:       make([]bb.Bitboard, configs),
+		stamps:      make([]uint32, configs),
+	}
+
+	for i := range configs {
+		ret.blockers[i] = bb.SetOccupancy(i, mask)
+
+		if piece == rook {
+			ret.attacks[i] = tables.RookAttacksOnTheFly(square, ret.blockers[i])
+		} else {
+			ret.attacks[i] = tables.BishopAttacksOnTheFly(square, ret.blockers[i])
+		}
+	}
+
+	return ret
+}
+
+// test reports whether a candidate magic works with the given shift, which must be at least 64
+// minus the number of bits in the mask, and if it does, the size of the table it gives.
+func (t *candidateTester) test(candidate uint64, shift int) (bool, uint64) {
+	// A magic has to spread the bits of the mask into the top of the product, which the index is
+	// taken from. One that leaves fewer than six of the top eight bits set hardly ever works, so
+	// it's rejected without trying every configuration.
+	if t.quickReject && bits.OnesCount64((uint64(t.mask)*candidate)&0xff00000000000000) < 6 {
+		return false, 0
+	}
+
+	t.epoch++
+	if t.epoch == 0 {
+		clear(t.stamps)
+
+		t.epoch = 1
+	}
+
+	t.indices, t.entries = t.indices[:0], t.entries[:0]
+
+	var maxIndex uint64
+
+	for i, blockers := range t.blockers {
+		index := (uint64(blockers) * candidate) >> shift
+
+		maxIndex = max(maxIndex, index)
+
+		switch {
+		case t.stamps[index] != t.epoch:
+			t.stamps[index] = t.epoch
+			t.table[index] = t.attacks[i]
+			t.indices = append(t.indices, int(index))
+			t.entries = append(t.entries, t.attacks[i])
+		case t.table[index] != t.attacks[i]:
+			return false, 0
+		}
+	}
+
+	return true, maxIndex + 1
+}
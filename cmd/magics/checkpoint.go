@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+	"github.com/samwestmoreland/chessengine/magic"
+)
+
+// checkpoint records the magics a search has found so far, keyed by square, so that a search
+// that's stopped can carry on where it left off. It's only carried on with the settings it was
+// started with.
+type checkpoint struct {
+	settings
+	Rook   map[string]magic.Entry `json:"rook"`
+	Bishop map[string]magic.Entry `json:"bishop"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// settings are the flags a checkpoint was started with. The seed and number of attempts are needed
+// to find the same magics again, packing looks for different magics, and the pieces and squares
+// decide which magics there are to find.
+type settings struct {
+	Seed     uint64 `json:"seed"`
+	Attempts int    `json:"attempts"`
+	Pack     bool   `json:"pack,omitempty"`
+	Piece    string `json:"piece"`
+	Squares  string `json:"squares,omitempty"`
+}
+
+// loadCheckpoint reads the checkpoint in the given file, or returns an empty one if there's no such
+// file.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	ret := &checkpoint{
+		Rook:   make(map[string]magic.Entry),
+		Bishop: make(map[string]magic.Entry),
+		path:   path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ret, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint %s: %w", path, err)
+	}
+
+	if ret.Rook == nil || ret.Bishop == nil {
+		return nil, fmt.Errorf("checkpoint %s is missing the magics of a piece", path)
+	}
+
+	log.Printf("Carrying on from %s, which has %d rook and %d bishop magics", path, len(ret.Rook), len(ret.Bishop))
+
+	return ret, nil
+}
+
+// start sets the settings of a new checkpoint, picking a seed at random if it's 0. A checkpoint
+// that's being carried on keeps its seed, and must have been started with the same settings and, if
+// one is given, the same seed.
+func (c *checkpoint) start(want settings) error {
+	if c.Attempts != 0 {
+		if want.Seed == 0 {
+			want.Seed = c.Seed
+		}
+
+		if want != c.settings {
+			return fmt.Errorf("%s was made with -seed %d -attempts %d -pack=%t -piece %s -squares %q; carry on with those, or remove it",
+				c.path, c.Seed, c.Attempts, c.Pack, c.Piece, c.Squares)
+		}
+
+		return nil
+	}
+
+	for want.Seed == 0 {
+		want.Seed = bb.RandomUint64()
+	}
+
+	c.settings = want
+
+	return nil
+}
+
+// has reports whether the checkpoint has a magic for a piece on a square.
+func (c *checkpoint) has(piece int, square sq.Square) bool {
+	_, ok := c.get(piece, square)
+
+	return ok
+}
+
+// get returns the magic the checkpoint has for a piece on a square, if it has one.
+func (c *checkpoint) get(piece int, square sq.Square) (magic.Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries(piece)[sq.Stringify(square)]
+
+	return entry, ok
+}
+
+// add records the magic found for a piece on a square, and writes the checkpoint out.
+func (c *checkpoint) add(piece int, entry magic.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries(piece)[entry.Square] = entry
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	// Write to a temporary file first, so that a checkpoint is never left half written.
+	if err := os.WriteFile(c.path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	if err := os.Rename(c.path+".tmp", c.path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// remove deletes the checkpoint's file once the search is finished.
+func (c *checkpoint) remove() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (c *checkpoint) entries(piece int) map[string]magic.Entry {
+	if piece == rook {
+		return c.Rook
+	}
+
+	return c.Bishop
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"math"
+	"math/rand/v2"
 	"os"
+	"os/signal"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
@@ -48,182 +54,499 @@ const (
 	rook
 )
 
-var versionString = strings.TrimSpace(magic.VersionString)
+// extraShifts is how many shifts a search tries for a square, starting from the one that gives an
+// index for every blocker configuration and halving the table each time, until one of them finds a
+// magic.
+const extraShifts = 4
+
+const defaultOut = "magic/magics.json"
+
+var (
+	attempts = flag.Int("attempts", 10000000, "number of candidate magic numbers to try per square and shift")
+	pieces   = flag.String("piece", "both", "piece to search magics for: rook, bishop or both")
+	squares  = flag.String("squares", "",
+		"comma-separated squares to search magics for, such as a1,h8, rather than every square")
+	workers = flag.Int("workers", runtime.GOMAXPROCS(0), "number of squares to search at once, without -pack")
+	out     = flag.String("out", defaultOut,
+		"file to write the magics to, which the current magics are read from if it exists")
+	seed = flag.Uint64("seed", 0,
+		"seed for the candidate magic numbers, so that a search can be repeated; 0 picks one at random")
+	improve = flag.Bool("improve", false,
+		"only replace the magic of a square if the new one gives a smaller table, or with -pack, adds less to the shared table")
+	pack = flag.Bool("pack", false,
+		"pack the tables of all the squares into one shared table, overlapping them where their entries agree, "+
+			"and search for the magics that pack best")
+	keep = flag.Bool("keep", false,
+		"keep the current magic numbers rather than searching for new ones")
+)
 
 func main() {
-	rookMagics, rookTableSize := generateMagics(rook)
-	bishopMagics, bishopTableSize := generateMagics(bishop)
+	flag.Parse()
+
+	if *attempts < 1 {
+		log.Fatal("-attempts must be at least 1")
+	}
+
+	if *workers < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+
+	if flag.Arg(0) == "verify" {
+		if err := verify(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	current, err := readMagics(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rookMagics := slices.Clone(current.Rook.Magics)
+	bishopMagics := slices.Clone(current.Bishop.Magics)
+
+	if !*keep {
+		if err := search(rookMagics, bishopMagics); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rookTables := squareTables(rook, rookMagics)
+	bishopTables := squareTables(bishop, bishopMagics)
+	allTables := append(slices.Clone(rookTables), bishopTables...)
+
+	var totalTableSize int
+	if *pack {
+		totalTableSize = packTables(allTables)
+	} else {
+		totalTableSize = layOutTables(allTables)
+	}
+
+	log.Printf("Total table size %s, against %s for %s",
+		formatTableSize(uint64(totalTableSize)), current.Metadata.TotalTableSize, *out)
+
+	version := current.Metadata.Version
+	if !sameMagics(rookMagics, current.Rook.Magics) || !sameMagics(bishopMagics, current.Bishop.Magics) {
+		version, err = bumpPatch(version)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Bumped the version to %s; remember to add it to magic/changelog.md", version)
+	}
 
 	today := time.Now().Format("2006-01-02 15:04:05")
 
 	magicData := magic.Data{
 		Rook: magic.RookData{
 			Magics:         rookMagics,
-			TotalTableSize: formatTableSize(rookTableSize),
+			TotalTableSize: formatTableSize(uint64(sumSizes(rookTables))),
 		},
 		Bishop: magic.BishopData{
 			Magics:         bishopMagics,
-			TotalTableSize: formatTableSize(bishopTableSize),
+			TotalTableSize: formatTableSize(uint64(sumSizes(bishopTables))),
 		},
 		Metadata: magic.Metadata{
-			TotalTableSize: formatTableSize(rookTableSize + bishopTableSize),
+			TotalTableSize: formatTableSize(uint64(totalTableSize)),
 			Generated:      today,
-			Version:        versionString,
+			Version:        version,
 		},
 	}
 
+	if err := tables.VerifyMagics(&magicData, ""); err != nil {
+		log.Fatalf("Refusing to write bad magics: %v", err)
+	}
+
 	data, err := json.MarshalIndent(magicData, "", "  ")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := os.WriteFile("magic/magics.json", data, 0o600); err != nil {
+	if err := os.WriteFile(*out, data, 0o600); err != nil {
 		log.Fatal(err)
 	}
+
+	// The version file only goes with the magics built into the engine.
+	if *out == defaultOut && version != current.Metadata.Version {
+		if err := os.WriteFile("magic/version.txt", []byte(version+"\n"), 0o600); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
-func generateMagics(piece int) ([]magic.Entry, uint64) {
-	switch piece {
-	case rook:
-		log.Println("Generating rook magics")
-	case bishop:
-		log.Println("Generating bishop magics")
-	default:
-		log.Fatal("Piece must be rook or bishop")
+// sameMagics reports whether two sets of magics have the same magic numbers, shifts and masks. The
+// offsets aren't compared, as laying the same tables out differently doesn't change the magics.
+func sameMagics(a, b []magic.Entry) bool {
+	return slices.EqualFunc(a, b, func(x, y magic.Entry) bool {
+		return x.Square == y.Square && x.Magic == y.Magic && x.Shift == y.Shift && x.Mask == y.Mask
+	})
+}
+
+// verify checks the magics in the file given, or -out if none is, with tables.VerifyMagics. The
+// version of magic/magics.json is checked against magic/version.txt as well.
+func verify(args []string) error {
+	path := *out
+	if len(args) > 0 {
+		path = args[0]
 	}
 
-	numWorkers := runtime.GOMAXPROCS(0)
-	log.Printf("Using %d workers", numWorkers)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read magics: %w", err)
+	}
 
-	squares := make(chan sq.Square, 64)
+	var magicData magic.Data
+	if err := json.Unmarshal(data, &magicData); err != nil {
+		return fmt.Errorf("failed to unmarshal magics: %w", err)
+	}
 
-	var wg sync.WaitGroup
+	var version string
 
-	var totalTableSize atomic.Uint64
+	if path == defaultOut {
+		versionData, err := os.ReadFile("magic/version.txt")
+		if err != nil {
+			return fmt.Errorf("failed to read version: %w", err)
+		}
 
-	magics := make([]magic.Entry, 64)
+		version = strings.TrimSpace(string(versionData))
+	}
 
-	for w := range numWorkers {
-		log.Printf("Spawning worker %d", w)
+	if err := tables.VerifyMagics(&magicData, version); err != nil {
+		return fmt.Errorf("%s is invalid: %w", path, err)
+	}
 
-		wg.Add(1)
+	log.Printf("%s (version %s, %s) is valid", path, magicData.Metadata.Version, magicData.Metadata.TotalTableSize)
 
-		go func() {
-			defer wg.Done()
+	return nil
+}
 
-			for square := range squares {
-				var bestTableSize uint64 = math.MaxUint64
+// readMagics reads the magics in the given file, or the ones built into the engine if there's no
+// such file yet.
+func readMagics(path string) (magic.Data, error) {
+	var ret magic.Data
 
-				var bestMagic uint64
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data = magic.JSONData
+	} else if err != nil {
+		return ret, fmt.Errorf("failed to read magics: %w", err)
+	}
 
-				var bestShift int
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return ret, fmt.Errorf("failed to unmarshal magics: %w", err)
+	}
 
-				var relevantBits int
-				if piece == rook {
-					relevantBits = rookRelevantBits[square]
-				} else {
-					relevantBits = bishopRelevantBits[square]
-				}
+	return ret, nil
+}
 
-				for shift := 64 - relevantBits; shift < 64-relevantBits+4; shift++ {
-					for range 10000000 {
-						magicCandidate := bb.GenerateSparseRandomUint64()
-
-						if works, tableSize := testMagicCandidate(magicCandidate, square, shift, piece, relevantBits); works {
-							if tableSize < bestTableSize {
-								bestTableSize = tableSize
-								bestMagic = magicCandidate
-								bestShift = shift
-							}
-						}
-					}
-
-					if bestMagic != 0 {
-						break
-					}
-				}
+// search searches for new magics for the pieces and squares given by the flags, and puts the ones
+// it finds into the entries. The magics are recorded in a checkpoint as they're found, so that a
+// search that's interrupted, or stopped with Ctrl-C, carries on where it left off when it's run
+// again with the same flags. When a search is stopped, the magics found so far are still used.
+func search(rookMagics, bishopMagics []magic.Entry) error {
+	chosenPieces, err := parsePieces(*pieces)
+	if err != nil {
+		return err
+	}
 
-				if bestMagic == 0 {
-					log.Printf("Failed to find a magic for square %d", square)
-				}
+	chosenSquares, err := parseSquares(*squares)
+	if err != nil {
+		return err
+	}
 
-				totalTableSize.Add(bestTableSize)
+	cp, err := loadCheckpoint(*out + ".checkpoint")
+	if err != nil {
+		return err
+	}
 
-				entry := magic.Entry{
-					Square: sq.Stringify(square),
-					Magic:  fmt.Sprintf("%016x", bestMagic),
-					Shift:  bestShift,
-					Mask:   "",
-				}
+	// The squares are written out in full, so that the same squares given another way still match.
+	var squareNames []string
 
-				var mask bb.Bitboard
-				if piece == rook {
-					mask = tables.MaskRookAttacks(square)
-				} else {
-					mask = tables.MaskBishopAttacks(square)
-				}
+	if *squares != "" {
+		for _, square := range chosenSquares {
+			squareNames = append(squareNames, sq.Stringify(square))
+		}
+	}
 
-				entry.Mask = fmt.Sprintf("%016x", mask)
+	want := settings{
+		Seed:     *seed,
+		Attempts: *attempts,
+		Pack:     *pack,
+		Piece:    *pieces,
+		Squares:  strings.Join(squareNames, ","),
+	}
 
-				magics[square] = entry
+	if err := cp.start(want); err != nil {
+		return err
+	}
 
-				log.Printf("Found magic for square %s", sq.Stringify(square))
-			}
-		}()
+	log.Printf("Using seed %d", cp.Seed)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *pack {
+		generatePackedMagics(ctx, chosenPieces, chosenSquares, rookMagics, bishopMagics, cp)
+	} else {
+		for _, piece := range chosenPieces {
+			generateMagics(ctx, piece, chosenSquares, cp)
+		}
+
+		useFound(rook, rookMagics, cp.Rook)
+		useFound(bishop, bishopMagics, cp.Bishop)
 	}
 
-	// Feed squares to workers
-	for square := range 64 {
-		squares <- sq.Square(byte(square))
+	if ctx.Err() != nil {
+		log.Printf("Stopped; writing the magics found so far. Run again with the same flags to carry on")
+
+		return nil
 	}
 
-	close(squares)
+	return cp.remove()
+}
 
-	// Wait for all workers to finish
-	wg.Wait()
+func parsePieces(s string) ([]int, error) {
+	switch s {
+	case "rook":
+		return []int{rook}, nil
+	case "bishop":
+		return []int{bishop}, nil
+	case "both":
+		return []int{rook, bishop}, nil
+	default:
+		return nil, fmt.Errorf("piece must be rook, bishop or both, not %q", s)
+	}
+}
 
-	return magics, totalTableSize.Load()
+// parseSquares parses a comma-separated list of squares, or returns every square for an empty one.
+func parseSquares(s string) ([]sq.Square, error) {
+	var ret []sq.Square
+
+	if s == "" {
+		for square := range 64 {
+			ret = append(ret, sq.Square(byte(square)))
+		}
+
+		return ret, nil
+	}
+
+	for _, name := range strings.Split(s, ",") {
+		square, err := sq.ParseString(strings.ToLower(strings.TrimSpace(name)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse squares: %w", err)
+		}
+
+		ret = append(ret, square)
+	}
+
+	return ret, nil
 }
 
-func testMagicCandidate(magicCandidate uint64, square sq.Square, shift, piece, relevantBits int) (bool, uint64) {
-	var maxIndex uint64
+// useFound puts the magics found for a piece into its entries. With -improve, an entry is only
+// replaced if the magic found gives a smaller table.
+func useFound(piece int, entries []magic.Entry, found map[string]magic.Entry) {
+	for square := range entries {
+		entry, ok := found[entries[square].Square]
+		if !ok {
+			continue
+		}
 
-	numBlockerConfigs := 1 << relevantBits
+		if *improve {
+			newSize, oldSize := tableSize(piece, square, entry), tableSize(piece, square, entries[square])
+			if newSize >= oldSize {
+				continue
+			}
 
-	used := make(map[uint64]bb.Bitboard) // index -> possible moves
+			log.Printf("Improved the table for %s from %d to %d entries", entry.Square, oldSize, newSize)
+		}
+
+		entry.Offset = entries[square].Offset
+		entries[square] = entry
+	}
+}
+
+// tableSize returns the size of a square's table, or math.MaxInt if the entry's magic can't be
+// parsed.
+func tableSize(piece, square int, entry magic.Entry) int {
+	t, err := newSquareTable(piece, sq.Square(byte(square)), &entry)
+	if err != nil {
+		return math.MaxInt
+	}
 
-	for blockerConfigIndex := range numBlockerConfigs {
-		var attacks bb.Bitboard
-		if piece == rook {
-			attacks = tables.MaskRookAttacks(square)
-		} else {
-			attacks = tables.MaskBishopAttacks(square)
+	return t.size
+}
+
+// bumpPatch returns the version with its patch number one higher.
+func bumpPatch(version string) (string, error) {
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return "", fmt.Errorf("failed to parse version %q: %w", version, err)
+	}
+
+	return fmt.Sprintf("%d.%d.%d", major, minor, patch+1), nil
+}
+
+// squareTables returns the tables of the squares of a piece's magic entries.
+func squareTables(piece int, entries []magic.Entry) []*squareTable {
+	ret := make([]*squareTable, len(entries))
+
+	for square := range entries {
+		t, err := newSquareTable(piece, sq.Square(byte(square)), &entries[square])
+		if err != nil {
+			log.Fatalf("Failed to build the table for %s: %v", entries[square].Square, err)
 		}
 
-		blockerConfig := bb.SetOccupancy(blockerConfigIndex, attacks)
+		ret[square] = t
+	}
+
+	return ret
+}
+
+// sumSizes returns the total size of the tables laid out one after the other.
+func sumSizes(squareTables []*squareTable) int {
+	var ret int
+
+	for _, t := range squareTables {
+		ret += t.size
+	}
+
+	return ret
+}
+
+// generateMagics searches for the magics of a piece on the given squares, skipping the ones the
+// checkpoint already has, and records each one it finds in the checkpoint.
+func generateMagics(ctx context.Context, piece int, squares []sq.Square, cp *checkpoint) {
+	switch piece {
+	case rook:
+		log.Println("Generating rook magics")
+	case bishop:
+		log.Println("Generating bishop magics")
+	default:
+		log.Fatal("Piece must be rook or bishop")
+	}
+
+	log.Printf("Using %d workers", *workers)
+
+	todo := make(chan sq.Square, len(squares))
 
-		var actualMoves bb.Bitboard
-		if piece == rook {
-			actualMoves = tables.RookAttacksOnTheFly(square, blockerConfig)
-		} else {
-			actualMoves = tables.BishopAttacksOnTheFly(square, blockerConfig)
+	for _, square := range squares {
+		if cp.has(piece, square) {
+			log.Printf("Already found magic for square %s", sq.Stringify(square))
+
+			continue
 		}
 
-		hashResult := (uint64(blockerConfig) * magicCandidate) >> shift
-		index := hashResult
+		todo <- square
+	}
+
+	close(todo)
+
+	var wg sync.WaitGroup
+
+	for range *workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for square := range todo {
+				entry, ok := searchSquare(ctx, piece, square, cp.Seed, cp.Attempts, nil)
+				if !ok {
+					continue
+				}
+
+				if err := cp.add(piece, entry); err != nil {
+					log.Fatal(err)
+				}
+
+				log.Printf("Found magic for square %s", entry.Square)
+			}
+		}()
+	}
 
-		if index > maxIndex {
-			maxIndex = index
+	wg.Wait()
+}
+
+// searchSquare searches for the magic of a piece on a square that gives the smallest table, or
+// given a shared table, the one whose table adds the fewest slots to it. Each square draws its
+// candidates from a generator of its own, seeded by the seed, the piece and the square, so that it
+// finds the same magic whichever worker searches it and whatever else is searched. It returns false
+// if it's stopped or finds nothing.
+func searchSquare(ctx context.Context, piece int, square sq.Square, seed uint64, attempts int,
+	shared *sharedTable,
+) (magic.Entry, bool) {
+	random := rand.New(rand.NewPCG(seed, uint64(piece)<<6|uint64(square)))
+
+	// The score of a magic is the size of its table, or the number of slots it adds to the shared
+	// table.
+	bestScore := math.MaxInt
+
+	var bestMagic uint64
+
+	var bestShift int
+
+	var relevantBits int
+	if piece == rook {
+		relevantBits = rookRelevantBits[square]
+	} else {
+		relevantBits = bishopRelevantBits[square]
+	}
+
+	tester := newCandidateTester(piece, square, shared == nil)
+
+	for shift := 64 - relevantBits; shift < 64-relevantBits+extraShifts; shift++ {
+		for attempt := range attempts {
+			if attempt%1024 == 0 && ctx.Err() != nil {
+				return magic.Entry{}, false
+			}
+
+			magicCandidate := bb.GenerateSparseRandomUint64(random)
+
+			works, tableSize := tester.test(magicCandidate, shift)
+			if !works {
+				continue
+			}
+
+			score := int(tableSize)
+			if shared != nil {
+				if score, works = shared.growth(tester.indices, tester.entries, score, bestScore); !works {
+					continue
+				}
+			}
+
+			if score < bestScore {
+				bestScore = score
+				bestMagic = magicCandidate
+				bestShift = shift
+			}
+
+			// Nothing beats a table that fits entirely inside the shared one.
+			if bestScore == 0 {
+				break
+			}
 		}
 
-		if _, ok := used[index]; !ok { // new index
-			used[index] = actualMoves
-		} else if used[index] != actualMoves { // check if actual moves are the same
-			return false, 0
+		// A table of its own is smallest at the first shift with a magic, but a smaller table with a
+		// larger shift may still fit better into a shared one, so every shift is tried for that.
+		if bestMagic != 0 && (shared == nil || bestScore == 0) {
+			break
 		}
 	}
 
-	return true, maxIndex + 1
+	if bestMagic == 0 {
+		log.Printf("Failed to find a magic for square %s", sq.Stringify(square))
+
+		return magic.Entry{}, false
+	}
+
+	return magic.Entry{
+		Square: sq.Stringify(square),
+		Magic:  fmt.Sprintf("%016x", bestMagic),
+		Shift:  bestShift,
+		Mask:   fmt.Sprintf("%016x", tester.mask),
+	}, true
 }
 
 func formatTableSize(numEntries uint64) string {
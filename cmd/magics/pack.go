@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+	"github.com/samwestmoreland/chessengine/internal/tables"
+	"github.com/samwestmoreland/chessengine/magic"
+)
+
+// squareTable is one square's part of the attack table: the attacks stored at each index its magic
+// hashes a blocker configuration to. The indices no configuration hashes to are free for the
+// tables of other squares to use.
+type squareTable struct {
+	entry   *magic.Entry
+	indices []int
+	attacks []bb.Bitboard
+	// size is one more than the largest index, and configs the number of blocker configurations.
+	size    int
+	configs int
+}
+
+// newSquareTable returns the table of the given piece's magic entry for a square.
+func newSquareTable(piece int, square sq.Square, entry *magic.Entry) (*squareTable, error) {
+	magicNum, err := strconv.ParseUint(entry.Magic, 16, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := tables.MaskBishopAttacks(square)
+	if piece == rook {
+		mask = tables.MaskRookAttacks(square)
+	}
+
+	ret := &squareTable{entry: entry, configs: 1 << bb.CountBits(mask)}
+	seen := make([]bool, 1<<(64-entry.Shift))
+
+	for i := range 1 << bb.CountBits(mask) {
+		blockers := bb.SetOccupancy(i, mask)
+
+		index := int((uint64(blockers) * magicNum) >> entry.Shift)
+		if seen[index] {
+			continue
+		}
+
+		seen[index] = true
+
+		attacks := tables.BishopAttacksOnTheFly(square, blockers)
+		if piece == rook {
+			attacks = tables.RookAttacksOnTheFly(square, blockers)
+		}
+
+		ret.indices = append(ret.indices, index)
+		ret.attacks = append(ret.attacks, attacks)
+		ret.size = max(ret.size, index+1)
+	}
+
+	return ret, nil
+}
+
+// layOutTables gives each square's table an offset into the shared table, putting them one after
+// the other in order. It returns the size of the shared table.
+func layOutTables(squareTables []*squareTable) int {
+	offset := 0
+
+	for _, t := range squareTables {
+		t.entry.Offset = offset
+		offset += t.size
+	}
+
+	return offset
+}
+
+// packTables gives each square's table an offset into the shared table, letting the tables overlap
+// wherever their entries agree. The tables are placed one at a time, those with the most blocker
+// configurations first and otherwise in the order given, which is the order generatePackedMagics
+// searches them in. Each goes at the lowest offset where every one of its entries lands either on
+// a free slot or on a slot that already holds the same attacks. It returns the size of the shared
+// table.
+func packTables(squareTables []*squareTable) int {
+	var shared sharedTable
+
+	sorted := slices.Clone(squareTables)
+	slices.SortStableFunc(sorted, func(a, b *squareTable) int {
+		return b.configs - a.configs
+	})
+
+	for _, t := range sorted {
+		t.entry.Offset, _ = shared.fit(t.indices, t.attacks, math.MaxInt)
+		shared.place(t.entry.Offset, t.indices, t.attacks)
+	}
+
+	return len(shared.attacks)
+}
+
+// sharedTable is the attack table shared by the squares, as it's filled in.
+type sharedTable struct {
+	attacks []bb.Bitboard
+	filled  []bool
+}
+
+// fit returns the lowest offset at which a table with the given entries can be placed, if there's
+// one below limit. An offset at or past the end of the shared table always fits.
+func (s *sharedTable) fit(indices []int, attacks []bb.Bitboard, limit int) (int, bool) {
+	for offset := 0; offset < limit; offset++ {
+		if offset >= len(s.attacks) {
+			return offset, true
+		}
+
+		fits := true
+
+		for i, index := range indices {
+			slot := offset + index
+			if slot < len(s.attacks) && s.filled[slot] && s.attacks[slot] != attacks[i] {
+				fits = false
+
+				break
+			}
+		}
+
+		if fits {
+			return offset, true
+		}
+	}
+
+	return 0, false
+}
+
+// place writes a table's entries into the shared table at an offset.
+func (s *sharedTable) place(offset int, indices []int, attacks []bb.Bitboard) {
+	for i, index := range indices {
+		slot := offset + index
+		if slot >= len(s.attacks) {
+			s.attacks = append(s.attacks, make([]bb.Bitboard, slot+1-len(s.attacks))...)
+			s.filled = append(s.filled, make([]bool, slot+1-len(s.filled))...)
+		}
+
+		s.attacks[slot] = attacks[i]
+		s.filled[slot] = true
+	}
+}
+
+// growth returns how many slots a table of the given entries and size adds to the end of the
+// shared table when it's placed at the lowest offset where it fits, if that's fewer than limit.
+func (s *sharedTable) growth(indices []int, attacks []bb.Bitboard, size, limit int) (int, bool) {
+	// Placed at the end, a table adds its whole size, so that's as much as it can add; and it adds
+	// fewer than limit slots only at offsets below maxOffset.
+	limit = min(limit, size+1)
+	maxOffset := len(s.attacks) - size + limit
+	if maxOffset <= 0 {
+		return 0, false
+	}
+
+	offset, ok := s.fit(indices, attacks, maxOffset)
+	if !ok {
+		return 0, false
+	}
+
+	return max(offset+size-len(s.attacks), 0), true
+}
+
+// generatePackedMagics searches for magics with -pack. Rather than giving each square the smallest
+// table on its own, it picks the magic whose table adds the fewest slots to the shared table,
+// filling the gaps and matching the entries left by the tables before it. So every square, chosen
+// or not, is visited one at a time in the order packTables places them: a chosen square is
+// searched, or its magic taken from the checkpoint, and then its table is placed before the next.
+// With -improve, a square keeps its current magic unless the new one adds fewer slots.
+func generatePackedMagics(ctx context.Context, chosenPieces []int, chosenSquares []sq.Square,
+	rookMagics, bishopMagics []magic.Entry, cp *checkpoint,
+) {
+	log.Println("Generating magics to pack into the shared table, one square at a time")
+
+	type slot struct {
+		piece   int
+		square  sq.Square
+		entries []magic.Entry
+	}
+
+	var order []slot
+
+	for _, piece := range []int{rook, bishop} {
+		entries := rookMagics
+		if piece == bishop {
+			entries = bishopMagics
+		}
+
+		for square := range entries {
+			order = append(order, slot{piece, sq.Square(byte(square)), entries})
+		}
+	}
+
+	relevantBits := func(s slot) int {
+		if s.piece == rook {
+			return rookRelevantBits[s.square]
+		}
+
+		return bishopRelevantBits[s.square]
+	}
+
+	slices.SortStableFunc(order, func(a, b slot) int {
+		return relevantBits(b) - relevantBits(a)
+	})
+
+	var shared sharedTable
+
+	for _, s := range order {
+		current := &s.entries[s.square]
+
+		if slices.Contains(chosenPieces, s.piece) && slices.Contains(chosenSquares, s.square) && ctx.Err() == nil {
+			entry, ok := cp.get(s.piece, s.square)
+			if !ok {
+				if entry, ok = searchSquare(ctx, s.piece, s.square, cp.Seed, cp.Attempts, &shared); ok {
+					if err := cp.add(s.piece, entry); err != nil {
+						log.Fatal(err)
+					}
+
+					log.Printf("Found magic for square %s", entry.Square)
+				}
+			}
+
+			if ok && (!*improve || tableGrowth(&shared, s.piece, s.square, entry) < tableGrowth(&shared, s.piece, s.square, *current)) {
+				*current = entry
+			}
+		}
+
+		t, err := newSquareTable(s.piece, s.square, current)
+		if err != nil {
+			log.Fatalf("Failed to build the table for %s: %v", current.Square, err)
+		}
+
+		offset, _ := shared.fit(t.indices, t.attacks, math.MaxInt)
+		shared.place(offset, t.indices, t.attacks)
+	}
+}
+
+// tableGrowth returns how many slots the table of a magic entry adds to the shared table, or
+// math.MaxInt if the entry's magic can't be parsed.
+func tableGrowth(shared *sharedTable, piece int, square sq.Square, entry magic.Entry) int {
+	t, err := newSquareTable(piece, square, &entry)
+	if err != nil {
+		return math.MaxInt
+	}
+
+	growth, _ := shared.growth(t.indices, t.attacks, t.size, math.MaxInt)
+
+	return growth
+}
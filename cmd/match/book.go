@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/epd"
+	"github.com/samwestmoreland/chessengine/internal/pgn"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// loadBook reads the openings of a book, which is a PGN file of games whose moves are played, up
+// to maxPlies of them if that's not 0, or otherwise an EPD file of positions. With no path, the
+// only opening is the standard starting position.
+func loadBook(path string, maxPlies int) ([]opening, error) {
+	if path == "" {
+		pos, err := position.NewPosition()
+		if err != nil {
+			return nil, err
+		}
+
+		return []opening{{start: pos}}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open book: %w", err)
+	}
+	defer f.Close()
+
+	var ret []opening
+
+	if strings.EqualFold(filepath.Ext(path), ".pgn") {
+		ret, err = readPGNBook(f, maxPlies)
+	} else {
+		ret, err = readEPDBook(f)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read book: %w", err)
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("book %s has no openings", path)
+	}
+
+	return ret, nil
+}
+
+// readPGNBook reads the openings of a PGN book. A game that can't be read is logged and skipped.
+func readPGNBook(r io.Reader, maxPlies int) ([]opening, error) {
+	var ret []opening
+
+	reader := pgn.NewReader(r)
+
+	for {
+		g, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return ret, nil
+		}
+
+		var gameErr *pgn.GameError
+		if errors.As(err, &gameErr) {
+			log.Printf("Skipping a book game: %v", err)
+
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		start, err := g.StartPosition()
+		if err != nil {
+			return nil, err
+		}
+
+		moves := g.MainLine()
+		if maxPlies > 0 && len(moves) > maxPlies {
+			moves = moves[:maxPlies]
+		}
+
+		o := opening{start: start, moves: moves}
+		if g.Tag("FEN") != "" {
+			o.fen = start.FEN()
+		}
+
+		ret = append(ret, o)
+	}
+}
+
+func readEPDBook(r io.Reader) ([]opening, error) {
+	records, err := epd.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]opening, len(records))
+	for i, record := range records {
+		ret[i] = opening{start: record.Position, fen: record.Position.FEN()}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/pgn"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// Terminations, as written in the PGN Termination tag.
+const (
+	terminationNormal      = "normal"
+	terminationAdjudicated = "adjudication"
+	terminationTime        = "time forfeit"
+	terminationInfraction  = "rules infraction"
+)
+
+// rules are how games are played and adjudicated.
+type rules struct {
+	tc         timeControl
+	timeMargin time.Duration
+
+	// A player resigns once its own score has been at most -resignScore for resignMoves of its
+	// moves in a row. A resignScore of 0 turns this off.
+	resignScore int
+	resignMoves int
+
+	// A game is drawn once both players' scores have been within drawScore of zero for drawMoves
+	// moves each in a row, from move drawMoveNumber on. A drawMoves of 0 turns this off.
+	drawScore      int
+	drawMoves      int
+	drawMoveNumber int
+
+	// A game is drawn after maxMoves moves, if it's not 0.
+	maxMoves int
+}
+
+// timeControl is a time control such as 40/60+0.6: moves moves in base time, plus inc a move.
+type timeControl struct {
+	moves int
+	base  time.Duration
+	inc   time.Duration
+}
+
+func parseTimeControl(s string) (timeControl, error) {
+	var ret timeControl
+
+	if moves, rest, ok := strings.Cut(s, "/"); ok {
+		if _, err := fmt.Sscan(moves, &ret.moves); err != nil || ret.moves <= 0 {
+			return ret, fmt.Errorf("invalid time control %q", s)
+		}
+
+		s = rest
+	}
+
+	base, inc, _ := strings.Cut(s, "+")
+
+	var seconds float64
+	if _, err := fmt.Sscan(base, &seconds); err != nil || seconds <= 0 {
+		return ret, fmt.Errorf("invalid time control %q", s)
+	}
+
+	ret.base = time.Duration(seconds * float64(time.Second))
+
+	if inc != "" {
+		if _, err := fmt.Sscan(inc, &seconds); err != nil || seconds < 0 {
+			return ret, fmt.Errorf("invalid time control %q", s)
+		}
+
+		ret.inc = time.Duration(seconds * float64(time.Second))
+	}
+
+	return ret, nil
+}
+
+// String returns the time control as in the PGN TimeControl tag.
+func (tc timeControl) String() string {
+	ret := fmt.Sprint(tc.base.Seconds())
+	if tc.moves > 0 {
+		ret = fmt.Sprintf("%d/%s", tc.moves, ret)
+	}
+
+	if tc.inc > 0 {
+		ret += fmt.Sprintf("+%v", tc.inc.Seconds())
+	}
+
+	return ret
+}
+
+// opening is a position to start games from, with the moves that led to it.
+type opening struct {
+	start *position.Position
+	fen   string
+	moves []move.Move
+}
+
+// outcome is how a game ended.
+type outcome struct {
+	result      string
+	termination string
+	reason      string
+}
+
+// playGame plays a game between two players from an opening.
+func playGame(ctx context.Context, white, black player, book opening, r *rules) (*pgn.Game, error) {
+	g := &pgn.Game{}
+	g.SetTag("White", white.name())
+	g.SetTag("Black", black.name())
+	g.SetTag("TimeControl", r.tc.String())
+
+	if book.fen != "" {
+		g.SetTag("SetUp", "1")
+		g.SetTag("FEN", book.fen)
+	}
+
+	for _, p := range []player{white, black} {
+		if err := p.newGame(); err != nil {
+			return nil, err
+		}
+	}
+
+	pos := book.start
+	moves := append([]move.Move(nil), book.moves...)
+	seen := make(map[string]int)
+
+	for _, m := range book.moves {
+		seen[positionKey(pos)]++
+		g.Moves = append(g.Moves, &pgn.Move{Move: m, Comment: "book"})
+		pos = movegen.MakeMove(pos, m, false)
+	}
+
+	players := [2]player{white, black}
+	clocks := [2]time.Duration{r.tc.base, r.tc.base}
+	movesToGo := [2]int{r.tc.moves, r.tc.moves}
+
+	var (
+		resignCount [2]int
+		drawCount   int
+		end         outcome
+	)
+
+	for {
+		seen[positionKey(pos)]++
+
+		if end = gameOver(pos, seen); end.result != "" {
+			break
+		}
+
+		side := 0
+		if !pos.WhiteToMove {
+			side = 1
+		}
+
+		if r.maxMoves > 0 && len(moves)/2 >= r.maxMoves {
+			end = outcome{pgn.Drawn, terminationAdjudicated, "Draw by move limit"}
+
+			break
+		}
+
+		req := &request{
+			start: book.start,
+			fen:   book.fen,
+			moves: moves,
+			pos:   pos,
+			limits: engine.Limits{
+				WhiteTime: clocks[0],
+				BlackTime: clocks[1],
+				WhiteInc:  r.tc.inc,
+				BlackInc:  r.tc.inc,
+				MovesToGo: movesToGo[side],
+			},
+			deadline: time.Now().Add(clocks[side] + r.timeMargin),
+		}
+
+		start := time.Now()
+		rep, err := players[side].play(ctx, req)
+		elapsed := time.Since(start)
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		switch {
+		case errors.Is(err, errNoMove) || err == nil && elapsed > clocks[side]+r.timeMargin:
+			end = outcome{loss(side), terminationTime, sideName(side) + " loses on time"}
+		case err != nil:
+			end = outcome{loss(side), terminationInfraction, fmt.Sprintf("%s loses: %v", sideName(side), err)}
+		}
+
+		if end.result != "" {
+			break
+		}
+
+		clocks[side] += r.tc.inc - elapsed
+
+		if r.tc.moves > 0 {
+			if movesToGo[side]--; movesToGo[side] == 0 {
+				clocks[side] += r.tc.base
+				movesToGo[side] = r.tc.moves
+			}
+		}
+
+		g.Moves = append(g.Moves, annotate(rep, pos.WhiteToMove, clocks[side]))
+		moves = append(moves, rep.move)
+		pos = movegen.MakeMove(pos, rep.move, false)
+
+		if end = adjudicate(r, rep, side, len(moves), &resignCount, &drawCount); end.result != "" {
+			break
+		}
+	}
+
+	g.Result = end.result
+	g.SetTag("Result", end.result)
+	g.SetTag("Termination", end.termination)
+
+	if len(g.Moves) > 0 {
+		last := g.Moves[len(g.Moves)-1]
+		last.Comment = strings.TrimSpace(last.Comment + " " + end.reason)
+	} else {
+		g.Comment = end.reason
+	}
+
+	return g, nil
+}
+
+// gameOver returns the outcome if the game has ended by the rules.
+func gameOver(pos *position.Position, seen map[string]int) outcome {
+	if len(movegen.GetLegalMoves(pos)) == 0 {
+		if !movegen.InCheck(pos) {
+			return outcome{pgn.Drawn, terminationNormal, "Draw by stalemate"}
+		}
+
+		if pos.WhiteToMove {
+			return outcome{pgn.BlackWins, terminationNormal, "Black mates"}
+		}
+
+		return outcome{pgn.WhiteWins, terminationNormal, "White mates"}
+	}
+
+	switch {
+	case pos.HalfMoveClock >= 100:
+		return outcome{pgn.Drawn, terminationNormal, "Draw by fifty-move rule"}
+	case seen[positionKey(pos)] >= 3:
+		return outcome{pgn.Drawn, terminationNormal, "Draw by threefold repetition"}
+	case insufficientMaterial(pos):
+		return outcome{pgn.Drawn, terminationNormal, "Draw by insufficient material"}
+	}
+
+	return outcome{}
+}
+
+// adjudicate returns the outcome if the game should be adjudicated after a move, updating the
+// counts of moves that point towards a resignation or a draw.
+func adjudicate(r *rules, rep reply, side, plies int, resignCount *[2]int, drawCount *int) outcome {
+	if !rep.score.ok {
+		resignCount[side], *drawCount = 0, 0
+
+		return outcome{}
+	}
+
+	cp := rep.score.centipawns()
+
+	if r.resignScore > 0 {
+		if cp <= -r.resignScore {
+			resignCount[side]++
+		} else {
+			resignCount[side] = 0
+		}
+
+		if resignCount[side] >= r.resignMoves {
+			return outcome{loss(side), terminationAdjudicated, sideName(side) + " resigns"}
+		}
+	}
+
+	if r.drawMoves > 0 && plies/2+1 >= r.drawMoveNumber {
+		if cp >= -r.drawScore && cp <= r.drawScore {
+			*drawCount++
+		} else {
+			*drawCount = 0
+		}
+
+		if *drawCount >= 2*r.drawMoves {
+			return outcome{pgn.Drawn, terminationAdjudicated, "Draw by adjudication"}
+		}
+	}
+
+	return outcome{}
+}
+
+// annotate returns a move for the PGN, with the mover's evaluation, from white's point of view,
+// and clock as command annotations and the search depth as the comment.
+func annotate(rep reply, whiteMoved bool, clock time.Duration) *pgn.Move {
+	ret := &pgn.Move{Move: rep.move}
+
+	if rep.score.ok {
+		s := rep.score
+		if !whiteMoved {
+			s.cp, s.mate = -s.cp, -s.mate
+		}
+
+		value := fmt.Sprintf("%.2f", float64(s.cp)/100)
+		if s.mate != 0 {
+			value = fmt.Sprintf("#%d", s.mate)
+		}
+
+		ret.Commands = append(ret.Commands, pgn.Command{Name: "eval", Value: value})
+		ret.Comment = fmt.Sprintf("depth %d", rep.depth)
+	}
+
+	ret.Commands = append(ret.Commands, pgn.Command{Name: "clk", Value: formatClock(clock)})
+
+	return ret
+}
+
+// formatClock formats the time on a clock as in a [%clk] annotation, such as 0:04:59.8.
+func formatClock(clock time.Duration) string {
+	clock = max(clock, 0).Round(100 * time.Millisecond)
+	minutes := clock.Truncate(time.Minute)
+
+	return fmt.Sprintf("%d:%02d:%04.1f", int(clock.Hours()), int(clock.Minutes())%60, (clock - minutes).Seconds())
+}
+
+// positionKey identifies a position for detecting repetitions.
+func positionKey(pos *position.Position) string {
+	fields := strings.Fields(pos.FEN())
+
+	return strings.Join(fields[:4], " ")
+}
+
+// insufficientMaterial reports whether neither side has enough material to mate: there are no
+// pawns, rooks or queens, and at most one minor piece.
+func insufficientMaterial(pos *position.Position) bool {
+	for _, p := range []piece.Piece{piece.Wp, piece.Bp, piece.Wr, piece.Br, piece.Wq, piece.Bq} {
+		if pos.Occupancy[p] != 0 {
+			return false
+		}
+	}
+
+	minors := 0
+	for _, p := range []piece.Piece{piece.Wn, piece.Bn, piece.Wb, piece.Bb} {
+		minors += bb.CountBits(pos.Occupancy[p])
+	}
+
+	return minors <= 1
+}
+
+func loss(side int) string {
+	if side == 0 {
+		return pgn.BlackWins
+	}
+
+	return pgn.WhiteWins
+}
+
+func sideName(side int) string {
+	if side == 0 {
+		return "White"
+	}
+
+	return "Black"
+}
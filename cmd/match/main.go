@@ -0,0 +1,321 @@
+// Command match plays games between two engines to find out which is stronger, typically a patched
+// build of the engine against the one before the patch.
+//
+// Engines are given with -engine, twice, as comma-separated settings:
+//
+//	go run ./cmd/match -engine cmd=./new,name=new -engine cmd=./old,name=old,option.Hash=64
+//
+// Each engine runs as a subprocess spoken to over UCI. An -engine without a cmd, or left out
+// altogether, is this engine run in process, so it can be played against itself with no other
+// programs.
+//
+// Games are played in pairs from the openings of a -book, a PGN file whose games are played up to
+// -bookplies moves or an EPD file of positions, with each engine taking white once. Clocks follow
+// -tc, given as seconds plus increment such as 10+0.1, or with a number of moves per period as in
+// 40/60. Games are adjudicated as lost once an engine's own score has been below -resign-score for
+// -resign-moves moves, and as drawn once both engines' scores have been within -draw-score of zero
+// for -draw-moves moves each after move -draw-movenumber, or after -max-moves moves.
+//
+// The games are written to -pgn with each engine's evaluation, clock and depth annotated. After
+// each game the score, Elo difference and, with -sprt, the log-likelihood ratio of the test of
+// -elo0 against -elo1 are logged; the match stops as soon as the test accepts either hypothesis.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/pgn"
+)
+
+// engineFlags collects the -engine flags.
+type engineFlags []string
+
+func (f *engineFlags) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *engineFlags) Set(s string) error {
+	*f = append(*f, s)
+
+	return nil
+}
+
+// finished is a game that has been played, or the error that stopped a worker playing games.
+type finished struct {
+	game *pgn.Game
+	// score is the first engine's score, and round the number of the pair and of the game in it.
+	score float64
+	round string
+	err   error
+}
+
+func main() {
+	var engineSpecs engineFlags
+
+	flag.Var(&engineSpecs, "engine", "an engine, as cmd=PATH,name=NAME,option.NAME=VALUE; give two")
+	tcFlag := flag.String("tc", "10+0.1", "time control, as [moves/]seconds[+increment]")
+	timeMargin := flag.Duration("timemargin", 50*time.Millisecond, "time an engine may overrun its clock by")
+	numGames := flag.Int("games", 100, "number of games to play, rounded up to a whole number of pairs")
+	concurrency := flag.Int("concurrency", 1, "number of games to play at once")
+	bookPath := flag.String("book", "", "PGN or EPD file of openings")
+	bookPlies := flag.Int("bookplies", 0, "maximum number of moves to play from each book game, or 0 for all")
+	pgnPath := flag.String("pgn", "", "file to write the games to")
+	resignScore := flag.Int("resign-score", 1000, "score in centipawns at which an engine resigns, or 0 to never resign")
+	resignMoves := flag.Int("resign-moves", 3, "number of moves the resign score must be held for")
+	drawScore := flag.Int("draw-score", 10, "score in centipawns within which a game may be adjudicated drawn")
+	drawMoves := flag.Int("draw-moves", 8, "number of moves each the draw score must be held for, or 0 to never adjudicate draws")
+	drawMoveNumber := flag.Int("draw-movenumber", 40, "move from which a game may be adjudicated drawn")
+	maxMoves := flag.Int("max-moves", 0, "number of moves after which a game is drawn, or 0 for no limit")
+	useSPRT := flag.Bool("sprt", false, "stop once a sequential probability ratio test accepts -elo0 or -elo1")
+	elo0 := flag.Float64("elo0", 0, "Elo difference of the SPRT null hypothesis")
+	elo1 := flag.Float64("elo1", 5, "Elo difference of the SPRT alternative hypothesis")
+	alpha := flag.Float64("alpha", 0.05, "SPRT false positive rate")
+	beta := flag.Float64("beta", 0.05, "SPRT false negative rate")
+	flag.Parse()
+
+	if len(engineSpecs) > 2 {
+		log.Fatal("-engine can be given at most twice")
+	}
+
+	var specs [2]engineSpec
+
+	for i, s := range engineSpecs {
+		spec, err := parseEngineSpec(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		specs[i] = spec
+	}
+
+	if specs[0].name() == specs[1].name() {
+		specs[0].label, specs[1].label = specs[0].name()+" 1", specs[1].name()+" 2"
+	}
+
+	tc, err := parseTimeControl(*tcFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := movegen.Initialise(); err != nil {
+		log.Fatal(err)
+	}
+
+	book, err := loadBook(*bookPath, *bookPlies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := &rules{
+		tc:             tc,
+		timeMargin:     *timeMargin,
+		resignScore:    *resignScore,
+		resignMoves:    *resignMoves,
+		drawScore:      *drawScore,
+		drawMoves:      *drawMoves,
+		drawMoveNumber: *drawMoveNumber,
+		maxMoves:       *maxMoves,
+	}
+
+	var test *sprt
+	if *useSPRT {
+		test = &sprt{elo0: *elo0, elo1: *elo1, alpha: *alpha, beta: *beta}
+	}
+
+	var out *os.File
+	if *pgnPath != "" {
+		if out, err = os.Create(*pgnPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := play(ctx, specs, book, r, (*numGames+1)/2, max(*concurrency, 1))
+
+	var (
+		t       tally
+		playErr error
+	)
+
+	for res := range results {
+		// Once a worker has failed, stop the match but wait for the other workers to finish, so
+		// that their engines are shut down.
+		if res.err != nil {
+			if playErr == nil {
+				playErr = res.err
+			}
+
+			cancel()
+
+			continue
+		}
+
+		res.game.SetTag("Event", "match")
+		res.game.SetTag("Date", time.Now().Format("2006.01.02"))
+		res.game.SetTag("Round", res.round)
+
+		if out != nil {
+			if _, err := res.game.WriteTo(out); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		t.add(res.score)
+		elo, margin := t.elo()
+
+		log.Printf("Game %s: %s vs %s, %s (%s)", res.round, res.game.Tag("White"), res.game.Tag("Black"),
+			res.game.Result, strings.ToLower(res.game.Tag("Termination")))
+		log.Printf("Score of %s vs %s: %d - %d - %d, Elo %.1f ± %.1f",
+			specs[0].name(), specs[1].name(), t.wins, t.losses, t.draws, elo, margin)
+
+		if test != nil {
+			lower, upper := test.bounds()
+			log.Printf("LLR %.2f (%.2f, %.2f) [%v]", test.llr(&t), lower, upper, test)
+
+			if decision := test.decision(&t); decision != "" {
+				log.Printf("SPRT accepts %s", decision)
+				cancel()
+			}
+		}
+	}
+
+	if out != nil {
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if playErr != nil {
+		log.Fatal(playErr)
+	}
+}
+
+// play plays pairs of games on concurrency workers, each with its own pair of engines, and sends
+// each game to the channel it returns as it finishes. A worker that can't start an engine or play a
+// game sends the error instead and stops. The channel is closed once every worker has stopped,
+// which is once every game has been played or the context is cancelled.
+func play(ctx context.Context, specs [2]engineSpec, book []opening, r *rules, pairs, concurrency int) <-chan finished {
+	results := make(chan finished)
+	jobs := make(chan int)
+	done := make(chan struct{})
+
+	for range concurrency {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			var players [2]player
+
+			defer func() {
+				for _, p := range players {
+					if p == nil {
+						continue
+					}
+
+					if err := p.close(); err != nil {
+						log.Printf("failed to close %s: %v", p.name(), err)
+					}
+				}
+			}()
+
+			for i := range players {
+				p, err := specs[i].start()
+				if err != nil {
+					results <- finished{err: err}
+
+					return
+				}
+
+				players[i] = p
+			}
+
+			for pair := range jobs {
+				for game := range 2 {
+					white, black := players[game], players[1-game]
+
+					g, err := playGame(ctx, white, black, book[pair%len(book)], r)
+					if ctx.Err() != nil {
+						return
+					}
+
+					if err != nil {
+						results <- finished{err: fmt.Errorf("failed to play game %d.%d: %w", pair+1, game+1, err)}
+
+						return
+					}
+
+					results <- finished{game: g, score: firstScore(g, game == 0), round: fmt.Sprintf("%d.%d", pair+1, game+1)}
+
+					// An engine that lost on time or broke the rules may have crashed or hung, so
+					// start it again.
+					if term := g.Tag("Termination"); term == terminationTime || term == terminationInfraction {
+						for i, p := range players {
+							p.close()
+							players[i] = nil
+
+							restarted, err := specs[i].start()
+							if err != nil {
+								results <- finished{err: err}
+
+								return
+							}
+
+							players[i] = restarted
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+	feed:
+		for pair := range pairs {
+			select {
+			case jobs <- pair:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+
+		close(jobs)
+
+		for range concurrency {
+			<-done
+		}
+
+		close(results)
+	}()
+
+	return results
+}
+
+// firstScore returns the first engine's score in a game.
+func firstScore(g *pgn.Game, firstIsWhite bool) float64 {
+	var ret float64
+
+	switch g.Result {
+	case pgn.WhiteWins:
+		ret = 1
+	case pgn.Drawn:
+		ret = 0.5
+	}
+
+	if !firstIsWhite {
+		ret = 1 - ret
+	}
+
+	return ret
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// startupTimeout is how long an engine has to answer uci and isready.
+const startupTimeout = 10 * time.Second
+
+// errNoMove is returned when an engine doesn't answer go with a best move in time.
+var errNoMove = errors.New("engine didn't send a best move in time")
+
+// request asks a player for a move.
+type request struct {
+	// start is the position the game started from, fen its FEN or "" for the standard starting
+	// position, and moves the moves played since.
+	start *position.Position
+	fen   string
+	moves []move.Move
+	pos   *position.Position
+	// limits are the clocks, and deadline is when the player has run out of time.
+	limits   engine.Limits
+	deadline time.Time
+}
+
+// score is an evaluation from the point of view of the side to move.
+type score struct {
+	cp   int
+	mate int // moves to mate, negative if being mated, or 0
+	ok   bool
+}
+
+// centipawns returns the score in centipawns, with mates as very large scores.
+func (s score) centipawns() int {
+	switch {
+	case s.mate > 0:
+		return engine.MateScore - 2*s.mate
+	case s.mate < 0:
+		return -engine.MateScore - 2*s.mate
+	default:
+		return s.cp
+	}
+}
+
+// reply is a player's move, with its evaluation and the depth it searched to.
+type reply struct {
+	move  move.Move
+	score score
+	depth int
+}
+
+// player plays one side of a game.
+type player interface {
+	name() string
+	newGame() error
+	play(ctx context.Context, req *request) (reply, error)
+	close() error
+}
+
+// engineSpec describes a player, parsed from a flag such as
+// "cmd=./old,name=old,option.Hash=64". A spec without a command is the built-in engine.
+type engineSpec struct {
+	cmd     string
+	label   string
+	options [][2]string
+}
+
+func parseEngineSpec(s string) (engineSpec, error) {
+	var ret engineSpec
+
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return ret, fmt.Errorf("invalid engine setting %q", field)
+		}
+
+		switch {
+		case key == "cmd":
+			if value != "self" {
+				ret.cmd = value
+			}
+		case key == "name":
+			ret.label = value
+		case strings.HasPrefix(key, "option."):
+			ret.options = append(ret.options, [2]string{strings.TrimPrefix(key, "option."), value})
+		default:
+			return ret, fmt.Errorf("unknown engine setting %q", key)
+		}
+	}
+
+	return ret, nil
+}
+
+// start starts the player the spec describes.
+func (s engineSpec) start() (player, error) {
+	if s.cmd == "" {
+		return newBuiltinPlayer(s)
+	}
+
+	return startUCIPlayer(s)
+}
+
+func (s engineSpec) name() string {
+	switch {
+	case s.label != "":
+		return s.label
+	case s.cmd != "":
+		return s.cmd
+	default:
+		return "chessengine"
+	}
+}
+
+// builtinPlayer plays with the engine in this process, so a match needs no external programs.
+type builtinPlayer struct {
+	label  string
+	engine *engine.Engine
+}
+
+func newBuiltinPlayer(spec engineSpec) (*builtinPlayer, error) {
+	e, err := engine.NewEngine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create engine: %w", err)
+	}
+
+	for _, option := range spec.options {
+		switch strings.ToLower(option[0]) {
+		case "syzygypath":
+			err = e.SetSyzygyPath(option[1])
+		case "bookfile":
+			err = e.SetBookFile(option[1])
+		case "bestbookmove":
+			e.BestBookMove = strings.EqualFold(option[1], "true")
+		default:
+			return nil, fmt.Errorf("unknown option %s", option[0])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &builtinPlayer{label: spec.name(), engine: e}, nil
+}
+
+func (p *builtinPlayer) name() string {
+	return p.label
+}
+
+func (p *builtinPlayer) newGame() error {
+	return nil
+}
+
+func (p *builtinPlayer) play(ctx context.Context, req *request) (reply, error) {
+	ctx, cancel := context.WithDeadline(ctx, req.deadline)
+	defer cancel()
+
+	var last engine.Info
+
+	m := p.engine.Search(ctx, req.pos, req.limits, func(info engine.Info) {
+		last = info
+	})
+
+	if m == 0 {
+		return reply{}, errors.New("engine found no move")
+	}
+
+	ret := reply{move: m, depth: last.Depth, score: score{cp: last.Score, ok: last.Depth > 0}}
+	if mate, ok := engine.MateIn(last.Score); ok {
+		ret.score.mate = mate
+	}
+
+	return ret, nil
+}
+
+func (p *builtinPlayer) close() error {
+	return nil
+}
+
+// uciPlayer plays with an engine run as a subprocess and spoken to over UCI.
+type uciPlayer struct {
+	label string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// lines receives the engine's output, and is closed when the engine exits.
+	lines chan string
+}
+
+func startUCIPlayer(spec engineSpec) (*uciPlayer, error) {
+	cmd := exec.Command(spec.cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", spec.cmd, err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", spec.cmd, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", spec.cmd, err)
+	}
+
+	p := &uciPlayer{label: spec.name(), cmd: cmd, stdin: stdin, lines: make(chan string, 64)}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			p.lines <- scanner.Text()
+		}
+
+		close(p.lines)
+	}()
+
+	if err := p.send("uci"); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.waitFor("uciok", time.Now().Add(startupTimeout)); err != nil {
+		p.close()
+
+		return nil, err
+	}
+
+	for _, option := range spec.options {
+		if err := p.send(fmt.Sprintf("setoption name %s value %s", option[0], option[1])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.ready(); err != nil {
+		p.close()
+
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *uciPlayer) name() string {
+	return p.label
+}
+
+func (p *uciPlayer) newGame() error {
+	if err := p.send("ucinewgame"); err != nil {
+		return err
+	}
+
+	return p.ready()
+}
+
+func (p *uciPlayer) ready() error {
+	if err := p.send("isready"); err != nil {
+		return err
+	}
+
+	_, err := p.waitFor("readyok", time.Now().Add(startupTimeout))
+
+	return err
+}
+
+func (p *uciPlayer) play(ctx context.Context, req *request) (reply, error) {
+	var cmd strings.Builder
+
+	if req.fen == "" {
+		cmd.WriteString("position startpos")
+	} else {
+		cmd.WriteString("position fen " + req.fen)
+	}
+
+	if len(req.moves) > 0 {
+		cmd.WriteString(" moves")
+
+		for _, m := range req.moves {
+			cmd.WriteString(" " + strings.ToLower(m.String()))
+		}
+	}
+
+	if err := p.send(cmd.String()); err != nil {
+		return reply{}, err
+	}
+
+	if err := p.send(goCommand(req.limits)); err != nil {
+		return reply{}, err
+	}
+
+	var ret reply
+
+	timer := time.NewTimer(time.Until(req.deadline))
+	defer timer.Stop()
+
+	stopped := false
+
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return reply{}, fmt.Errorf("%s exited", p.label)
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch fields[0] {
+			case "info":
+				parseInfo(fields[1:], &ret)
+			case "bestmove":
+				if stopped {
+					return reply{}, errNoMove
+				}
+
+				if len(fields) < 2 {
+					return reply{}, errors.New("empty best move")
+				}
+
+				m, ok := findMove(req.pos, fields[1])
+				if !ok {
+					return reply{}, fmt.Errorf("illegal move %s", fields[1])
+				}
+
+				ret.move = m
+
+				return ret, nil
+			}
+		case <-ctx.Done():
+			p.stop()
+
+			return reply{}, ctx.Err()
+		case <-timer.C:
+			if stopped {
+				return reply{}, errNoMove
+			}
+
+			// Give the engine a moment to answer stop, so it's in a fit state for the next game.
+			p.stop()
+
+			stopped = true
+
+			timer.Reset(time.Second)
+		}
+	}
+}
+
+// stop stops the search, ignoring the best move it sends.
+func (p *uciPlayer) stop() {
+	if err := p.send("stop"); err != nil {
+		return
+	}
+
+	deadline := time.After(time.Second)
+
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok || strings.HasPrefix(line, "bestmove") {
+				return
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func (p *uciPlayer) close() error {
+	_ = p.send("quit")
+	p.stdin.Close()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- p.cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		if err := p.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("failed to kill %s: %w", p.label, err)
+		}
+
+		return <-done
+	}
+}
+
+func (p *uciPlayer) send(line string) error {
+	if _, err := io.WriteString(p.stdin, line+"\n"); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", p.label, err)
+	}
+
+	return nil
+}
+
+// waitFor waits for a line starting with prefix and returns it.
+func (p *uciPlayer) waitFor(prefix string, deadline time.Time) (string, error) {
+	timeout := time.After(time.Until(deadline))
+
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return "", fmt.Errorf("%s exited", p.label)
+			}
+
+			if strings.HasPrefix(line, prefix) {
+				return line, nil
+			}
+		case <-timeout:
+			return "", fmt.Errorf("%s didn't send %s in time", p.label, prefix)
+		}
+	}
+}
+
+func goCommand(limits engine.Limits) string {
+	ret := fmt.Sprintf("go wtime %d btime %d winc %d binc %d",
+		limits.WhiteTime.Milliseconds(), limits.BlackTime.Milliseconds(),
+		limits.WhiteInc.Milliseconds(), limits.BlackInc.Milliseconds())
+
+	if limits.MovesToGo > 0 {
+		ret += fmt.Sprintf(" movestogo %d", limits.MovesToGo)
+	}
+
+	return ret
+}
+
+// parseInfo takes the depth and score from the fields of an info line. Lines about a single move
+// of a multi-PV search, or with a bound rather than an exact score, are ignored.
+func parseInfo(fields []string, r *reply) {
+	var (
+		depth int
+		s     score
+	)
+
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "depth":
+			depth, _ = strconv.Atoi(fields[i+1])
+		case "multipv":
+			if fields[i+1] != "1" {
+				return
+			}
+		case "lowerbound", "upperbound":
+			return
+		case "score":
+			if i+2 >= len(fields) {
+				return
+			}
+
+			n, err := strconv.Atoi(fields[i+2])
+			if err != nil {
+				return
+			}
+
+			switch fields[i+1] {
+			case "cp":
+				s = score{cp: n, ok: true}
+			case "mate":
+				s = score{mate: n, ok: true}
+			}
+		}
+	}
+
+	if s.ok {
+		r.score, r.depth = s, depth
+	}
+}
+
+// findMove returns the legal move written in coordinate notation, in either case.
+func findMove(pos *position.Position, s string) (move.Move, bool) {
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if strings.EqualFold(m.String(), s) {
+			return m, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// tally counts the results of a match from the first engine's point of view.
+type tally struct {
+	wins, losses, draws int
+}
+
+func (t *tally) add(score float64) {
+	switch score {
+	case 1:
+		t.wins++
+	case 0:
+		t.losses++
+	default:
+		t.draws++
+	}
+}
+
+func (t *tally) games() int {
+	return t.wins + t.losses + t.draws
+}
+
+// stats returns the mean score per game and its variance.
+func (t *tally) stats() (float64, float64) {
+	n := float64(t.games())
+	mean := (float64(t.wins) + float64(t.draws)/2) / n
+
+	variance := (float64(t.wins)*math.Pow(1-mean, 2) +
+		float64(t.draws)*math.Pow(0.5-mean, 2) +
+		float64(t.losses)*math.Pow(mean, 2)) / n
+
+	return mean, variance
+}
+
+// elo returns the Elo difference the results suggest and the half-width of its 95% confidence
+// interval.
+func (t *tally) elo() (float64, float64) {
+	if t.games() == 0 {
+		return 0, 0
+	}
+
+	mean, variance := t.stats()
+	margin := 1.96 * math.Sqrt(variance/float64(t.games()))
+
+	return scoreToElo(mean), (scoreToElo(mean+margin) - scoreToElo(mean-margin)) / 2
+}
+
+// scoreToElo returns the Elo difference at which the expected score is s. Scores of 0 and 1 are
+// treated as slightly less extreme, so that the result is finite.
+func scoreToElo(s float64) float64 {
+	s = max(min(s, 0.999), 0.001)
+
+	return 400 * math.Log10(s/(1-s))
+}
+
+func eloToScore(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// sprt is a sequential probability ratio test of the hypothesis that the first engine is elo1
+// stronger than the second, against the hypothesis that it is elo0 stronger.
+type sprt struct {
+	elo0, elo1  float64
+	alpha, beta float64
+}
+
+// bounds returns the log-likelihood ratios at which the test accepts H0 and H1.
+func (s *sprt) bounds() (float64, float64) {
+	return math.Log(s.beta / (1 - s.alpha)), math.Log((1 - s.beta) / s.alpha)
+}
+
+// llr returns the log-likelihood ratio of the results, using the generalised SPRT approximation
+// on the score per game, with logistic Elo.
+func (s *sprt) llr(t *tally) float64 {
+	if t.games() == 0 {
+		return 0
+	}
+
+	mean, variance := t.stats()
+	if variance == 0 {
+		return 0
+	}
+
+	s0, s1 := eloToScore(s.elo0), eloToScore(s.elo1)
+
+	return float64(t.games()) * (s1 - s0) * (2*mean - s0 - s1) / (2 * variance)
+}
+
+// decision returns "H0" or "H1" once the test has accepted one of them, and "" before then.
+func (s *sprt) decision(t *tally) string {
+	lower, upper := s.bounds()
+
+	switch llr := s.llr(t); {
+	case llr <= lower:
+		return "H0"
+	case llr >= upper:
+		return "H1"
+	default:
+		return ""
+	}
+}
+
+func (s *sprt) String() string {
+	return fmt.Sprintf("elo0 %g, elo1 %g, alpha %g, beta %g", s.elo0, s.elo1, s.alpha, s.beta)
+}
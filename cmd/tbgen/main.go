@@ -0,0 +1,203 @@
+// Command tbgen generates distance-to-mate tablebases by retrograde analysis, using the engine's
+// own move generator.
+//
+// With no arguments it generates every ending with up to -pieces pieces; otherwise it generates the
+// endings named on the command line, such as KQvKR, along with the smaller endings they need.
+// Tables already in the output directory are reused rather than generated again, so an interrupted
+// run can be resumed.
+// Endings with pawns on both sides, such as KPvKP, are refused, as the tables don't model en
+// passant.
+//
+// With -verify, every generated table is checked against the values found by generating each
+// position's moves forwards before it is written, which makes this a thorough test of the move
+// generator. Tables that were already in the output directory are not checked again.
+//
+// With -syzygy, the endings are also written as Syzygy WDL and DTZ tables, which the syzygy package
+// probes. These are what the syzygy package's tests use when the official tables can't be
+// downloaded.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/dtm"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	"github.com/samwestmoreland/chessengine/internal/syzygy"
+)
+
+func main() {
+	output := flag.String("output", "tables", "directory to write the tables to")
+	pieces := flag.Int("pieces", dtm.MaxPieces, "generate every ending with up to this many pieces")
+	verify := flag.Bool("verify", false, "check every table against forward move generation")
+	numWorkers := flag.Int("workers", runtime.GOMAXPROCS(0), "number of worker goroutines")
+	syzygyTables := flag.Bool("syzygy", false, "also write the endings as Syzygy tables")
+	flag.Parse()
+
+	if *pieces < 3 || *pieces > dtm.MaxPieces {
+		log.Fatalf("-pieces must be between 3 and %d", dtm.MaxPieces)
+	}
+
+	if err := movegen.Initialise(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll(*output, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	existing, err := dtm.Open(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gen := dtm.NewGenerator()
+	gen.Workers = *numWorkers
+	gen.Tables = existing
+	gen.Logf = log.Printf
+
+	start := time.Now()
+
+	gen.Generated = func(t *dtm.Table) error {
+		stats := t.Stats()
+		log.Printf("%s: %d wins, %d losses, longest mate %d plies, took %v",
+			t.Signature(), stats.Wins, stats.Losses, stats.Longest.Plies, time.Since(start).Round(time.Millisecond))
+
+		if *verify {
+			verifyStart := time.Now()
+
+			if err := gen.Verify(t); err != nil {
+				return fmt.Errorf("failed to verify %s: %w", t.Signature(), err)
+			}
+
+			log.Printf("%s: verified in %v", t.Signature(), time.Since(verifyStart).Round(time.Millisecond))
+		}
+
+		if err := write(t, filepath.Join(*output, t.Signature()+dtm.Extension)); err != nil {
+			return err
+		}
+
+		start = time.Now()
+
+		return nil
+	}
+
+	endings := flag.Args()
+	if len(endings) == 0 {
+		endings = dtm.Endings(*pieces)
+	}
+
+	for _, sig := range endings {
+		if _, err := gen.Generate(sig); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *syzygyTables {
+		// Open the directory again, as the tables just generated were missing from it before.
+		tables, err := dtm.Open(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, sig := range endings {
+			if err := writeSyzygy(tables, *output, sig); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// writeSyzygy writes the Syzygy WDL and DTZ tables of an ending, taking the results from the
+// distance-to-mate tables.
+func writeSyzygy(tables *dtm.Tables, dir, signature string) error {
+	sig, err := dtm.Canonical(signature)
+	if err != nil {
+		return err
+	}
+
+	result := func(pos *position.Position) (syzygy.WDL, error) {
+		r, ok := tables.Probe(pos)
+		if !ok {
+			return syzygy.Draw, fmt.Errorf("no table for %s", endgame.Signature(pos))
+		}
+
+		switch r.Outcome {
+		case dtm.Win:
+			return syzygy.Win, nil
+		case dtm.Loss:
+			return syzygy.Loss, nil
+		default:
+			return syzygy.Draw, nil
+		}
+	}
+
+	start := time.Now()
+
+	err = writeFile(filepath.Join(dir, sig+".rtbw"), func(w io.Writer) error {
+		return syzygy.WriteWDL(w, sig, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(filepath.Join(dir, sig+".rtbz"), func(w io.Writer) error {
+		return syzygy.WriteDTZ(w, sig, result)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s: wrote Syzygy tables in %v", sig, time.Since(start).Round(time.Millisecond))
+
+	return nil
+}
+
+// write writes a table to a temporary file and then renames it, so that an interrupted run never
+// leaves a partial table behind.
+func write(t *dtm.Table, path string) error {
+	return writeFile(path, func(w io.Writer) error {
+		_, err := t.WriteTo(w)
+
+		return err
+	})
+}
+
+// writeFile writes a file through a temporary file, which is renamed once it's complete.
+func writeFile(path string, writeTo func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := writeTo(f); err != nil {
+		f.Close()
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
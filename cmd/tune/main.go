@@ -0,0 +1,397 @@
+// Command tune fits the evaluation weights to a set of labelled positions using Texel's method.
+//
+// Each line of the input file holds a position as a FEN, followed by the result of the game it was
+// taken from, for example:
+//
+//	rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2 [0.5]
+//	r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - c9 "1-0";
+//
+// Results may be written as 1-0, 0-1 or 1/2-1/2, or as a number from white's point of view, with
+// or without brackets and quotes. The move clocks may be left out of the FEN.
+//
+// Every position is first resolved with a quiescence search, and the tuner then adjusts each
+// parameter the evaluator exposes in turn, keeping changes which reduce the mean squared error
+// between the game results and the evaluations mapped through a sigmoid.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+const infinity = 1 << 20
+
+type entry struct {
+	pos    *position.Position
+	result float64 // 1 for a white win, 0.5 for a draw, 0 for a black win
+}
+
+func main() {
+	input := flag.String("input", "", "path to the labelled position file")
+	output := flag.String("output", "tuned_weights.json", "path to write the tuned weights to")
+	outputFormat := flag.String("format", "json", "output format, either json or go")
+	iterations := flag.Int("iterations", 100, "maximum number of passes over the parameters")
+	maxPositions := flag.Int("positions", 0, "maximum number of positions to load, or 0 for all")
+	numWorkers := flag.Int("workers", runtime.GOMAXPROCS(0), "number of worker goroutines")
+	flag.Parse()
+
+	if *input == "" {
+		log.Fatal("-input is required")
+	}
+
+	if *numWorkers < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+
+	if *outputFormat != "json" && *outputFormat != "go" {
+		log.Fatalf("unknown output format %q", *outputFormat)
+	}
+
+	if err := movegen.Initialise(); err != nil {
+		log.Fatal(err)
+	}
+
+	entries, err := loadEntries(*input, *maxPositions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Loaded %d positions", len(entries))
+
+	weights := eval.DefaultWeights
+
+	resolve(entries, &weights, *numWorkers)
+
+	k := fitScalingConstant(entries, &weights, *numWorkers)
+	log.Printf("Using scaling constant K = %.4f", k)
+
+	tune(entries, &weights, k, *iterations, *numWorkers, func(weights *eval.Weights) {
+		if err := writeWeights(weights, *output, *outputFormat); err != nil {
+			log.Fatal(err)
+		}
+	})
+}
+
+func loadEntries(path string, limit int) ([]entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open position file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []entry
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := parseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		entries = append(entries, e)
+
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read position file: %w", err)
+	}
+
+	return entries, nil
+}
+
+func parseEntry(line string) (entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return entry{}, errors.New("expected a FEN followed by a result")
+	}
+
+	result, err := parseResult(fields[len(fields)-1])
+	if err != nil {
+		return entry{}, err
+	}
+
+	fenFields := fields[:4]
+
+	// Keep the move clocks if they are there, and make them up if they are not.
+	if len(fields) >= 7 && isInteger(fields[4]) && isInteger(fields[5]) {
+		fenFields = append(fenFields, fields[4], fields[5])
+	} else {
+		fenFields = append(fenFields, "0", "1")
+	}
+
+	pos, err := position.NewPositionFromFEN(strings.Join(fenFields, " "))
+	if err != nil {
+		return entry{}, fmt.Errorf("invalid position: %w", err)
+	}
+
+	return entry{pos: pos, result: result}, nil
+}
+
+func parseResult(token string) (float64, error) {
+	token = strings.Trim(token, "[]\";")
+
+	switch token {
+	case "1-0":
+		return 1, nil
+	case "0-1":
+		return 0, nil
+	case "1/2-1/2":
+		return 0.5, nil
+	}
+
+	result, err := strconv.ParseFloat(token, 64)
+	if err != nil || result < 0 || result > 1 {
+		return 0, fmt.Errorf("invalid result %q", token)
+	}
+
+	return result, nil
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.Atoi(s)
+
+	return err == nil
+}
+
+// resolve replaces every position with the quiet position at the end of its quiescence search, so
+// that tuning only ever sees positions where the static evaluation is meaningful.
+func resolve(entries []entry, weights *eval.Weights, numWorkers int) {
+	evaluator := eval.ShannonEvaluator{Weights: weights}
+
+	forEachChunk(len(entries), numWorkers, func(_, start, end int) {
+		for i := start; i < end; i++ {
+			_, leaf := engine.Quiesce(entries[i].pos, -infinity, infinity, evaluator)
+			entries[i].pos = leaf
+		}
+	})
+}
+
+// fitScalingConstant finds the K which minimises the error for the starting weights, so that the
+// sigmoid matches the scale of the evaluation.
+func fitScalingConstant(entries []entry, weights *eval.Weights, numWorkers int) float64 {
+	low, high := 0.0, 3.0
+
+	for range 40 {
+		mid1 := low + (high-low)/3
+		mid2 := high - (high-low)/3
+
+		if meanSquaredError(entries, weights, mid1, numWorkers) < meanSquaredError(entries, weights, mid2, numWorkers) {
+			high = mid2
+		} else {
+			low = mid1
+		}
+	}
+
+	return (low + high) / 2
+}
+
+// tune runs a local search over the parameters: each one is nudged up and then down, and the
+// change is kept if it lowers the error. The search stops when a full pass over the parameters
+// makes no improvement, or after the given number of passes. checkpoint is called with the
+// current weights after every pass.
+func tune(entries []entry, weights *eval.Weights, k float64, iterations, numWorkers int, checkpoint func(*eval.Weights)) {
+	params := weights.Params()
+
+	bestError := meanSquaredError(entries, weights, k, numWorkers)
+	log.Printf("Initial error %.8f over %d parameters", bestError, len(params))
+
+	for iteration := range iterations {
+		improved := false
+
+		for _, param := range params {
+			for _, step := range []int{1, -2} {
+				*param += step
+
+				if e := meanSquaredError(entries, weights, k, numWorkers); e < bestError {
+					bestError = e
+					improved = true
+
+					break
+				}
+
+				if step == -2 {
+					*param++
+				}
+			}
+		}
+
+		log.Printf("Iteration %d: error %.8f", iteration+1, bestError)
+
+		checkpoint(weights)
+
+		if !improved {
+			break
+		}
+	}
+}
+
+func meanSquaredError(entries []entry, weights *eval.Weights, k float64, numWorkers int) float64 {
+	evaluator := eval.ShannonEvaluator{Weights: weights}
+
+	partials := make([]float64, numWorkers)
+
+	forEachChunk(len(entries), numWorkers, func(worker, start, end int) {
+		var sum float64
+
+		for _, e := range entries[start:end] {
+			score := evaluator.Evaluate(e.pos)
+			if !e.pos.WhiteToMove {
+				score = -score
+			}
+
+			diff := e.result - sigmoid(float64(score), k)
+			sum += diff * diff
+		}
+
+		partials[worker] += sum
+	})
+
+	var total float64
+
+	for _, partial := range partials {
+		total += partial
+	}
+
+	return total / float64(len(entries))
+}
+
+func sigmoid(score, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*score/400))
+}
+
+// forEachChunk splits the range [0, n) into chunks and hands them out to a pool of workers. Each
+// call to fn is given the index of the worker running it.
+func forEachChunk(n, numWorkers int, fn func(worker, start, end int)) {
+	const chunkSize = 1024
+
+	chunks := make(chan int, n/chunkSize+1)
+
+	for start := 0; start < n; start += chunkSize {
+		chunks <- start
+	}
+
+	close(chunks)
+
+	var wg sync.WaitGroup
+
+	for w := range numWorkers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for start := range chunks {
+				fn(w, start, min(start+chunkSize, n))
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func writeWeights(weights *eval.Weights, path, outputFormat string) error {
+	var data []byte
+
+	if outputFormat == "json" {
+		var err error
+
+		data, err = json.MarshalIndent(weights, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode weights: %w", err)
+		}
+	} else {
+		var buf bytes.Buffer
+
+		buf.WriteString("// Code generated by cmd/tune. DO NOT EDIT.\n\n")
+		buf.WriteString("package eval\n\n")
+		buf.WriteString("// TunedWeights are the weights found by cmd/tune.\n")
+		buf.WriteString("var TunedWeights = ")
+		writeGoValue(&buf, reflect.ValueOf(*weights))
+		buf.WriteString("\n")
+
+		formatted, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to format weights: %w", err)
+		}
+
+		data = formatted
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write weights: %w", err)
+	}
+
+	return nil
+}
+
+// writeGoValue writes a Go literal for the weights or one of their fields. Scores are written with
+// the S helper and long arrays are wrapped eight to a line, matching how the default weights are
+// laid out by hand.
+func writeGoValue(buf *bytes.Buffer, value reflect.Value) {
+	switch {
+	case value.Type() == reflect.TypeOf(eval.Score{}):
+		score := value.Interface().(eval.Score) //nolint:forcetypeassert
+		fmt.Fprintf(buf, "S(%d, %d)", score.MG, score.EG)
+	case value.Kind() == reflect.Struct:
+		buf.WriteString("Weights{\n")
+
+		for i := range value.NumField() {
+			fmt.Fprintf(buf, "%s: ", value.Type().Field(i).Name)
+			writeGoValue(buf, value.Field(i))
+			buf.WriteString(",\n")
+		}
+
+		buf.WriteString("}")
+	case value.Kind() == reflect.Array:
+		fmt.Fprintf(buf, "%s{", strings.ReplaceAll(value.Type().String(), "eval.", ""))
+
+		wrap := value.Len() > 8 || value.Type().Elem().Kind() == reflect.Array
+
+		for i := range value.Len() {
+			if wrap && i%8 == 0 {
+				buf.WriteString("\n")
+			}
+
+			writeGoValue(buf, value.Index(i))
+			buf.WriteString(", ")
+		}
+
+		if wrap {
+			buf.WriteString("\n")
+		}
+
+		buf.WriteString("}")
+	default:
+		fmt.Fprintf(buf, "%v", value.Interface())
+	}
+}
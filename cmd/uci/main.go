@@ -3,12 +3,18 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/eval"
 	"github.com/samwestmoreland/chessengine/internal/movegen"
 	"github.com/samwestmoreland/chessengine/internal/position"
 )
@@ -18,6 +24,21 @@ type UCI struct {
 	position *position.Position
 	writer   *bufio.Writer
 	reader   *bufio.Reader
+	// chess960 is the UCI_Chess960 option, under which castling moves are written as the king
+	// taking its own rook.
+	chess960 bool
+	// variant is the UCI_Variant option, the rules positions are set up and played by.
+	variant position.Variant
+	// useNNUE and evalFile are the UseNNUE and EvalFile options, which choose the evaluator.
+	useNNUE  bool
+	evalFile string
+
+	// mu guards the writer, which the search writes to while the next command is read.
+	mu sync.Mutex
+	// cancel stops the running search, if any, and done is closed once it has written its best
+	// move.
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func NewUCI(writer *bufio.Writer, reader *bufio.Reader) (*UCI, error) {
@@ -40,32 +61,26 @@ func NewUCI(writer *bufio.Writer, reader *bufio.Reader) (*UCI, error) {
 
 func (u *UCI) Run() error {
 	for {
-		if _, err := u.writer.WriteString("engine ready\n"); err != nil {
+		if err := u.write("engine ready\n"); err != nil {
 			return fmt.Errorf("failed to write ready response: %w", err)
 		}
 
-		u.writer.Flush()
-
 		cmdStr, err := u.reader.ReadString('\n')
 		if err != nil {
-			if _, err := u.writer.WriteString("Error reading input\n"); err != nil {
+			if err := u.write("Error reading input\n"); err != nil {
 				return fmt.Errorf("failed to write error response: %w", err)
 			}
 
-			u.writer.Flush()
-
 			continue
 		}
 
 		cmd := parseCmd(cmdStr)
 		resp, quit := u.handleCommand(cmd)
 
-		if _, err := resp.WriteTo(u.writer); err != nil {
+		if err := u.write(resp.String()); err != nil {
 			return fmt.Errorf("failed to write response: %w", err)
 		}
 
-		u.writer.Flush()
-
 		if quit {
 			break
 		}
@@ -74,6 +89,17 @@ func (u *UCI) Run() error {
 	return nil
 }
 
+func (u *UCI) write(s string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, err := u.writer.WriteString(s); err != nil {
+		return err
+	}
+
+	return u.writer.Flush()
+}
+
 func (u *UCI) handleCommand(cmd *command) (*bytes.Buffer, bool) {
 	var resp bytes.Buffer
 
@@ -83,18 +109,35 @@ func (u *UCI) handleCommand(cmd *command) (*bytes.Buffer, bool) {
 	case "uci":
 		resp.WriteString("id name Toto Chess Engine\n")
 		resp.WriteString("id author Sam Westmoreland\n")
+		resp.WriteString("option name SyzygyPath type string default <empty>\n")
+		resp.WriteString("option name BookFile type string default <empty>\n")
+		resp.WriteString("option name BestBookMove type check default false\n")
+		resp.WriteString("option name UCI_Chess960 type check default false\n")
+		resp.WriteString("option name UseNNUE type check default false\n")
+		resp.WriteString("option name EvalFile type string default <empty>\n")
+		resp.WriteString("option name EvalWeights type string default <empty>\n")
+		resp.WriteString(variantOption())
+		resp.WriteString("uciok\n")
 	case "quit", "exit", "bye", "q":
+		u.stopSearch()
 		resp.WriteString("bye!\n")
 
 		quit = true
 	case "position":
+		u.stopSearch()
 		u.handlePositionCmd(cmd, &resp)
 
 	case "isready":
 		resp.WriteString("readyok\n")
-	case "ponder":
-		bestMove := u.engine.Search(u.position)
-		resp.WriteString(bestMove + "\n")
+	case "setoption":
+		u.stopSearch()
+		u.handleSetOptionCmd(cmd, &resp)
+	case "eval":
+		u.handleEvalCmd(&resp)
+	case "go", "ponder":
+		u.handleGoCmd(cmd, &resp)
+	case "stop":
+		u.stopSearch()
 	default:
 		resp.WriteString("unknown command\n")
 	}
@@ -109,20 +152,291 @@ func (u *UCI) handlePositionCmd(cmd *command, resp *bytes.Buffer) {
 		return
 	}
 
-	if cmd.args[0] == "startpos" {
-		pos, err := position.NewPosition()
+	var pos *position.Position
+
+	var moves []string
+
+	switch cmd.args[0] {
+	case "startpos":
+		var err error
+
+		pos, err = position.NewVariantPosition(u.variant)
 		if err != nil {
 			panic(err)
 		}
 
-		u.position = pos
+		moves = cmd.args[1:]
 
 		resp.WriteString("set up starting position\n")
+	case "fen":
+		// The FEN runs up to the moves, if there are any. Its length varies, as the clocks may be
+		// left out and Three-check FENs have the checks as well.
+		end := slices.Index(cmd.args, "moves")
+		if end < 0 {
+			end = len(cmd.args)
+		}
+
+		if end < 5 {
+			resp.WriteString("too few arguments. expected `position fen <fen>`\n")
+
+			return
+		}
+
+		var err error
+
+		pos, err = position.NewVariantPositionFromFEN(strings.Join(cmd.args[1:end], " "), u.variant)
+		if err != nil {
+			resp.WriteString(fmt.Sprintf("invalid fen: %v\n", err))
+
+			return
+		}
+
+		moves = cmd.args[end:]
+
+		resp.WriteString("set up position from fen\n")
+	default:
+		return
+	}
+
+	if len(moves) > 0 && moves[0] == "moves" {
+		for _, arg := range moves[1:] {
+			m, ok := movegen.ParseUCI(pos, arg, u.chess960)
+			if !ok {
+				resp.WriteString(fmt.Sprintf("illegal move: %s\n", arg))
+
+				return
+			}
 
+			pos = movegen.MakeMove(pos, m, false)
+		}
+	}
+
+	u.position = pos
+
+	if cmd.args[0] == "startpos" {
 		pos.Print(os.Stdout)
+	}
+}
+
+// handleSetOptionCmd handles `setoption name <name> value <value>`. The value may contain spaces.
+func (u *UCI) handleSetOptionCmd(cmd *command, resp *bytes.Buffer) {
+	args := strings.Join(cmd.args, " ")
+
+	name, value, _ := strings.Cut(strings.TrimPrefix(args, "name "), " value ")
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "syzygypath":
+		if err := u.engine.SetSyzygyPath(strings.TrimSpace(value)); err != nil {
+			resp.WriteString(fmt.Sprintf("info string %v\n", err))
+
+			return
+		}
+
+		switch tb := u.engine.Tablebases; {
+		case tb == nil:
+		case tb.MaxPieces() == 0:
+			resp.WriteString("info string no tablebases found\n")
+		default:
+			resp.WriteString(fmt.Sprintf("info string found tablebases with up to %d pieces\n", tb.MaxPieces()))
+		}
+	case "bookfile":
+		if err := u.engine.SetBookFile(strings.TrimSpace(value)); err != nil {
+			resp.WriteString(fmt.Sprintf("info string %v\n", err))
+
+			return
+		}
+
+		if book := u.engine.Book; book != nil {
+			resp.WriteString(fmt.Sprintf("info string opened book with %d entries\n", book.Len()))
+		}
+	case "bestbookmove":
+		u.engine.BestBookMove = strings.EqualFold(strings.TrimSpace(value), "true")
+	case "uci_chess960":
+		u.chess960 = strings.EqualFold(strings.TrimSpace(value), "true")
+	case "usennue":
+		u.useNNUE = strings.EqualFold(strings.TrimSpace(value), "true")
+		u.setEvaluator(resp)
+	case "evalfile":
+		u.evalFile = strings.TrimSpace(value)
+		u.setEvaluator(resp)
+	case "evalweights":
+		if err := u.engine.SetEvalWeights(strings.TrimSpace(value)); err != nil {
+			resp.WriteString(fmt.Sprintf("info string %v\n", err))
+		}
+	case "uci_variant":
+		variant, err := position.ParseVariant(value)
+		if err != nil {
+			resp.WriteString(fmt.Sprintf("info string %v\n", err))
+
+			return
+		}
+
+		u.variant = variant
+	default:
+		resp.WriteString(fmt.Sprintf("unknown option: %s\n", name))
+	}
+}
+
+// setEvaluator sets the engine's evaluator from the UseNNUE and EvalFile options.
+func (u *UCI) setEvaluator(resp *bytes.Buffer) {
+	if err := u.engine.SetNNUE(u.useNNUE, u.evalFile); err != nil {
+		resp.WriteString(fmt.Sprintf("info string %v\n", err))
+	}
+}
+
+// variantOption returns the UCI_Variant option, listing the variants the engine plays.
+func variantOption() string {
+	var sb strings.Builder
+
+	sb.WriteString("option name UCI_Variant type combo default chess")
+
+	for _, v := range position.Variants {
+		sb.WriteString(" var " + v.String())
+	}
+
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// handleGoCmd starts searching the current position in the background. Info lines are written as
+// each iteration completes, followed by the best move once the search stops.
+func (u *UCI) handleGoCmd(cmd *command, resp *bytes.Buffer) {
+	if u.position == nil {
+		resp.WriteString("no position set. use `position` first\n")
+
+		return
+	}
+
+	limits, err := parseLimits(cmd.args)
+	if err != nil {
+		resp.WriteString(fmt.Sprintf("invalid go command: %v\n", err))
+
+		return
+	}
+
+	u.stopSearch()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	u.cancel = cancel
+	u.done = done
+
+	pos, chess960 := u.position, u.chess960
+
+	go func() {
+		defer close(done)
+
+		best := u.engine.Search(ctx, pos, limits, func(info engine.Info) {
+			if err := u.write(formatInfo(pos, info, chess960)); err != nil {
+				log.Println("failed to write info:", err)
+			}
+		})
+
+		bestMove := "0000"
+		if best != 0 {
+			bestMove = movegen.UCI(pos, best, chess960)
+		}
+
+		if err := u.write("bestmove " + bestMove + "\n"); err != nil {
+			log.Println("failed to write best move:", err)
+		}
+	}()
+}
+
+// stopSearch stops the running search, if any, and waits for it to write its best move.
+func (u *UCI) stopSearch() {
+	if u.cancel == nil {
+		return
+	}
+
+	u.cancel()
+	<-u.done
+
+	u.cancel = nil
+	u.done = nil
+}
+
+func parseLimits(args []string) (engine.Limits, error) {
+	var limits engine.Limits
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			limits.Infinite = true
+
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return limits, fmt.Errorf("missing value for %s", args[i])
+		}
+
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return limits, fmt.Errorf("invalid value for %s: %w", args[i], err)
+		}
+
+		i++
+
+		ms := time.Duration(n) * time.Millisecond
+
+		switch args[i-1] {
+		case "depth":
+			limits.Depth = n
+		case "nodes":
+			limits.Nodes = uint64(n)
+		case "movetime":
+			limits.MoveTime = ms
+		case "wtime":
+			limits.WhiteTime = ms
+		case "btime":
+			limits.BlackTime = ms
+		case "winc":
+			limits.WhiteInc = ms
+		case "binc":
+			limits.BlackInc = ms
+		case "movestogo":
+			limits.MovesToGo = n
+		default:
+			return limits, fmt.Errorf("unknown limit %s", args[i-1])
+		}
+	}
+
+	return limits, nil
+}
+
+func formatInfo(pos *position.Position, info engine.Info, chess960 bool) string {
+	score := fmt.Sprintf("cp %d", info.Score)
+	if moves, ok := engine.MateIn(info.Score); ok {
+		score = fmt.Sprintf("mate %d", moves)
+	}
+
+	ms := info.Time.Milliseconds()
+	nps := info.Nodes * 1000 / uint64(max(ms, 1))
+
+	// Castling is written relative to the position it's played in, so the PV is played out as it's
+	// written.
+	pv := make([]string, len(info.PV))
+	for i, m := range info.PV {
+		pv[i] = movegen.UCI(pos, m, chess960)
+		pos = movegen.MakeMove(pos, m, false)
+	}
+
+	return fmt.Sprintf("info depth %d score %s nodes %d nps %d tbhits %d time %d pv %s\n",
+		info.Depth, score, info.Nodes, nps, info.TBHits, ms, strings.Join(pv, " "))
+}
+
+// handleEvalCmd writes a term-by-term breakdown of the static evaluation of the current position.
+// This is a debugging command rather than part of the UCI protocol.
+func (u *UCI) handleEvalCmd(resp *bytes.Buffer) {
+	if u.position == nil {
+		resp.WriteString("no position set. use `position` first\n")
 
 		return
 	}
+
+	resp.WriteString(eval.Trace(u.position).String())
 }
 
 func main() {
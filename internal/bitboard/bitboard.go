@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math/bits"
+	mathrand "math/rand/v2"
 
 	sq "github.com/samwestmoreland/chessengine/internal/squares"
 	"github.com/samwestmoreland/chessengine/internal/utils"
@@ -117,9 +118,10 @@ func RandomUint64() uint64 {
 	return binary.BigEndian.Uint64(b[:])
 }
 
-// GenerateSparseRandomUint64 generates a random uint64 that is sparse.
-func GenerateSparseRandomUint64() uint64 {
-	return RandomUint64() & RandomUint64() & RandomUint64() //nolint
+// GenerateSparseRandomUint64 generates a random uint64 that is sparse, taking its randomness from
+// the given generator so that a seeded one gives the same numbers every time.
+func GenerateSparseRandomUint64(r *mathrand.Rand) uint64 {
+	return r.Uint64() & r.Uint64() & r.Uint64()
 }
 
 // PrintBoard prints a bitboard to output.
@@ -0,0 +1,324 @@
+// Package dtm generates and probes distance-to-mate tablebases for endings with up to four pieces,
+// using nothing but the engine's own move generator.
+//
+// Tables are generated by retrograde analysis. Every position is first classified by generating
+// its moves: checkmates are lost, stalemates drawn, and captures and promotions are looked up in
+// the tables of smaller endings. Then, starting from the checkmates, the positions that can reach
+// each newly lost position are found by un-making moves, which makes them won, and the positions
+// whose moves all reach won positions become lost in turn. Because the forward and backward move
+// generation have to agree exactly for this to work, a generated table that passes Verify is a
+// strong check on the move generator.
+//
+// Castling and en passant are left out. Positions in a table have no castling rights, and endings
+// with pawns on both sides, the only ones where a pawn could be taken en passant, are refused when
+// they're generated, loaded or probed. With pawns on one side only, an en passant square can be set
+// but never used, so it doesn't change a position's value.
+package dtm
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// Outcome is the result of a position with perfect play, from the side to move's point of view.
+type Outcome int
+
+const (
+	Loss Outcome = -1
+	Draw Outcome = 0
+	Win  Outcome = 1
+)
+
+// Result is the value of a position in a table.
+type Result struct {
+	Outcome Outcome
+	// Plies is the number of half moves until mate with the quickest win and the slowest loss. It
+	// is zero for draws and for positions that are already checkmate.
+	Plies int
+}
+
+func (r Result) String() string {
+	switch r.Outcome {
+	case Win:
+		return fmt.Sprintf("win in %d plies", r.Plies)
+	case Loss:
+		return fmt.Sprintf("loss in %d plies", r.Plies)
+	default:
+		return "draw"
+	}
+}
+
+// Table is the distance-to-mate table of one ending.
+type Table struct {
+	material *material
+	// Each entry is zero for draws and illegal positions, and otherwise one more than the number
+	// of plies to mate. Odd numbers of plies are wins for the side to move and even numbers losses.
+	data []byte
+}
+
+// Signature returns the canonical signature of the table's ending.
+func (t *Table) Signature() string {
+	return t.material.signature
+}
+
+// Probe returns the value of a position from the side to move's point of view, or false if the
+// position is not in the table's ending.
+func (t *Table) Probe(pos *position.Position) (Result, bool) {
+	if pos.CastlingRights != 0 || pos.Variant != position.Standard {
+		return Result{}, false
+	}
+
+	var flip bool
+
+	switch sig := endgame.Signature(pos); t.material.signature {
+	case sig:
+	case flipSignature(sig):
+		flip = true
+	default:
+		return Result{}, false
+	}
+
+	p := t.material.placementOf(pos, flip)
+
+	return decode(t.data[t.material.index(&p)]), true
+}
+
+func decode(entry byte) Result {
+	if entry == 0 {
+		return Result{}
+	}
+
+	plies := int(entry) - 1
+	if plies%2 == 1 {
+		return Result{Outcome: Win, Plies: plies}
+	}
+
+	return Result{Outcome: Loss, Plies: plies}
+}
+
+func encode(r Result) (byte, error) {
+	if r.Outcome == Draw {
+		return 0, nil
+	}
+
+	if r.Plies >= 255 {
+		return 0, fmt.Errorf("mate in %d plies is too long to store", r.Plies)
+	}
+
+	return byte(r.Plies + 1), nil
+}
+
+// Stats counts the positions in a table by result.
+type Stats struct {
+	Wins, Draws, Losses int
+	// Longest is the longest win.
+	Longest Result
+}
+
+// Stats counts the table's positions. Draws include illegal positions, which aren't told apart
+// from draws in the table.
+func (t *Table) Stats() Stats {
+	var ret Stats
+
+	for _, entry := range t.data {
+		r := decode(entry)
+
+		switch r.Outcome {
+		case Win:
+			ret.Wins++
+
+			if r.Plies > ret.Longest.Plies {
+				ret.Longest = r
+			}
+		case Loss:
+			ret.Losses++
+		default:
+			ret.Draws++
+		}
+	}
+
+	return ret
+}
+
+// The file format is a header of the magic bytes, the signature as a length-prefixed string and
+// the number of entries as a little-endian uint32, followed by the entries compressed with
+// DEFLATE. Long runs of draws and repeated values make the tables compress well.
+var magic = [4]byte{'D', 'T', 'M', 1}
+
+// Extension is the file extension of table files.
+const Extension = ".dtm"
+
+var errCorrupt = errors.New("corrupt table")
+
+// WriteTo writes the table in its file format.
+func (t *Table) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	header := append(magic[:], byte(len(t.material.signature)))
+	header = append(header, t.material.signature...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(t.data)))
+
+	if _, err := bw.Write(header); err != nil {
+		return cw.n, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	fw, err := flate.NewWriter(bw, flate.BestCompression)
+	if err != nil {
+		return cw.n, fmt.Errorf("failed to create compressor: %w", err)
+	}
+
+	if _, err := fw.Write(t.data); err != nil {
+		return cw.n, fmt.Errorf("failed to write entries: %w", err)
+	}
+
+	if err := fw.Close(); err != nil {
+		return cw.n, fmt.Errorf("failed to write entries: %w", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return cw.n, fmt.Errorf("failed to write table: %w", err)
+	}
+
+	return cw.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// ReadTable reads a table written by WriteTo.
+func ReadTable(r io.Reader) (*Table, error) {
+	br := bufio.NewReader(r)
+
+	var header [5]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if [4]byte(header[:4]) != magic {
+		return nil, fmt.Errorf("%w: bad magic", errCorrupt)
+	}
+
+	sig := make([]byte, header[4])
+	if _, err := io.ReadFull(br, sig); err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	m, err := newMaterial(string(sig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCorrupt, err)
+	}
+
+	var size uint32
+	if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read size: %w", err)
+	}
+
+	if int(size) != m.size {
+		return nil, fmt.Errorf("%w: %s has %d entries, want %d", errCorrupt, sig, size, m.size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(flate.NewReader(br), data); err != nil {
+		return nil, fmt.Errorf("failed to read entries: %w", err)
+	}
+
+	return &Table{material: m, data: data}, nil
+}
+
+// Tables is a directory of table files, which are read when they're first needed. It is safe for
+// concurrent use.
+type Tables struct {
+	dir    string
+	mu     sync.Mutex
+	tables map[string]*Table
+	// missing holds endings that have no file, so the directory isn't searched again.
+	missing map[string]bool
+}
+
+// Open returns the tables in a directory.
+func Open(dir string) (*Tables, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to open tables: %w", err)
+	}
+
+	return &Tables{
+		dir:     dir,
+		tables:  make(map[string]*Table),
+		missing: make(map[string]bool),
+	}, nil
+}
+
+// Table returns the table of an ending, or nil if there is no file for it.
+func (ts *Tables) Table(signature string) (*Table, error) {
+	sig, err := Canonical(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if t, ok := ts.tables[sig]; ok || ts.missing[sig] {
+		return t, nil
+	}
+
+	f, err := os.Open(filepath.Join(ts.dir, sig+Extension))
+	if errors.Is(err, os.ErrNotExist) {
+		ts.missing[sig] = true
+
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", sig, err)
+	}
+	defer f.Close()
+
+	t, err := ReadTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sig, err)
+	}
+
+	ts.tables[sig] = t
+
+	return t, nil
+}
+
+// Probe returns the value of a position, or false if there is no table for it. Bare kings are
+// always drawn.
+func (ts *Tables) Probe(pos *position.Position) (Result, bool) {
+	if onlyKings(pos) {
+		return Result{}, true
+	}
+
+	t, err := ts.Table(endgame.Signature(pos))
+	if err != nil || t == nil {
+		return Result{}, false
+	}
+
+	return t.Probe(pos)
+}
+
+func onlyKings(pos *position.Position) bool {
+	return bb.CountBits(pos.Occupancy[piece.Wa]|pos.Occupancy[piece.Ba]) == 2
+}
@@ -0,0 +1,299 @@
+package dtm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/dtm"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// The three-piece tables are generated once and shared between tests.
+var (
+	generateOnce sync.Once
+	generator    *dtm.Generator
+	generateErr  error
+)
+
+func table(t *testing.T, signature string) *dtm.Table {
+	t.Helper()
+
+	generateOnce.Do(func() {
+		generator = dtm.NewGenerator()
+
+		for _, sig := range dtm.Endings(3) {
+			if _, generateErr = generator.Generate(sig); generateErr != nil {
+				return
+			}
+		}
+	})
+
+	if generateErr != nil {
+		t.Fatal(generateErr)
+	}
+
+	tb, err := generator.Generate(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tb
+}
+
+func TestCanonical(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		signature string
+		want      string
+		wantErr   bool
+	}{
+		{signature: "KQvK", want: "KQvK"},
+		{signature: "KvKQ", want: "KQvK"},
+		{signature: "KNBvK", want: "KBNvK"},
+		{signature: "KRvKQ", want: "KQvKR"},
+		{signature: "KNvKB", want: "KBvKN"},
+		{signature: "kpvkp", want: "KPvKP"},
+		{signature: "KQK", wantErr: true},
+		{signature: "KXvK", wantErr: true},
+		{signature: "QvK", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := dtm.Canonical(tt.signature)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v", tt.signature, err)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.signature, got, tt.want)
+		}
+	}
+
+	if got := len(dtm.Endings(4)); got != 34 {
+		t.Errorf("got %d endings with up to four pieces, want 34", got)
+	}
+}
+
+// TestPawnsOnBothSides checks that endings where en passant is possible are refused, since tables
+// don't model it.
+func TestPawnsOnBothSides(t *testing.T) {
+	t.Parallel()
+
+	if slices.Contains(dtm.Endings(4), "KPvKP") {
+		t.Error("KPvKP is listed as an ending")
+	}
+
+	if _, err := dtm.NewGenerator().Generate("KPvKP"); err == nil {
+		t.Error("KPvKP generated")
+	}
+}
+
+// TestLongestMates checks the longest wins against the well-known maximum distances to mate.
+func TestLongestMates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		signature string
+		plies     int
+	}{
+		{"KQvK", 19},
+		{"KRvK", 31},
+		{"KPvK", 55},
+		{"KBvK", 0},
+		{"KNvK", 0},
+	}
+
+	for _, tt := range tests {
+		tb := table(t, tt.signature)
+
+		if got := tb.Stats().Longest.Plies; got != tt.plies {
+			t.Errorf("%s: longest win is %d plies, want %d", tt.signature, got, tt.plies)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	for _, sig := range dtm.Endings(3) {
+		tb := table(t, sig)
+
+		if err := generator.Verify(tb); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	tb := table(t, "KQvK")
+
+	tests := []struct {
+		fen  string
+		want dtm.Result
+	}{
+		{"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", dtm.Result{Outcome: dtm.Win, Plies: 1}},
+		{"Q1k5/8/2K5/8/8/8/8/8 b - - 0 1", dtm.Result{Outcome: dtm.Loss}},
+		{"K7/8/1k6/8/8/8/8/6q1 b - - 0 1", dtm.Result{Outcome: dtm.Win, Plies: 1}},
+		{"k7/1Q6/8/8/8/8/8/7K b - - 0 1", dtm.Result{}},
+		{"k7/2Q5/8/1K6/8/8/8/8 b - - 0 1", dtm.Result{}},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := tb.Probe(pos)
+		if !ok {
+			t.Errorf("%s: not in the table", tt.fen)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.fen, got, tt.want)
+		}
+	}
+
+	pos, err := position.NewPositionFromFEN("k7/8/1K6/8/8/8/8/7R w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tb.Probe(pos); ok {
+		t.Error("KRvK position found in the KQvK table")
+	}
+}
+
+// TestKPKAgreesWithBitbase compares every KPvK position with the bitbase the evaluator uses.
+func TestKPKAgreesWithBitbase(t *testing.T) {
+	t.Parallel()
+
+	tb := table(t, "KPvK")
+
+	for whiteKing := sq.Square(0); whiteKing < 64; whiteKing++ {
+		for blackKing := sq.Square(0); blackKing < 64; blackKing++ {
+			for pawn := sq.Square(8); pawn < 56; pawn++ {
+				for _, whiteToMove := range []bool{true, false} {
+					pos := kpk(whiteKing, pawn, blackKing, whiteToMove)
+					if pos == nil {
+						continue
+					}
+
+					r, ok := tb.Probe(pos)
+					if !ok {
+						t.Fatalf("%v %v %v not in the table", whiteKing, pawn, blackKing)
+					}
+
+					whiteWins := r.Outcome == dtm.Win
+					if !whiteToMove {
+						whiteWins = r.Outcome == dtm.Loss
+					}
+
+					if want := endgame.ProbeKPK(whiteToMove, whiteKing, pawn, blackKing); whiteWins != want {
+						t.Fatalf("K%v P%v k%v white to move %v: table says %v, bitbase win %v",
+							whiteKing, pawn, blackKing, whiteToMove, r, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// kpk returns a KPvK position, or nil if it is illegal.
+func kpk(whiteKing, pawn, blackKing sq.Square, whiteToMove bool) *position.Position {
+	if whiteKing == blackKing || whiteKing == pawn || blackKing == pawn {
+		return nil
+	}
+
+	pos := &position.Position{
+		WhiteToMove:     whiteToMove,
+		EnPassantSquare: sq.NoSquare,
+	}
+
+	pos.PlacePiece(whiteKing, piece.Wk)
+	pos.PlacePiece(blackKing, piece.Bk)
+	pos.PlacePiece(pawn, piece.Wp)
+
+	notToMove := pos.Copy()
+	notToMove.WhiteToMove = !whiteToMove
+
+	if movegen.InCheck(notToMove) {
+		return nil
+	}
+
+	return pos
+}
+
+func TestReadWrite(t *testing.T) {
+	t.Parallel()
+
+	tb := table(t, "KRvK")
+
+	var buf bytes.Buffer
+	if _, err := tb.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The table has 81920 entries, mostly draws and illegal positions.
+	if buf.Len() > 40000 {
+		t.Errorf("table is %d bytes on disk", buf.Len())
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "KRvK"+dtm.Extension), buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := dtm.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos, err := position.NewPositionFromFEN("8/8/8/8/8/1k6/8/K6r w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := tables.Probe(pos)
+	want, _ := tb.Probe(pos)
+
+	if !ok || got != want || got.Outcome != dtm.Loss {
+		t.Errorf("got %v (ok %v), want %v", got, ok, want)
+	}
+
+	pos, err = position.NewPositionFromFEN("8/8/8/8/8/1k6/8/K6q w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tables.Probe(pos); ok {
+		t.Error("probe succeeded without a KQvK table")
+	}
+
+	if _, err := dtm.ReadTable(bytes.NewReader(buf.Bytes()[:20])); err == nil {
+		t.Error("truncated table read without error")
+	}
+}
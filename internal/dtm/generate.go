@@ -0,0 +1,621 @@
+package dtm
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// Generator generates tables, along with the tables of the smaller endings they convert into.
+// movegen.Initialise must have been called first.
+type Generator struct {
+	// Workers is the number of goroutines used to classify positions.
+	Workers int
+	// Logf, if set, is given progress messages.
+	Logf func(format string, args ...any)
+	// Tables, if set, are used for smaller endings before generating them.
+	Tables *Tables
+	// Generated, if set, is called with each table as soon as it has been generated, including the
+	// tables of smaller endings generated along the way.
+	Generated func(t *Table) error
+
+	tables map[string]*Table
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		Workers: runtime.GOMAXPROCS(0),
+		tables:  make(map[string]*Table),
+	}
+}
+
+// Generate returns the table of an ending, generating it and any smaller endings it needs if they
+// haven't been generated already.
+func (g *Generator) Generate(signature string) (*Table, error) {
+	sig, err := Canonical(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := g.tables[sig]; ok {
+		return t, nil
+	}
+
+	if g.Tables != nil {
+		if t, err := g.Tables.Table(sig); err != nil {
+			return nil, err
+		} else if t != nil {
+			g.tables[sig] = t
+
+			return t, nil
+		}
+	}
+
+	m, err := newMaterial(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range conversions(sig) {
+		if _, err := g.Generate(sub); err != nil {
+			return nil, fmt.Errorf("failed to generate %s for %s: %w", sub, sig, err)
+		}
+	}
+
+	g.logf("Generating %s (%d positions)", sig, m.size)
+
+	gen := &generation{
+		generator: g,
+		material:  m,
+		state:     make([]uint8, m.size),
+		plies:     make([]uint8, m.size),
+		count:     make([]uint8, m.size),
+		bestWin:   make([]uint8, m.size),
+		longest:   make([]uint8, m.size),
+		escapes:   make([]bool, m.size),
+	}
+
+	gen.classify()
+
+	if err := gen.propagate(); err != nil {
+		return nil, fmt.Errorf("failed to generate %s: %w", sig, err)
+	}
+
+	t, err := gen.table()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s: %w", sig, err)
+	}
+
+	g.tables[sig] = t
+
+	if g.Generated != nil {
+		if err := g.Generated(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func (g *Generator) logf(format string, args ...any) {
+	if g.Logf != nil {
+		g.Logf(format, args...)
+	}
+}
+
+// probe looks up a position in a smaller ending that has already been generated.
+func (g *Generator) probe(pos *position.Position) (Result, error) {
+	if onlyKings(pos) {
+		return Result{}, nil
+	}
+
+	sig, err := Canonical(endgame.Signature(pos))
+	if err != nil {
+		return Result{}, err
+	}
+
+	t, ok := g.tables[sig]
+	if !ok {
+		return Result{}, fmt.Errorf("no table for %s", sig)
+	}
+
+	r, _ := t.Probe(pos)
+
+	return r, nil
+}
+
+// conversions returns the endings that captures and promotions lead to from an ending, leaving
+// out bare kings.
+func conversions(signature string) []string {
+	white, black, _ := strings.Cut(signature, "v")
+
+	var ret []string
+
+	add := func(white, black string) {
+		if len(white)+len(black) > 2 {
+			if sig, err := Canonical(white + "v" + black); err == nil {
+				ret = append(ret, sig)
+			}
+		}
+	}
+
+	for i := 1; i < len(white); i++ {
+		add(white[:i]+white[i+1:], black)
+	}
+
+	for i := 1; i < len(black); i++ {
+		add(white, black[:i]+black[i+1:])
+	}
+
+	for i := 1; i < len(white); i++ {
+		if white[i] == 'P' {
+			for _, p := range "QRBN" {
+				add(white[:i]+string(p)+white[i+1:], black)
+			}
+		}
+	}
+
+	for i := 1; i < len(black); i++ {
+		if black[i] == 'P' {
+			for _, p := range "QRBN" {
+				add(white, black[:i]+string(p)+black[i+1:])
+			}
+		}
+	}
+
+	return ret
+}
+
+// Position states during generation.
+const (
+	stateUnknown uint8 = iota
+	stateInvalid
+	stateWin
+	stateLoss
+	stateDraw
+)
+
+type generation struct {
+	generator *Generator
+	material  *material
+
+	state []uint8
+	plies []uint8
+	// count is the number of moves that stay in the ending and haven't yet been found to reach
+	// a won position.
+	count []uint8
+	// bestWin is one more than the quickest mate through a capture or promotion, if any, and
+	// longest one more than the slowest loss through one.
+	bestWin []uint8
+	longest []uint8
+	// escapes marks positions with a capture or promotion that draws.
+	escapes []bool
+
+	// buckets[n] holds positions that may be decided at n plies from mate. Wins are at odd
+	// numbers of plies and losses at even numbers.
+	buckets [][]int
+}
+
+// classify generates the moves of every position in the ending, setting the number that stay in
+// the ending and resolving the rest from the smaller endings' tables.
+func (gen *generation) classify() {
+	workers := max(gen.generator.Workers, 1)
+	chunk := (gen.material.size + workers - 1) / workers
+
+	var wg sync.WaitGroup
+
+	for start := 0; start < gen.material.size; start += chunk {
+		wg.Add(1)
+
+		go func(start, end int) {
+			defer wg.Done()
+
+			for idx := start; idx < end; idx++ {
+				gen.classifyPosition(idx)
+			}
+		}(start, min(start+chunk, gen.material.size))
+	}
+
+	wg.Wait()
+
+	for idx, state := range gen.state {
+		if state != stateUnknown {
+			continue
+		}
+
+		switch {
+		case gen.bestWin[idx] > 0:
+			gen.push(int(gen.bestWin[idx])-1, idx)
+		case gen.count[idx] > 0:
+		case gen.escapes[idx]:
+			gen.state[idx] = stateDraw
+		default:
+			gen.push(int(gen.longest[idx])-1, idx)
+		}
+	}
+}
+
+func (gen *generation) classifyPosition(idx int) {
+	m := gen.material
+
+	p := m.placement(idx)
+
+	pos, ok := m.position(&p)
+	if !ok || m.index(&p) != idx || opponentInCheck(pos) {
+		gen.state[idx] = stateInvalid
+
+		return
+	}
+
+	moves := movegen.GetLegalMoves(pos)
+	if len(moves) == 0 {
+		if movegen.InCheck(pos) {
+			gen.state[idx] = stateLoss
+		} else {
+			gen.state[idx] = stateDraw
+		}
+
+		return
+	}
+
+	for _, mv := range moves {
+		if !converts(mv) {
+			gen.count[idx]++
+
+			continue
+		}
+
+		child := movegen.MakeMove(pos, mv, false)
+
+		r, err := gen.generator.probe(child)
+		if err != nil {
+			panic(err)
+		}
+
+		switch r.Outcome {
+		case Loss:
+			if gen.bestWin[idx] == 0 || r.Plies+2 < int(gen.bestWin[idx]) {
+				gen.bestWin[idx] = uint8(r.Plies + 2)
+			}
+		case Win:
+			gen.longest[idx] = max(gen.longest[idx], uint8(r.Plies+2))
+		default:
+			gen.escapes[idx] = true
+		}
+	}
+}
+
+// converts reports whether a move leaves the ending.
+func converts(m move.Move) bool {
+	return m.IsCapture() || m.IsEnPassant() || m.PromotionPiece() != piece.NoPiece
+}
+
+// opponentInCheck reports whether the side not to move is in check, which makes a position
+// illegal.
+func opponentInCheck(pos *position.Position) bool {
+	king := pos.Occupancy[piece.Wk]
+	if pos.WhiteToMove {
+		king = pos.Occupancy[piece.Bk]
+	}
+
+	return movegen.SquareAttacked(pos, bb.LSBIndex(king), pos.WhiteToMove)
+}
+
+func (gen *generation) push(plies, idx int) {
+	for len(gen.buckets) <= plies {
+		gen.buckets = append(gen.buckets, nil)
+	}
+
+	gen.buckets[plies] = append(gen.buckets[plies], idx)
+}
+
+// propagate works outwards from the checkmates, deciding positions in order of distance to mate.
+func (gen *generation) propagate() error {
+	for idx, state := range gen.state {
+		if state == stateLoss {
+			gen.state[idx] = stateUnknown
+			gen.push(0, idx)
+		}
+	}
+
+	moves := make(map[int]int)
+
+	for plies := 0; plies < len(gen.buckets); plies++ {
+		won := plies%2 == 1
+
+		for _, idx := range gen.buckets[plies] {
+			if gen.state[idx] != stateUnknown {
+				continue
+			}
+
+			if plies > 254 {
+				return fmt.Errorf("mate in %d plies is too long to store", plies)
+			}
+
+			gen.plies[idx] = uint8(plies)
+			gen.state[idx] = stateLoss
+
+			if won {
+				gen.state[idx] = stateWin
+			}
+
+			clear(moves)
+
+			if err := gen.predecessors(idx, moves); err != nil {
+				return err
+			}
+
+			for prev, n := range moves {
+				if err := gen.update(prev, n, plies, won); err != nil {
+					return err
+				}
+			}
+		}
+
+		gen.buckets[plies] = nil
+	}
+
+	for idx, state := range gen.state {
+		if state == stateUnknown {
+			gen.state[idx] = stateDraw
+		}
+	}
+
+	return nil
+}
+
+// update handles the moves from prev to a position that has just been decided.
+func (gen *generation) update(prev, moves, plies int, won bool) error {
+	switch gen.state[prev] {
+	case stateUnknown:
+	case stateInvalid:
+		return fmt.Errorf("position %d is reached by un-making a move but has no legal moves of its own", prev)
+	default:
+		return nil
+	}
+
+	if !won {
+		gen.push(plies+1, prev)
+
+		return nil
+	}
+
+	if int(gen.count[prev]) < moves {
+		return fmt.Errorf("position %d has more moves going backwards than forwards", prev)
+	}
+
+	gen.count[prev] -= uint8(moves)
+
+	if gen.count[prev] == 0 && gen.bestWin[prev] == 0 && !gen.escapes[prev] {
+		gen.push(max(plies+1, int(gen.longest[prev])-1), prev)
+	}
+
+	return nil
+}
+
+// predecessors finds the positions from which a move that stays in the ending reaches the given
+// position, and adds the number of such moves from each to moves.
+//
+// Positions are only stored once for each way of mirroring them, which makes the number of moves
+// found going backwards differ from the number going forwards when either position is symmetric.
+// If a position can be mirrored onto itself in n ways, its moves are found n times as often going
+// backwards, so the counts are corrected by the number of symmetries of each position.
+func (gen *generation) predecessors(idx int, moves map[int]int) error {
+	m := gen.material
+
+	p := m.placement(idx)
+
+	pos, _ := m.position(&p)
+	occupied := pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba]
+
+	// The side that just moved.
+	white := !p.whiteToMove
+
+	for i := range len(m.pieces) + 2 {
+		pc := m.piece(i)
+		if colour, _ := pc.Colour(); (colour == piece.White) != white {
+			continue
+		}
+
+		origins := unmoves(pc, p.squares[i], occupied)
+
+		for origins != 0 {
+			origin := bb.LSBIndex(origins)
+			origins = bb.ClearBit(origins, origin)
+
+			prev := p
+			prev.squares[i] = origin
+			prev.whiteToMove = white
+
+			prevPos, ok := m.position(&prev)
+			if !ok || opponentInCheck(prevPos) {
+				continue
+			}
+
+			moves[m.index(&prev)] += m.symmetric(&prev)
+		}
+	}
+
+	symmetric := m.symmetric(&p)
+
+	for prev, n := range moves {
+		if n%symmetric != 0 {
+			return fmt.Errorf("position %d has %d symmetries but is reached from %d in %d ways",
+				idx, symmetric, prev, n)
+		}
+
+		moves[prev] = n / symmetric
+	}
+
+	return nil
+}
+
+// unmoves returns the squares a piece on the given square could have come from without capturing
+// or promoting.
+func unmoves(pc piece.Piece, s sq.Square, occupied bb.Bitboard) bb.Bitboard {
+	var ret bb.Bitboard
+
+	switch pc {
+	case piece.Wk, piece.Bk:
+		ret = movegen.KingAttacks(s)
+	case piece.Wn, piece.Bn:
+		ret = movegen.KnightAttacks(s)
+	case piece.Wb, piece.Bb:
+		ret = movegen.BishopAttacks(s, occupied)
+	case piece.Wr, piece.Br:
+		ret = movegen.RookAttacks(s, occupied)
+	case piece.Wq, piece.Bq:
+		ret = movegen.QueenAttacks(s, occupied)
+	case piece.Wp:
+		// White pawns move towards the eighth rank, which is towards square 0.
+		if s.Rank() >= 3 && !bb.GetBit(occupied, s+8) {
+			ret = bb.SetBit(ret, s+8)
+
+			if s.Rank() == 4 && !bb.GetBit(occupied, s+16) {
+				ret = bb.SetBit(ret, s+16)
+			}
+		}
+	case piece.Bp:
+		if s.Rank() <= 6 && !bb.GetBit(occupied, s-8) {
+			ret = bb.SetBit(ret, s-8)
+
+			if s.Rank() == 5 && !bb.GetBit(occupied, s-16) {
+				ret = bb.SetBit(ret, s-16)
+			}
+		}
+	}
+
+	return ret &^ occupied
+}
+
+func (gen *generation) table() (*Table, error) {
+	t := &Table{material: gen.material, data: make([]byte, gen.material.size)}
+
+	for idx, state := range gen.state {
+		var r Result
+
+		switch state {
+		case stateWin:
+			r = Result{Outcome: Win, Plies: int(gen.plies[idx])}
+		case stateLoss:
+			r = Result{Outcome: Loss, Plies: int(gen.plies[idx])}
+		}
+
+		entry, err := encode(r)
+		if err != nil {
+			return nil, err
+		}
+
+		t.data[idx] = entry
+	}
+
+	return t, nil
+}
+
+// Verify checks every position in a table against the values of its moves, found by generating
+// them forwards. A generated table that doesn't verify means the move generator's forward and
+// backward moves disagree.
+func (g *Generator) Verify(t *Table) error {
+	m := t.material
+
+	for idx := range m.size {
+		p := m.placement(idx)
+
+		pos, ok := m.position(&p)
+		if !ok || m.index(&p) != idx || opponentInCheck(pos) {
+			continue
+		}
+
+		want, err := g.solve(t, pos)
+		if err != nil {
+			return err
+		}
+
+		if got := decode(t.data[idx]); got != want {
+			return fmt.Errorf("%s: %v with %v to move is a %v in the table, but its moves make it a %v",
+				m.signature, describe(m, &p), side(p.whiteToMove), got, want)
+		}
+	}
+
+	return nil
+}
+
+// solve returns the value of a position from the values of the positions its moves reach.
+func (g *Generator) solve(t *Table, pos *position.Position) (Result, error) {
+	moves := movegen.GetLegalMoves(pos)
+	if len(moves) == 0 {
+		if movegen.InCheck(pos) {
+			return Result{Outcome: Loss}, nil
+		}
+
+		return Result{}, nil
+	}
+
+	var best, worst *Result
+
+	drawn := false
+
+	for _, mv := range moves {
+		child := movegen.MakeMove(pos, mv, false)
+
+		var r Result
+
+		if converts(mv) {
+			var err error
+			if r, err = g.probe(child); err != nil {
+				return Result{}, err
+			}
+		} else {
+			r, _ = t.Probe(child)
+		}
+
+		switch r.Outcome {
+		case Loss:
+			if best == nil || r.Plies < best.Plies {
+				best = &r
+			}
+		case Win:
+			if worst == nil || r.Plies > worst.Plies {
+				worst = &r
+			}
+		default:
+			drawn = true
+		}
+	}
+
+	switch {
+	case best != nil:
+		return Result{Outcome: Win, Plies: best.Plies + 1}, nil
+	case drawn:
+		return Result{}, nil
+	default:
+		return Result{Outcome: Loss, Plies: worst.Plies + 1}, nil
+	}
+}
+
+func describe(m *material, p *placement) string {
+	var ret []string
+
+	for i := range len(m.pieces) + 2 {
+		ret = append(ret, m.piece(i).String()+p.squares[i].String())
+	}
+
+	return strings.Join(ret, " ")
+}
+
+func side(white bool) string {
+	if white {
+		return "white"
+	}
+
+	return "black"
+}
@@ -0,0 +1,470 @@
+package dtm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// MaxPieces is the largest number of pieces, kings included, that tables can be generated for.
+const MaxPieces = 4
+
+// pieceOrder is the order pieces are written in a signature, and indexed within each side.
+const pieceOrder = "QRBNP"
+
+var pieceValue = map[byte]int{'Q': 9, 'R': 5, 'B': 3, 'N': 3, 'P': 1}
+
+// material describes an ending. Positions are indexed by the squares of the white king, the black
+// king, and then the other pieces in the order given by pieces: white before black, and in
+// signature order within each side.
+type material struct {
+	signature string
+	pieces    []piece.Piece
+	pawns     bool
+	// kingSlots is the number of squares the white king is indexed on after the board has been
+	// mirrored, and size the number of entries in the table.
+	kingSlots int
+	size      int
+}
+
+// Canonical returns the signature of an ending in the form its table is stored under, with the
+// stronger side first and each side's pieces in the order KQRBNP, so "KvKNB" becomes "KBNvK".
+func Canonical(signature string) (string, error) {
+	white, black, ok := strings.Cut(strings.ToUpper(signature), "V")
+	if !ok {
+		return "", fmt.Errorf("invalid signature %q: missing v", signature)
+	}
+
+	var err error
+
+	if white, err = sortSide(white); err != nil {
+		return "", fmt.Errorf("invalid signature %q: %w", signature, err)
+	}
+
+	if black, err = sortSide(black); err != nil {
+		return "", fmt.Errorf("invalid signature %q: %w", signature, err)
+	}
+
+	if stronger(black, white) {
+		white, black = black, white
+	}
+
+	return white + "v" + black, nil
+}
+
+func sortSide(side string) (string, error) {
+	if !strings.HasPrefix(side, "K") || strings.Count(side, "K") != 1 {
+		return "", fmt.Errorf("each side needs exactly one king")
+	}
+
+	pieces := []byte(side[1:])
+	for _, p := range pieces {
+		if !strings.ContainsRune(pieceOrder, rune(p)) {
+			return "", fmt.Errorf("unknown piece %q", p)
+		}
+	}
+
+	sort.Slice(pieces, func(i, j int) bool {
+		return strings.IndexByte(pieceOrder, pieces[i]) < strings.IndexByte(pieceOrder, pieces[j])
+	})
+
+	return "K" + string(pieces), nil
+}
+
+// stronger reports whether side a should be written before side b. Both must be sorted.
+func stronger(a, b string) bool {
+	valueA, valueB := 0, 0
+
+	for i := 1; i < len(a); i++ {
+		valueA += pieceValue[a[i]]
+	}
+
+	for i := 1; i < len(b); i++ {
+		valueB += pieceValue[b[i]]
+	}
+
+	if valueA != valueB {
+		return valueA > valueB
+	}
+
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+
+	for i := 1; i < len(a); i++ {
+		if a[i] != b[i] {
+			return strings.IndexByte(pieceOrder, a[i]) < strings.IndexByte(pieceOrder, b[i])
+		}
+	}
+
+	return false
+}
+
+// flipSignature swaps the two sides of a signature.
+func flipSignature(signature string) string {
+	white, black, _ := strings.Cut(signature, "v")
+
+	return black + "v" + white
+}
+
+// Endings returns the canonical signatures of every ending with at least one piece besides the
+// kings and at most maxPieces pieces in all, smallest first. Endings with pawns on both sides are
+// left out, as they aren't supported.
+func Endings(maxPieces int) []string {
+	var ret []string
+
+	seen := make(map[string]bool)
+
+	var add func(white, black string, remaining int)
+
+	add = func(white, black string, remaining int) {
+		sig, err := Canonical(white + "v" + black)
+		if err == nil && len(white)+len(black) > 2 && !pawnsOnBothSides(sig) && !seen[sig] {
+			seen[sig] = true
+
+			ret = append(ret, sig)
+		}
+
+		if remaining == 0 {
+			return
+		}
+
+		for _, p := range pieceOrder {
+			add(white+string(p), black, remaining-1)
+			add(white, black+string(p), remaining-1)
+		}
+	}
+
+	add("K", "K", maxPieces-2)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return len(ret[i]) < len(ret[j])
+	})
+
+	return ret
+}
+
+// pawnsOnBothSides reports whether both sides of a signature have pawns. Only then can a pawn be
+// taken en passant, which tables don't model, so such endings are refused rather than given values
+// that are wrong whenever en passant is possible.
+func pawnsOnBothSides(signature string) bool {
+	white, black, _ := strings.Cut(signature, "v")
+
+	return strings.Contains(white, "P") && strings.Contains(black, "P")
+}
+
+func newMaterial(signature string) (*material, error) {
+	canonical, err := Canonical(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if canonical != signature {
+		return nil, fmt.Errorf("signature %q is not canonical, use %q", signature, canonical)
+	}
+
+	if pawnsOnBothSides(signature) {
+		return nil, fmt.Errorf("%s has pawns on both sides, which needs en passant, and that isn't supported", signature)
+	}
+
+	white, black, _ := strings.Cut(signature, "v")
+
+	m := &material{signature: signature}
+
+	for i, side := range []string{white, black} {
+		for _, c := range side[1:] {
+			p := pieceFromLetter[c]
+			if i == 1 {
+				p += piece.Bp - piece.Wp
+			}
+
+			m.pieces = append(m.pieces, p)
+			m.pawns = m.pawns || c == 'P'
+		}
+	}
+
+	if count := len(m.pieces) + 2; count > MaxPieces {
+		return nil, fmt.Errorf("%s has %d pieces, at most %d are supported", signature, count, MaxPieces)
+	}
+
+	m.kingSlots = 10
+	if m.pawns {
+		m.kingSlots = 32
+	}
+
+	m.size = 2 * m.kingSlots * 64
+	for range m.pieces {
+		m.size *= 64
+	}
+
+	return m, nil
+}
+
+var pieceFromLetter = map[rune]piece.Piece{
+	'Q': piece.Wq, 'R': piece.Wr, 'B': piece.Wb, 'N': piece.Wn, 'P': piece.Wp,
+}
+
+// A placement is a position in index form: the squares of the white king, the black king and the
+// other pieces of the material, in order.
+type placement struct {
+	squares     [MaxPieces]sq.Square
+	whiteToMove bool
+}
+
+// symmetry is one of the eight ways of mirroring and rotating the board.
+type symmetry struct {
+	transpose, flipFile, flipRank bool
+}
+
+func (s symmetry) apply(square sq.Square) sq.Square {
+	if s.transpose {
+		square = ((square >> 3) | (square << 3)) & 63
+	}
+
+	if s.flipFile {
+		square ^= 7
+	}
+
+	if s.flipRank {
+		square ^= 56
+	}
+
+	return square
+}
+
+var (
+	// Positions with pawns can only be mirrored left to right; positions without pawns can be
+	// mirrored and rotated in every way.
+	pawnSymmetries = []symmetry{{}, {flipFile: true}}
+	allSymmetries  = func() []symmetry {
+		var ret []symmetry
+
+		for i := range 8 {
+			ret = append(ret, symmetry{transpose: i&1 != 0, flipFile: i&2 != 0, flipRank: i&4 != 0})
+		}
+
+		return ret
+	}()
+
+	// kingSlot numbers the squares the white king is indexed on, which are the lowest squares of
+	// each orbit under the symmetries, and slotSquare is the inverse.
+	kingSlot   [2][64]int
+	slotSquare [2][]sq.Square
+)
+
+func init() {
+	for pawns, symmetries := range [][]symmetry{allSymmetries, pawnSymmetries} {
+		for s := sq.Square(0); s < 64; s++ {
+			lowest := s
+			for _, sym := range symmetries {
+				lowest = min(lowest, sym.apply(s))
+			}
+
+			if lowest == s {
+				kingSlot[pawns][s] = len(slotSquare[pawns])
+				slotSquare[pawns] = append(slotSquare[pawns], s)
+			} else {
+				kingSlot[pawns][s] = -1
+			}
+		}
+	}
+}
+
+func (m *material) pawnIndex() int {
+	if m.pawns {
+		return 1
+	}
+
+	return 0
+}
+
+func (m *material) symmetries() []symmetry {
+	if m.pawns {
+		return pawnSymmetries
+	}
+
+	return allSymmetries
+}
+
+// index returns the index of a placement. Of the ways of mirroring the board that bring the white
+// king to an indexed square, the one giving the lowest index is used, and identical pieces are
+// sorted by square, so every placement has a single index.
+func (m *material) index(p *placement) int {
+	n := len(m.pieces) + 2
+	best := -1
+
+	for _, sym := range m.symmetries() {
+		var squares [MaxPieces]sq.Square
+		for i := range n {
+			squares[i] = sym.apply(p.squares[i])
+		}
+
+		slot := kingSlot[m.pawnIndex()][squares[0]]
+		if slot < 0 {
+			continue
+		}
+
+		for i := 2; i < n; {
+			j := i + 1
+			for j < n && m.pieces[j-2] == m.pieces[i-2] {
+				j++
+			}
+
+			run := squares[i:j]
+			sort.Slice(run, func(a, b int) bool { return run[a] < run[b] })
+
+			i = j
+		}
+
+		idx := slot
+		if !p.whiteToMove {
+			idx += m.kingSlots
+		}
+
+		for i := 1; i < n; i++ {
+			idx = idx*64 + int(squares[i])
+		}
+
+		if best < 0 || idx < best {
+			best = idx
+		}
+	}
+
+	return best
+}
+
+// placement returns the placement with the given index. It is not necessarily legal, and not
+// necessarily the one index would return.
+func (m *material) placement(idx int) placement {
+	n := len(m.pieces) + 2
+
+	var ret placement
+
+	for i := n - 1; i >= 1; i-- {
+		ret.squares[i] = sq.Square(idx % 64)
+		idx /= 64
+	}
+
+	ret.whiteToMove = idx < m.kingSlots
+	ret.squares[0] = slotSquare[m.pawnIndex()][idx%m.kingSlots]
+
+	return ret
+}
+
+// position returns the position of a placement, or false if two pieces share a square or a pawn is
+// on the first or last rank.
+func (m *material) position(p *placement) (*position.Position, bool) {
+	pos := &position.Position{
+		WhiteToMove:     p.whiteToMove,
+		EnPassantSquare: sq.NoSquare,
+		FullMoveNumber:  1,
+	}
+
+	for i, s := range p.squares[:len(m.pieces)+2] {
+		if pos.IsOccupied(s) {
+			return nil, false
+		}
+
+		pc := m.piece(i)
+		if (pc == piece.Wp || pc == piece.Bp) && (s < 8 || s >= 56) {
+			return nil, false
+		}
+
+		pos.PlacePiece(s, pc)
+	}
+
+	return pos, true
+}
+
+// piece returns the piece at position i of a placement.
+func (m *material) piece(i int) piece.Piece {
+	switch i {
+	case 0:
+		return piece.Wk
+	case 1:
+		return piece.Bk
+	default:
+		return m.pieces[i-2]
+	}
+}
+
+// placementOf returns the placement of a position with this material. If flip is set, the
+// position's colours are swapped and the board mirrored top to bottom first, which is how a
+// position with the material the other way round is looked up.
+func (m *material) placementOf(pos *position.Position, flip bool) placement {
+	occupancy := func(p piece.Piece) bb.Bitboard {
+		if !flip {
+			return pos.Occupancy[p]
+		}
+
+		if p >= piece.Bp {
+			return pos.Occupancy[p-(piece.Bp-piece.Wp)]
+		}
+
+		return pos.Occupancy[p+(piece.Bp-piece.Wp)]
+	}
+
+	ret := placement{whiteToMove: pos.WhiteToMove != flip}
+
+	// remaining holds the pieces of each kind not yet placed, once the first has been.
+	var remaining [piece.Bk + 1]bb.Bitboard
+
+	var started [piece.Bk + 1]bool
+
+	for i := range len(m.pieces) + 2 {
+		p := m.piece(i)
+
+		if !started[p] {
+			remaining[p] = occupancy(p)
+			started[p] = true
+		}
+
+		s := bb.LSBIndex(remaining[p])
+		remaining[p] = bb.ClearBit(remaining[p], s)
+
+		if flip {
+			s ^= 56
+		}
+
+		ret.squares[i] = s
+	}
+
+	return ret
+}
+
+// symmetric returns the number of ways of mirroring the board that leave a placement unchanged,
+// counting doing nothing.
+func (m *material) symmetric(p *placement) int {
+	n := len(m.pieces) + 2
+	ret := 0
+
+	for _, sym := range m.symmetries() {
+		unchanged := true
+
+		for i := 0; i < n && unchanged; i++ {
+			target := sym.apply(p.squares[i])
+			found := false
+
+			for j := range n {
+				if p.squares[j] == target && m.piece(j) == m.piece(i) {
+					found = true
+
+					break
+				}
+			}
+
+			unchanged = found
+		}
+
+		if unchanged {
+			ret++
+		}
+	}
+
+	return ret
+}
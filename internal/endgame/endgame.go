@@ -0,0 +1,258 @@
+// Package endgame holds knowledge of particular endings which the general evaluation gets wrong,
+// either because they are won or drawn regardless of material, or because the winning plan is
+// something the evaluation terms don't reward.
+//
+// Endings are looked up by material signature, which lists each side's pieces from the king down,
+// with the side being evaluated first: "KBNvK" is king, bishop and knight against a lone king. A
+// registry holds two kinds of function. Evaluation functions replace the evaluation entirely and
+// are keyed by exact signature. Scale functions return a factor which the normal evaluation is
+// multiplied by, and are keyed by a signature in which any number of pawns is written as a single
+// P, so that "KBPvKB" covers a bishop and any number of pawns against a bishop.
+package endgame
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+const (
+	// KnownWin is the score given to endings which the stronger side wins by force. Bonuses for
+	// making progress are added to it, so that the search still finds its way to mate.
+	KnownWin = 10000
+
+	// ScaleNormal is the scale factor which leaves an evaluation unchanged. A factor of zero turns
+	// the evaluation into a draw.
+	ScaleNormal = 64
+)
+
+// EvalFunc scores a position from the point of view of the strong side, which is the side listed
+// first in the signature the function was registered under.
+type EvalFunc func(pos *position.Position, strong piece.Colour) int
+
+// ScaleFunc returns the factor, out of ScaleNormal, which the evaluation of a position should be
+// multiplied by.
+type ScaleFunc func(pos *position.Position, strong piece.Colour) int
+
+// Registry maps material signatures to the functions which know about them. The signatures are
+// turned into keys when the functions are registered, so that looking a position up doesn't build
+// a string.
+type Registry struct {
+	evals  map[key]evalEntry
+	scales map[key]ScaleFunc
+}
+
+type evalEntry struct {
+	fn        EvalFunc
+	signature string
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		evals:  make(map[key]evalEntry),
+		scales: make(map[key]ScaleFunc),
+	}
+}
+
+// AddEval registers an evaluation function for an exact material signature. It panics if the
+// signature isn't valid.
+func (r *Registry) AddEval(signature string, fn EvalFunc) {
+	r.evals[mustParseKey(signature)] = evalEntry{fn: fn, signature: signature}
+}
+
+// AddScale registers a scale function for a signature whose pawns have been collapsed into a
+// single P. It panics if the signature isn't valid.
+func (r *Registry) AddScale(signature string, fn ScaleFunc) {
+	r.scales[mustParseKey(signature)] = fn
+}
+
+// Evaluate looks the position up and, if there is an evaluation function for it, returns its score
+// from the side to move's point of view along with the signature it was found under. The
+// registry's knowledge is of standard chess, so positions of other variants are never found.
+func (r *Registry) Evaluate(pos *position.Position) (int, string, bool) {
+	if pos.Variant != position.Standard {
+		return 0, "", false
+	}
+
+	white, black := sideKey(pos, piece.White, false), sideKey(pos, piece.Black, false)
+
+	strong := piece.White
+
+	entry, ok := r.evals[pairKey(white, black)]
+	if !ok {
+		strong = piece.Black
+
+		if entry, ok = r.evals[pairKey(black, white)]; !ok {
+			return 0, "", false
+		}
+	}
+
+	score := entry.fn(pos, strong)
+
+	if (strong == piece.White) != pos.WhiteToMove {
+		score = -score
+	}
+
+	return score, entry.signature, true
+}
+
+// Scale returns the factor the evaluation of the position should be multiplied by, which is
+// ScaleNormal unless the registry has a scale function for it or the position isn't standard chess.
+func (r *Registry) Scale(pos *position.Position) int {
+	if pos.Variant != position.Standard {
+		return ScaleNormal
+	}
+
+	white, black := sideKey(pos, piece.White, true), sideKey(pos, piece.Black, true)
+
+	if fn, ok := r.scales[pairKey(white, black)]; ok {
+		return fn(pos, piece.White)
+	}
+
+	if fn, ok := r.scales[pairKey(black, white)]; ok {
+		return fn(pos, piece.Black)
+	}
+
+	return ScaleNormal
+}
+
+// Signature returns the material signature of the position with white's pieces first.
+func Signature(pos *position.Position) string {
+	return material(pos, piece.White, false) + "v" + material(pos, piece.Black, false)
+}
+
+type pieceLetter struct {
+	offset piece.Piece
+	letter string
+}
+
+var pieceLetters = [6]pieceLetter{
+	{piece.Wk - piece.Wp, "K"},
+	{piece.Wq - piece.Wp, "Q"},
+	{piece.Wr - piece.Wp, "R"},
+	{piece.Wb - piece.Wp, "B"},
+	{piece.Wn - piece.Wp, "N"},
+	{0, "P"},
+}
+
+// material lists one side's pieces from the king down. If collapsePawns is set, any number of pawns
+// is written as a single P.
+func material(pos *position.Position, colour piece.Colour, collapsePawns bool) string {
+	var ret strings.Builder
+
+	for _, p := range pieceLetters {
+		count := bb.CountBits(pieces(pos, colour, p.offset))
+		if collapsePawns && p.letter == "P" {
+			count = min(count, 1)
+		}
+
+		ret.WriteString(strings.Repeat(p.letter, count))
+	}
+
+	return ret.String()
+}
+
+// key is a material signature packed into an integer. Each side takes four bits for the number of
+// each of its pieces, from the king down, and the side listed first takes the high bits.
+type key uint64
+
+const (
+	countBits = 4
+	maxCount  = 1<<countBits - 1
+	sideBits  = countBits * len(pieceLetters)
+)
+
+// sideKey returns the key of one side's pieces. If collapsePawns is set, any number of pawns
+// counts as one. Counts too large to fit are capped, which no legal position needs.
+func sideKey(pos *position.Position, colour piece.Colour, collapsePawns bool) key {
+	var ret key
+
+	for _, p := range pieceLetters {
+		count := bb.CountBits(pieces(pos, colour, p.offset))
+		if collapsePawns && p.letter == "P" {
+			count = min(count, 1)
+		}
+
+		ret = ret<<countBits | key(min(count, maxCount))
+	}
+
+	return ret
+}
+
+// pairKey combines the keys of two sides into the key of a signature which lists first first.
+func pairKey(first, second key) key {
+	return first<<sideBits | second
+}
+
+// mustParseKey returns the key of a material signature such as "KBNvK", and panics if it isn't
+// one.
+func mustParseKey(signature string) key {
+	first, second, ok := strings.Cut(signature, "v")
+	if !ok {
+		panic(fmt.Sprintf("invalid material signature %q", signature))
+	}
+
+	return pairKey(mustParseSideKey(signature, first), mustParseSideKey(signature, second))
+}
+
+func mustParseSideKey(signature, side string) key {
+	var counts [len(pieceLetters)]int
+
+	for _, r := range side {
+		i := slices.IndexFunc(pieceLetters[:], func(p pieceLetter) bool { return p.letter == string(r) })
+		if i < 0 || counts[i] == maxCount {
+			panic(fmt.Sprintf("invalid material signature %q", signature))
+		}
+
+		counts[i]++
+	}
+
+	var ret key
+
+	for _, count := range counts {
+		ret = ret<<countBits | key(count)
+	}
+
+	return ret
+}
+
+// pieces returns the given side's pieces of one type, where the type is the offset from the pawn.
+func pieces(pos *position.Position, colour piece.Colour, offset piece.Piece) bb.Bitboard {
+	if colour == piece.White {
+		return pos.Occupancy[piece.Wp+offset]
+	}
+
+	return pos.Occupancy[piece.Bp+offset]
+}
+
+// distance returns the number of king moves between two squares.
+func distance(a, b sq.Square) int {
+	return max(abs(int(a/8)-int(b/8)), abs(int(a%8)-int(b%8)))
+}
+
+// centreDistance returns how far a square is from the four centre squares, counting files and
+// ranks separately, so that it is 0 in the centre and 6 in the corners.
+func centreDistance(square sq.Square) int {
+	row, col := int(square/8), int(square%8)
+
+	return max(3-row, row-4) + max(3-col, col-4)
+}
+
+// isDark reports whether a square is a dark square. a1 is dark, and a8 is light.
+func isDark(square sq.Square) bool {
+	return (square/8+square%8)%2 == 1
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,209 @@
+package endgame_test
+
+import (
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func evaluate(t *testing.T, fen string) (int, string) {
+	t.Helper()
+
+	pos, err := position.NewPositionFromFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score, signature, ok := endgame.Default.Evaluate(pos)
+	if !ok {
+		t.Fatalf("no evaluation for %s", endgame.Signature(pos))
+	}
+
+	return score, signature
+}
+
+func TestSignature(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fen  string
+		want string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "KQRRBBNNPPPPPPPPvKQRRBBNNPPPPPPPP"},
+		{"8/8/8/8/4N3/2K1B3/8/k7 w - - 0 1", "KBNvK"},
+		{"8/8/8/8/4p3/4k3/8/R3K3 b - - 0 1", "KRvKP"},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := endgame.Signature(pos); got != tt.want {
+			t.Errorf("signature of %s is %s, want %s", tt.fen, got, tt.want)
+		}
+	}
+}
+
+func TestKPK(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		fen  string
+		win  bool
+	}{
+		{"defending king in front", "8/8/8/8/8/4k3/4P3/4K3 w - - 0 1", false},
+		{"king on the sixth in front of the pawn", "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", true},
+		{"rook pawn", "7k/8/8/8/8/8/7P/7K w - - 0 1", false},
+		{"outside the square", "8/8/8/8/8/k7/6P1/6K1 b - - 0 1", true},
+		{"pawn falls", "8/8/8/8/8/8/3kP3/7K b - - 0 1", false},
+		{"black pawn", "8/8/8/8/4p3/4k3/8/4K3 b - - 0 1", true},
+		{"black rook pawn", "7k/p7/8/8/8/8/8/K7 w - - 0 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			score, signature := evaluate(t, tt.fen)
+
+			if signature != "KPvK" {
+				t.Errorf("evaluated as %s, want KPvK", signature)
+			}
+
+			if got := score > endgame.KnownWin || score < -endgame.KnownWin; got != tt.win {
+				t.Errorf("score %d, want win: %v", score, tt.win)
+			}
+
+			if !tt.win && score != 0 {
+				t.Errorf("drawn position scored %d", score)
+			}
+		})
+	}
+}
+
+func TestKBNKDrivesToBishopCorner(t *testing.T) {
+	t.Parallel()
+
+	// The bishop is on the dark squares, so a1 is the right corner and a8 the wrong one.
+	right, _ := evaluate(t, "8/8/8/8/4N3/2K1B3/8/k7 w - - 0 1")
+	wrong, _ := evaluate(t, "k7/8/2K5/8/4N3/4B3/8/8 w - - 0 1")
+
+	if right <= wrong {
+		t.Errorf("right corner scored %d, wrong corner scored %d", right, wrong)
+	}
+
+	if wrong <= endgame.KnownWin {
+		t.Errorf("KBNK scored %d, want a known win", wrong)
+	}
+}
+
+func TestMopUp(t *testing.T) {
+	t.Parallel()
+
+	centre, _ := evaluate(t, "8/8/8/3k4/8/8/8/KQ6 w - - 0 1")
+	edge, _ := evaluate(t, "3k4/8/8/8/8/8/8/KQ6 w - - 0 1")
+	blackToMove, _ := evaluate(t, "3k4/8/8/8/8/8/8/KQ6 b - - 0 1")
+
+	if centre <= endgame.KnownWin {
+		t.Errorf("KQK scored %d, want a known win", centre)
+	}
+
+	if edge <= centre {
+		t.Errorf("king on the edge scored %d, king in the centre scored %d", edge, centre)
+	}
+
+	if blackToMove != -edge {
+		t.Errorf("black to move scored %d, want %d", blackToMove, -edge)
+	}
+}
+
+func TestKRKP(t *testing.T) {
+	t.Parallel()
+
+	// The white king stands in front of the pawn.
+	won, _ := evaluate(t, "8/8/8/8/4p3/8/4K1k1/R7 w - - 0 1")
+	// The pawn is about to queen with its king beside it and the white king far away.
+	drawish, _ := evaluate(t, "K7/8/8/8/8/8/4pk2/R7 w - - 0 1")
+
+	if won < 400 {
+		t.Errorf("KRKP with the king in front of the pawn scored %d", won)
+	}
+
+	if drawish > 100 {
+		t.Errorf("KRKP with an advanced, supported pawn scored %d", drawish)
+	}
+}
+
+func TestScale(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		fen  string
+		want int
+	}{
+		{"wrong bishop", "k7/8/8/8/8/8/P7/K1B5 w - - 0 1", 0},
+		{"right bishop", "k7/8/8/8/8/8/P7/KB6 w - - 0 1", endgame.ScaleNormal},
+		{"wrong bishop, king too far", "8/8/8/k7/8/8/P7/K1B5 w - - 0 1", endgame.ScaleNormal},
+		{"opposite bishops", "8/4k3/8/4b3/8/2PB4/1P6/4K3 w - - 0 1", 32},
+		{"same coloured bishops", "8/4k3/8/3b4/8/2PB4/1P6/4K3 w - - 0 1", endgame.ScaleNormal},
+		{"no scaling", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", endgame.ScaleNormal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := endgame.Default.Scale(pos); got != tt.want {
+				t.Errorf("scale %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// AllocsPerRun can't be called from a parallel test.
+func TestLookupDoesNotAllocate(t *testing.T) { //nolint:paralleltest
+	for _, fen := range []string{
+		"8/8/8/8/4N3/2K1B3/8/k7 w - - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	} {
+		pos, err := position.NewPositionFromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		allocs := testing.AllocsPerRun(100, func() {
+			endgame.Default.Evaluate(pos)
+			endgame.Default.Scale(pos)
+		})
+
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per lookup, want none", fen, allocs)
+		}
+	}
+}
+
+func TestAddEvalRejectsInvalidSignature(t *testing.T) {
+	t.Parallel()
+
+	for _, signature := range []string{"KQK", "KXvK", "KPPPPPPPPPPPPPPPPvK"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s accepted", signature)
+				}
+			}()
+
+			endgame.NewRegistry().AddEval(signature, nil)
+		}()
+	}
+}
@@ -0,0 +1,223 @@
+package endgame
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// Default is the registry used by the evaluator, holding every ending this package knows about.
+var Default = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	ret := NewRegistry()
+
+	for _, signature := range []string{"KvK", "KNvK", "KBvK", "KNNvK"} {
+		ret.AddEval(signature, draw)
+	}
+
+	for _, signature := range []string{
+		"KQvK", "KRvK", "KQQvK", "KQRvK", "KRRvK", "KQBvK", "KQNvK", "KRBvK", "KRNvK",
+	} {
+		ret.AddEval(signature, mopUp)
+	}
+
+	ret.AddEval("KBBvK", evaluateKBBK)
+	ret.AddEval("KBNvK", evaluateKBNK)
+	ret.AddEval("KPvK", evaluateKPK)
+	ret.AddEval("KRvKP", evaluateKRKP)
+
+	ret.AddScale("KBPvK", scaleWrongBishop)
+	ret.AddScale("KBPvKB", scaleOppositeBishops)
+	ret.AddScale("KBPvKBP", scaleOppositeBishops)
+
+	return ret
+}
+
+// Piece values used to make won endings with more material score higher, so that the search
+// prefers keeping material to giving it away.
+var pieceValues = [6]int{100, 300, 320, 500, 900, 0}
+
+const (
+	pawnValue = 100
+	rookValue = 500
+)
+
+func draw(*position.Position, piece.Colour) int {
+	return 0
+}
+
+// mopUp scores an ending the strong side wins with ease. The weak king is driven to the edge of the
+// board and the strong king brought up to help mate it.
+func mopUp(pos *position.Position, strong piece.Colour) int {
+	strongKing, weakKing := kingSquare(pos, strong), kingSquare(pos, strong^1)
+
+	return KnownWin + materialValue(pos, strong) + 20*centreDistance(weakKing) + pushClose(strongKing, weakKing)
+}
+
+// evaluateKBBK is a win with bishops on opposite colours and a draw otherwise.
+func evaluateKBBK(pos *position.Position, strong piece.Colour) int {
+	bishops := pieces(pos, strong, piece.Wb-piece.Wp)
+
+	dark := 0
+
+	for bishops != 0 {
+		square := bb.LSBIndex(bishops)
+		bishops = bb.ClearBit(bishops, square)
+
+		if isDark(square) {
+			dark++
+		}
+	}
+
+	if dark != 1 {
+		return 0
+	}
+
+	return mopUp(pos, strong)
+}
+
+// evaluateKBNK drives the weak king towards one of the two corners the bishop controls, which is
+// the only place mate can be forced.
+func evaluateKBNK(pos *position.Position, strong piece.Colour) int {
+	strongKing, weakKing := kingSquare(pos, strong), kingSquare(pos, strong^1)
+	bishop := bb.LSBIndex(pieces(pos, strong, piece.Wb-piece.Wp))
+
+	corners := [2]sq.Square{sq.A8, sq.H1}
+	if isDark(bishop) {
+		corners = [2]sq.Square{sq.A1, sq.H8}
+	}
+
+	cornerDistance := min(distance(weakKing, corners[0]), distance(weakKing, corners[1]))
+
+	return KnownWin + materialValue(pos, strong) + 30*(7-cornerDistance) + 5*centreDistance(weakKing) +
+		pushClose(strongKing, weakKing)
+}
+
+// evaluateKPK probes the bitbase, scoring wins by how far the pawn has advanced and everything else
+// as a draw.
+func evaluateKPK(pos *position.Position, strong piece.Colour) int {
+	strongKing := relative(strong, kingSquare(pos, strong))
+	weakKing := relative(strong, kingSquare(pos, strong^1))
+	pawn := relative(strong, bb.LSBIndex(pieces(pos, strong, 0)))
+
+	if !ProbeKPK(strongToMove(pos, strong), strongKing, pawn, weakKing) {
+		return 0
+	}
+
+	return KnownWin + pawnValue + 10*pawn.Rank()
+}
+
+// evaluateKRKP is usually a win for the rook, but a pawn which is far advanced and supported by its
+// king while the strong king is far away can hold the draw. The rules follow the usual ones for
+// this ending: the strong side wins if its king is in front of the pawn, or if the weak king is too
+// far from both the pawn and the rook; the position is drawish if the pawn has reached its last
+// three ranks with the king beside it and the strong king cut off; otherwise the score depends on
+// the race between the kings.
+func evaluateKRKP(pos *position.Position, strong piece.Colour) int {
+	// From the strong side's point of view the pawn runs down the board, towards row 7.
+	strongKing := relative(strong, kingSquare(pos, strong))
+	weakKing := relative(strong, kingSquare(pos, strong^1))
+	rook := relative(strong, bb.LSBIndex(pieces(pos, strong, piece.Wr-piece.Wp)))
+	pawn := relative(strong, bb.LSBIndex(pieces(pos, strong^1, 0)))
+
+	queening := sq.Square(byte(56 + pawn%8))
+	toMove := strongToMove(pos, strong)
+
+	weakTempo, strongTempo := 0, 1
+	if !toMove {
+		weakTempo, strongTempo = 1, 0
+	}
+
+	switch {
+	case strongKing%8 == pawn%8 && strongKing > pawn:
+		return rookValue - distance(strongKing, pawn)
+	case distance(weakKing, pawn) >= 3+weakTempo && distance(weakKing, rook) >= 3:
+		return rookValue - distance(strongKing, pawn)
+	case weakKing/8 >= 5 && distance(weakKing, pawn) == 1 && strongKing/8 <= 4 &&
+		distance(strongKing, pawn) > 2+strongTempo:
+		return 80 - 8*distance(strongKing, pawn)
+	default:
+		ahead := pawn + 8
+
+		return 200 - 8*(distance(strongKing, ahead)-distance(weakKing, ahead)-distance(pawn, queening))
+	}
+}
+
+// scaleWrongBishop recognises the draw where every pawn is on one rook file, the bishop can't
+// control the queening square and the weak king has reached it.
+func scaleWrongBishop(pos *position.Position, strong piece.Colour) int {
+	pawns := pieces(pos, strong, 0)
+	file := bb.LSBIndex(pawns) % 8
+
+	if file != 0 && file != 7 {
+		return ScaleNormal
+	}
+
+	for pawns != 0 {
+		square := bb.LSBIndex(pawns)
+		pawns = bb.ClearBit(pawns, square)
+
+		if square%8 != file {
+			return ScaleNormal
+		}
+	}
+
+	queening := relative(strong, file)
+	bishop := bb.LSBIndex(pieces(pos, strong, piece.Wb-piece.Wp))
+
+	if isDark(bishop) != isDark(queening) && distance(kingSquare(pos, strong^1), queening) <= 1 {
+		return 0
+	}
+
+	return ScaleNormal
+}
+
+// scaleOppositeBishops scales down endings with bishops on opposite colours and nothing but pawns,
+// which are hard to win unless one side is several pawns up.
+func scaleOppositeBishops(pos *position.Position, strong piece.Colour) int {
+	strongBishop := bb.LSBIndex(pieces(pos, strong, piece.Wb-piece.Wp))
+	weakBishop := bb.LSBIndex(pieces(pos, strong^1, piece.Wb-piece.Wp))
+
+	if isDark(strongBishop) == isDark(weakBishop) {
+		return ScaleNormal
+	}
+
+	pawnDifference := abs(bb.CountBits(pieces(pos, strong, 0)) - bb.CountBits(pieces(pos, strong^1, 0)))
+
+	return min(16+8*pawnDifference, ScaleNormal)
+}
+
+func kingSquare(pos *position.Position, colour piece.Colour) sq.Square {
+	return bb.LSBIndex(pieces(pos, colour, piece.Wk-piece.Wp))
+}
+
+func materialValue(pos *position.Position, colour piece.Colour) int {
+	ret := 0
+
+	for offset, value := range pieceValues {
+		ret += value * bb.CountBits(pieces(pos, colour, piece.Piece(offset)))
+	}
+
+	return ret
+}
+
+// pushClose rewards bringing the kings together.
+func pushClose(a, b sq.Square) int {
+	return 10 * (7 - distance(a, b))
+}
+
+// relative returns the square as seen by the given side, flipping the board vertically for black,
+// so that endings can be written once with the strong side playing up the board.
+func relative(colour piece.Colour, square sq.Square) sq.Square {
+	if colour == piece.White {
+		return square
+	}
+
+	return square ^ 56
+}
+
+func strongToMove(pos *position.Position, strong piece.Colour) bool {
+	return pos.WhiteToMove == (strong == piece.White)
+}
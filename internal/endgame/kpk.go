@@ -0,0 +1,251 @@
+package endgame
+
+import (
+	"sync"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// The KPK bitbase records, for every position with a white king, a white pawn and a black king,
+// whether white wins. Positions are mirrored so that the pawn is on files a to d, which leaves 24
+// pawn squares, and the index is built from the side to move, the pawn square and both king
+// squares.
+const kpkSize = 2 * 24 * 64 * 64
+
+var (
+	kpkOnce sync.Once
+	kpkWins [kpkSize / 64]uint64
+)
+
+const (
+	kpkUnknown uint8 = iota
+	kpkInvalid
+	kpkDraw
+	kpkWin
+)
+
+// ProbeKPK reports whether white wins the position with the given king and pawn squares. The
+// bitbase is generated the first time it is probed.
+func ProbeKPK(whiteToMove bool, whiteKing, pawn, blackKing sq.Square) bool {
+	kpkOnce.Do(generateKPK)
+
+	if pawn%8 > 3 {
+		whiteKing ^= 7
+		pawn ^= 7
+		blackKing ^= 7
+	}
+
+	index := kpkIndex(whiteToMove, whiteKing, pawn, blackKing)
+
+	return kpkWins[index/64]&(1<<(index%64)) != 0
+}
+
+// kpkIndex returns the bitbase index of a position whose pawn is on files a to d and ranks 2 to 7.
+func kpkIndex(whiteToMove bool, whiteKing, pawn, blackKing sq.Square) int {
+	stm := 0
+	if !whiteToMove {
+		stm = 1
+	}
+
+	// Ranks 7 down to 2 are rows 1 to 6.
+	pawnIndex := (int(pawn/8)-1)*4 + int(pawn%8)
+
+	return ((stm*24+pawnIndex)*64+int(whiteKing))*64 + int(blackKing)
+}
+
+func decodeKPK(index int) (bool, sq.Square, sq.Square, sq.Square) {
+	blackKing := sq.Square(byte(index % 64))
+	index /= 64
+	whiteKing := sq.Square(byte(index % 64))
+	index /= 64
+	pawnIndex := index % 24
+	whiteToMove := index/24 == 0
+
+	pawn := sq.Square(byte((pawnIndex/4+1)*8 + pawnIndex%4))
+
+	return whiteToMove, whiteKing, pawn, blackKing
+}
+
+// generateKPK fills the bitbase by retrograde analysis. Every position is first classified from
+// its own features where it can be: illegal positions, safe promotions, stalemates and undefended
+// pawns. The rest are then resolved from their successors, over and over until nothing changes.
+// With white to move, a position is won if any move reaches a won position and drawn once every
+// move reaches a drawn one; with black to move, it is the other way round. Anything still unknown
+// at the end is a position white cannot force a win from, so it is a draw.
+func generateKPK() {
+	results := make([]uint8, kpkSize)
+
+	for index := range kpkSize {
+		results[index] = classifyKPK(index)
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		for index, result := range results {
+			if result != kpkUnknown {
+				continue
+			}
+
+			if result = resolveKPK(index, results); result != kpkUnknown {
+				results[index] = result
+				changed = true
+			}
+		}
+	}
+
+	for index, result := range results {
+		if result == kpkWin {
+			kpkWins[index/64] |= 1 << (index % 64)
+		}
+	}
+}
+
+func classifyKPK(index int) uint8 {
+	whiteToMove, whiteKing, pawn, blackKing := decodeKPK(index)
+
+	if distance(whiteKing, blackKing) <= 1 || whiteKing == pawn || blackKing == pawn {
+		return kpkInvalid
+	}
+
+	if whiteToMove {
+		// Black can't be in check with white to move.
+		if bb.GetBit(whitePawnAttacks(pawn), blackKing) {
+			return kpkInvalid
+		}
+
+		// A pawn on the seventh promotes if the square in front is free and the black king can't
+		// take the new queen.
+		if pawn/8 == 1 {
+			promotion := pawn - 8
+			if promotion != whiteKing && promotion != blackKing &&
+				(distance(blackKing, promotion) > 1 || distance(whiteKing, promotion) == 1) {
+				return kpkWin
+			}
+		}
+
+		return kpkUnknown
+	}
+
+	safe := kingMoves(blackKing) &^ kingMoves(whiteKing) &^ whitePawnAttacks(pawn)
+
+	if safe == 0 && !bb.GetBit(whitePawnAttacks(pawn), blackKing) {
+		return kpkDraw
+	}
+
+	if bb.GetBit(safe, pawn) {
+		return kpkDraw
+	}
+
+	return kpkUnknown
+}
+
+func resolveKPK(index int, results []uint8) uint8 {
+	whiteToMove, whiteKing, pawn, blackKing := decodeKPK(index)
+
+	if !whiteToMove {
+		allWon := true
+
+		moves := kingMoves(blackKing) &^ kingMoves(whiteKing) &^ whitePawnAttacks(pawn)
+
+		for moves != 0 {
+			target := bb.LSBIndex(moves)
+			moves = bb.ClearBit(moves, target)
+
+			switch results[kpkIndex(true, whiteKing, pawn, target)] {
+			case kpkDraw:
+				return kpkDraw
+			case kpkWin:
+			default:
+				allWon = false
+			}
+		}
+
+		if allWon {
+			return kpkWin
+		}
+
+		return kpkUnknown
+	}
+
+	var successors []int
+
+	moves := kingMoves(whiteKing)
+
+	for moves != 0 {
+		target := bb.LSBIndex(moves)
+		moves = bb.ClearBit(moves, target)
+
+		if target != pawn {
+			successors = append(successors, kpkIndex(false, target, pawn, blackKing))
+		}
+	}
+
+	// Promotions were dealt with by classifyKPK, so only pushes to the sixth rank and below are
+	// left.
+	if push := pawn - 8; pawn/8 > 1 && push != whiteKing && push != blackKing {
+		successors = append(successors, kpkIndex(false, whiteKing, push, blackKing))
+
+		if double := push - 8; pawn/8 == 6 && double != whiteKing && double != blackKing {
+			successors = append(successors, kpkIndex(false, whiteKing, double, blackKing))
+		}
+	}
+
+	allDrawn := true
+
+	for _, successor := range successors {
+		switch results[successor] {
+		case kpkWin:
+			return kpkWin
+		case kpkDraw, kpkInvalid:
+		default:
+			allDrawn = false
+		}
+	}
+
+	if allDrawn {
+		return kpkDraw
+	}
+
+	return kpkUnknown
+}
+
+// kingMoves returns the squares a king on the given square attacks. It is worked out here rather
+// than taken from the move generator so that the bitbase doesn't depend on its lookup tables
+// having been initialised.
+func kingMoves(square sq.Square) bb.Bitboard {
+	var ret bb.Bitboard
+
+	row, col := int(square/8), int(square%8)
+
+	for dr := -1; dr <= 1; dr++ {
+		for dc := -1; dc <= 1; dc++ {
+			r, c := row+dr, col+dc
+			if (dr != 0 || dc != 0) && r >= 0 && r < 8 && c >= 0 && c < 8 {
+				ret = bb.SetBit(ret, sq.Square(byte(r*8+c)))
+			}
+		}
+	}
+
+	return ret
+}
+
+// whitePawnAttacks returns the squares attacked by a white pawn on the given square.
+func whitePawnAttacks(square sq.Square) bb.Bitboard {
+	var ret bb.Bitboard
+
+	if square < 8 {
+		return ret
+	}
+
+	if square%8 > 0 {
+		ret = bb.SetBit(ret, square-9)
+	}
+
+	if square%8 < 7 {
+		ret = bb.SetBit(ret, square-7)
+	}
+
+	return ret
+}
@@ -1,10 +1,13 @@
 package engine
 
 import (
-	"log"
+	"fmt"
+	"os"
 
-	"github.com/samwestmoreland/chessengine/internal/movegen"
-	"github.com/samwestmoreland/chessengine/internal/position"
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/nnue"
+	"github.com/samwestmoreland/chessengine/internal/polyglot"
+	"github.com/samwestmoreland/chessengine/internal/syzygy"
 )
 
 type Engine struct {
@@ -12,23 +15,118 @@ type Engine struct {
 	Depth int
 	// The maximum search depth.
 	MaxDepth int
-	// evaluator eval.Evaluator
+	// Tablebases, if set, are probed during the search.
+	Tablebases *syzygy.Tablebases
+	// Book, if set, is played from before searching, choosing the most heavily weighted move if
+	// BestBookMove is set and a weighted random one otherwise.
+	Book         *polyglot.Book
+	BestBookMove bool
+	evaluator    eval.Evaluator
+	// weights are the parameters the hand-crafted evaluator uses, or nil for the defaults.
+	weights *eval.Weights
 }
 
 func NewEngine() (*Engine, error) {
 	return &Engine{
-		Depth:    0,
-		MaxDepth: 1,
-		// evaluator: eval.ShannonEvaluator{},
+		Depth:     0,
+		MaxDepth:  64,
+		evaluator: eval.ShannonEvaluator{},
 	}, nil
 }
 
-func (e *Engine) Search(pos *position.Position) string {
-	moves := movegen.GetLegalMoves(pos)
+// SetNNUE switches between the hand-crafted evaluator and NNUE. The network is read from the file at
+// the given path, or is the one built in if the path is empty or the UCI default of "<empty>".
+func (e *Engine) SetNNUE(enabled bool, path string) error {
+	if !enabled {
+		e.evaluator = eval.ShannonEvaluator{Weights: e.weights}
 
-	numMoves := len(moves)
+		return nil
+	}
 
-	log.Println("Number of moves:", numMoves)
+	net := nnue.DefaultNetwork()
 
-	return moves[0].String()
+	if path != "" && path != "<empty>" {
+		var err error
+
+		net, err = nnue.LoadNetworkFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to load network: %w", err)
+		}
+	}
+
+	e.evaluator = nnue.NewEvaluator(net)
+
+	return nil
+}
+
+// SetEvalWeights reads the hand-crafted evaluator's weights from the JSON file at the given path, as
+// written by cmd/tune. An empty path, or the UCI default of "<empty>", goes back to the default
+// weights. The weights take effect whenever NNUE is off.
+func (e *Engine) SetEvalWeights(path string) error {
+	var weights *eval.Weights
+
+	if path != "" && path != "<empty>" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open weights: %w", err)
+		}
+		defer file.Close()
+
+		weights, err = eval.LoadWeights(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.weights = weights
+
+	if _, ok := e.evaluator.(eval.ShannonEvaluator); ok {
+		e.evaluator = eval.ShannonEvaluator{Weights: weights}
+	}
+
+	return nil
+}
+
+// SetSyzygyPath opens the tablebases in the given directories, which are separated as in the PATH
+// environment variable. An empty path, or the UCI default of "<empty>", turns probing off.
+func (e *Engine) SetSyzygyPath(path string) error {
+	if path == "" || path == "<empty>" {
+		e.Tablebases = nil
+
+		return nil
+	}
+
+	tb, err := syzygy.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tablebases: %w", err)
+	}
+
+	e.Tablebases = tb
+
+	return nil
+}
+
+// SetBookFile opens the Polyglot opening book at the given path, closing any book already open. An
+// empty path, or the UCI default of "<empty>", turns the book off.
+func (e *Engine) SetBookFile(path string) error {
+	if e.Book != nil {
+		if err := e.Book.Close(); err != nil {
+			return fmt.Errorf("failed to close book: %w", err)
+		}
+
+		e.Book = nil
+	}
+
+	if path == "" || path == "<empty>" {
+		return nil
+	}
+
+	book, err := polyglot.Open(path)
+	if err != nil {
+		return err
+	}
+
+	e.Book = book
+
+	return nil
 }
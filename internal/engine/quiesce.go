@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// Quiesce searches captures from the given position until it reaches quiet positions, so that the
+// static evaluation is not fooled by pieces that are about to be taken. It returns the score from
+// the side to move's point of view together with the quiet position at the end of the principal
+// variation.
+func Quiesce(pos *position.Position, alpha, beta int, evaluator eval.Evaluator) (int, *position.Position) {
+	s := &searcher{evaluator: evaluator, leaves: true}
+
+	score, leaf := s.quiesce(pos, alpha, beta, 0)
+	ret := *leaf
+
+	return score, &ret
+}
+
+// quiesce is Quiesce within a search, which counts its nodes and can stop it. The leaf it returns is
+// only meaningful if the searcher keeps leaves, and only valid until the caller makes its next
+// move.
+func (s *searcher) quiesce(pos *position.Position, alpha, beta, ply int) (int, *position.Position) {
+	if s.stop() {
+		return 0, pos
+	}
+
+	s.nodes++
+
+	if result, over := movegen.VariantResult(pos); over {
+		return resultScore(result, ply), pos
+	}
+
+	standPat := s.evaluator.Evaluate(pos)
+	if standPat >= beta || ply >= maxPly-1 {
+		return standPat, pos
+	}
+
+	f := s.frame(ply)
+	leaf := pos
+	alpha = max(alpha, standPat)
+
+	for _, m := range orderCaptures(pos, captures(pos, &f.moves)) {
+		score, childLeaf := s.quiesce(s.makeMove(pos, m, ply), -beta, -alpha, ply+1)
+		score = -score
+
+		s.unmakeMove()
+
+		if s.stopped {
+			return 0, pos
+		}
+
+		if score >= beta {
+			return score, childLeaf
+		}
+
+		if score > alpha {
+			alpha = score
+
+			if s.leaves {
+				f.leaf = *childLeaf
+				leaf = &f.leaf
+			}
+		}
+	}
+
+	return alpha, leaf
+}
+
+// captures fills the list with the legal moves and returns the captures among them.
+func captures(pos *position.Position, list *movegen.MoveList) []move.Move {
+	movegen.GenerateLegalMoves(pos, list)
+
+	ret := list.Moves[:0]
+
+	for _, m := range list.Slice() {
+		if m.IsCapture() || m.IsEnPassant() {
+			ret = append(ret, m)
+		}
+	}
+
+	return ret
+}
+
+// pieceValues are rough piece values indexed by piece, used for ordering captures.
+var pieceValues = [piece.Bk + 1]int{
+	piece.Wp: 100, piece.Wn: 320, piece.Wb: 330, piece.Wr: 500, piece.Wq: 900, piece.Wk: 20000,
+	piece.Bp: 100, piece.Bn: 320, piece.Bb: 330, piece.Br: 500, piece.Bq: 900, piece.Bk: 20000,
+}
+
+// orderCaptures sorts captures in place so that the most valuable victims come first, and of those,
+// the ones taken by the least valuable attackers.
+func orderCaptures(pos *position.Position, moves []move.Move) []move.Move {
+	slices.SortStableFunc(moves, func(a, b move.Move) int {
+		return cmp.Compare(captureScore(pos, b), captureScore(pos, a))
+	})
+
+	return moves
+}
+
+// captureScore is the score a capture is ordered by, higher first.
+func captureScore(pos *position.Position, m move.Move) int {
+	victim := pos.PieceAt(m.Target())
+	if m.IsEnPassant() {
+		victim = piece.Wp
+	}
+
+	return pieceValues[victim]*10 - pieceValues[m.Piece()]/100
+}
@@ -0,0 +1,80 @@
+package engine_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestQuiesce(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		fen     string
+		leafFEN string
+	}{
+		{
+			name:    "quiet position is its own leaf",
+			fen:     "4k3/8/8/8/8/8/8/3QK3 w - - 0 1",
+			leafFEN: "4k3/8/8/8/8/8/8/3QK3 w - - 0 1",
+		},
+		{
+			name:    "hanging rook is taken",
+			fen:     "4k3/8/8/8/3r4/8/8/3QK3 w - - 0 1",
+			leafFEN: "4k3/8/8/8/3Q4/8/8/4K3 b - - 0 1",
+		},
+		{
+			name:    "defended pawn is not taken by the queen",
+			fen:     "4k3/8/2p5/3p4/8/8/8/3QK3 w - - 0 1",
+			leafFEN: "4k3/8/2p5/3p4/8/8/8/3QK3 w - - 0 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := position.NewPositionFromFEN(tt.leafFEN)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			evaluator := eval.ShannonEvaluator{}
+
+			score, leaf := engine.Quiesce(pos, -100000, 100000, evaluator)
+
+			for i := range want.Occupancy {
+				if leaf.Occupancy[i] != want.Occupancy[i] || leaf.WhiteToMove != want.WhiteToMove {
+					t.Fatalf("quiescence search ended in the wrong position")
+				}
+			}
+
+			leafScore := evaluator.Evaluate(leaf)
+			if leaf.WhiteToMove != pos.WhiteToMove {
+				leafScore = -leafScore
+			}
+
+			if score != leafScore {
+				t.Errorf("got score %d, but the leaf evaluates to %d", score, leafScore)
+			}
+		})
+	}
+}
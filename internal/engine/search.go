@@ -0,0 +1,457 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	"github.com/samwestmoreland/chessengine/internal/syzygy"
+)
+
+const (
+	// MateScore is the score of being mated at the root. Being mated n plies from the root scores
+	// -MateScore+n, so that shorter mates are preferred.
+	MateScore = 32000
+
+	maxPly = 128
+
+	// tbWinScore is the score of a tablebase win, below any mate the search can find so that a
+	// real mate is still preferred.
+	tbWinScore = MateScore - 2*maxPly
+
+	infinity = MateScore + 1
+
+	// checkInterval is how many nodes are searched between checks of the clock and the context.
+	checkInterval = 1024
+)
+
+// Limits controls how long a search runs. A zero field means no limit of that kind; with no
+// limits at all, the search runs to the engine's maximum depth.
+type Limits struct {
+	Depth    int
+	Nodes    uint64
+	MoveTime time.Duration
+
+	// The remaining time and increment of each side, and the number of moves until the next time
+	// control, as given by the UCI go command.
+	WhiteTime time.Duration
+	BlackTime time.Duration
+	WhiteInc  time.Duration
+	BlackInc  time.Duration
+	MovesToGo int
+
+	// Infinite ignores every other limit, so the search only stops when its context is cancelled.
+	Infinite bool
+}
+
+// Info describes a completed iteration of the search.
+type Info struct {
+	Depth  int
+	Score  int
+	Nodes  uint64
+	TBHits uint64
+	Time   time.Duration
+	PV     []move.Move
+}
+
+// MateIn returns the number of moves until mate for a mate score, negative if the side to move is
+// being mated, and false if the score is not a mate score.
+func MateIn(score int) (int, bool) {
+	switch {
+	case score > MateScore-maxPly:
+		return (MateScore - score + 1) / 2, true
+	case score < -MateScore+maxPly:
+		return -(MateScore + score) / 2, true
+	default:
+		return 0, false
+	}
+}
+
+type searcher struct {
+	ctx    context.Context
+	limits Limits
+	engine *Engine
+	// evaluator scores quiet positions, and incremental is the same evaluator if it keeps a stack
+	// of positions, which the search pushes each position it reaches onto.
+	evaluator   eval.Evaluator
+	incremental eval.Incremental
+	start       time.Time
+	deadline    time.Time
+	nodes       uint64
+	tbHits      uint64
+	iterations  int
+	stopped     bool
+	// frames holds the moves of each ply and the positions they lead to, so that the search doesn't
+	// allocate as it goes. It grows as the search reaches new depths.
+	frames []*frame
+	// leaves is set when the caller wants the quiet positions quiescence search ends in, which are
+	// then copied out of the frames before the next move overwrites them.
+	leaves bool
+}
+
+// frame is the state of one ply of the search.
+type frame struct {
+	moves movegen.MoveList
+	// child is the position reached by the move being searched.
+	child position.Position
+	// leaf is the quiet position at the end of the best line found so far, if the searcher keeps
+	// leaves.
+	leaf position.Position
+}
+
+// Search searches the position by iterative deepening until the limits are reached or the context
+// is cancelled, calling report, if it is not nil, after each completed iteration. It returns the
+// best move found, or the zero move if the position has no legal moves. The first iteration always
+// completes, so there is a move to play however short the time.
+//
+// If the engine has a book with a move for the position, that move is returned straight away
+// without searching, unless the search is infinite, which is taken to mean analysis. Books are of
+// standard chess, so they aren't used in other variants.
+func (e *Engine) Search(ctx context.Context, pos *position.Position, limits Limits, report func(Info)) move.Move {
+	if e.Book != nil && !limits.Infinite && pos.Variant == position.Standard {
+		// A book that can't be read is no worse than no book, so errors fall through to the search.
+		if m, ok, err := e.Book.Pick(pos, e.BestBookMove); err == nil && ok {
+			return m
+		}
+	}
+
+	s := &searcher{
+		ctx:       ctx,
+		limits:    limits,
+		engine:    e,
+		evaluator: e.evaluator,
+		start:     time.Now(),
+	}
+
+	budget := s.budget(pos)
+	if budget > 0 {
+		s.deadline = s.start.Add(budget)
+	}
+
+	if incremental, ok := e.evaluator.(eval.Incremental); ok {
+		s.incremental = incremental
+
+		incremental.Push(pos)
+		defer incremental.Pop()
+	}
+
+	rootMoves := s.rootMoves(pos)
+	if len(rootMoves) == 0 {
+		return 0
+	}
+
+	maxDepth := e.MaxDepth
+	if limits.Depth > 0 && !limits.Infinite {
+		maxDepth = min(maxDepth, limits.Depth)
+	}
+
+	best := rootMoves[0]
+
+	for depth := 1; depth <= maxDepth; depth++ {
+		e.Depth = depth
+
+		score, pv := s.root(pos, rootMoves, depth)
+		if s.stopped {
+			break
+		}
+
+		s.iterations++
+
+		if len(pv) > 0 {
+			best = pv[0]
+
+			// Search the best move first next time.
+			for i, m := range rootMoves {
+				if m == best {
+					copy(rootMoves[1:i+1], rootMoves[:i])
+					rootMoves[0] = best
+
+					break
+				}
+			}
+		}
+
+		if report != nil {
+			report(Info{
+				Depth:  depth,
+				Score:  score,
+				Nodes:  s.nodes,
+				TBHits: s.tbHits,
+				Time:   time.Since(s.start),
+				PV:     pv,
+			})
+		}
+
+		// Another iteration takes several times as long as the last, so don't start one that won't
+		// finish.
+		if !s.deadline.IsZero() && time.Since(s.start) > budget/2 {
+			break
+		}
+	}
+
+	return best
+}
+
+// budget returns how long to spend on a move, or zero for no time limit.
+func (s *searcher) budget(pos *position.Position) time.Duration {
+	if s.limits.Infinite {
+		return 0
+	}
+
+	if s.limits.MoveTime > 0 {
+		return s.limits.MoveTime
+	}
+
+	remaining, inc := s.limits.WhiteTime, s.limits.WhiteInc
+	if !pos.WhiteToMove {
+		remaining, inc = s.limits.BlackTime, s.limits.BlackInc
+	}
+
+	if remaining <= 0 {
+		return 0
+	}
+
+	movesToGo := s.limits.MovesToGo
+	if movesToGo <= 0 {
+		movesToGo = 30
+	}
+
+	// Keep a little in hand for communication overhead.
+	return min(remaining/time.Duration(movesToGo)+inc/2, remaining/2)
+}
+
+// rootMoves returns the legal moves to search. When the position is in the tablebases, only the
+// moves that keep the best result, taking the fifty-move rule into account, are kept, ordered so
+// that the quickest conversion is searched first.
+func (s *searcher) rootMoves(pos *position.Position) []move.Move {
+	moves := orderMoves(pos, movegen.GetLegalMoves(pos))
+
+	tb := s.engine.Tablebases
+	if tb == nil || !tb.Covers(pos) {
+		return moves
+	}
+
+	ranked, ok := tb.RankRootMoves(pos)
+	if !ok || len(ranked) == 0 {
+		return moves
+	}
+
+	s.tbHits += uint64(len(ranked))
+
+	moves = moves[:0]
+
+	for _, m := range ranked {
+		if m.Rank != ranked[0].Rank {
+			break
+		}
+
+		moves = append(moves, m.Move)
+	}
+
+	return moves
+}
+
+func (s *searcher) root(pos *position.Position, moves []move.Move, depth int) (int, []move.Move) {
+	alpha := -infinity
+
+	var pv []move.Move
+
+	for _, m := range moves {
+		score, line := s.negamax(s.makeMove(pos, m, 0), depth-1, 1, -infinity, -alpha)
+		score = -score
+
+		s.unmakeMove()
+
+		if s.stopped {
+			return 0, nil
+		}
+
+		if score > alpha {
+			alpha = score
+			pv = append([]move.Move{m}, line...)
+		}
+	}
+
+	return alpha, pv
+}
+
+func (s *searcher) negamax(pos *position.Position, depth, ply, alpha, beta int) (int, []move.Move) {
+	if s.stop() {
+		return 0, nil
+	}
+
+	s.nodes++
+
+	if result, over := movegen.VariantResult(pos); over {
+		return resultScore(result, ply), nil
+	}
+
+	f := s.frame(ply)
+
+	// The fifty-move rule draws the game, unless the move that reached it was mate.
+	if pos.HalfMoveClock >= 100 {
+		movegen.GenerateLegalMoves(pos, &f.moves)
+		if f.moves.Count == 0 {
+			return resultScore(movegen.NoMovesResult(pos), ply), nil
+		}
+
+		return 0, nil
+	}
+
+	if tb := s.engine.Tablebases; tb != nil && tb.Covers(pos) {
+		if wdl, ok := tb.ProbeWDL(pos); ok {
+			s.tbHits++
+
+			return tbScore(wdl, ply), nil
+		}
+	}
+
+	if depth <= 0 || ply >= maxPly-1 {
+		score, _ := s.quiesce(pos, alpha, beta, ply)
+
+		return score, nil
+	}
+
+	movegen.GenerateLegalMoves(pos, &f.moves)
+	if f.moves.Count == 0 {
+		return resultScore(movegen.NoMovesResult(pos), ply), nil
+	}
+
+	var pv []move.Move
+
+	for _, m := range orderMoves(pos, f.moves.Slice()) {
+		child := s.makeMove(pos, m, ply)
+
+		// Look further along forcing lines, so that the horizon doesn't hide a mate.
+		extension := 0
+		if movegen.InCheck(child) && ply < maxPly/2 {
+			extension = 1
+		}
+
+		score, line := s.negamax(child, depth-1+extension, ply+1, -beta, -alpha)
+		score = -score
+
+		s.unmakeMove()
+
+		if s.stopped {
+			return 0, nil
+		}
+
+		if score >= beta {
+			return score, nil
+		}
+
+		if score > alpha {
+			alpha = score
+			pv = append([]move.Move{m}, line...)
+		}
+	}
+
+	return alpha, pv
+}
+
+// frame returns the frame of the given ply.
+func (s *searcher) frame(ply int) *frame {
+	for len(s.frames) <= ply {
+		s.frames = append(s.frames, new(frame))
+	}
+
+	return s.frames[ply]
+}
+
+// makeMove returns the position a move made at the given ply leads to, pushing it onto the
+// evaluator's stack if it keeps one. The position belongs to the ply's frame, so it's only valid
+// until the next move is made there. Every call is matched by a call to unmakeMove once the
+// position has been searched.
+func (s *searcher) makeMove(pos *position.Position, m move.Move, ply int) *position.Position {
+	child := &s.frame(ply).child
+	movegen.MakeMoveInto(pos, child, m)
+
+	if s.incremental != nil {
+		s.incremental.Push(child)
+	}
+
+	return child
+}
+
+// unmakeMove pops the position the last move led to off the evaluator's stack.
+func (s *searcher) unmakeMove() {
+	if s.incremental != nil {
+		s.incremental.Pop()
+	}
+}
+
+// stop reports whether the search has run out of time or nodes, or has been cancelled. It only
+// looks at the clock every so often, and never stops the first iteration.
+func (s *searcher) stop() bool {
+	if s.stopped {
+		return true
+	}
+
+	if s.iterations == 0 || s.nodes%checkInterval != 0 {
+		return false
+	}
+
+	switch {
+	case s.ctx.Err() != nil:
+		s.stopped = true
+	case s.limits.Infinite:
+	case s.limits.Nodes > 0 && s.nodes >= s.limits.Nodes:
+		s.stopped = true
+	case !s.deadline.IsZero() && time.Now().After(s.deadline):
+		s.stopped = true
+	}
+
+	return s.stopped
+}
+
+// tbScore converts a tablebase result to a search score. Wins that the fifty-move rule spoils are
+// scored just above a draw, so that the search still prefers them to a real draw.
+func tbScore(wdl syzygy.WDL, ply int) int {
+	switch wdl {
+	case syzygy.Win:
+		return tbWinScore - ply
+	case syzygy.Loss:
+		return -tbWinScore + ply
+	default:
+		return int(wdl)
+	}
+}
+
+// resultScore converts the result of a game that has ended, by checkmate, stalemate or a rule of
+// its variant, to a search score. Wins and losses are scored as mates so that the quickest win is
+// preferred.
+func resultScore(result movegen.Result, ply int) int {
+	switch result {
+	case movegen.Win:
+		return MateScore - ply
+	case movegen.Loss:
+		return -MateScore + ply
+	default:
+		return 0
+	}
+}
+
+// orderMoves sorts the moves in place and returns them: captures first, most valuable victims
+// first, followed by promotions and then the remaining quiet moves in generation order.
+func orderMoves(pos *position.Position, moves []move.Move) []move.Move {
+	score := func(m move.Move) int {
+		if m.IsCapture() || m.IsEnPassant() {
+			return captureScore(pos, m)
+		}
+
+		// Quiet moves score below every capture.
+		return int(m.PromotionPiece()) - infinity
+	}
+
+	slices.SortStableFunc(moves, func(a, b move.Move) int {
+		return cmp.Compare(score(b), score(a))
+	})
+
+	return moves
+}
@@ -0,0 +1,329 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/engine"
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/polyglot"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		variant position.Variant
+		fen     string
+		depth   int
+		want    string
+		mate    int
+	}{
+		{
+			name:  "back rank mate",
+			fen:   "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1",
+			depth: 2,
+			want:  "a1a8",
+			mate:  1,
+		},
+		{
+			name:  "mate on the last move before the fifty-move rule",
+			fen:   "6k1/5ppp/8/8/8/8/8/R5K1 w - - 99 80",
+			depth: 2,
+			want:  "a1a8",
+			mate:  1,
+		},
+		{
+			name:  "hanging queen is taken",
+			fen:   "4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1",
+			depth: 2,
+			want:  "d1d5",
+		},
+		{
+			name:  "mate in two",
+			fen:   "7k/8/5K2/8/8/8/8/R7 w - - 0 1",
+			depth: 4,
+			mate:  2,
+		},
+		{
+			name:    "king of the hill",
+			variant: position.KingOfTheHill,
+			fen:     "8/8/8/8/2K5/8/8/k7 w - - 0 1",
+			depth:   2,
+			mate:    1,
+		},
+		{
+			name:    "third check",
+			variant: position.ThreeCheck,
+			fen:     "4k3/1ppppppp/8/8/8/8/8/R3K3 w - - 1+3 0 1",
+			depth:   2,
+			mate:    1,
+		},
+		{
+			name:    "racing kings",
+			variant: position.RacingKings,
+			fen:     "8/6K1/8/8/8/8/1k6/8 w - - 0 1",
+			depth:   2,
+			mate:    1,
+		},
+		{
+			name:    "atomic",
+			variant: position.Atomic,
+			fen:     "4k3/4rb1R/8/8/8/8/8/4K3 w - - 0 1",
+			depth:   2,
+			want:    "h7f7",
+			mate:    1,
+		},
+		{
+			name:    "antichess",
+			variant: position.Antichess,
+			fen:     "1r5k/8/8/8/8/8/8/K7 w - - 0 1",
+			depth:   2,
+			mate:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, tt.variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			eng, err := engine.NewEngine()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var last engine.Info
+
+			best := eng.Search(context.Background(), pos, engine.Limits{Depth: tt.depth}, func(info engine.Info) {
+				last = info
+			})
+
+			if got := best.String(); tt.want != "" && got != tt.want {
+				t.Errorf("best move %s, want %s", got, tt.want)
+			}
+
+			if last.Depth != tt.depth || len(last.PV) == 0 || last.PV[0] != best {
+				t.Errorf("last iteration was depth %d with pv %v", last.Depth, last.PV)
+			}
+
+			mate, ok := engine.MateIn(last.Score)
+			if tt.mate != 0 && (!ok || mate != tt.mate) {
+				t.Errorf("score %d, want mate in %d", last.Score, tt.mate)
+			}
+		})
+	}
+}
+
+func TestSearchStops(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng, err := engine.NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	if best := eng.Search(ctx, pos, engine.Limits{Infinite: true}, nil); best == 0 {
+		t.Error("no move returned")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("search took %v after being cancelled", elapsed)
+	}
+
+	// Checkmated, so there is nothing to play.
+	mated, err := position.NewPositionFromFEN("R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if best := eng.Search(context.Background(), mated, engine.Limits{Depth: 3}, nil); best != 0 {
+		t.Errorf("got %v from a checkmated position", best)
+	}
+}
+
+func TestSetSyzygyPath(t *testing.T) {
+	t.Parallel()
+
+	eng, err := engine.NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eng.SetSyzygyPath(t.TempDir()); err != nil || eng.Tablebases == nil {
+		t.Fatalf("failed to set path: %v", err)
+	}
+
+	if err := eng.SetSyzygyPath("<empty>"); err != nil || eng.Tablebases != nil {
+		t.Errorf("tablebases not cleared: %v", err)
+	}
+
+	if err := eng.SetSyzygyPath("/does/not/exist"); err == nil {
+		t.Error("missing directory accepted")
+	}
+}
+
+func TestSetNNUE(t *testing.T) {
+	t.Parallel()
+
+	eng, err := engine.NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eng.SetNNUE(true, "<empty>"); err != nil {
+		t.Fatal(err)
+	}
+
+	pos, err := position.NewPositionFromFEN("4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Search twice, as a search that left positions on the evaluator's stack would throw the
+	// second one off.
+	for range 2 {
+		if best := eng.Search(context.Background(), pos, engine.Limits{Depth: 3}, nil); best.String() != "d1d5" {
+			t.Errorf("best move %s, want d1d5", best)
+		}
+	}
+
+	if err := eng.SetNNUE(true, "/does/not/exist"); err == nil {
+		t.Error("missing network accepted")
+	}
+
+	if err := eng.SetNNUE(false, ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetEvalWeights(t *testing.T) {
+	t.Parallel()
+
+	eng, err := engine.NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Weights under which a pawn is worth more than a queen.
+	weights := eval.DefaultWeights
+	weights.Material[0] = eval.S(2000, 2000)
+
+	data, err := json.Marshal(weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "weights.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eng.SetEvalWeights(path); err != nil {
+		t.Fatal(err)
+	}
+
+	pos, err := position.NewPositionFromFEN("k7/1p1q4/8/8/3R3p/8/5PP1/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if best := eng.Search(context.Background(), pos, engine.Limits{Depth: 2}, nil); best.String() != "d4h4" {
+		t.Errorf("best move %s with valuable pawns, want d4h4", best)
+	}
+
+	if err := eng.SetEvalWeights("<empty>"); err != nil {
+		t.Fatal(err)
+	}
+
+	if best := eng.Search(context.Background(), pos, engine.Limits{Depth: 2}, nil); best.String() != "d4d7" {
+		t.Errorf("best move %s with the default weights, want d4d7", best)
+	}
+
+	if err := eng.SetEvalWeights("/does/not/exist"); err == nil {
+		t.Error("missing weights accepted")
+	}
+}
+
+func TestBook(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A book with a single entry: a3 from the starting position, which the search would never pick.
+	var a3 uint16
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if m.String() == "a2a3" {
+			a3 = polyglot.EncodeMove(m)
+		}
+	}
+
+	entry := binary.BigEndian.AppendUint64(nil, polyglot.Key(pos))
+	entry = binary.BigEndian.AppendUint16(entry, a3)
+	entry = binary.BigEndian.AppendUint16(entry, 1)
+	entry = binary.BigEndian.AppendUint32(entry, 0)
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := os.WriteFile(path, entry, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	eng, err := engine.NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eng.SetBookFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	searched := false
+
+	best := eng.Search(context.Background(), pos, engine.Limits{Depth: 2}, func(engine.Info) {
+		searched = true
+	})
+
+	if best.String() != "a2a3" || searched {
+		t.Errorf("got %s, searched %v; want the book move a2a3 without searching", best, searched)
+	}
+
+	// Out of book, the search takes over.
+	after := movegen.MakeMove(pos, best, false)
+	if best := eng.Search(context.Background(), after, engine.Limits{Depth: 2}, nil); best == 0 {
+		t.Error("no move returned out of book")
+	}
+
+	if err := eng.SetBookFile("<empty>"); err != nil || eng.Book != nil {
+		t.Errorf("book not cleared: %v", err)
+	}
+
+	if err := eng.SetBookFile(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+		t.Error("missing book accepted")
+	}
+}
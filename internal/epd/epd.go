@@ -0,0 +1,366 @@
+// Package epd reads and writes Extended Position Description records, the format that test suites
+// such as WAC and STS are distributed in. A record is the first four fields of a FEN followed by
+// operations, each an opcode with its operands and a closing semicolon, as in
+//
+//	2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";
+package epd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// moveOpcodes are the opcodes whose operands are moves in the record's position: best moves,
+// avoid moves, the predicted move and the supplied move.
+var moveOpcodes = map[string]bool{"am": true, "bm": true, "pm": true, "sm": true}
+
+// stringOpcodes are the opcodes whose operands are always quoted strings.
+var stringOpcodes = map[string]bool{
+	"id": true, "eco": true, "nic": true, "tcgs": true, "tcri": true, "tcsi": true,
+	"c0": true, "c1": true, "c2": true, "c3": true, "c4": true, "c5": true, "c6": true, "c7": true, "c8": true, "c9": true,
+	"v0": true, "v1": true, "v2": true, "v3": true, "v4": true, "v5": true, "v6": true, "v7": true, "v8": true, "v9": true,
+}
+
+// Operation is the operands of an operation. The operands of bm, am, pm and sm are also resolved to
+// legal moves, and those of pv to the moves of the variation, each played after the one before.
+type Operation struct {
+	Operands []string
+	Moves    []move.Move
+}
+
+// Operations maps opcodes to their operations.
+type Operations map[string]Operation
+
+// Record is a position with its operations.
+type Record struct {
+	Position *position.Position
+	Ops      Operations
+}
+
+// Read reads one record per line from r, skipping blank lines and lines starting with "#".
+func Read(r io.Reader) ([]Record, error) {
+	var ret []Record
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		pos, ops, err := Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+
+		ret = append(ret, Record{Position: pos, Ops: ops})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+
+	return ret, nil
+}
+
+// Parse parses an EPD record. Clocks after the four position fields, which some files have, are
+// accepted, and so are the hmvc and fmvn operations, which set them.
+func Parse(record string) (*position.Position, Operations, error) {
+	fields := make([]string, 0, 6)
+	rest := record
+
+	for range 4 {
+		var field string
+
+		field, rest = cutField(rest)
+		fields = append(fields, field)
+	}
+
+	if clock, afterClock := cutField(rest); isInteger(clock) {
+		if number, afterNumber := cutField(afterClock); isInteger(number) {
+			fields = append(fields, clock, number)
+			rest = afterNumber
+		}
+	}
+
+	pos, err := position.NewPositionFromFEN(strings.Join(fields, " "))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse position: %w", err)
+	}
+
+	ops, err := parseOperations(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := resolve(pos, ops); err != nil {
+		return nil, nil, err
+	}
+
+	return pos, ops, nil
+}
+
+// parseOperations parses the operations that follow the position.
+func parseOperations(s string) (Operations, error) {
+	ops := make(Operations)
+
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return ops, nil
+		}
+
+		end := strings.IndexAny(s, " \t;")
+		if end < 0 {
+			end = len(s)
+		}
+
+		opcode := s[:end]
+		s = s[end:]
+
+		if !isOpcode(opcode) {
+			return nil, fmt.Errorf("invalid opcode %q", opcode)
+		}
+
+		if _, ok := ops[opcode]; ok {
+			return nil, fmt.Errorf("opcode %s appears more than once", opcode)
+		}
+
+		var operands []string
+
+		for {
+			s = strings.TrimLeft(s, " \t")
+
+			if s == "" {
+				// The last operation is missing its semicolon, which is common enough to allow.
+				break
+			}
+
+			if s[0] == ';' {
+				s = s[1:]
+
+				break
+			}
+
+			if s[0] == '"' {
+				end := strings.IndexByte(s[1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated string in %s operation", opcode)
+				}
+
+				operands = append(operands, s[1:end+1])
+				s = s[end+2:]
+
+				continue
+			}
+
+			end := strings.IndexAny(s, " \t;")
+			if end < 0 {
+				end = len(s)
+			}
+
+			operands = append(operands, s[:end])
+			s = s[end:]
+		}
+
+		ops[opcode] = Operation{Operands: operands}
+	}
+}
+
+// resolve resolves the operands of move operations to moves, and applies the clock operations to
+// the position.
+func resolve(pos *position.Position, ops Operations) error {
+	for opcode, op := range ops {
+		switch {
+		case moveOpcodes[opcode]:
+			for _, san := range op.Operands {
+				m, err := movegen.ParseSAN(pos, san)
+				if err != nil {
+					return fmt.Errorf("failed to parse %s operation: %w", opcode, err)
+				}
+
+				op.Moves = append(op.Moves, m)
+			}
+		case opcode == "pv":
+			variation := pos
+
+			for _, san := range op.Operands {
+				m, err := movegen.ParseSAN(variation, san)
+				if err != nil {
+					return fmt.Errorf("failed to parse pv operation: %w", err)
+				}
+
+				op.Moves = append(op.Moves, m)
+				variation = movegen.MakeMove(variation, m, false)
+			}
+		case opcode == "hmvc" || opcode == "fmvn":
+			n, ok := ops.Int(opcode)
+			if !ok || n < 0 || n > 255 {
+				return fmt.Errorf("invalid %s operation %v", opcode, op.Operands)
+			}
+
+			if opcode == "hmvc" {
+				pos.HalfMoveClock = uint8(n)
+			} else {
+				pos.FullMoveNumber = uint8(n)
+			}
+		}
+
+		ops[opcode] = op
+	}
+
+	return nil
+}
+
+// Format returns an EPD record for a position and its operations. Operations with moves have them
+// written in standard algebraic notation, and the operations are written in order of opcode.
+func Format(pos *position.Position, ops Operations) string {
+	var sb strings.Builder
+
+	fields := strings.Fields(pos.FEN())
+	sb.WriteString(strings.Join(fields[:4], " "))
+
+	opcodes := make([]string, 0, len(ops))
+	for opcode := range ops {
+		opcodes = append(opcodes, opcode)
+	}
+
+	sort.Strings(opcodes)
+
+	for _, opcode := range opcodes {
+		sb.WriteByte(' ')
+		sb.WriteString(opcode)
+
+		for _, operand := range operands(pos, opcode, ops[opcode]) {
+			sb.WriteByte(' ')
+
+			// Strings can't contain double quotes, since there's no way of escaping them.
+			if stringOpcodes[opcode] || operand == "" || strings.ContainsAny(operand, " \t;\"") {
+				operand = `"` + strings.ReplaceAll(operand, `"`, "'") + `"`
+			}
+
+			sb.WriteString(operand)
+		}
+
+		sb.WriteByte(';')
+	}
+
+	return sb.String()
+}
+
+// operands returns the operands of an operation as they're written.
+func operands(pos *position.Position, opcode string, op Operation) []string {
+	if len(op.Moves) == 0 {
+		return op.Operands
+	}
+
+	ret := make([]string, len(op.Moves))
+
+	for i, m := range op.Moves {
+		ret[i] = movegen.SAN(pos, m)
+
+		if opcode == "pv" {
+			pos = movegen.MakeMove(pos, m, false)
+		}
+	}
+
+	return ret
+}
+
+// ID returns the operand of the id operation, which names the record.
+func (o Operations) ID() string {
+	return o.Text("id")
+}
+
+// BestMoves returns the moves of the bm operation.
+func (o Operations) BestMoves() []move.Move {
+	return o["bm"].Moves
+}
+
+// AvoidMoves returns the moves of the am operation.
+func (o Operations) AvoidMoves() []move.Move {
+	return o["am"].Moves
+}
+
+// Comment returns the operand of the comment operation c0 to c9.
+func (o Operations) Comment(n int) string {
+	return o.Text("c" + strconv.Itoa(n))
+}
+
+// Eval returns the centipawn evaluation of the ce operation, from the point of view of the side
+// to move.
+func (o Operations) Eval() (int, bool) {
+	return o.Int("ce")
+}
+
+// Depth returns the analysis depth of the acd operation.
+func (o Operations) Depth() (int, bool) {
+	return o.Int("acd")
+}
+
+// Text returns the first operand of an operation, or "" if there isn't one.
+func (o Operations) Text(opcode string) string {
+	if op := o[opcode]; len(op.Operands) > 0 {
+		return op.Operands[0]
+	}
+
+	return ""
+}
+
+// Int returns the first operand of an operation as an integer, and false if there isn't one or it
+// isn't an integer.
+func (o Operations) Int(opcode string) (int, bool) {
+	n, err := strconv.Atoi(o.Text(opcode))
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// cutField returns the first whitespace-separated field of s and what follows it.
+func cutField(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		return s, ""
+	}
+
+	return s[:end], s[end:]
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.Atoi(s)
+
+	return err == nil
+}
+
+// isOpcode reports whether s is a valid opcode: a letter followed by letters, digits and
+// underscores.
+func isOpcode(s string) bool {
+	if s == "" || !isLetter(s[0]) {
+		return false
+	}
+
+	for i := 1; i < len(s); i++ {
+		if !isLetter(s[i]) && (s[i] < '0' || s[i] > '9') && s[i] != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
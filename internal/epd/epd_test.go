@@ -0,0 +1,171 @@
+package epd_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/epd"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	pos, ops, err := epd.Parse(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";` +
+		` c0 "Qg6 mates; Rf3 is slower"; ce 32000; acd 12; pv Qg6 fxg6 Nxg6+;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pos.FEN(); got != "2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1" {
+		t.Errorf("got position %s", got)
+	}
+
+	if got := ops.ID(); got != "WAC.001" {
+		t.Errorf("got id %q", got)
+	}
+
+	if got := ops.BestMoves(); len(got) != 1 || got[0].String() != "g3g6" {
+		t.Errorf("got best moves %v", got)
+	}
+
+	if got := ops.Comment(0); got != "Qg6 mates; Rf3 is slower" {
+		t.Errorf("got comment %q", got)
+	}
+
+	if got, ok := ops.Eval(); !ok || got != 32000 {
+		t.Errorf("got ce %d, %v", got, ok)
+	}
+
+	if got, ok := ops.Depth(); !ok || got != 12 {
+		t.Errorf("got acd %d, %v", got, ok)
+	}
+
+	if got := ops["pv"].Moves; len(got) != 3 || got[2].String() != "f6g8" && got[2].String() != "e5g6" {
+		t.Errorf("got pv %v", got)
+	}
+
+	if len(ops.AvoidMoves()) != 0 {
+		t.Errorf("got avoid moves %v", ops.AvoidMoves())
+	}
+}
+
+func TestParseVariants(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		record  string
+		wantFEN string
+		wantErr bool
+	}{
+		{
+			name:    "clocks",
+			record:  "4k3/8/8/8/8/8/4P3/4K3 w - - 5 40 bm Kd2;",
+			wantFEN: "4k3/8/8/8/8/8/4P3/4K3 w - - 5 40",
+		},
+		{
+			name:    "clock operations",
+			record:  "4k3/8/8/8/8/8/4P3/4K3 w - - hmvc 7; fmvn 52;",
+			wantFEN: "4k3/8/8/8/8/8/4P3/4K3 w - - 7 52",
+		},
+		{
+			name:    "repeated spaces and no final semicolon",
+			record:  "4k3/8/8/8/8/8/4P3/4K3   w  -  -   am Kd1 Kf1 ;  id   x",
+			wantFEN: "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1",
+		},
+		{name: "no operations", record: "4k3/8/8/8/8/8/4P3/4K3 b - -", wantFEN: "4k3/8/8/8/8/8/4P3/4K3 b - - 0 1"},
+		{name: "illegal best move", record: "4k3/8/8/8/8/8/4P3/4K3 w - - bm e5;", wantErr: true},
+		{name: "unterminated string", record: `4k3/8/8/8/8/8/4P3/4K3 w - - id "WAC;`, wantErr: true},
+		{name: "repeated opcode", record: "4k3/8/8/8/8/8/4P3/4K3 w - - acd 1; acd 2;", wantErr: true},
+		{name: "invalid opcode", record: "4k3/8/8/8/8/8/4P3/4K3 w - - 1bm e4;", wantErr: true},
+		{name: "missing fields", record: "4k3/8/8/8/8/8/4P3/4K3 w", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, _, err := epd.Parse(tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+
+			if !tt.wantErr && pos.FEN() != tt.wantFEN {
+				t.Errorf("got %s, want %s", pos.FEN(), tt.wantFEN)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		record string
+		want   string
+	}{
+		{
+			`8/8/8/8/8/8/8/K1k5 w - - id "draw"; am Ka2; ce 0; acd 20;`,
+			`8/8/8/8/8/8/8/K1k5 w - - acd 20; am Ka2; ce 0; id "draw";`,
+		},
+		{
+			`4k3/8/8/8/8/8/4P3/4K3 w - - 3 9 pv Kd2 Kd7 e4; c0 "pawn; push";`,
+			`4k3/8/8/8/8/8/4P3/4K3 w - - c0 "pawn; push"; pv Kd2 Kd7 e4;`,
+		},
+	}
+
+	for _, tt := range tests {
+		pos, ops, err := epd.Parse(tt.record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := epd.Format(pos, ops); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+
+	pos, ops, err := epd.Parse("4k3/8/8/8/8/8/4P3/4K3 w - - bm e4;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops["id"] = epd.Operation{Operands: []string{`say "hi"`}}
+
+	if got, want := epd.Format(pos, ops), `4k3/8/8/8/8/8/4P3/4K3 w - - bm e4; id "say 'hi'";`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	text := `# Two records
+2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";
+
+8/7p/5k2/5p2/p1p2P2/Pr1pPK2/1P1R3P/8 b - - bm Rxb2; id "WAC.002";
+`
+
+	records, err := epd.Read(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[1].Ops.ID() != "WAC.002" || records[1].Position.WhiteToMove {
+		t.Errorf("got %v", records)
+	}
+
+	if _, err := epd.Read(strings.NewReader("\n\n4k3/8 w - -\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("got error %v, want one for line 3", err)
+	}
+}
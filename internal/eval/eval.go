@@ -0,0 +1,382 @@
+package eval
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// Evaluator scores a position in centipawns from the point of view of the side to move.
+type Evaluator interface {
+	Evaluate(pos *position.Position) int
+}
+
+// ShannonEvaluator is a hand-crafted evaluator in the tradition of Shannon's 1950 paper: material,
+// pawn structure and mobility, extended with piece-square tables, king safety and a few piece
+// specific terms. Every term is tapered between a midgame and an endgame value. Endings the
+// endgame registry knows about are evaluated or scaled by it instead.
+type ShannonEvaluator struct {
+	// Weights are the parameters to evaluate with. If nil, DefaultWeights is used.
+	Weights *Weights
+	// Endgames is the registry of specialised endgame knowledge. If nil, endgame.Default is used.
+	Endgames *endgame.Registry
+}
+
+func (e ShannonEvaluator) Evaluate(pos *position.Position) int {
+	if score, _, ok := e.endgames().Evaluate(pos); ok {
+		return score
+	}
+
+	ev := evaluation{pos: pos, weights: e.weights(), scale: e.endgames().Scale(pos)}
+	ev.run()
+
+	return ev.result()
+}
+
+func (e ShannonEvaluator) weights() *Weights {
+	if e.Weights == nil {
+		return &DefaultWeights
+	}
+
+	return e.Weights
+}
+
+func (e ShannonEvaluator) endgames() *endgame.Registry {
+	if e.Endgames == nil {
+		return endgame.Default
+	}
+
+	return e.Endgames
+}
+
+const (
+	pawn = iota
+	knight
+	bishop
+	rook
+	queen
+	king
+)
+
+// Terms of the evaluation, each of which is accumulated separately for white and black.
+const (
+	termMaterial = iota
+	termPST
+	termPawns
+	termMobility
+	termKingSafety
+	termPieces
+	termTempo
+	termVariant
+	numTerms
+)
+
+const maxPhase = 24
+
+var phaseWeights = [6]int{0, 1, 1, 2, 4, 0}
+
+type evaluation struct {
+	pos     *position.Position
+	weights *Weights
+
+	occupied    bb.Bitboard
+	pawnAttacks [2]bb.Bitboard
+	kingZone    [2]bb.Bitboard
+
+	// The number of pieces attacking each side's king zone, and the attack units they contribute.
+	kingAttackers   [2]int
+	kingAttackUnits [2]int
+
+	phase int
+	terms [numTerms][2]Score
+
+	// scale is the factor, out of endgame.ScaleNormal, applied to the tapered score.
+	scale int
+}
+
+func (e *evaluation) run() {
+	e.occupied = e.pos.Occupancy[piece.Wa] | e.pos.Occupancy[piece.Ba]
+
+	for _, colour := range []piece.Colour{piece.White, piece.Black} {
+		pawns := e.pieces(colour, pawn)
+
+		for pawns != 0 {
+			square := bb.LSBIndex(pawns)
+			pawns = bb.ClearBit(pawns, square)
+
+			e.pawnAttacks[colour] |= movegen.PawnAttacks(colour, square)
+		}
+
+		kingSquare := bb.LSBIndex(e.pieces(colour, king))
+		if kingSquare != sq.NoSquare {
+			e.kingZone[colour] = bb.SetBit(movegen.KingAttacks(kingSquare), kingSquare)
+		}
+	}
+
+	for _, colour := range []piece.Colour{piece.White, piece.Black} {
+		e.evaluateMaterial(colour)
+		e.evaluatePawns(colour)
+		e.evaluatePieces(colour)
+		e.evaluateVariant(colour)
+	}
+
+	for _, colour := range []piece.Colour{piece.White, piece.Black} {
+		e.evaluateKingSafety(colour)
+	}
+
+	if e.pos.WhiteToMove {
+		e.terms[termTempo][piece.White] = e.weights.Tempo
+	} else {
+		e.terms[termTempo][piece.Black] = e.weights.Tempo
+	}
+
+	e.phase = min(e.phase, maxPhase)
+}
+
+// total returns the sum of all terms from white's point of view.
+func (e *evaluation) total() Score {
+	var ret Score
+
+	for term := range numTerms {
+		ret = ret.add(e.terms[term][piece.White]).sub(e.terms[term][piece.Black])
+	}
+
+	return ret
+}
+
+// result tapers the total score by game phase, scales it and returns it from the side to move's
+// point of view.
+func (e *evaluation) result() int {
+	total := e.total()
+
+	score := (total.MG*e.phase + total.EG*(maxPhase-e.phase)) / maxPhase
+	score = score * e.scale / endgame.ScaleNormal
+
+	if !e.pos.WhiteToMove {
+		return -score
+	}
+
+	return score
+}
+
+func (e *evaluation) evaluateMaterial(colour piece.Colour) {
+	for pieceType := pawn; pieceType <= king; pieceType++ {
+		pieces := e.pieces(colour, pieceType)
+
+		for pieces != 0 {
+			square := bb.LSBIndex(pieces)
+			pieces = bb.ClearBit(pieces, square)
+
+			e.terms[termMaterial][colour] = e.terms[termMaterial][colour].add(e.weights.Material[pieceType])
+			e.terms[termPST][colour] = e.terms[termPST][colour].add(e.weights.PST[pieceType][pstIndex(colour, square)])
+			e.phase += phaseWeights[pieceType]
+		}
+	}
+}
+
+func (e *evaluation) evaluatePawns(colour piece.Colour) {
+	ownPawns := e.pieces(colour, pawn)
+	enemyPawns := e.pieces(colour^1, pawn)
+
+	pawns := ownPawns
+
+	for pawns != 0 {
+		square := bb.LSBIndex(pawns)
+		pawns = bb.ClearBit(pawns, square)
+
+		file := square % 8
+
+		var score Score
+
+		if forwardMasks[colour][square]&ownPawns != 0 {
+			score = score.add(e.weights.DoubledPawn)
+		} else if passedMasks[colour][square]&enemyPawns == 0 {
+			score = score.add(e.weights.PassedPawn[relativeRank(colour, square)-1])
+		}
+
+		if adjacentFileMasks[file]&ownPawns == 0 {
+			score = score.add(e.weights.IsolatedPawn)
+		}
+
+		e.terms[termPawns][colour] = e.terms[termPawns][colour].add(score)
+	}
+}
+
+// evaluatePieces scores the mobility of the given side's knights, bishops, rooks and queens, along
+// with outposts, rooks on open files and the bishop pair. It also records how heavily the pieces
+// attack the enemy king zone, which is consumed by evaluateKingSafety.
+func (e *evaluation) evaluatePieces(colour piece.Colour) {
+	enemy := colour ^ 1
+	own := e.pos.Occupancy[piece.Wa]
+	allPawns := e.pieces(piece.White, pawn) | e.pieces(piece.Black, pawn)
+
+	if colour == piece.Black {
+		own = e.pos.Occupancy[piece.Ba]
+	}
+
+	// Squares occupied by our own pieces or attacked by enemy pawns do not count towards mobility.
+	mobilityArea := ^own &^ e.pawnAttacks[enemy]
+
+	for pieceType := knight; pieceType <= queen; pieceType++ {
+		pieces := e.pieces(colour, pieceType)
+
+		for pieces != 0 {
+			square := bb.LSBIndex(pieces)
+			pieces = bb.ClearBit(pieces, square)
+
+			attacks := e.attacks(pieceType, square)
+
+			mobility := bb.CountBits(attacks&mobilityArea) - mobilityOffset[pieceType-knight]
+			e.terms[termMobility][colour] = e.terms[termMobility][colour].add(
+				e.weights.Mobility[pieceType-knight].mul(mobility),
+			)
+
+			if zoneAttacks := attacks & e.kingZone[enemy]; zoneAttacks != 0 {
+				e.kingAttackers[enemy]++
+				e.kingAttackUnits[enemy] += e.weights.KingAttackUnits[pieceType-knight] * bb.CountBits(zoneAttacks)
+			}
+
+			switch pieceType {
+			case knight, bishop:
+				if e.isOutpost(colour, square) {
+					e.terms[termPieces][colour] = e.terms[termPieces][colour].add(e.weights.Outpost[pieceType-knight])
+				}
+			case rook:
+				file := fileMasks[square%8]
+
+				if file&allPawns == 0 {
+					e.terms[termPieces][colour] = e.terms[termPieces][colour].add(e.weights.RookOpenFile)
+				} else if file&e.pieces(colour, pawn) == 0 {
+					e.terms[termPieces][colour] = e.terms[termPieces][colour].add(e.weights.RookSemiOpenFile)
+				}
+			}
+		}
+	}
+
+	if bb.CountBits(e.pieces(colour, bishop)) >= 2 {
+		e.terms[termPieces][colour] = e.terms[termPieces][colour].add(e.weights.BishopPair)
+	}
+}
+
+// isOutpost reports whether a minor piece on the given square sits on one of the opponent's
+// ranks, is defended by a pawn and can never be attacked by an enemy pawn.
+func (e *evaluation) isOutpost(colour piece.Colour, square sq.Square) bool {
+	rank := relativeRank(colour, square)
+	if rank < 4 || rank > 6 {
+		return false
+	}
+
+	if !bb.GetBit(e.pawnAttacks[colour], square) {
+		return false
+	}
+
+	return outpostMasks[colour][square]&e.pieces(colour^1, pawn) == 0
+}
+
+// evaluateKingSafety scores the safety of the given side's king from the attacks gathered by
+// evaluatePieces, the pawns sheltering it and any open files next to it.
+func (e *evaluation) evaluateKingSafety(colour piece.Colour) {
+	kingSquare := bb.LSBIndex(e.pieces(colour, king))
+	if kingSquare == sq.NoSquare {
+		return
+	}
+
+	var score Score
+
+	// A lone attacker rarely amounts to anything, so the danger only counts once several pieces
+	// are involved.
+	if e.kingAttackers[colour] >= 2 {
+		units := e.kingAttackUnits[colour]
+		score = score.add(S(
+			e.weights.KingDanger.MG*units*units/64,
+			e.weights.KingDanger.EG*units*units/64,
+		))
+	}
+
+	ownPawns := e.pieces(colour, pawn)
+	allPawns := ownPawns | e.pieces(colour^1, pawn)
+
+	kingFile := int(kingSquare % 8)
+	kingRow := int(kingSquare / 8)
+
+	forward := -1
+	if colour == piece.Black {
+		forward = 1
+	}
+
+	for file := max(kingFile-1, 0); file <= min(kingFile+1, 7); file++ {
+		for distance := 1; distance <= 2; distance++ {
+			row := kingRow + forward*distance
+			if row < 0 || row > 7 {
+				break
+			}
+
+			if bb.GetBit(ownPawns, sq.Square(byte(row*8+file))) {
+				score = score.add(e.weights.PawnShield[distance-1])
+			}
+		}
+
+		if fileMasks[file]&allPawns == 0 {
+			score = score.add(e.weights.KingOpenFile)
+		} else if fileMasks[file]&ownPawns == 0 {
+			score = score.add(e.weights.KingSemiOpenFile)
+		}
+	}
+
+	e.terms[termKingSafety][colour] = e.terms[termKingSafety][colour].add(score)
+}
+
+func (e *evaluation) attacks(pieceType int, square sq.Square) bb.Bitboard {
+	switch pieceType {
+	case knight:
+		return movegen.KnightAttacks(square)
+	case bishop:
+		return movegen.BishopAttacks(square, e.occupied)
+	case rook:
+		return movegen.RookAttacks(square, e.occupied)
+	case queen:
+		return movegen.QueenAttacks(square, e.occupied)
+	default:
+		return movegen.KingAttacks(square)
+	}
+}
+
+func (e *evaluation) pieces(colour piece.Colour, pieceType int) bb.Bitboard {
+	if colour == piece.White {
+		return e.pos.Occupancy[piece.Wp+piece.Piece(pieceType)]
+	}
+
+	return e.pos.Occupancy[piece.Bp+piece.Piece(pieceType)]
+}
+
+// relativeRank returns the rank of the square from the given side's point of view, so that a white
+// pawn on e2 and a black pawn on e7 are both on rank 2.
+func relativeRank(colour piece.Colour, square sq.Square) int {
+	if colour == piece.White {
+		return square.Rank()
+	}
+
+	return 9 - square.Rank()
+}
+
+// pstIndex returns the index into a piece-square table for the given side. The tables are written
+// from white's point of view, so black's squares are flipped vertically.
+func pstIndex(colour piece.Colour, square sq.Square) sq.Square {
+	if colour == piece.White {
+		return square
+	}
+
+	return square ^ 56
+}
+
+// Incremental is implemented by evaluators that keep state which is updated as moves are made and
+// unmade, rather than being recomputed from scratch at every node. The engine's search calls Push
+// with each position it reaches, and Pop when it backs out of it again.
+type Incremental interface {
+	Evaluator
+	Push(pos *position.Position)
+	Pop()
+}
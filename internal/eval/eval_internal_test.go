@@ -0,0 +1,193 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func evaluateTerms(t *testing.T, fen string, weights *Weights) *evaluation {
+	t.Helper()
+
+	pos, err := position.NewPositionFromFEN(fen)
+	if err != nil {
+		t.Fatalf("failed to create position: %v", err)
+	}
+
+	ev := &evaluation{pos: pos, weights: weights}
+	ev.run()
+
+	return ev
+}
+
+func TestMobilityExcludesSquaresAttackedByEnemyPawns(t *testing.T) {
+	t.Parallel()
+
+	weights := &Weights{Mobility: [4]Score{S(1, 1), S(1, 1), S(1, 1), S(1, 1)}}
+
+	tests := []struct {
+		name string
+		fen  string
+		want int
+	}{
+		{
+			name: "knight in the centre",
+			fen:  "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1",
+			want: 8 - mobilityOffset[0],
+		},
+		{
+			// The black pawns on c6 and g6 cover b5 and f5, leaving the knight with c6 (a capture),
+			// e6, b3, c2, e2 and f3.
+			name: "knight hemmed in by pawns",
+			fen:  "4k3/8/2p3p1/8/3N4/8/8/4K3 w - - 0 1",
+			want: 6 - mobilityOffset[0],
+		},
+		{
+			// Our own pawn on d3 takes away one square from the rook.
+			name: "rook blocked by own pawn",
+			fen:  "4k3/8/8/8/8/3P4/8/3RK3 w - - 0 1",
+			want: 4 - mobilityOffset[2],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ev := evaluateTerms(t, tt.fen, weights)
+
+			if got := ev.terms[termMobility][piece.White].MG; got != tt.want {
+				t.Errorf("got mobility %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKingSafety(t *testing.T) {
+	t.Parallel()
+
+	weights := &Weights{
+		KingAttackUnits:  [4]int{2, 2, 3, 5},
+		KingDanger:       S(-64, 0),
+		PawnShield:       [2]Score{S(10, 0), S(5, 0)},
+		KingOpenFile:     S(-100, 0),
+		KingSemiOpenFile: S(-1000, 0),
+	}
+
+	tests := []struct {
+		name string
+		fen  string
+		want int
+	}{
+		{
+			name: "full pawn shield",
+			fen:  "4k3/8/8/8/8/8/5PPP/6K1 w - - 0 1",
+			want: 30,
+		},
+		{
+			name: "advanced g pawn",
+			fen:  "4k3/8/8/8/8/6P1/5P1P/6K1 w - - 0 1",
+			want: 25,
+		},
+		{
+			name: "open h file",
+			fen:  "4k3/8/8/8/8/8/5PP1/6K1 w - - 0 1",
+			want: 20 - 100,
+		},
+		{
+			name: "semi-open g file",
+			fen:  "4k3/6p1/8/8/8/8/5P1P/6K1 w - - 0 1",
+			want: 20 - 1000,
+		},
+		{
+			// The queen attacks g1, g2 and h2, and the rook attacks f2 and g1, giving
+			// 3*5 + 2*3 = 21 units.
+			name: "queen and rook attacking",
+			fen:  "4k3/8/8/8/8/8/5PPP/5rKq w - - 0 1",
+			want: 30 - 21*21,
+		},
+		{
+			name: "lone queen attacking",
+			fen:  "4k3/8/8/8/8/8/5PPP/6Kq w - - 0 1",
+			want: 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ev := evaluateTerms(t, tt.fen, weights)
+
+			if got := ev.terms[termKingSafety][piece.White].MG; got != tt.want {
+				t.Errorf("got king safety %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPieceTerms(t *testing.T) {
+	t.Parallel()
+
+	weights := &Weights{
+		Outpost:          [2]Score{S(1, 0), S(10, 0)},
+		RookOpenFile:     S(100, 0),
+		RookSemiOpenFile: S(1000, 0),
+		BishopPair:       S(10000, 0),
+	}
+
+	tests := []struct {
+		name string
+		fen  string
+		want int
+	}{
+		{
+			name: "knight outpost",
+			fen:  "4k3/8/8/3N4/4P3/8/8/4K3 w - - 0 1",
+			want: 1,
+		},
+		{
+			name: "knight outpost can be challenged by a pawn",
+			fen:  "4k3/2p5/8/3N4/4P3/8/8/4K3 w - - 0 1",
+			want: 0,
+		},
+		{
+			name: "unsupported knight",
+			fen:  "4k3/8/8/3N4/8/8/8/4K3 w - - 0 1",
+			want: 0,
+		},
+		{
+			name: "bishop outpost",
+			fen:  "4k3/8/3B4/2P5/8/8/8/4K3 w - - 0 1",
+			want: 10,
+		},
+		{
+			name: "rook on open file",
+			fen:  "4k3/p7/8/8/8/8/P7/3RK3 w - - 0 1",
+			want: 100,
+		},
+		{
+			name: "rook on semi-open file",
+			fen:  "4k3/3p4/8/8/8/8/8/3RK3 w - - 0 1",
+			want: 1000,
+		},
+		{
+			name: "bishop pair",
+			fen:  "4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1",
+			want: 10000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ev := evaluateTerms(t, tt.fen, weights)
+
+			if got := ev.terms[termPieces][piece.White].MG; got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
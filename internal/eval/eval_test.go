@@ -0,0 +1,263 @@
+package eval_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestStartingPositionOnlyScoresTempo(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := eval.ShannonEvaluator{}.Evaluate(pos)
+	if want := eval.DefaultWeights.Tempo.MG; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+}
+
+func TestEvaluationIsColourSymmetric(t *testing.T) {
+	t.Parallel()
+
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		"8/2k5/3p4/p2P1p2/P2P1P2/8/8/4K3 w - - 0 1",
+		"6k1/5ppp/8/3N4/8/8/5PPP/2R3K1 b - - 0 1",
+	}
+
+	for _, fen := range fens {
+		t.Run(fen, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mirrored, err := position.NewPositionFromFEN(mirrorFEN(fen))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			evaluator := eval.ShannonEvaluator{}
+
+			if got, want := evaluator.Evaluate(mirrored), evaluator.Evaluate(pos); got != want {
+				t.Errorf("mirrored position scored %d, original scored %d", got, want)
+			}
+		})
+	}
+}
+
+func TestExtraMaterialIsBetter(t *testing.T) {
+	t.Parallel()
+
+	even, err := position.NewPositionFromFEN("4k3/pppppppp/8/8/8/8/PPPPPPPP/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := position.NewPositionFromFEN("4k3/pppppppp/8/8/8/8/PPPPPPPP/3QK3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluator := eval.ShannonEvaluator{}
+
+	if evaluator.Evaluate(up) <= evaluator.Evaluate(even) {
+		t.Errorf("extra queen did not improve the evaluation")
+	}
+}
+
+// mirrorFEN flips the board vertically and swaps the colours of every piece, which should give a
+// position with exactly the opposite evaluation for the side to move.
+func mirrorFEN(fen string) string {
+	parts := strings.Split(fen, " ")
+
+	ranks := strings.Split(parts[0], "/")
+	for i, j := 0, len(ranks)-1; i < j; i, j = i+1, j-1 {
+		ranks[i], ranks[j] = ranks[j], ranks[i]
+	}
+
+	parts[0] = swapCase(strings.Join(ranks, "/"))
+
+	if parts[1] == "w" {
+		parts[1] = "b"
+	} else {
+		parts[1] = "w"
+	}
+
+	parts[2] = swapCase(parts[2])
+
+	if parts[3] != "-" {
+		parts[3] = string(parts[3][0]) + string('9'-parts[3][1]+'0')
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+func TestTraceAgreesWithEvaluate(t *testing.T) {
+	t.Parallel()
+
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		"8/2k5/3p4/p2P1p2/P2P1P2/8/8/4K3 b - - 0 1",
+	}
+
+	for _, fen := range fens {
+		t.Run(fen, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trace := eval.Trace(pos)
+
+			if got, want := trace.Score, (eval.ShannonEvaluator{}).Evaluate(pos); got != want {
+				t.Errorf("trace score %d, evaluate returned %d", got, want)
+			}
+
+			total := trace.Total()
+
+			tapered := (total.MG*trace.Phase + total.EG*(eval.MaxPhase-trace.Phase)) / eval.MaxPhase
+			if !pos.WhiteToMove {
+				tapered = -tapered
+			}
+
+			if tapered != trace.Score {
+				t.Errorf("terms taper to %d, but the trace scored %d", tapered, trace.Score)
+			}
+		})
+	}
+}
+
+func TestTraceOutputFormat(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `term         white mg white eg black mg black eg total mg total eg
+material         4039     3868     4039     3868        0        0
+pst              -147     -193     -147     -193        0        0
+pawns               0        0        0        0        0        0
+mobility         -112     -148     -112     -148        0        0
+king safety        36        0       36        0        0        0
+pieces             30       50       30       50        0        0
+tempo              10        5        0        0       10        5
+variant             0        0        0        0        0        0
+total            3856     3582     3846     3577       10        5
+phase 24/24
+scale 64/64
+score 10 (white) 10 (side to move)
+`
+
+	if got := eval.Trace(pos).String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEndgameKnowledge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		fen     string
+		endgame string
+		draw    bool
+	}{
+		{"drawn KPK", "8/8/8/8/8/4k3/4P3/4K3 w - - 0 1", "KPvK", true},
+		{"won KPK", "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", "KPvK", false},
+		{"wrong bishop", "k7/8/8/8/8/8/P7/K1B5 w - - 0 1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trace := eval.Trace(pos)
+
+			if trace.Endgame != tt.endgame {
+				t.Errorf("evaluated as %q, want %q", trace.Endgame, tt.endgame)
+			}
+
+			if got := (eval.ShannonEvaluator{}).Evaluate(pos); (got == 0) != tt.draw || got != trace.Score {
+				t.Errorf("scored %d (trace %d), want draw: %v", got, trace.Score, tt.draw)
+			}
+		})
+	}
+}
+
+func TestVariantTerms(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		variant position.Variant
+		fen     string
+	}{
+		// In each position white is closer to winning by the variant's rules, and otherwise the
+		// sides are level.
+		{"king of the hill", position.KingOfTheHill, "k7/8/8/8/8/3K4/8/8 w - - 0 1"},
+		{"three-check", position.ThreeCheck, "4k3/8/8/8/8/8/8/4K3 w - - 1+2 0 1"},
+		{"racing kings", position.RacingKings, "8/8/8/8/K7/8/8/k7 w - - 0 1"},
+		{"crazyhouse", position.Crazyhouse, "4k3/8/8/8/8/8/8/4K3[Np] w - - 0 1"},
+		{"antichess", position.Antichess, "4k2n/8/8/8/8/8/8/4K3 w - - 0 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, tt.variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trace := eval.Trace(pos)
+
+			variant := trace.Terms[len(trace.Terms)-1]
+			if variant.Name != "variant" || variant.Total().EG <= 0 {
+				t.Errorf("variant term is %+v, want it in white's favour", variant)
+			}
+		})
+	}
+}
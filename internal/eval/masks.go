@@ -0,0 +1,60 @@
+package eval
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+var (
+	// fileMasks[f] is every square on file f, where file 0 is the a-file.
+	fileMasks [8]bb.Bitboard
+	// adjacentFileMasks[f] is every square on the files either side of file f.
+	adjacentFileMasks [8]bb.Bitboard
+	// forwardMasks[c][s] is every square in front of s on the same file, from the point of view of
+	// colour c (white is 0, black is 1).
+	forwardMasks [2][64]bb.Bitboard
+	// passedMasks[c][s] is every square in front of s on the same or adjacent files. A pawn is
+	// passed when no enemy pawns stand on these squares.
+	passedMasks [2][64]bb.Bitboard
+	// outpostMasks[c][s] is every square in front of s on the adjacent files, i.e. the squares
+	// from which an enemy pawn could advance to attack s.
+	outpostMasks [2][64]bb.Bitboard
+)
+
+func init() {
+	for square := range sq.Square(64) {
+		file := square % 8
+		fileMasks[file] = bb.SetBit(fileMasks[file], square)
+	}
+
+	for file := range 8 {
+		if file > 0 {
+			adjacentFileMasks[file] |= fileMasks[file-1]
+		}
+
+		if file < 7 {
+			adjacentFileMasks[file] |= fileMasks[file+1]
+		}
+	}
+
+	for square := range sq.Square(64) {
+		row := square / 8
+		file := square % 8
+
+		var whiteAhead, blackAhead bb.Bitboard
+
+		for other := range sq.Square(64) {
+			if other/8 < row {
+				whiteAhead = bb.SetBit(whiteAhead, other)
+			} else if other/8 > row {
+				blackAhead = bb.SetBit(blackAhead, other)
+			}
+		}
+
+		for colour, ahead := range [2]bb.Bitboard{whiteAhead, blackAhead} {
+			forwardMasks[colour][square] = ahead & fileMasks[file]
+			outpostMasks[colour][square] = ahead & adjacentFileMasks[file]
+			passedMasks[colour][square] = forwardMasks[colour][square] | outpostMasks[colour][square]
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+var termNames = [numTerms]string{
+	termMaterial:   "material",
+	termPST:        "pst",
+	termPawns:      "pawns",
+	termMobility:   "mobility",
+	termKingSafety: "king safety",
+	termPieces:     "pieces",
+	termTempo:      "tempo",
+	termVariant:    "variant",
+}
+
+// TraceTerm is the contribution of a single evaluation term for each side.
+type TraceTerm struct {
+	Name  string
+	White Score
+	Black Score
+}
+
+// Total returns the term from white's point of view.
+func (t TraceTerm) Total() Score {
+	return t.White.sub(t.Black)
+}
+
+// Breakdown is an evaluation split up by term, side and game phase.
+type Breakdown struct {
+	Terms []TraceTerm
+	// Phase is the game phase, from MaxPhase at the start of the game down to zero once only pawns
+	// and kings remain.
+	Phase int
+	// Scale is the factor, out of endgame.ScaleNormal, which the tapered terms were multiplied by.
+	Scale int
+	// Endgame is the signature of the ending if the registry evaluated the position itself, in
+	// which case Score comes from the registry rather than from the terms.
+	Endgame string
+	// Score is the final evaluation from the side to move's point of view, i.e. what Evaluate
+	// returns.
+	Score       int
+	WhiteToMove bool
+}
+
+// MaxPhase is the game phase of a position with all pieces still on the board.
+const MaxPhase = maxPhase
+
+// Trace evaluates the position with the default weights and returns the breakdown.
+func Trace(pos *position.Position) *Breakdown {
+	return ShannonEvaluator{}.Trace(pos)
+}
+
+// Trace evaluates the position and returns the breakdown of the evaluation.
+func (e ShannonEvaluator) Trace(pos *position.Position) *Breakdown {
+	ev := evaluation{pos: pos, weights: e.weights(), scale: e.endgames().Scale(pos)}
+	ev.run()
+
+	ret := &Breakdown{
+		Terms:       make([]TraceTerm, numTerms),
+		Phase:       ev.phase,
+		Scale:       ev.scale,
+		Score:       ev.result(),
+		WhiteToMove: pos.WhiteToMove,
+	}
+
+	if score, signature, ok := e.endgames().Evaluate(pos); ok {
+		ret.Score = score
+		ret.Endgame = signature
+	}
+
+	for term := range numTerms {
+		ret.Terms[term] = TraceTerm{
+			Name:  termNames[term],
+			White: ev.terms[term][piece.White],
+			Black: ev.terms[term][piece.Black],
+		}
+	}
+
+	return ret
+}
+
+// Total returns the sum of all terms from white's point of view, before tapering.
+func (b *Breakdown) Total() Score {
+	var ret Score
+
+	for _, term := range b.Terms {
+		ret = ret.add(term.Total())
+	}
+
+	return ret
+}
+
+// WriteTo writes the breakdown as a table. The layout is kept stable so that the output of two
+// engine versions can be compared with diff: one line per term in a fixed order, followed by the
+// totals, the phase, the scale factor and the final score. Positions evaluated by the endgame
+// registry get an extra line naming the ending.
+func (b *Breakdown) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	row := func(name string, white, black, total Score) {
+		fmt.Fprintf(&sb, "%-12s %8d %8d %8d %8d %8d %8d\n",
+			name, white.MG, white.EG, black.MG, black.EG, total.MG, total.EG)
+	}
+
+	fmt.Fprintf(&sb, "%-12s %8s %8s %8s %8s %8s %8s\n",
+		"term", "white mg", "white eg", "black mg", "black eg", "total mg", "total eg")
+
+	var white, black Score
+
+	for _, term := range b.Terms {
+		row(term.Name, term.White, term.Black, term.Total())
+
+		white = white.add(term.White)
+		black = black.add(term.Black)
+	}
+
+	row("total", white, black, b.Total())
+
+	fmt.Fprintf(&sb, "phase %d/%d\n", b.Phase, MaxPhase)
+	fmt.Fprintf(&sb, "scale %d/%d\n", b.Scale, endgame.ScaleNormal)
+
+	if b.Endgame != "" {
+		fmt.Fprintf(&sb, "endgame %s\n", b.Endgame)
+	}
+
+	whiteScore := b.Score
+	if !b.WhiteToMove {
+		whiteScore = -whiteScore
+	}
+
+	fmt.Fprintf(&sb, "score %d (white) %d (side to move)\n", whiteScore, b.Score)
+
+	n, err := io.WriteString(w, sb.String())
+
+	return int64(n), err
+}
+
+func (b *Breakdown) String() string {
+	var sb strings.Builder
+
+	if _, err := b.WriteTo(&sb); err != nil {
+		panic(err)
+	}
+
+	return sb.String()
+}
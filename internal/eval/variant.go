@@ -0,0 +1,67 @@
+package eval
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// The weights of the variant terms. They're set by hand rather than being part of Weights, as the
+// tuner only learns from standard games.
+var (
+	// hillDistance scores a king in King of the Hill by how many king moves it is from the centre.
+	// A king on the hill has already won.
+	hillDistance = [4]Score{S(0, 0), S(150, 250), S(50, 100), S(0, 0)}
+	// checksGiven scores a side in Three-check by the number of checks it has given.
+	checksGiven = [4]Score{S(0, 0), S(120, 120), S(350, 350), S(0, 0)}
+	// raceRank scores a king in Racing Kings by its rank, counting from 1. A king on the eighth rank
+	// has already won.
+	raceRank = [8]Score{S(0, 0), S(0, 0), S(40, 40), S(90, 90), S(160, 160), S(260, 260), S(400, 400), S(0, 0)}
+)
+
+// evaluateVariant scores what the given side needs to win in variants that aren't won by mate
+// alone: getting its king to the centre in King of the Hill, the checks it has given in
+// Three-check, and how far its king has raced in Racing Kings. In Crazyhouse it scores the pieces
+// the side has in hand, which are worth as much as they would be on the board, and in Antichess,
+// where a side wins by losing its pieces, it takes back twice the side's material.
+func (e *evaluation) evaluateVariant(colour piece.Colour) {
+	kingSquare := bb.LSBIndex(e.pieces(colour, king))
+
+	var score Score
+
+	switch e.pos.Variant {
+	case position.KingOfTheHill:
+		if kingSquare != sq.NoSquare {
+			score = hillDistance[min(hillDistanceOf(kingSquare), 3)]
+		}
+	case position.ThreeCheck:
+		score = checksGiven[min(e.pos.Checks[colour], 3)]
+	case position.RacingKings:
+		if kingSquare != sq.NoSquare {
+			score = raceRank[kingSquare.Rank()-1]
+		}
+	case position.Crazyhouse:
+		first := piece.Wp
+		if colour == piece.Black {
+			first = piece.Bp
+		}
+
+		for pieceType := pawn; pieceType < king; pieceType++ {
+			held := int(e.pos.Pockets[first+piece.Piece(pieceType)])
+			score = score.add(e.weights.Material[pieceType].mul(held))
+		}
+	case position.Antichess:
+		score = e.terms[termMaterial][colour].mul(-2)
+	}
+
+	e.terms[termVariant][colour] = e.terms[termVariant][colour].add(score)
+}
+
+// hillDistanceOf returns the number of king moves from the square to the nearest of the four centre
+// squares.
+func hillDistanceOf(square sq.Square) int {
+	file, row := int(square%8), int(square/8)
+
+	return max(3-file, file-4, 3-row, row-4, 0)
+}
@@ -0,0 +1,290 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Score is a pair of midgame and endgame values. The two halves are interpolated according to the
+// game phase once the whole position has been evaluated.
+type Score struct {
+	MG int `json:"mg"`
+	EG int `json:"eg"`
+}
+
+// S is shorthand for constructing a Score.
+func S(mg, eg int) Score {
+	return Score{MG: mg, EG: eg}
+}
+
+func (s Score) add(other Score) Score {
+	return Score{MG: s.MG + other.MG, EG: s.EG + other.EG}
+}
+
+func (s Score) sub(other Score) Score {
+	return Score{MG: s.MG - other.MG, EG: s.EG - other.EG}
+}
+
+func (s Score) mul(n int) Score {
+	return Score{MG: s.MG * n, EG: s.EG * n}
+}
+
+// Weights holds every parameter used by the evaluator. Piece-indexed arrays are ordered pawn,
+// knight, bishop, rook, queen, king, and piece-square tables are laid out from white's point of
+// view with a8 first, matching the square numbering in the squares package.
+type Weights struct {
+	Material [6]Score     `json:"material"`
+	PST      [6][64]Score `json:"pst"`
+
+	DoubledPawn  Score    `json:"doubled_pawn"`
+	IsolatedPawn Score    `json:"isolated_pawn"`
+	PassedPawn   [8]Score `json:"passed_pawn"` // indexed by relative rank - 1
+
+	// Mobility is the value of each safe square attacked by a knight, bishop, rook or queen.
+	Mobility [4]Score `json:"mobility"`
+
+	// KingAttackUnits is the number of attack units each knight, bishop, rook or queen contributes
+	// per square of the enemy king zone it attacks. The squared total is scaled by KingDanger.
+	KingAttackUnits  [4]int   `json:"king_attack_units"`
+	KingDanger       Score    `json:"king_danger"`
+	PawnShield       [2]Score `json:"pawn_shield"` // one and two ranks in front of the king
+	KingOpenFile     Score    `json:"king_open_file"`
+	KingSemiOpenFile Score    `json:"king_semi_open_file"`
+
+	Outpost          [2]Score `json:"outpost"` // knight, bishop
+	RookOpenFile     Score    `json:"rook_open_file"`
+	RookSemiOpenFile Score    `json:"rook_semi_open_file"`
+	BishopPair       Score    `json:"bishop_pair"`
+
+	Tempo Score `json:"tempo"`
+}
+
+// mobilityOffset is subtracted from each piece's safe square count so that a piece with typical
+// mobility scores roughly zero.
+var mobilityOffset = [4]int{4, 6, 6, 12}
+
+// DefaultWeights are the hand-tuned weights used when an evaluator is not given its own. The
+// material values and piece-square tables are PeSTO's.
+var DefaultWeights = Weights{
+	Material: [6]Score{S(82, 94), S(337, 281), S(365, 297), S(477, 512), S(1025, 936), S(0, 0)},
+	PST:      defaultPST(),
+
+	DoubledPawn:  S(-10, -20),
+	IsolatedPawn: S(-8, -12),
+	PassedPawn: [8]Score{
+		S(0, 0), S(0, 5), S(2, 8), S(8, 15), S(15, 30), S(30, 55), S(50, 80), S(0, 0),
+	},
+
+	Mobility: [4]Score{S(4, 4), S(5, 5), S(2, 4), S(1, 2)},
+
+	KingAttackUnits:  [4]int{2, 2, 3, 5},
+	KingDanger:       S(-20, -2),
+	PawnShield:       [2]Score{S(12, 0), S(6, 0)},
+	KingOpenFile:     S(-25, 0),
+	KingSemiOpenFile: S(-12, 0),
+
+	Outpost:          [2]Score{S(20, 10), S(12, 6)},
+	RookOpenFile:     S(25, 10),
+	RookSemiOpenFile: S(12, 6),
+	BishopPair:       S(30, 50),
+
+	Tempo: S(10, 5),
+}
+
+func defaultPST() [6][64]Score {
+	mg := [6][64]int{
+		{ // pawn
+			0, 0, 0, 0, 0, 0, 0, 0,
+			98, 134, 61, 95, 68, 126, 34, -11,
+			-6, 7, 26, 31, 65, 56, 25, -20,
+			-14, 13, 6, 21, 23, 12, 17, -23,
+			-27, -2, -5, 12, 17, 6, 10, -25,
+			-26, -4, -4, -10, 3, 3, 33, -12,
+			-35, -1, -20, -23, -15, 24, 38, -22,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		{ // knight
+			-167, -89, -34, -49, 61, -97, -15, -107,
+			-73, -41, 72, 36, 23, 62, 7, -17,
+			-47, 60, 37, 65, 84, 129, 73, 44,
+			-9, 17, 19, 53, 37, 69, 18, 22,
+			-13, 4, 16, 13, 28, 19, 21, -8,
+			-23, -9, 12, 10, 19, 17, 25, -16,
+			-29, -53, -12, -3, -1, 18, -14, -19,
+			-105, -21, -58, -33, -17, -28, -19, -23,
+		},
+		{ // bishop
+			-29, 4, -82, -37, -25, -42, 7, -8,
+			-26, 16, -18, -13, 30, 59, 18, -47,
+			-16, 37, 43, 40, 35, 50, 37, -2,
+			-4, 5, 19, 50, 37, 37, 7, -2,
+			-6, 13, 13, 26, 34, 12, 10, 4,
+			0, 15, 15, 15, 14, 27, 18, 10,
+			4, 15, 16, 0, 7, 21, 33, 1,
+			-33, -3, -14, -21, -13, -12, -39, -21,
+		},
+		{ // rook
+			32, 42, 32, 51, 63, 9, 31, 43,
+			27, 32, 58, 62, 80, 67, 26, 44,
+			-5, 19, 26, 36, 17, 45, 61, 16,
+			-24, -11, 7, 26, 24, 35, -8, -20,
+			-36, -26, -12, -1, 9, -7, 6, -23,
+			-45, -25, -16, -17, 3, 0, -5, -33,
+			-44, -16, -20, -9, -1, 11, -6, -71,
+			-19, -13, 1, 17, 16, 7, -37, -26,
+		},
+		{ // queen
+			-28, 0, 29, 12, 59, 44, 43, 45,
+			-24, -39, -5, 1, -16, 57, 28, 54,
+			-13, -17, 7, 8, 29, 56, 47, 57,
+			-27, -27, -16, -16, -1, 17, -2, 1,
+			-9, -26, -9, -10, -2, -4, 3, -3,
+			-14, 2, -11, -2, -5, 2, 14, 5,
+			-35, -8, 11, 2, 8, 15, -3, 1,
+			-1, -18, -9, 10, -15, -25, -31, -50,
+		},
+		{ // king
+			-65, 23, 16, -15, -56, -34, 2, 13,
+			29, -1, -20, -7, -8, -4, -38, -29,
+			-9, 24, 2, -16, -20, 6, 22, -22,
+			-17, -20, -12, -27, -30, -25, -14, -36,
+			-49, -1, -27, -39, -46, -44, -33, -51,
+			-14, -14, -22, -46, -44, -30, -15, -27,
+			1, 7, -8, -64, -43, -16, 9, 8,
+			-15, 36, 12, -54, 8, -28, 24, 14,
+		},
+	}
+
+	eg := [6][64]int{
+		{ // pawn
+			0, 0, 0, 0, 0, 0, 0, 0,
+			178, 173, 158, 134, 147, 132, 165, 187,
+			94, 100, 85, 67, 56, 53, 82, 84,
+			32, 24, 13, 5, -2, 4, 17, 17,
+			13, 9, -3, -7, -7, -8, 3, -1,
+			4, 7, -6, 1, 0, -5, -1, -8,
+			13, 8, 8, 10, 13, 0, 2, -7,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		{ // knight
+			-58, -38, -13, -28, -31, -27, -63, -99,
+			-25, -8, -25, -2, -9, -25, -24, -52,
+			-24, -20, 10, 9, -1, -9, -19, -41,
+			-17, 3, 22, 22, 22, 11, 8, -18,
+			-18, -6, 16, 25, 16, 17, 4, -18,
+			-23, -3, -1, 15, 10, -3, -20, -22,
+			-42, -20, -10, -5, -2, -20, -23, -44,
+			-29, -51, -23, -15, -22, -18, -50, -64,
+		},
+		{ // bishop
+			-14, -21, -11, -8, -7, -9, -17, -24,
+			-8, -4, 7, -12, -3, -13, -4, -14,
+			2, -8, 0, -1, -2, 6, 0, 4,
+			-3, 9, 12, 9, 14, 10, 3, 2,
+			-6, 3, 13, 19, 7, 10, -3, -9,
+			-12, -3, 8, 10, 13, 3, -7, -15,
+			-14, -18, -7, -1, 4, -9, -15, -27,
+			-23, -9, -23, -5, -9, -16, -5, -17,
+		},
+		{ // rook
+			13, 10, 18, 15, 12, 12, 8, 5,
+			11, 13, 13, 11, -3, 3, 8, 3,
+			7, 7, 7, 5, 4, -3, -5, -3,
+			4, 3, 13, 1, 2, 1, -1, 2,
+			3, 5, 8, 4, -5, -6, -8, -11,
+			-4, 0, -5, -1, -7, -12, -8, -16,
+			-6, -6, 0, 2, -9, -9, -11, -3,
+			-9, 2, 3, -1, -5, -13, 4, -20,
+		},
+		{ // queen
+			-9, 22, 22, 27, 27, 19, 10, 20,
+			-17, 20, 32, 41, 58, 25, 30, 0,
+			-20, 6, 9, 49, 47, 35, 19, 9,
+			3, 22, 24, 45, 57, 40, 57, 36,
+			-18, 28, 19, 47, 31, 34, 39, 23,
+			-16, -27, 15, 6, 9, 17, 10, 5,
+			-22, -23, -30, -16, -16, -23, -36, -32,
+			-33, -28, -22, -43, -5, -32, -20, -41,
+		},
+		{ // king
+			-74, -35, -18, -18, -11, 15, 4, -17,
+			-12, 17, 14, 17, 17, 38, 23, 11,
+			10, 17, 23, 15, 20, 45, 44, 13,
+			-8, 22, 24, 27, 26, 33, 26, 3,
+			-18, -4, 21, 24, 27, 23, 9, -11,
+			-19, -3, 11, 21, 23, 16, 7, -9,
+			-27, -11, 4, 13, 14, 4, -5, -17,
+			-53, -34, -21, -11, -28, -14, -24, -43,
+		},
+	}
+
+	var pst [6][64]Score
+
+	for pieceType := range 6 {
+		for square := range 64 {
+			pst[pieceType][square] = S(mg[pieceType][square], eg[pieceType][square])
+		}
+	}
+
+	return pst
+}
+
+// Params returns pointers to every tunable parameter in the weights, so that a tuner can adjust
+// them without knowing the layout of the struct. The king's material value and the pawn
+// piece-square entries on the first and last ranks are left out, since they can never affect the
+// evaluation.
+func (w *Weights) Params() []*int {
+	var ret []*int
+
+	addScores := func(scores ...*Score) {
+		for _, score := range scores {
+			ret = append(ret, &score.MG, &score.EG)
+		}
+	}
+
+	for pieceType := pawn; pieceType < king; pieceType++ {
+		addScores(&w.Material[pieceType])
+	}
+
+	for pieceType := range w.PST {
+		for square := range w.PST[pieceType] {
+			if pieceType == pawn && (square < 8 || square >= 56) {
+				continue
+			}
+
+			addScores(&w.PST[pieceType][square])
+		}
+	}
+
+	addScores(&w.DoubledPawn, &w.IsolatedPawn)
+
+	for rank := 1; rank < 7; rank++ {
+		addScores(&w.PassedPawn[rank])
+	}
+
+	for i := range w.Mobility {
+		addScores(&w.Mobility[i])
+	}
+
+	for i := range w.KingAttackUnits {
+		ret = append(ret, &w.KingAttackUnits[i])
+	}
+
+	addScores(&w.KingDanger, &w.PawnShield[0], &w.PawnShield[1], &w.KingOpenFile, &w.KingSemiOpenFile)
+	addScores(&w.Outpost[0], &w.Outpost[1], &w.RookOpenFile, &w.RookSemiOpenFile, &w.BishopPair)
+	addScores(&w.Tempo)
+
+	return ret
+}
+
+// LoadWeights reads weights from JSON, in the format written by encoding/json and by the tuner.
+func LoadWeights(r io.Reader) (*Weights, error) {
+	var ret Weights
+
+	if err := json.NewDecoder(r).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("failed to decode weights: %w", err)
+	}
+
+	return &ret, nil
+}
@@ -1,20 +1,26 @@
 package move
 
 import (
+	"strings"
+
 	"github.com/samwestmoreland/chessengine/internal/piece"
 	sq "github.com/samwestmoreland/chessengine/internal/squares"
 )
 
 // Moves are represented as bitmasks:
 //
-//	0000 0000 0000 0000 0011 1111    source square
-//	0000 0000 0000 1111 1100 0000    target square
-//	0000 0000 1111 0000 0000 0000    piece
-//	0000 1111 0000 0000 0000 0000    promotion piece
-//	0001 0000 0000 0000 0000 0000    capture flag
-//	0010 0000 0000 0000 0000 0000    double push flag
-//	0100 0000 0000 0000 0000 0000    en passant flag
-//	1000 0000 0000 0000 0000 0000    castling flag
+//	0000 0000 0000 0000 0000 0011 1111    source square
+//	0000 0000 0000 0000 1111 1100 0000    target square
+//	0000 0000 0000 1111 0000 0000 0000    piece
+//	0000 0000 1111 0000 0000 0000 0000    promotion piece
+//	0000 0001 0000 0000 0000 0000 0000    capture flag
+//	0000 0010 0000 0000 0000 0000 0000    double push flag
+//	0000 0100 0000 0000 0000 0000 0000    en passant flag
+//	0000 1000 0000 0000 0000 0000 0000    castling flag
+//	0001 0000 0000 0000 0000 0000 0000    drop flag
+//
+// A drop, which puts a piece from a Crazyhouse pocket onto the board, has the same source square as
+// its target.
 type Move uint32
 
 func Encode(
@@ -33,7 +39,19 @@ func Encode(
 			(castling << 23))
 }
 
+// EncodeDrop returns the move dropping the given piece onto the target square.
+func EncodeDrop(target sq.Square, dropPiece piece.Piece) Move {
+	return Encode(target, target, dropPiece, piece.NoPiece, 0, 0, 0, 0) | 1<<24
+}
+
+// String returns the move in coordinate notation, such as "e2e4" or "e7e8Q". Drops are written as
+// the piece, in upper case whichever side it belongs to, followed by an @ and the target square,
+// as in "N@f3".
 func (m Move) String() string {
+	if m.IsDrop() {
+		return strings.ToUpper(m.Piece().String()) + "@" + sq.Stringify(m.Target())
+	}
+
 	ret := sq.Stringify(m.Source()) + sq.Stringify(m.Target())
 
 	if m.PromotionPiece() != piece.NoPiece {
@@ -68,19 +86,23 @@ func (m Move) PromotionPiece() piece.Piece {
 }
 
 func (m Move) IsCapture() bool {
-	return (m >> 20) == 1
+	return (m>>20)&1 == 1
 }
 
 func (m Move) IsDoublePush() bool {
-	return (m >> 21) == 1
+	return (m>>21)&1 == 1
 }
 
 func (m Move) IsEnPassant() bool {
-	return (m >> 22) == 1
+	return (m>>22)&1 == 1
 }
 
 func (m Move) IsCastling() bool {
-	return (m >> 23) == 1
+	return (m>>23)&1 == 1
+}
+
+func (m Move) IsDrop() bool {
+	return (m>>24)&1 == 1
 }
 
 // Builder type for debugging and testing.
@@ -93,6 +115,7 @@ type Builder struct {
 	isDoublePush bool
 	isEnPassant  bool
 	isCastling   bool
+	isDrop       bool
 }
 
 func NewMove() *Builder {
@@ -156,11 +179,24 @@ func (b *Builder) Castling() *Builder {
 	return b
 }
 
+// Drop makes the move a drop, onto the square given with To.
+func (b *Builder) Drop() *Builder {
+	b.isDrop = true
+
+	return b
+}
+
 func (b *Builder) Build() Move {
 	var move Move
 
+	// A drop's source is its target.
+	source := b.source
+	if b.isDrop {
+		source = b.target
+	}
+
 	// Pack all the fields into the move
-	move |= Move(uint32(b.source))
+	move |= Move(uint32(source))
 	move |= Move(uint32(b.target) << 6)
 	move |= Move(uint32(b.piece) << 12)
 	move |= Move(uint32(b.promotion) << 16)
@@ -181,5 +217,9 @@ func (b *Builder) Build() Move {
 		move |= (1 << 23)
 	}
 
+	if b.isDrop {
+		move |= (1 << 24)
+	}
+
 	return move
 }
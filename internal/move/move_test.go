@@ -29,3 +29,25 @@ func TestExtractSourceAndTargetSquares(t *testing.T) {
 		t.Errorf("Expected promotion to be no piece, got %s", aMove.PromotionPiece().String())
 	}
 }
+
+func TestDrop(t *testing.T) {
+	t.Parallel()
+
+	drop := move.EncodeDrop(sq.E4, piece.Bn)
+
+	if !drop.IsDrop() || drop.IsCapture() || drop.Target() != sq.E4 || drop.Piece() != piece.Bn {
+		t.Errorf("EncodeDrop(e4, n) decoded as drop %v to %s of %s", drop.IsDrop(), drop.Target(), drop.Piece())
+	}
+
+	if got := drop.String(); got != "N@e4" {
+		t.Errorf("String() = %s, want N@e4", got)
+	}
+
+	if built := move.NewMove().To(sq.E4).Piece(piece.Bn).Drop().Build(); built != drop {
+		t.Errorf("Builder made %s, want %s", built, drop)
+	}
+
+	if quiet := move.Encode(sq.E2, sq.E4, piece.Wp, piece.NoPiece, 0, 1, 0, 0); quiet.IsDrop() {
+		t.Error("e2e4 is a drop")
+	}
+}
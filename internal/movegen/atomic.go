@@ -0,0 +1,77 @@
+package movegen
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// explode carries out the explosion of an Atomic capture on the given square of the position the
+// capture has been made in: the capturing piece and every piece other than a pawn next to the
+// square are removed, along with the castling rights of any king or rook among them.
+func explode(pos *position.Position, square sq.Square) {
+	pawns := pos.Occupancy[piece.Wp] | pos.Occupancy[piece.Bp]
+	blast := bb.SetBit(KingAttacks(square)&^pawns, square)
+
+	for ; blast != 0; blast = bb.ClearBit(blast, bb.LSBIndex(blast)) {
+		s := bb.LSBIndex(blast)
+
+		switch pos.PieceAt(s) {
+		case piece.NoPiece:
+			continue
+		case piece.Wk:
+			pos.CastlingRights &^= position.CastlingBits[0] | position.CastlingBits[1]
+		case piece.Bk:
+			pos.CastlingRights &^= position.CastlingBits[2] | position.CastlingBits[3]
+		}
+
+		for i, rook := range pos.CastlingRooks {
+			if rook == s {
+				pos.CastlingRights &^= position.CastlingBits[i]
+			}
+		}
+
+		pos.ClearSquare(s)
+	}
+}
+
+// isAtomicLegal reports whether a move is legal in Atomic, given the position it leads to. Kings
+// can't capture, and a move may not blow up the mover's own king. A move that blows up the enemy
+// king wins at once, so it's legal even if it leaves the mover's king attacked. Otherwise the
+// mover's king may not be left in check, which it can't be while it's next to the enemy king.
+func isAtomicLegal(pos, child *position.Position, m move.Move) bool {
+	if (m.Piece() == piece.Wk || m.Piece() == piece.Bk) && (m.IsCapture() || m.IsEnPassant()) {
+		return false
+	}
+
+	king, enemyKing := piece.Wk, piece.Bk
+	if !pos.WhiteToMove {
+		king, enemyKing = piece.Bk, piece.Wk
+	}
+
+	switch {
+	case child.Occupancy[king] == 0:
+		return false
+	case child.Occupancy[enemyKing] == 0:
+		return true
+	}
+
+	return !atomicAttacked(child, bb.LSBIndex(child.Occupancy[king]), !pos.WhiteToMove)
+}
+
+// atomicAttacked is SquareAttacked for a king in Atomic. A square next to the attacking side's
+// king isn't attacked, as capturing there would blow up that king too.
+func atomicAttacked(pos *position.Position, square sq.Square, whiteAttacking bool) bool {
+	king := pos.Occupancy[piece.Bk]
+	if whiteAttacking {
+		king = pos.Occupancy[piece.Wk]
+	}
+
+	if KingAttacks(square)&king != 0 {
+		return false
+	}
+
+	return SquareAttacked(pos, square, whiteAttacking)
+}
@@ -0,0 +1,78 @@
+package movegen
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// backRanks are the first and eighth ranks, which pawns can't be dropped on.
+var backRanks = bb.SetBits(0, sq.A1, sq.B1, sq.C1, sq.D1, sq.E1, sq.F1, sq.G1, sq.H1) |
+	bb.SetBits(0, sq.A8, sq.B8, sq.C8, sq.D8, sq.E8, sq.F8, sq.G8, sq.H8)
+
+// generateDrops adds the drops of the pieces the side to move has in hand onto the empty squares.
+func generateDrops(pos *position.Position, list *MoveList) {
+	pawn := piece.Wp
+	if !pos.WhiteToMove {
+		pawn = piece.Bp
+	}
+
+	empty := ^(pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba])
+
+	for p := pawn; p <= pawn+4; p++ {
+		if pos.Pockets[p] == 0 {
+			continue
+		}
+
+		targets := empty
+		if p == pawn {
+			targets &^= backRanks
+		}
+
+		for ; targets != 0; targets = bb.ClearBit(targets, bb.LSBIndex(targets)) {
+			list.add(move.EncodeDrop(bb.LSBIndex(targets), p))
+		}
+	}
+}
+
+// updateCrazyhouse updates the pieces in hand and the promoted pieces of the position reached by
+// a move: a captured piece goes into the mover's hand, as a pawn if it had been promoted, and a
+// promoted piece that moves stays promoted.
+func updateCrazyhouse(pos, child *position.Position, m move.Move) {
+	source, target := m.Source(), m.Target()
+
+	captured := piece.NoPiece
+
+	switch {
+	case m.IsEnPassant():
+		captured = piece.Wp
+	case m.IsCapture():
+		captured = pos.PieceAt(target)
+	}
+
+	if captured != piece.NoPiece {
+		// The captured piece's kind, counting from a pawn, changes sides.
+		kind := captured - piece.Wp
+		if captured >= piece.Bp {
+			kind = captured - piece.Bp
+		}
+
+		if bb.GetBit(pos.Promoted, target) {
+			kind = 0
+		}
+
+		if pos.WhiteToMove {
+			child.Pockets[piece.Wp+kind]++
+		} else {
+			child.Pockets[piece.Bp+kind]++
+		}
+	}
+
+	child.Promoted = bb.ClearBit(child.Promoted, target)
+
+	if !m.IsDrop() && bb.GetBit(pos.Promoted, source) || m.PromotionPiece() != piece.NoPiece {
+		child.Promoted = bb.SetBit(bb.ClearBit(child.Promoted, source), target)
+	}
+}
@@ -2,6 +2,7 @@ package movegen
 
 import (
 	"fmt"
+	"os"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
 	"github.com/samwestmoreland/chessengine/internal/move"
@@ -11,48 +12,125 @@ import (
 	"github.com/samwestmoreland/chessengine/internal/tables"
 )
 
-var lookupTables *tables.Lookup
+var (
+	lookupTables *tables.Lookup
+	// sliderAttacks is the implementation of slider attacks named by tables.SliderAttacksEnv, or
+	// nil for the magic tables in lookupTables. Those are the default, and slider lookups are the
+	// hottest part of move generation, so they're called directly rather than through the
+	// interface.
+	sliderAttacks tables.SliderAttacks
+)
 
-// Initialise populates the lookup tables which are stored as a global variable in this package.
+// Initialise picks the implementation of slider attacks named by tables.SliderAttacksEnv, the magic
+// tables by default, and populates the lookup tables which are stored as a global variable in this
+// package. The magic tables are only built and checked when they're the implementation picked.
 func Initialise() error {
-	lookupTables = &tables.Lookup{
-		Pawns:   [2][64]bb.Bitboard{},
-		Knights: [64]bb.Bitboard{},
-		Kings:   [64]bb.Bitboard{},
-		Bishops: [64][]bb.Bitboard{},
-		Rooks:   [64][]bb.Bitboard{},
-	}
+	lookupTables = &tables.Lookup{}
+
+	var err error
 
-	err := tables.InitialiseLookupTables(lookupTables)
+	sliderAttacks, err = tables.NewSliderAttacks(os.Getenv(tables.SliderAttacksEnv), lookupTables)
 	if err != nil {
+		return fmt.Errorf("failed to initialise slider attacks: %w", err)
+	}
+
+	if sliderAttacks != tables.SliderAttacks(lookupTables) {
+		tables.InitialiseLeaperTables(lookupTables)
+
+		return nil
+	}
+
+	sliderAttacks = nil
+
+	if err := tables.InitialiseLookupTables(lookupTables); err != nil {
 		return fmt.Errorf("failed to initialise lookup tables: %w", err)
 	}
 
 	return nil
 }
 
+// GetLegalMoves returns every legal move in the position. In Antichess, where captures are
+// compulsory, only the captures are returned if there are any. It allocates the slice it returns;
+// GenerateLegalMoves fills a MoveList instead.
 func GetLegalMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
+	var list MoveList
+
+	GenerateLegalMoves(pos, &list)
+
+	return append([]move.Move(nil), list.Slice()...)
+}
 
+// GenerateLegalMoves fills the list with every legal move in the position, as GetLegalMoves returns
+// them, without allocating.
+func GenerateLegalMoves(pos *position.Position, list *MoveList) {
+	generatePseudoLegalMoves(pos, list)
+
+	legal, captures := 0, 0
+
+	for _, m := range list.Slice() {
+		if IsLegal(pos, m) {
+			list.Moves[legal] = m
+			legal++
+
+			if m.IsCapture() || m.IsEnPassant() {
+				captures++
+			}
+		}
+	}
+
+	list.Count = legal
+
+	if pos.Variant == position.Antichess && captures > 0 {
+		list.Count = 0
+
+		for _, m := range list.Moves[:legal] {
+			if m.IsCapture() || m.IsEnPassant() {
+				list.add(m)
+			}
+		}
+	}
+}
+
+// IsLegal returns true if the pseudo-legal move does not leave the mover's own king in check. In
+// Racing Kings, moves that give check aren't legal either. Atomic has rules of its own, and in
+// Antichess, where the king can be captured like any other piece, every pseudo-legal move is legal.
+func IsLegal(pos *position.Position, m move.Move) bool {
+	if pos.Variant == position.Antichess {
+		return true
+	}
+
+	child := *pos
+	makeMove(pos, &child, m)
+
+	switch {
+	case pos.Variant == position.Atomic:
+		return isAtomicLegal(pos, &child, m)
+	case pos.Variant == position.RacingKings && InCheck(&child):
+		return false
+	}
+
+	king := child.Occupancy[piece.Wk]
 	if pos.WhiteToMove {
-		ret = append(ret, getPawnMoves(pos, piece.White)...)
-		ret = append(ret, getWhiteKingCastlingMoves(pos)...)
-		ret = append(ret, getWhiteKnightMoves(pos)...)
-		ret = append(ret, getWhiteBishopMoves(pos)...)
-		ret = append(ret, getWhiteRookMoves(pos)...)
-		ret = append(ret, getWhiteKingMoves(pos)...)
-		ret = append(ret, getQueenMoves(pos, piece.White)...)
-	} else {
-		ret = append(ret, getPawnMoves(pos, piece.Black)...)
-		ret = append(ret, getBlackKingCastlingMoves(pos)...)
-		ret = append(ret, getBlackKnightMoves(pos)...)
-		ret = append(ret, getBlackBishopMoves(pos)...)
-		ret = append(ret, getBlackRookMoves(pos)...)
-		ret = append(ret, getBlackKingMoves(pos)...)
-		ret = append(ret, getQueenMoves(pos, piece.Black)...)
+		return king == 0 || !SquareAttacked(&child, bb.LSBIndex(king), false)
 	}
 
-	return ret
+	king = child.Occupancy[piece.Bk]
+
+	return king == 0 || !SquareAttacked(&child, bb.LSBIndex(king), true)
+}
+
+// generatePseudoLegalMoves fills the list with the moves of the side to move, some of which may
+// leave its king in check.
+func generatePseudoLegalMoves(pos *position.Position, list *MoveList) {
+	list.Count = 0
+
+	generatePawnMoves(pos, list)
+	generateCastlingMoves(pos, list)
+	generatePieceMoves(pos, list)
+
+	if pos.Variant == position.Crazyhouse {
+		generateDrops(pos, list)
+	}
 }
 
 // SquareAttacked returns true if the given square is attacked by any opposing pieces.
@@ -87,489 +165,436 @@ func SquareAttacked(pos *position.Position, square sq.Square, whiteAttacking boo
 
 	// Calculate indices for sliding pieces
 	allPieces := pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba]
+	diagonal := pos.Occupancy[pieces[3]] | pos.Occupancy[pieces[5]]
+	straight := pos.Occupancy[pieces[4]] | pos.Occupancy[pieces[5]]
 
-	// Check bishop attacks
-	bishopIndex := tables.GetBishopLookupIndex(square, allPieces)
-	if lookupTables.Bishops[square][bishopIndex]&pos.Occupancy[pieces[3]] != 0 {
-		return true
+	if sliderAttacks != nil {
+		return sliderAttacks.BishopAttacks(square, allPieces)&diagonal != 0 ||
+			sliderAttacks.RookAttacks(square, allPieces)&straight != 0
 	}
 
-	// Check rook attacks
-	rookIndex := tables.GetRookLookupIndex(square, allPieces)
-	if lookupTables.Rooks[square][rookIndex]&pos.Occupancy[pieces[4]] != 0 {
-		return true
-	}
+	// Check bishop and queen attacks, then rook and queen attacks
+	return lookupTables.BishopAttacks(square, allPieces)&diagonal != 0 ||
+		lookupTables.RookAttacks(square, allPieces)&straight != 0
+}
 
-	// Check queen attacks
-	if lookupTables.Bishops[square][bishopIndex]&pos.Occupancy[pieces[5]] != 0 ||
-		lookupTables.Rooks[square][rookIndex]&pos.Occupancy[pieces[5]] != 0 {
-		return true
+// Masks of the edges of the board, for generating pawn moves set-wise.
+const (
+	fileA bb.Bitboard = 0x0101010101010101
+	fileH             = fileA << 7
+	rank8 bb.Bitboard = 0xff
+	rank6             = rank8 << 16
+	rank3             = rank8 << 40
+	rank1             = rank8 << 56
+)
+
+// shift moves every square of a bitboard by the given number of squares, towards the first rank if
+// it's positive and towards the eighth if it's negative.
+func shift(b bb.Bitboard, squares int) bb.Bitboard {
+	if squares < 0 {
+		return b >> -squares
 	}
 
-	return false
+	return b << squares
 }
 
-func getPawnMoves(pos *position.Position, colour piece.Colour) []move.Move {
-	var ret []move.Move
-
-	var pawnPiece, queenPiece, rookPiece, bishopPiece, knightPiece piece.Piece
+// generatePawnMoves adds the pawn moves of the side to move. The pushes and captures of all the
+// pawns are found at once by shifting the bitboard of pawns, rather than pawn by pawn.
+func generatePawnMoves(pos *position.Position, list *MoveList) {
+	pawn, enemy, forward, doublePushRank := piece.Wp, piece.Ba, -8, rank3
+	if !pos.WhiteToMove {
+		pawn, enemy, forward, doublePushRank = piece.Bp, piece.Wa, 8, rank6
+	}
 
-	var enemyPieces piece.Piece
+	pawns := pos.Occupancy[pawn]
+	empty := ^(pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba])
 
-	var penultimateRank, startRank int
+	pushes := shift(pawns, forward) & empty
+	addPawnMoves(pos, list, pushes, forward, 0)
 
-	if colour == piece.White {
-		pawnPiece = piece.Wp
-		queenPiece = piece.Wq
-		rookPiece = piece.Wr
-		bishopPiece = piece.Wb
-		knightPiece = piece.Wn
-		enemyPieces = piece.Ba
-		penultimateRank = 7
-		startRank = 2
-	} else {
-		pawnPiece = piece.Bp
-		queenPiece = piece.Bq
-		rookPiece = piece.Br
-		bishopPiece = piece.Bb
-		knightPiece = piece.Bn
-		enemyPieces = piece.Wa
-		penultimateRank = 2
-		startRank = 7
+	doublePushes := shift(pushes&doublePushRank, forward) & empty
+	for ; doublePushes != 0; doublePushes = bb.ClearBit(doublePushes, bb.LSBIndex(doublePushes)) {
+		target := bb.LSBIndex(doublePushes)
+		list.add(move.Encode(sq.Square(int(target)-2*forward), target, pawn, piece.NoPiece, 0, 1, 0, 0))
 	}
 
-	pawns := pos.Occupancy[pawnPiece]
-
-	for pawns != 0 {
-		source := bb.LSBIndex(pawns)
-
-		var target, doublePush sq.Square
-		if colour == piece.White {
-			target = source - 8
-			doublePush = source - 16
-		} else {
-			target = source + 8
-			doublePush = source + 16
+	// Captures towards the a file and towards the h file, leaving out the pawns that would wrap
+	// around to the other side of the board.
+	addPawnMoves(pos, list, shift(pawns&^fileA, forward-1)&pos.Occupancy[enemy], forward-1, 1)
+	addPawnMoves(pos, list, shift(pawns&^fileH, forward+1)&pos.Occupancy[enemy], forward+1, 1)
+
+	if pos.EnPassantSquare != sq.NoSquare {
+		// The pawns that can take en passant are those an enemy pawn on the en passant square would
+		// attack.
+		them := piece.Black
+		if !pos.WhiteToMove {
+			them = piece.White
 		}
 
-		// Pawn advances
-		if sq.OnBoard(target) && !pos.IsOccupied(target) {
-			// Check promotion
-			if bb.IsNthRank(penultimateRank, source) {
-				promotionMoves := []move.Move{
-					move.Encode(source, target, pawnPiece, queenPiece, 0, 0, 0, 0),
-					move.Encode(source, target, pawnPiece, rookPiece, 0, 0, 0, 0),
-					move.Encode(source, target, pawnPiece, bishopPiece, 0, 0, 0, 0),
-					move.Encode(source, target, pawnPiece, knightPiece, 0, 0, 0, 0),
-				}
-
-				ret = append(ret, promotionMoves...)
-			} else {
-				ret = append(ret,
-					move.Encode(source, target, pawnPiece, piece.NoPiece, 0, 0, 0, 0),
-				)
-
-				// Double push
-				if bb.IsNthRank(startRank, source) && !pos.IsOccupied(doublePush) {
-					ret = append(ret,
-						move.Encode(source, doublePush, pawnPiece, piece.NoPiece, 0, 1, 0, 0),
-					)
-				}
-			}
+		attackers := lookupTables.Pawns[them][pos.EnPassantSquare] & pawns
+		for ; attackers != 0; attackers = bb.ClearBit(attackers, bb.LSBIndex(attackers)) {
+			list.add(move.Encode(bb.LSBIndex(attackers), pos.EnPassantSquare, pawn, piece.NoPiece, 0, 0, 1, 0))
 		}
+	}
+}
 
-		// Pawn captures
-		attacks := lookupTables.Pawns[colour][source] & pos.Occupancy[enemyPieces]
-
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
-
-			if bb.IsNthRank(penultimateRank, source) {
-				promotionMoves := []move.Move{
-					move.Encode(source, target, pawnPiece, queenPiece, 1, 0, 0, 0),
-					move.Encode(source, target, pawnPiece, rookPiece, 1, 0, 0, 0),
-					move.Encode(source, target, pawnPiece, bishopPiece, 1, 0, 0, 0),
-					move.Encode(source, target, pawnPiece, knightPiece, 1, 0, 0, 0),
-				}
+// addPawnMoves adds the moves of the side to move's pawns to each of the target squares from the
+// square the given number of squares behind it, with every promotion for the targets on the back
+// rank.
+func addPawnMoves(pos *position.Position, list *MoveList, targets bb.Bitboard, squares int, capture uint32) {
+	pawn := piece.Wp
+	if !pos.WhiteToMove {
+		pawn = piece.Bp
+	}
 
-				ret = append(ret, promotionMoves...)
-			} else {
-				ret = append(ret,
-					move.Encode(source, target, pawnPiece, piece.NoPiece, 1, 0, 0, 0),
-				)
-			}
+	queen, rook, bishop, knight, king := pawn+4, pawn+3, pawn+2, pawn+1, pawn+5
 
-			attacks = bb.ClearBit(attacks, target)
-		}
+	for ; targets != 0; targets = bb.ClearBit(targets, bb.LSBIndex(targets)) {
+		target := bb.LSBIndex(targets)
+		source := sq.Square(int(target) - squares)
 
-		if pos.EnPassantSquare != sq.NoSquare {
-			enpassant := lookupTables.Pawns[colour][source] & bb.SetBit(0, pos.EnPassantSquare)
+		if bb.GetBit(rank8|rank1, target) {
+			list.add(move.Encode(source, target, pawn, queen, capture, 0, 0, 0))
+			list.add(move.Encode(source, target, pawn, rook, capture, 0, 0, 0))
+			list.add(move.Encode(source, target, pawn, bishop, capture, 0, 0, 0))
+			list.add(move.Encode(source, target, pawn, knight, capture, 0, 0, 0))
 
-			if enpassant != 0 {
-				ret = append(ret,
-					move.Encode(source, pos.EnPassantSquare, pawnPiece, piece.NoPiece, 0, 0, 1, 0),
-				)
+			// In Antichess pawns can promote to a king as well.
+			if pos.Variant == position.Antichess {
+				list.add(move.Encode(source, target, pawn, king, capture, 0, 0, 0))
 			}
+
+			continue
 		}
 
-		pawns = bb.ClearBit(pawns, source)
+		list.add(move.Encode(source, target, pawn, piece.NoPiece, capture, 0, 0, 0))
 	}
-
-	return ret
 }
 
-func getWhiteKingCastlingMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	// King side castle
-	if pos.CastlingRights&8 != 0 {
-		// Check if pieces are in the way or if squares are attacked
-		if !pos.IsOccupied(sq.F1) &&
-			!pos.IsOccupied(sq.G1) &&
-			!SquareAttacked(pos, sq.E1, false) &&
-			!SquareAttacked(pos, sq.F1, false) &&
-			!SquareAttacked(pos, sq.G1, false) {
-			ret = append(ret, move.Encode(sq.E1, sq.G1, piece.Wk, piece.NoPiece, 0, 0, 0, 1))
-		}
+// generateCastlingMoves adds the castling moves of the side to move. The rules are those of Chess960,
+// which standard chess is a special case of: the king ends up on the g file and the rook on the f
+// file when castling kingside, and on the c and d files when castling queenside; every square the
+// king or the rook crosses or lands on must be empty, other than the squares the two of them start
+// on; and the king may not be in check or cross or land on an attacked square. There is no
+// castling in Antichess.
+func generateCastlingMoves(pos *position.Position, list *MoveList) {
+	if pos.Variant == position.Antichess {
+		return
 	}
 
-	// Queen side castle
-	if pos.CastlingRights&4 != 0 {
-		// Check if pieces are in the way
-		if !pos.IsOccupied(sq.D1) &&
-			!pos.IsOccupied(sq.C1) &&
-			!pos.IsOccupied(sq.B1) &&
-			!SquareAttacked(pos, sq.E1, false) &&
-			!SquareAttacked(pos, sq.D1, false) &&
-			!SquareAttacked(pos, sq.C1, false) {
-			ret = append(ret, move.Encode(sq.E1, sq.C1, piece.Wk, piece.NoPiece, 0, 0, 0, 1))
-		}
-	}
-
-	return ret
-}
-
-func getBlackKingCastlingMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	// King side castle
-	if pos.CastlingRights&2 != 0 {
-		// Check if pieces are in the way
-		if !pos.IsOccupied(sq.F8) &&
-			!pos.IsOccupied(sq.G8) &&
-			!SquareAttacked(pos, sq.E8, true) &&
-			!SquareAttacked(pos, sq.F8, true) &&
-			!SquareAttacked(pos, sq.G8, true) {
-			ret = append(ret, move.Encode(sq.E8, sq.G8, piece.Bk, piece.NoPiece, 0, 0, 0, 1))
-		}
+	king, rook, first, backRank := piece.Wk, piece.Wr, 0, sq.Square(sq.A1)
+	if !pos.WhiteToMove {
+		king, rook, first, backRank = piece.Bk, piece.Br, 2, sq.A8
 	}
 
-	// Queen side castle
-	if pos.CastlingRights&1 != 0 {
-		// Check if pieces are in the way
-		if !pos.IsOccupied(sq.D8) &&
-			!pos.IsOccupied(sq.C8) &&
-			!pos.IsOccupied(sq.B8) &&
-			!SquareAttacked(pos, sq.E8, true) &&
-			!SquareAttacked(pos, sq.D8, true) &&
-			!SquareAttacked(pos, sq.C8, true) {
-			ret = append(ret, move.Encode(sq.E8, sq.C8, piece.Bk, piece.NoPiece, 0, 0, 0, 1))
-		}
+	if pos.CastlingRights&(position.CastlingBits[first]|position.CastlingBits[first+1]) == 0 ||
+		pos.Occupancy[king] == 0 {
+		return
 	}
 
-	return ret
-}
+	kingSource := bb.LSBIndex(pos.Occupancy[king])
+	occupied := pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba]
 
-func getWhiteKnightMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
+	for i := first; i < first+2; i++ {
+		rookSource := pos.CastlingRooks[i]
 
-	knights := pos.Occupancy[piece.Wn]
+		if pos.CastlingRights&position.CastlingBits[i] == 0 || !bb.GetBit(pos.Occupancy[rook], rookSource) {
+			continue
+		}
 
-	for knights != 0 {
-		source := bb.LSBIndex(knights)
-		knights = bb.ClearBit(knights, source)
+		kingTarget, rookTarget := backRank+6, backRank+5
+		if i == first+1 {
+			kingTarget, rookTarget = backRank+2, backRank+3
+		}
 
-		attacks := lookupTables.Knights[source] &^ pos.Occupancy[piece.Wa]
+		others := bb.ClearBit(bb.ClearBit(occupied, kingSource), rookSource)
+		if others&(rankSpan(kingSource, kingTarget)|rankSpan(rookSource, rookTarget)) != 0 {
+			continue
+		}
 
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
+		attacked := false
 
-			if pos.Occupancy[piece.Ba]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Wn, piece.NoPiece, 1, 0, 0, 0))
+		for path := rankSpan(kingSource, kingTarget); path != 0 && !attacked; path = bb.ClearBit(path, bb.LSBIndex(path)) {
+			if pos.Variant == position.Atomic {
+				attacked = atomicAttacked(pos, bb.LSBIndex(path), !pos.WhiteToMove)
 			} else {
-				ret = append(ret, move.Encode(source, target, piece.Wn, piece.NoPiece, 0, 0, 0, 0))
+				attacked = SquareAttacked(pos, bb.LSBIndex(path), !pos.WhiteToMove)
 			}
+		}
 
-			attacks = bb.ClearBit(attacks, target)
+		if !attacked {
+			list.add(move.Encode(kingSource, kingTarget, king, piece.NoPiece, 0, 0, 0, 1))
 		}
 	}
-
-	return ret
 }
 
-func getBlackKnightMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	knights := pos.Occupancy[piece.Bn]
-
-	for knights != 0 {
-		source := bb.LSBIndex(knights)
-		knights = bb.ClearBit(knights, source)
+// rankSpan returns the squares from one square to another on the same rank, both included.
+func rankSpan(from, to sq.Square) bb.Bitboard {
+	var ret bb.Bitboard
 
-		attacks := lookupTables.Knights[source] &^ pos.Occupancy[piece.Ba]
-
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
-
-			if pos.Occupancy[piece.Wa]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Bn, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Bn, piece.NoPiece, 0, 0, 0, 0))
-			}
-
-			attacks = bb.ClearBit(attacks, target)
-		}
+	for s := min(from, to); s <= max(from, to); s++ {
+		ret = bb.SetBit(ret, s)
 	}
 
 	return ret
 }
 
-func getWhiteBishopMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	bishops := pos.Occupancy[piece.Wb]
+// generatePieceMoves adds the moves of the side to move's knights, bishops, rooks, queens and
+// king.
+func generatePieceMoves(pos *position.Position, list *MoveList) {
+	pawn, own, enemy := piece.Wp, piece.Wa, piece.Ba
+	if !pos.WhiteToMove {
+		pawn, own, enemy = piece.Bp, piece.Ba, piece.Wa
+	}
 
-	for bishops != 0 {
-		source := bb.LSBIndex(bishops)
-		bishops = bb.ClearBit(bishops, source)
+	occupied := pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba]
 
-		index := tables.GetBishopLookupIndex(source, pos.Occupancy[piece.Wa]|pos.Occupancy[piece.Ba])
+	for p := pawn + 1; p <= pawn+5; p++ {
+		for pieces := pos.Occupancy[p]; pieces != 0; pieces = bb.ClearBit(pieces, bb.LSBIndex(pieces)) {
+			source := bb.LSBIndex(pieces)
 
-		attacks := lookupTables.Bishops[source][index] &^ pos.Occupancy[piece.Wa]
+			targets := attacks(p, source, occupied) &^ pos.Occupancy[own]
+			for ; targets != 0; targets = bb.ClearBit(targets, bb.LSBIndex(targets)) {
+				target := bb.LSBIndex(targets)
 
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
+				var capture uint32
+				if bb.GetBit(pos.Occupancy[enemy], target) {
+					capture = 1
+				}
 
-			if pos.Occupancy[piece.Ba]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Wb, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Wb, piece.NoPiece, 0, 0, 0, 0))
+				list.add(move.Encode(source, target, p, piece.NoPiece, capture, 0, 0, 0))
 			}
-
-			attacks = bb.ClearBit(attacks, target)
 		}
 	}
-
-	return ret
 }
 
-func getBlackBishopMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	bishops := pos.Occupancy[piece.Bb]
-
-	for bishops != 0 {
-		source := bb.LSBIndex(bishops)
-		bishops = bb.ClearBit(bishops, source)
-
-		index := tables.GetBishopLookupIndex(source, pos.Occupancy[piece.Wa]|pos.Occupancy[piece.Ba])
-
-		attacks := lookupTables.Bishops[source][index] &^ pos.Occupancy[piece.Ba]
-
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
-
-			if pos.Occupancy[piece.Wa]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Bb, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Bb, piece.NoPiece, 0, 0, 0, 0))
-			}
+// attacks returns the squares attacked by a piece other than a pawn on the given square, given the
+// occupancy of the board.
+func attacks(p piece.Piece, square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	switch p {
+	case piece.Wn, piece.Bn:
+		return KnightAttacks(square)
+	case piece.Wk, piece.Bk:
+		return KingAttacks(square)
+	}
 
-			attacks = bb.ClearBit(attacks, target)
+	if sliderAttacks != nil {
+		switch p {
+		case piece.Wb, piece.Bb:
+			return sliderAttacks.BishopAttacks(square, occupancy)
+		case piece.Wr, piece.Br:
+			return sliderAttacks.RookAttacks(square, occupancy)
+		default:
+			return sliderAttacks.BishopAttacks(square, occupancy) | sliderAttacks.RookAttacks(square, occupancy)
 		}
 	}
 
-	return ret
+	switch p {
+	case piece.Wb, piece.Bb:
+		return lookupTables.BishopAttacks(square, occupancy)
+	case piece.Wr, piece.Br:
+		return lookupTables.RookAttacks(square, occupancy)
+	default:
+		return lookupTables.BishopAttacks(square, occupancy) | lookupTables.RookAttacks(square, occupancy)
+	}
 }
 
-func getWhiteRookMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	rooks := pos.Occupancy[piece.Wr]
-
-	for rooks != 0 {
-		source := bb.LSBIndex(rooks)
-		rooks = bb.ClearBit(rooks, source)
+// MakeMove returns the position reached by playing the given move. The original position is left
+// untouched. If capturesOnly is set, quiet moves are not made and the original position is
+// returned instead.
+func MakeMove(pos *position.Position, m move.Move, capturesOnly bool) *position.Position {
+	if capturesOnly && !m.IsCapture() && !m.IsEnPassant() {
+		return pos
+	}
 
-		index := tables.GetRookLookupIndex(source, pos.Occupancy[piece.Wa]|pos.Occupancy[piece.Ba])
+	ret := *pos
+	makeMove(pos, &ret, m)
 
-		attacks := lookupTables.Rooks[source][index] &^ pos.Occupancy[piece.Wa]
+	return &ret
+}
 
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
+// MakeMoveInto is MakeMove without the allocation: the position the move leads to is written to
+// child, which may be reused from one move to the next. pos is left untouched.
+func MakeMoveInto(pos, child *position.Position, m move.Move) {
+	*child = *pos
+	makeMove(pos, child, m)
+}
 
-			if pos.Occupancy[piece.Ba]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Wr, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Wr, piece.NoPiece, 0, 0, 0, 0))
-			}
+// makeMove plays a move on child, which starts out as a copy of pos, the position the move is
+// played in.
+func makeMove(pos, child *position.Position, m move.Move) {
+	source := m.Source()
+	target := m.Target()
+	movePiece := m.Piece()
 
-			attacks = bb.ClearBit(attacks, target)
-		}
+	placed := movePiece
+	if m.PromotionPiece() != piece.NoPiece {
+		placed = m.PromotionPiece()
 	}
 
-	return ret
-}
+	switch {
+	case m.IsDrop():
+		child.PlacePiece(target, movePiece)
+		child.Pockets[movePiece]--
+	case m.IsEnPassant():
+		if pos.WhiteToMove {
+			child.ClearSquare(target + 8)
+		} else {
+			child.ClearSquare(target - 8)
+		}
 
-func getBlackRookMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
+		child.ClearSquare(source)
+		child.PlacePiece(target, placed)
+	case m.IsCastling():
+		// In Chess960 the king or the rook can start on the other's target square, so both are
+		// lifted before either is put down.
+		rookSource, rookTarget := castlingRookSquares(pos, target)
+
+		child.ClearSquare(source)
+		child.ClearSquare(rookSource)
+		child.PlacePiece(target, movePiece)
+		child.PlacePiece(rookTarget, rookPiece(pos.WhiteToMove))
+	default:
+		child.ClearSquare(target)
+		child.ClearSquare(source)
+		child.PlacePiece(target, placed)
+	}
 
-	rooks := pos.Occupancy[piece.Br]
+	switch {
+	case pos.Variant == position.Crazyhouse:
+		updateCrazyhouse(pos, child, m)
+	case pos.Variant == position.Atomic && (m.IsCapture() || m.IsEnPassant()):
+		explode(child, target)
+	}
 
-	for rooks != 0 {
-		source := bb.LSBIndex(rooks)
-		rooks = bb.ClearBit(rooks, source)
+	child.CastlingRights &^= castlingRightsLost(pos, movePiece, source, target)
 
-		index := tables.GetRookLookupIndex(source, pos.Occupancy[piece.Wa]|pos.Occupancy[piece.Ba])
+	child.EnPassantSquare = sq.NoSquare
+	if m.IsDoublePush() {
+		child.EnPassantSquare = (source + target) / 2
+	}
 
-		attacks := lookupTables.Rooks[source][index] &^ pos.Occupancy[piece.Ba]
+	if movePiece == piece.Wp || movePiece == piece.Bp || m.IsCapture() {
+		child.HalfMoveClock = 0
+	} else {
+		child.HalfMoveClock++
+	}
 
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
+	if !pos.WhiteToMove {
+		child.FullMoveNumber++
+	}
 
-			if pos.Occupancy[piece.Wa]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Br, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Br, piece.NoPiece, 0, 0, 0, 0))
-			}
+	child.WhiteToMove = !pos.WhiteToMove
 
-			attacks = bb.ClearBit(attacks, target)
+	if pos.Variant == position.ThreeCheck && InCheck(child) {
+		if pos.WhiteToMove {
+			child.Checks[0]++
+		} else {
+			child.Checks[1]++
 		}
 	}
-
-	return ret
 }
 
-func getWhiteKingMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	king := pos.Occupancy[piece.Wk]
-
-	for king != 0 {
-		source := bb.LSBIndex(king)
-		king = bb.ClearBit(king, source)
-
-		attacks := lookupTables.Kings[source] &^ pos.Occupancy[piece.Wa]
+// castlingRightsLost returns the castling rights lost by a move: both of a side's rights when its
+// king moves, and the right of a rook that moves or is captured.
+func castlingRightsLost(pos *position.Position, movePiece piece.Piece, source, target sq.Square) uint8 {
+	var ret uint8
 
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
-
-			if pos.Occupancy[piece.Ba]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Wk, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Wk, piece.NoPiece, 0, 0, 0, 0))
-			}
+	switch movePiece {
+	case piece.Wk:
+		ret |= position.CastlingBits[0] | position.CastlingBits[1]
+	case piece.Bk:
+		ret |= position.CastlingBits[2] | position.CastlingBits[3]
+	}
 
-			attacks = bb.ClearBit(attacks, target)
+	for i, s := range pos.CastlingRooks {
+		if s == source || s == target {
+			ret |= position.CastlingBits[i]
 		}
 	}
 
 	return ret
 }
 
-func getBlackKingMoves(pos *position.Position) []move.Move {
-	var ret []move.Move
-
-	king := pos.Occupancy[piece.Bk]
-
-	for king != 0 {
-		source := bb.LSBIndex(king)
-		king = bb.ClearBit(king, source)
-
-		attacks := lookupTables.Kings[source] &^ pos.Occupancy[piece.Ba]
-
-		for attacks != 0 {
-			target := bb.LSBIndex(attacks)
-
-			if pos.Occupancy[piece.Wa]&(bb.SetBit(0, target)) != 0 {
-				ret = append(ret, move.Encode(source, target, piece.Bk, piece.NoPiece, 1, 0, 0, 0))
-			} else {
-				ret = append(ret, move.Encode(source, target, piece.Bk, piece.NoPiece, 0, 0, 0, 0))
-			}
+// castlingRookSquares returns the source and target squares of the rook when the king castles to
+// the given square.
+func castlingRookSquares(pos *position.Position, kingTarget sq.Square) (sq.Square, sq.Square) {
+	i := 0
+	if !pos.WhiteToMove {
+		i = 2
+	}
 
-			attacks = bb.ClearBit(attacks, target)
-		}
+	// Kingside castling takes the king to the g file, and the rook to the f file next to it.
+	if kingTarget.File() == 7 {
+		return pos.CastlingRooks[i], kingTarget - 1
 	}
 
-	return ret
+	return pos.CastlingRooks[i+1], kingTarget + 1
 }
 
-func getQueenMoves(pos *position.Position, colour piece.Colour) []move.Move {
-	var ret []move.Move
-
-	var queenPiece piece.Piece
-
-	var ownOccupancy, enemyOccupancy piece.Piece
-
-	if colour == piece.White {
-		queenPiece = piece.Wq
-		ownOccupancy = piece.Wa
-		enemyOccupancy = piece.Ba
-	} else {
-		queenPiece = piece.Bq
-		ownOccupancy = piece.Ba
-		enemyOccupancy = piece.Wa
+func rookPiece(white bool) piece.Piece {
+	if white {
+		return piece.Wr
 	}
 
-	queens := pos.Occupancy[queenPiece]
+	return piece.Br
+}
 
-	for queens != 0 {
-		source := bb.LSBIndex(queens)
-		queens = bb.ClearBit(queens, source)
+// InCheck returns true if the side to move is in check. There is no check in Antichess, and in
+// Atomic a king can't be in check while it's next to the enemy king.
+func InCheck(pos *position.Position) bool {
+	king := pos.Occupancy[piece.Bk]
+	if pos.WhiteToMove {
+		king = pos.Occupancy[piece.Wk]
+	}
 
-		allPieces := pos.Occupancy[ownOccupancy] | pos.Occupancy[enemyOccupancy]
-		bishopTableIndex := tables.GetBishopLookupIndex(source, allPieces)
-		rookTableIndex := tables.GetRookLookupIndex(source, allPieces)
+	switch {
+	case king == 0 || pos.Variant == position.Antichess:
+		return false
+	case pos.Variant == position.Atomic:
+		return atomicAttacked(pos, bb.LSBIndex(king), !pos.WhiteToMove)
+	}
 
-		bishopAttacks := lookupTables.Bishops[source][bishopTableIndex] &^ pos.Occupancy[ownOccupancy]
-		rookAttacks := lookupTables.Rooks[source][rookTableIndex] &^ pos.Occupancy[ownOccupancy]
+	return SquareAttacked(pos, bb.LSBIndex(king), !pos.WhiteToMove)
+}
 
-		// Helper function to avoid duplication in move generation
-		addMoves := func(attacks bb.Bitboard) {
-			for attacks != 0 {
-				target := bb.LSBIndex(attacks)
+// PawnAttacks returns the squares attacked by a pawn of the given colour on the given square.
+func PawnAttacks(colour piece.Colour, square sq.Square) bb.Bitboard {
+	return lookupTables.Pawns[colour][square]
+}
 
-				var captureFlag uint32
-				if pos.Occupancy[enemyOccupancy]&(bb.SetBit(0, target)) != 0 {
-					captureFlag = 1
-				}
+// KnightAttacks returns the squares attacked by a knight on the given square.
+func KnightAttacks(square sq.Square) bb.Bitboard {
+	return lookupTables.Knights[square]
+}
 
-				ret = append(ret, move.Encode(source, target, queenPiece, piece.NoPiece, captureFlag, 0, 0, 0))
-				attacks = bb.ClearBit(attacks, target)
-			}
-		}
+// KingAttacks returns the squares attacked by a king on the given square.
+func KingAttacks(square sq.Square) bb.Bitboard {
+	return lookupTables.Kings[square]
+}
 
-		addMoves(bishopAttacks)
-		addMoves(rookAttacks)
+// BishopAttacks returns the squares attacked by a bishop on the given square, given the occupancy
+// of the board.
+func BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	if sliderAttacks == nil {
+		return lookupTables.BishopAttacks(square, occupancy)
 	}
 
-	return ret
+	return sliderAttacks.BishopAttacks(square, occupancy)
 }
 
-func MakeMove(pos *position.Position, move move.Move, capturesOnly bool) *position.Position {
-	if !capturesOnly {
-		source := move.Source()
-		target := move.Target()
-		piece := move.Piece()
-
-		return pos.MakeMove(source, target, piece)
+// RookAttacks returns the squares attacked by a rook on the given square, given the occupancy of
+// the board.
+func RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	if sliderAttacks == nil {
+		return lookupTables.RookAttacks(square, occupancy)
 	}
 
-	if move.IsCapture() {
-		MakeMove(pos, move, false)
-	} else {
-		return pos
-	}
+	return sliderAttacks.RookAttacks(square, occupancy)
+}
 
-	return nil
+// QueenAttacks returns the squares attacked by a queen on the given square, given the occupancy of
+// the board.
+func QueenAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return BishopAttacks(square, occupancy) | RookAttacks(square, occupancy)
 }
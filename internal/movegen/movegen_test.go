@@ -230,8 +230,7 @@ func TestGetLegalMovesReturnsCorrectMoves(t *testing.T) {
 				move.NewMove().From(sq.C3).To(sq.B5).Piece(piece.Wn).Build(): {},
 				move.NewMove().From(sq.C3).To(sq.D5).Piece(piece.Wn).Build(): {},
 				move.NewMove().From(sq.C3).To(sq.E2).Piece(piece.Wn).Build(): {},
-				// King
-				move.NewMove().From(sq.G1).To(sq.F1).Piece(piece.Wk).Build(): {},
+				// King. Kf1 would walk into the bishop on a6.
 				move.NewMove().From(sq.G1).To(sq.F2).Piece(piece.Wk).Build(): {},
 				move.NewMove().From(sq.G1).To(sq.H1).Piece(piece.Wk).Build(): {},
 			},
@@ -542,3 +541,182 @@ func TestSquareIsAttacked(t *testing.T) {
 		})
 	}
 }
+
+func TestPerft(t *testing.T) {
+	t.Parallel()
+
+	// Node counts from https://www.chessprogramming.org/Perft_Results
+	tests := []struct {
+		name  string
+		fen   string
+		nodes []uint64
+	}{
+		{
+			name:  "starting position",
+			fen:   "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			nodes: []uint64{20, 400, 8902, 197281},
+		},
+		{
+			name:  "kiwipete",
+			fen:   "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+			nodes: []uint64{48, 2039, 97862},
+		},
+		{
+			name:  "position 3",
+			fen:   "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+			nodes: []uint64{14, 191, 2812, 43238},
+		},
+		{
+			name:  "position 4",
+			fen:   "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+			nodes: []uint64{6, 264, 9467},
+		},
+		{
+			name:  "position 5",
+			fen:   "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+			nodes: []uint64{44, 1486, 62379},
+		},
+		// Chess960 positions from the Fischer random perft suite, with castling rights in Shredder-FEN
+		{
+			name:  "chess960 1",
+			fen:   "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+			nodes: []uint64{21, 528, 12189, 326672},
+		},
+		{
+			name:  "chess960 2",
+			fen:   "2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9",
+			nodes: []uint64{21, 807, 18002},
+		},
+		{
+			name:  "chess960 3",
+			fen:   "b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9",
+			nodes: []uint64{20, 479, 10471, 273318},
+		},
+		{
+			name:  "chess960 4",
+			fen:   "qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9",
+			nodes: []uint64{22, 593, 13440},
+		},
+		{
+			name:  "chess960 5",
+			fen:   "1nbbnrkr/p1p1ppp1/3p4/1p3P1p/3Pq2P/8/PPP1P1P1/QNBBNRKR w HFhf - 0 9",
+			nodes: []uint64{28, 1120, 31058},
+		},
+		{
+			name:  "chess960 6",
+			fen:   "qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w HEhe - 1 9",
+			nodes: []uint64{29, 899, 26578},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatalf("failed to create position: %v", err)
+			}
+
+			for i, want := range tt.nodes {
+				if got := movegen.Perft(pos, i+1); got != want {
+					t.Errorf("perft(%d) = %d, want %d", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+// AllocsPerRun can't be called from a parallel test.
+func TestGenerateLegalMovesDoesNotAllocate(t *testing.T) { //nolint:paralleltest
+	tests := []struct {
+		variant position.Variant
+		fen     string
+	}{
+		{position.Standard, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"},
+		{position.Standard, "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1"},
+		{position.Crazyhouse, "2k5/8/8/8/8/8/8/4K3[QRBNPqrbnp] w - - 0 1"},
+		{position.Atomic, "rnbqkbnr/pppppppp/8/6N1/8/8/PPPPPPPP/RNBQKB1R w KQkq - 0 1"},
+		{position.Antichess, "8/P7/8/8/8/8/3p4/4K3 w - - 0 1"},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewVariantPositionFromFEN(tt.fen, tt.variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var list movegen.MoveList
+
+		allocs := testing.AllocsPerRun(100, func() {
+			movegen.GenerateLegalMoves(pos, &list)
+		})
+
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per call, want none", tt.fen, allocs)
+		}
+
+		if got, want := list.Slice(), movegen.GetLegalMoves(pos); len(got) != len(want) {
+			t.Errorf("%s: %d moves in the list, GetLegalMoves returned %d", tt.fen, len(got), len(want))
+		}
+	}
+}
+
+// AllocsPerRun can't be called from a parallel test.
+func TestMakeMoveInto(t *testing.T) { //nolint:paralleltest
+	pos, err := position.NewPositionFromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var child position.Position
+
+	// Start from a dirty position, as a search reusing it would.
+	child.HalfMoveClock = 99
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		allocs := testing.AllocsPerRun(10, func() {
+			movegen.MakeMoveInto(pos, &child, m)
+		})
+
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per call, want none", m, allocs)
+		}
+
+		if want := movegen.MakeMove(pos, m, false); child != *want {
+			t.Errorf("%s: got %+v, want %+v", m, child, *want)
+		}
+	}
+}
+
+func BenchmarkGenerateLegalMoves(b *testing.B) {
+	pos, err := position.NewPositionFromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var list movegen.MoveList
+
+	b.ReportAllocs()
+
+	for range b.N {
+		movegen.GenerateLegalMoves(pos, &list)
+	}
+}
+
+func BenchmarkPerft(b *testing.B) {
+	pos, err := position.NewPosition()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var nodes uint64
+
+	b.ReportAllocs()
+
+	for range b.N {
+		nodes += movegen.Perft(pos, 4)
+	}
+
+	b.ReportMetric(float64(nodes)/b.Elapsed().Seconds(), "nodes/s")
+}
@@ -0,0 +1,27 @@
+package movegen
+
+import "github.com/samwestmoreland/chessengine/internal/move"
+
+// MaxMoves is the number of moves a MoveList can hold. No position of standard chess has more than
+// 218 legal moves, but a Crazyhouse position with several kinds of piece in hand can have a few
+// hundred drops on top of its other moves.
+const MaxMoves = 512
+
+// MoveList is a fixed-capacity list of moves, which the move generator fills without allocating.
+// It's a couple of kilobytes, so declare it as a local variable or reuse one rather than making new
+// ones on the heap.
+type MoveList struct {
+	Moves [MaxMoves]move.Move
+	Count int
+}
+
+// Slice returns the moves in the list. It shares the list's storage, so it's only valid until the
+// list is next filled.
+func (l *MoveList) Slice() []move.Move {
+	return l.Moves[:l.Count]
+}
+
+func (l *MoveList) add(m move.Move) {
+	l.Moves[l.Count] = m
+	l.Count++
+}
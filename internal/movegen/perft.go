@@ -0,0 +1,39 @@
+package movegen
+
+import (
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// Perft counts the leaf nodes of the legal move tree to the given depth. Comparing the counts
+// against published values is the standard way of validating a move generator.
+func Perft(pos *position.Position, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+
+	var list MoveList
+
+	GenerateLegalMoves(pos, &list)
+
+	if depth == 1 {
+		return uint64(list.Count)
+	}
+
+	var nodes uint64
+
+	for _, m := range list.Slice() {
+		nodes += perftMove(pos, m, depth-1)
+	}
+
+	return nodes
+}
+
+// perftMove counts the leaf nodes below the move. The position it leads to is made in a function of
+// its own, outside the loop over the moves, so that it can stay on the stack.
+func perftMove(pos *position.Position, m move.Move, depth int) uint64 {
+	child := *pos
+	makeMove(pos, &child, m)
+
+	return Perft(&child, depth)
+}
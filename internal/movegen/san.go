@@ -0,0 +1,242 @@
+package movegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// SAN returns a legal move in standard algebraic notation, for example "Nbd7", "exd5", "e8=Q+"
+// or "O-O-O#", or "P@e4" for a drop. The source square is given only as far as is needed to tell
+// the move apart from other legal moves of the same kind of piece to the same square.
+func SAN(pos *position.Position, m move.Move) string {
+	var ret strings.Builder
+
+	switch {
+	case m.IsDrop():
+		ret.WriteString(m.String())
+	case m.IsCastling():
+		if m.Target().File() == 7 {
+			ret.WriteString("O-O")
+		} else {
+			ret.WriteString("O-O-O")
+		}
+	case isPawn(m.Piece()):
+		if m.IsCapture() || m.IsEnPassant() {
+			ret.WriteByte(fileLetter(m.Source()))
+			ret.WriteByte('x')
+		}
+
+		ret.WriteString(m.Target().String())
+
+		if m.PromotionPiece() != piece.NoPiece {
+			ret.WriteByte('=')
+			ret.WriteString(pieceLetter(m.PromotionPiece()))
+		}
+	default:
+		ret.WriteString(pieceLetter(m.Piece()))
+		ret.WriteString(disambiguation(pos, m))
+
+		if m.IsCapture() {
+			ret.WriteByte('x')
+		}
+
+		ret.WriteString(m.Target().String())
+	}
+
+	child := MakeMove(pos, m, false)
+	if InCheck(child) {
+		if len(GetLegalMoves(child)) == 0 {
+			ret.WriteByte('#')
+		} else {
+			ret.WriteByte('+')
+		}
+	}
+
+	return ret.String()
+}
+
+// disambiguation returns the file, rank or square of a piece move's source that's needed to tell
+// it apart from moves of other pieces of the same kind to the same square. The file is preferred,
+// then the rank, and the whole square is only used when neither is enough.
+func disambiguation(pos *position.Position, m move.Move) string {
+	var others []move.Move
+
+	for _, other := range GetLegalMoves(pos) {
+		if other.Piece() == m.Piece() && other.Target() == m.Target() && other.Source() != m.Source() && !other.IsDrop() {
+			others = append(others, other)
+		}
+	}
+
+	if len(others) == 0 {
+		return ""
+	}
+
+	sameFile, sameRank := false, false
+
+	for _, other := range others {
+		sameFile = sameFile || other.Source().File() == m.Source().File()
+		sameRank = sameRank || other.Source().Rank() == m.Source().Rank()
+	}
+
+	switch {
+	case !sameFile:
+		return string(fileLetter(m.Source()))
+	case !sameRank:
+		return fmt.Sprint(m.Source().Rank())
+	default:
+		return m.Source().String()
+	}
+}
+
+// ParseSAN returns the legal move written in standard algebraic notation. It accepts the common
+// variations found in the wild: castling written with zeros, promotions with or without "=",
+// missing or superfluous check and capture marks, annotations such as "!?", long algebraic notation
+// such as "Ng1-f3", and pawn drops with or without the P, as in "@e4".
+func ParseSAN(pos *position.Position, san string) (move.Move, error) {
+	s := strings.TrimSpace(san)
+	s = strings.TrimSuffix(s, "e.p.")
+	s = strings.TrimRight(s, "+#!? ")
+
+	if s == "" {
+		return 0, fmt.Errorf("empty move %q", san)
+	}
+
+	moves := GetLegalMoves(pos)
+
+	if kind, to, ok := strings.Cut(s, "@"); ok {
+		return findDrop(moves, kind, to, san)
+	}
+
+	switch strings.ToUpper(strings.ReplaceAll(s, "0", "O")) {
+	case "O-O", "OO":
+		return findCastling(moves, 7, san)
+	case "O-O-O", "OOO":
+		return findCastling(moves, 3, san)
+	}
+
+	// A leading capital is the piece; otherwise this is a pawn move.
+	kind := "P"
+	if strings.ContainsRune("KQRBN", rune(s[0])) {
+		kind = s[:1]
+		s = s[1:]
+	}
+
+	promotion := ""
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	if n := len(s); n > 0 && kind == "P" && strings.ContainsRune("QRBNKqrbnk", rune(s[n-1])) {
+		promotion = strings.ToUpper(s[n-1:])
+		s = strings.TrimRight(s[:n-1], "=(/")
+	}
+
+	s = strings.NewReplacer("x", "", "X", "", "-", "", ":", "").Replace(s)
+
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid move %q", san)
+	}
+
+	target, err := sq.ParseString(s[len(s)-2:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid move %q: %w", san, err)
+	}
+
+	// What's left is all or part of the source square.
+	from := s[:len(s)-2]
+	if len(from) > 2 {
+		return 0, fmt.Errorf("invalid move %q", san)
+	}
+
+	var matches []move.Move
+
+	for _, m := range moves {
+		if m.Target() != target || m.IsCastling() || m.IsDrop() || pieceLetter(m.Piece()) != kind {
+			continue
+		}
+
+		if pieceLetter(m.PromotionPiece()) != promotion {
+			continue
+		}
+
+		if !matchesSource(m.Source(), from) {
+			continue
+		}
+
+		matches = append(matches, m)
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no legal move matches %q", san)
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, fmt.Errorf("move %q is ambiguous", san)
+	}
+}
+
+// matchesSource reports whether a square matches a file, rank or square, or an empty string.
+func matchesSource(source sq.Square, from string) bool {
+	for _, c := range from {
+		switch {
+		case c >= 'a' && c <= 'h':
+			if byte(c) != fileLetter(source) {
+				return false
+			}
+		case c >= '1' && c <= '8':
+			if int(c-'0') != source.Rank() {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func findCastling(moves []move.Move, file int, san string) (move.Move, error) {
+	for _, m := range moves {
+		if m.IsCastling() && m.Target().File() == file {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("castling %q is not legal", san)
+}
+
+func findDrop(moves []move.Move, kind, to, san string) (move.Move, error) {
+	if kind == "" {
+		kind = "P"
+	}
+
+	target, err := sq.ParseString(to)
+	if err != nil {
+		return 0, fmt.Errorf("invalid drop %q: %w", san, err)
+	}
+
+	for _, m := range moves {
+		if m.IsDrop() && m.Target() == target && pieceLetter(m.Piece()) == strings.ToUpper(kind) {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("drop %q is not legal", san)
+}
+
+func isPawn(p piece.Piece) bool {
+	return p == piece.Wp || p == piece.Bp
+}
+
+// pieceLetter returns the upper case letter of a piece, "P" for pawns, or "" for no piece.
+func pieceLetter(p piece.Piece) string {
+	return strings.ToUpper(p.String())
+}
+
+func fileLetter(s sq.Square) byte {
+	return byte('a' + s.File() - 1)
+}
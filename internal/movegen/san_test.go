@@ -0,0 +1,158 @@
+package movegen_test
+
+import (
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// findMove returns the legal move with the given coordinate notation.
+func findMove(t *testing.T, pos *position.Position, coordinates string) move.Move {
+	t.Helper()
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if m.String() == coordinates {
+			return m
+		}
+	}
+
+	t.Fatalf("%s is not legal", coordinates)
+
+	return 0
+}
+
+func TestSAN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		fen  string
+		move string
+		want string
+	}{
+		{"knight", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "g1f3", "Nf3"},
+		{"pawn push", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", "e4"},
+		{"file disambiguation", "4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "b1d2", "Nbd2"},
+		{"rank disambiguation", "4k3/8/8/N7/8/8/8/N3K3 w - - 0 1", "a1b3", "N1b3"},
+		{"square disambiguation", "4k3/8/8/8/8/Q7/8/Q1Q1K3 w - - 0 1", "a1b2", "Qa1b2"},
+		{"pinned piece needs no disambiguation", "4k3/8/8/7b/8/5N2/8/1N1K4 w - - 0 1", "b1d2", "Nd2"},
+		{"pawn capture", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", "exd5"},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+		{"promotion with check", "k7/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8Q", "e8=Q+"},
+		{"underpromotion capture", "k2r4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8N", "exd8=N"},
+		{"short castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"long castling", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"capture", "4k3/8/8/3p4/8/8/8/3RK3 w - - 0 1", "d1d5", "Rxd5"},
+		{"checkmate", "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := findMove(t, pos, tt.move)
+
+			if got := movegen.SAN(pos, m); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+
+			if got, err := movegen.ParseSAN(pos, tt.want); err != nil || got != m {
+				t.Errorf("parsing %s gave %v, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+// TestSANRoundTrip checks that every legal move in a few busy positions parses back to itself.
+func TestSANRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"4k3/8/8/8/8/Q7/8/Q1Q1K3 w - - 0 1",
+	}
+
+	for _, fen := range fens {
+		pos, err := position.NewPositionFromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := make(map[string]bool)
+
+		for _, m := range movegen.GetLegalMoves(pos) {
+			san := movegen.SAN(pos, m)
+			if seen[san] {
+				t.Errorf("%s: %s is written the same as another move", fen, san)
+			}
+
+			seen[san] = true
+
+			got, err := movegen.ParseSAN(pos, san)
+			if err != nil || got != m {
+				t.Errorf("%s: %s parsed as %v, %v, want %v", fen, san, got, err, m)
+			}
+		}
+	}
+}
+
+func TestParseSANVariants(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fen     string
+		san     string
+		want    string
+		wantErr bool
+	}{
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", san: "0-0", want: "e1g1"},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", san: "0-0-0", want: "e1c1"},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", san: "O-O+", want: "e1g1"},
+		{fen: "k7/4P3/8/8/8/8/8/4K3 w - - 0 1", san: "e8Q", want: "e7e8Q"},
+		{fen: "k7/4P3/8/8/8/8/8/4K3 w - - 0 1", san: "e8=Q", want: "e7e8Q"},
+		{fen: "k7/4P3/8/8/8/8/8/4K3 w - - 0 1", san: "e8(R)", want: "e7e8R"},
+		{fen: "k7/4P3/8/8/8/8/8/4K3 w - - 0 1", san: "e8=n", want: "e7e8N"},
+		{fen: "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", san: "exd5!?", want: "e4d5"},
+		{fen: "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", san: "ed5", want: "e4d5"},
+		{fen: "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", san: "e4:d5", want: "e4d5"},
+		{fen: "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", san: "exd6 e.p.", want: "e5d6"},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "Nf3+", want: "g1f3"},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "Ng1-f3", want: "g1f3"},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "e2e4", want: "e2e4"},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "Nf3??", want: "g1f3"},
+		{fen: "4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", san: "Nd2", wantErr: true},
+		{fen: "k7/4P3/8/8/8/8/8/4K3 w - - 0 1", san: "e8", wantErr: true},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "Ke2", wantErr: true},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "O-O", wantErr: true},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "", wantErr: true},
+		{fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", san: "Zz9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := movegen.ParseSAN(pos, tt.san)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v", tt.san, err)
+
+			continue
+		}
+
+		if !tt.wantErr && got.String() != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.san, got, tt.want)
+		}
+	}
+}
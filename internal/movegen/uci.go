@@ -0,0 +1,38 @@
+package movegen
+
+import (
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// UCI returns a move in the coordinate notation of the UCI protocol, for example "e2e4", "e7e8q" or,
+// for a drop, "N@f3". Castling is written as the king's move, "e1g1", unless chess960 is set, in
+// which case it's written as the king taking its own rook, "e1h1", as UCI_Chess960 asks for: in
+// Chess960 the king can start next to, or even on, the square it castles to, so its move alone is
+// ambiguous.
+func UCI(pos *position.Position, m move.Move, chess960 bool) string {
+	switch {
+	case m.IsDrop():
+		return m.String()
+	case !chess960 || !m.IsCastling():
+		return strings.ToLower(m.String())
+	}
+
+	rookSource, _ := castlingRookSquares(pos, m.Target())
+
+	return m.Source().String() + rookSource.String()
+}
+
+// ParseUCI returns the legal move written in UCI coordinate notation, as UCI writes it. It reports
+// false if there is no such move.
+func ParseUCI(pos *position.Position, s string, chess960 bool) (move.Move, bool) {
+	for _, m := range GetLegalMoves(pos) {
+		if strings.EqualFold(UCI(pos, m, chess960), s) {
+			return m, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,100 @@
+package movegen_test
+
+import (
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestUCI(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		fen      string
+		move     string
+		standard string
+		chess960 string
+		after    string
+	}{
+		{
+			name:     "pawn push",
+			fen:      "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			move:     "e2e4",
+			standard: "e2e4",
+			chess960: "e2e4",
+			after:    "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		},
+		{
+			name:     "promotion",
+			fen:      "7k/4P3/8/8/8/8/8/K7 w - - 0 1",
+			move:     "e7e8Q",
+			standard: "e7e8q",
+			chess960: "e7e8q",
+			after:    "4Q2k/8/8/8/8/8/8/K7 b - - 0 1",
+		},
+		{
+			name:     "kingside castling",
+			fen:      "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+			move:     "e1g1",
+			standard: "e1g1",
+			chess960: "e1h1",
+			after:    "r3k2r/8/8/8/8/8/8/R4RK1 b kq - 1 1",
+		},
+		{
+			name:     "queenside castling",
+			fen:      "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+			move:     "e8c8",
+			standard: "e8c8",
+			chess960: "e8a8",
+			after:    "2kr3r/8/8/8/8/8/8/R3K2R w KQ - 1 2",
+		},
+		{
+			name:     "chess960 castling with the king staying put",
+			fen:      "4k3/8/8/8/8/8/8/R5KR w HA - 0 1",
+			move:     "g1g1",
+			standard: "g1g1",
+			chess960: "g1h1",
+			after:    "4k3/8/8/8/8/8/8/R4RK1 b - - 1 1",
+		},
+		{
+			name:     "chess960 castling with the rook crossing the king's target",
+			fen:      "4k3/8/8/8/8/8/8/1R4KR w HB - 0 1",
+			move:     "g1c1",
+			standard: "g1c1",
+			chess960: "g1b1",
+			after:    "4k3/8/8/8/8/8/8/2KR3R b - - 1 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatalf("failed to create position: %v", err)
+			}
+
+			m := findMove(t, pos, tt.move)
+
+			if got := movegen.UCI(pos, m, false); got != tt.standard {
+				t.Errorf("UCI(%s, false) = %s, want %s", tt.move, got, tt.standard)
+			}
+
+			if got := movegen.UCI(pos, m, true); got != tt.chess960 {
+				t.Errorf("UCI(%s, true) = %s, want %s", tt.move, got, tt.chess960)
+			}
+
+			parsed, ok := movegen.ParseUCI(pos, tt.chess960, true)
+			if !ok || parsed != m {
+				t.Errorf("ParseUCI(%s, true) = %s, %v, want %s", tt.chess960, parsed, ok, tt.move)
+			}
+
+			if got := movegen.MakeMove(pos, m, false).FEN(); got != tt.after {
+				t.Errorf("after %s, FEN() = %s, want %s", tt.move, got, tt.after)
+			}
+		})
+	}
+}
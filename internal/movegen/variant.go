@@ -0,0 +1,118 @@
+package movegen
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// Result is the result of a game from the point of view of the side to move.
+type Result int
+
+const (
+	Loss Result = iota - 1
+	Draw
+	Win
+)
+
+var (
+	// hill are the centre squares a king wins King of the Hill by reaching.
+	hill = bb.SetBits(0, sq.D4, sq.E4, sq.D5, sq.E5)
+	// eighthRank is where the kings race to in Racing Kings.
+	eighthRank = bb.SetBits(0, sq.A8, sq.B8, sq.C8, sq.D8, sq.E8, sq.F8, sq.G8, sq.H8)
+)
+
+// VariantResult reports whether the game has ended by a rule of its variant, such as a king
+// reaching the centre in King of the Hill, and if so what the result is for the side to move.
+// Checkmate and stalemate, which end games in every variant, are left to the caller.
+func VariantResult(pos *position.Position) (Result, bool) {
+	// winner returns the result for the side to move of a win for white if white is set, and for
+	// black otherwise.
+	winner := func(white bool) Result {
+		if white == pos.WhiteToMove {
+			return Win
+		}
+
+		return Loss
+	}
+
+	switch pos.Variant {
+	case position.ThreeCheck:
+		for _, white := range []bool{true, false} {
+			if pos.ChecksToWin(white) <= 0 {
+				return winner(white), true
+			}
+		}
+	case position.KingOfTheHill:
+		for _, white := range []bool{true, false} {
+			if kingOn(pos, white, hill) {
+				return winner(white), true
+			}
+		}
+	case position.RacingKings:
+		whiteHome, blackHome := kingOn(pos, true, eighthRank), kingOn(pos, false, eighthRank)
+
+		switch {
+		case whiteHome && blackHome:
+			return Draw, true
+		case blackHome:
+			return winner(false), true
+		case whiteHome:
+			// Black gets one last move, which draws if it takes its king to the eighth rank too.
+			if !pos.WhiteToMove && canReachEighthRank(pos) {
+				return Draw, false
+			}
+
+			return winner(true), true
+		}
+	case position.Atomic:
+		// A king that's been blown up loses.
+		for _, white := range []bool{true, false} {
+			if !kingOn(pos, white, ^bb.Bitboard(0)) {
+				return winner(!white), true
+			}
+		}
+	case position.Antichess:
+		// The side that has just moved still has the piece it moved, so only the side to move can
+		// have won by losing every piece.
+		if pos.WhiteToMove && pos.Occupancy[piece.Wa] == 0 || !pos.WhiteToMove && pos.Occupancy[piece.Ba] == 0 {
+			return Win, true
+		}
+	}
+
+	return Draw, false
+}
+
+// NoMovesResult returns the result for the side to move when it has no legal moves: a loss if it's
+// checkmated and a draw if it's stalemated, other than in Antichess, where being stalemated wins.
+func NoMovesResult(pos *position.Position) Result {
+	switch {
+	case pos.Variant == position.Antichess:
+		return Win
+	case InCheck(pos):
+		return Loss
+	default:
+		return Draw
+	}
+}
+
+// kingOn reports whether the given side's king is on one of the squares.
+func kingOn(pos *position.Position, white bool, squares bb.Bitboard) bool {
+	if white {
+		return pos.Occupancy[piece.Wk]&squares != 0
+	}
+
+	return pos.Occupancy[piece.Bk]&squares != 0
+}
+
+// canReachEighthRank reports whether the side to move has a legal king move to the eighth rank.
+func canReachEighthRank(pos *position.Position) bool {
+	for _, m := range GetLegalMoves(pos) {
+		if (m.Piece() == piece.Wk || m.Piece() == piece.Bk) && m.Target().Rank() == 8 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,405 @@
+package movegen_test
+
+import (
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestVariantPerft(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		variant position.Variant
+		// fen is the position to count from, or the variant's starting position if empty.
+		fen   string
+		nodes []uint64
+	}{
+		{"three-check", position.ThreeCheck, "", []uint64{20, 400, 8902, 197281}},
+		{"king of the hill", position.KingOfTheHill, "", []uint64{20, 400, 8902, 197281}},
+		// Racing Kings counts from Fairy-Stockfish.
+		{"racing kings", position.RacingKings, "", []uint64{21, 421, 11264, 296242}},
+		// Crazyhouse counts from Fairy-Stockfish and lichess's scalachess. The first drops come at
+		// depth 5 from the start; the middlegame has drops after captures throughout, and the
+		// promoted queen on b7 goes back to black's pocket as a pawn when the bishop takes it.
+		{"crazyhouse", position.Crazyhouse, "", []uint64{20, 400, 8902, 197281, 4888832}},
+		{"crazyhouse drops", position.Crazyhouse, "2k5/8/8/8/8/8/8/4K3[QRBNPqrbnp] w - - 0 1", []uint64{301, 75353}},
+		{
+			"crazyhouse middlegame", position.Crazyhouse,
+			"r1bqk2r/pppp1ppp/2n1p3/4P3/1b1Pn3/2NB1N2/PPP2PPP/R1BQK2R[] b KQkq - 0 1",
+			[]uint64{42, 1347, 58057, 2083382},
+		},
+		{"crazyhouse promoted", position.Crazyhouse, "4k3/1Q~6/8/8/4b3/8/Kpp5/8[] b - - 0 1", []uint64{20, 360, 5445, 132758}},
+		{"atomic", position.Atomic, "", []uint64{20, 400, 8902, 197326, 4864979}},
+		{"antichess", position.Antichess, "", []uint64{20, 400, 8067, 153299, 2732672}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fen := tt.fen
+			if fen == "" {
+				fen = tt.variant.StartFEN()
+			}
+
+			pos, err := position.NewVariantPositionFromFEN(fen, tt.variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range tt.nodes {
+				if got := movegen.Perft(pos, i+1); got != want {
+					t.Errorf("perft(%d) = %d, want %d", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVariantResult(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		variant position.Variant
+		fen     string
+		result  movegen.Result
+		over    bool
+	}{
+		{"three checks given", position.ThreeCheck, "4k3/8/8/8/8/8/8/4K3 b - - 0+3 0 1", movegen.Loss, true},
+		{"two checks given", position.ThreeCheck, "4k3/8/8/8/8/8/8/4K3 w - - 3+1 0 1", movegen.Draw, false},
+		{"king on the hill", position.KingOfTheHill, "8/8/8/3K4/8/8/8/k7 b - - 0 1", movegen.Loss, true},
+		{"king next to the hill", position.KingOfTheHill, "8/8/2K5/8/8/8/8/k7 b - - 0 1", movegen.Draw, false},
+		{"black wins the race", position.RacingKings, "6k1/8/8/8/8/8/8/K7 w - - 0 1", movegen.Loss, true},
+		{"white wins the race", position.RacingKings, "K7/8/6k1/8/8/8/8/8 b - - 0 1", movegen.Loss, true},
+		{"black can still draw", position.RacingKings, "K7/6k1/8/8/8/8/8/8 b - - 0 1", movegen.Draw, false},
+		{"both kings home", position.RacingKings, "K5k1/8/8/8/8/8/8/8 w - - 0 1", movegen.Draw, true},
+		{"king blown up", position.Atomic, "4k3/8/8/8/8/8/8/8 w - - 0 1", movegen.Loss, true},
+		{"both kings standing", position.Atomic, "4k3/8/8/8/8/8/8/4K3 w - - 0 1", movegen.Draw, false},
+		{"no pieces left", position.Antichess, "8/8/8/8/8/8/8/k7 w - - 0 1", movegen.Win, true},
+		{"pieces left", position.Antichess, "8/8/8/8/8/8/8/k6K w - - 0 1", movegen.Draw, false},
+		{"standard chess", position.Standard, "8/8/8/3K4/8/8/8/k7 b - - 0 1", movegen.Draw, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, tt.variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result, over := movegen.VariantResult(pos); result != tt.result || over != tt.over {
+				t.Errorf("VariantResult() = %d, %v, want %d, %v", result, over, tt.result, tt.over)
+			}
+		})
+	}
+}
+
+func TestThreeCheckCounting(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewVariantPositionFromFEN("4k3/8/8/8/8/8/8/R3K3 w - - 1+3 0 1", position.ThreeCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos = movegen.MakeMove(pos, findMove(t, pos, "a1a8"), false)
+
+	if want := "R3k3/8/8/8/8/8/8/4K3 b - - 0+3 1 1"; pos.FEN() != want {
+		t.Errorf("FEN() = %s, want %s", pos.FEN(), want)
+	}
+
+	if result, over := movegen.VariantResult(pos); result != movegen.Loss || !over {
+		t.Errorf("VariantResult() = %d, %v, want a loss", result, over)
+	}
+}
+
+func TestRacingKingsNoChecks(t *testing.T) {
+	t.Parallel()
+
+	// Rh1-h8 and Rh1-e1 would both give check.
+	pos, err := position.NewVariantPositionFromFEN("4k3/8/8/8/8/8/8/K6R w - - 0 1", position.RacingKings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if s := m.String(); s == "h1h8" || s == "h1e1" {
+			t.Errorf("%s gives check but is legal", s)
+		}
+	}
+}
+
+func TestCrazyhouse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		fen   string
+		moves []string
+		want  string
+	}{
+		{
+			name:  "capture goes in hand",
+			fen:   "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR[] w KQkq - 0 2",
+			moves: []string{"exd5", "Qxd5", "P@e4"},
+			want:  "rnb1kbnr/ppp1pppp/8/3q4/4P3/8/PPPP1PPP/RNBQKBNR[p] b KQkq - 0 3",
+		},
+		{
+			name:  "drop blocks check",
+			fen:   "4k3/8/8/8/8/8/8/r3K3[N] w - - 0 1",
+			moves: []string{"N@d1"},
+			want:  "4k3/8/8/8/8/8/8/r2NK3[] b - - 1 1",
+		},
+		{
+			name:  "promoted piece keeps its mark",
+			fen:   "7k/P7/8/8/8/8/8/4K3[] w - - 0 1",
+			moves: []string{"a8=Q+", "Kh7", "Qa1"},
+			want:  "8/7k/8/8/8/8/8/Q~3K3[] b - - 2 2",
+		},
+		{
+			name:  "promoted piece goes back to a pawn",
+			fen:   "4k3/8/8/7R/8/8/8/4K2q~[] w - - 0 1",
+			moves: []string{"Rxh1"},
+			want:  "4k3/8/8/8/8/8/8/4K2R[P] b - - 0 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, position.Crazyhouse)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, san := range tt.moves {
+				m, err := movegen.ParseSAN(pos, san)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := movegen.SAN(pos, m); got != san {
+					t.Errorf("SAN() = %s, want %s", got, san)
+				}
+
+				pos = movegen.MakeMove(pos, m, false)
+			}
+
+			if got := pos.FEN(); got != tt.want {
+				t.Errorf("FEN() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPawnDrops(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewVariantPositionFromFEN("4k3/8/8/8/8/8/8/4K3[P] w - - 0 1", position.Crazyhouse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drops := 0
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if !m.IsDrop() {
+			continue
+		}
+
+		drops++
+
+		if rank := m.Target().Rank(); rank == 1 || rank == 8 {
+			t.Errorf("pawn dropped on %s", m.Target())
+		}
+
+		if got := movegen.UCI(pos, m, false); got != "P@"+m.Target().String() {
+			t.Errorf("UCI() = %s, want P@%s", got, m.Target())
+		}
+	}
+
+	// Six ranks of eight squares, including the ones that give check.
+	if drops != 48 {
+		t.Errorf("%d pawn drops, want 48", drops)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		fen  string
+		// legal and illegal are moves that are and aren't legal in the position.
+		legal   []string
+		illegal []string
+	}{
+		{
+			name:    "kings can't capture",
+			fen:     "4k3/8/8/8/8/8/4p3/4K3 w - - 0 1",
+			legal:   []string{"e1d2", "e1f2"},
+			illegal: []string{"e1e2"},
+		},
+		{
+			name:  "kings can stand next to each other",
+			fen:   "8/8/8/8/8/3k4/8/4K3 w - - 0 1",
+			legal: []string{"e1d2", "e1e2"},
+		},
+		{
+			name:  "blowing up the king ignores check",
+			fen:   "4k3/4rb1R/8/8/8/8/8/4K3 w - - 0 1",
+			legal: []string{"h7f7"},
+		},
+		{
+			name:    "own king can't be blown up",
+			fen:     "4k3/8/8/8/8/8/8/R2nK3 w - - 0 1",
+			illegal: []string{"a1d1", "e1d1"},
+		},
+		{
+			name:    "castling through an attacked square",
+			fen:     "3rk3/8/8/8/8/8/8/R3K3 w Q - 0 1",
+			illegal: []string{"e1c1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, position.Atomic)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			legal := map[string]bool{}
+			for _, m := range movegen.GetLegalMoves(pos) {
+				legal[movegen.UCI(pos, m, false)] = true
+			}
+
+			for _, m := range tt.legal {
+				if !legal[m] {
+					t.Errorf("%s is illegal", m)
+				}
+			}
+
+			for _, m := range tt.illegal {
+				if legal[m] {
+					t.Errorf("%s is legal", m)
+				}
+			}
+		})
+	}
+}
+
+func TestAtomicExplosion(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewVariantPositionFromFEN("rnbqkbnr/pppppppp/8/6N1/8/8/PPPPPPPP/RNBQKB1R w KQkq - 0 1",
+		position.Atomic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The knight, the bishop and the knight next to f7 and the black king all go, but the pawns
+	// stay.
+	pos = movegen.MakeMove(pos, findMove(t, pos, "g5f7"), false)
+
+	if want := "rnbq3r/ppppp1pp/8/8/8/8/PPPPPPPP/RNBQKB1R b KQ - 0 1"; pos.FEN() != want {
+		t.Errorf("FEN() = %s, want %s", pos.FEN(), want)
+	}
+
+	if result, over := movegen.VariantResult(pos); result != movegen.Loss || !over {
+		t.Errorf("VariantResult() = %d, %v, want a loss", result, over)
+	}
+}
+
+func TestAntichess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		fen   string
+		moves []string
+	}{
+		{"captures are compulsory", "4k3/8/8/8/8/8/3p4/4K3 w - - 0 1", []string{"e1d2"}},
+		{"pawns promote to kings", "8/P7/8/8/8/8/8/k7 w - - 0 1", []string{"a7a8q", "a7a8r", "a7a8b", "a7a8n", "a7a8k"}},
+		{"no castling", "4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, position.Antichess)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			legal := map[string]bool{}
+			for _, m := range movegen.GetLegalMoves(pos) {
+				legal[movegen.UCI(pos, m, false)] = true
+			}
+
+			if tt.moves == nil {
+				for m := range legal {
+					if m == "e1g1" || m == "e1c1" {
+						t.Errorf("%s is legal", m)
+					}
+				}
+
+				return
+			}
+
+			if len(legal) != len(tt.moves) {
+				t.Errorf("%d legal moves, want %d", len(legal), len(tt.moves))
+			}
+
+			for _, m := range tt.moves {
+				if !legal[m] {
+					t.Errorf("%s is illegal", m)
+				}
+			}
+		})
+	}
+}
+
+func TestNoMovesResult(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		variant position.Variant
+		fen     string
+		want    movegen.Result
+	}{
+		{"checkmate", position.Standard, "R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1", movegen.Loss},
+		{"stalemate", position.Standard, "7k/5Q2/8/8/8/8/8/6K1 b - - 0 1", movegen.Draw},
+		{"antichess stalemate", position.Antichess, "8/8/8/8/8/p7/P7/8 w - - 0 1", movegen.Win},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := position.NewVariantPositionFromFEN(tt.fen, tt.variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if moves := movegen.GetLegalMoves(pos); len(moves) != 0 {
+				t.Fatalf("%d legal moves, want none", len(moves))
+			}
+
+			if got := movegen.NoMovesResult(pos); got != tt.want {
+				t.Errorf("NoMovesResult() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
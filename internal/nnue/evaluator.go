@@ -0,0 +1,198 @@
+package nnue
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// Accumulator holds the hidden layer values of a position before activation, once from white's
+// point of view and once from black's.
+type Accumulator [2][]int16
+
+func newAccumulator(hiddenSize int) Accumulator {
+	return Accumulator{make([]int16, hiddenSize), make([]int16, hiddenSize)}
+}
+
+// Refresh computes the accumulator from scratch for the given position.
+func (n *Network) Refresh(acc Accumulator, pos *position.Position) {
+	copy(acc[piece.White], n.FeatureBias)
+	copy(acc[piece.Black], n.FeatureBias)
+
+	for p := piece.Wp; p <= piece.Bk; p++ {
+		pieces := pos.Occupancy[p]
+
+		for pieces != 0 {
+			square := bb.LSBIndex(pieces)
+			pieces = bb.ClearBit(pieces, square)
+
+			n.addFeature(acc, p, square)
+		}
+	}
+}
+
+// Output runs the output layer on the accumulator and returns the score in centipawns from the
+// side to move's point of view.
+func (n *Network) Output(acc Accumulator, whiteToMove bool) int {
+	us, them := acc[piece.White], acc[piece.Black]
+	if !whiteToMove {
+		us, them = them, us
+	}
+
+	sum := int64(n.OutputBias)
+
+	for i, value := range us {
+		sum += int64(clippedReLU(value)) * int64(n.OutputWeights[i])
+	}
+
+	for i, value := range them {
+		sum += int64(clippedReLU(value)) * int64(n.OutputWeights[n.HiddenSize+i])
+	}
+
+	return int(sum * Scale / (QA * QB))
+}
+
+func (n *Network) addFeature(acc Accumulator, p piece.Piece, square sq.Square) {
+	for _, perspective := range []piece.Colour{piece.White, piece.Black} {
+		weights := n.featureWeights(FeatureIndex(perspective, p, square))
+
+		for i, weight := range weights {
+			acc[perspective][i] += weight
+		}
+	}
+}
+
+func (n *Network) removeFeature(acc Accumulator, p piece.Piece, square sq.Square) {
+	for _, perspective := range []piece.Colour{piece.White, piece.Black} {
+		weights := n.featureWeights(FeatureIndex(perspective, p, square))
+
+		for i, weight := range weights {
+			acc[perspective][i] -= weight
+		}
+	}
+}
+
+func (n *Network) featureWeights(feature int) []int16 {
+	return n.FeatureWeights[feature*n.HiddenSize : (feature+1)*n.HiddenSize]
+}
+
+// FeatureIndex returns the input feature for a piece on a square, seen from the given side's point
+// of view. The board is flipped for black so that both sides see their own pieces moving up the
+// board, and features for the perspective's own pieces come before those of the opponent.
+func FeatureIndex(perspective piece.Colour, p piece.Piece, square sq.Square) int {
+	colour, err := p.Colour()
+	if err != nil {
+		panic(err)
+	}
+
+	pieceType := int(p-piece.Wp) % 6
+
+	if perspective == piece.Black {
+		square ^= 56
+	}
+
+	relative := 0
+	if colour != perspective {
+		relative = 1
+	}
+
+	return relative*384 + pieceType*64 + int(square)
+}
+
+func clippedReLU(value int16) int16 {
+	return min(max(value, 0), QA)
+}
+
+// Evaluator evaluates positions with a network. It implements eval.Incremental: positions passed
+// to Push are evaluated by updating the accumulator of the previous position with only the
+// features that changed, and Pop restores the previous accumulator. Positions that are not on top
+// of the stack are evaluated with a full refresh.
+//
+// An Evaluator is not safe for concurrent use. Each search thread needs its own.
+type Evaluator struct {
+	net   *Network
+	stack []stackEntry
+	depth int
+}
+
+type stackEntry struct {
+	pos *position.Position
+	acc Accumulator
+}
+
+// NewEvaluator returns an evaluator using the given network.
+func NewEvaluator(net *Network) *Evaluator {
+	return &Evaluator{net: net}
+}
+
+func (e *Evaluator) Evaluate(pos *position.Position) int {
+	if e.depth > 0 && e.stack[e.depth-1].pos == pos {
+		return e.net.Output(e.stack[e.depth-1].acc, pos.WhiteToMove)
+	}
+
+	acc := newAccumulator(e.net.HiddenSize)
+	e.net.Refresh(acc, pos)
+
+	return e.net.Output(acc, pos.WhiteToMove)
+}
+
+// Push makes the given position the top of the stack. The first position pushed is refreshed from
+// scratch. Every later one is expected to follow from the position below it by a single move, and
+// is updated incrementally from it.
+func (e *Evaluator) Push(pos *position.Position) {
+	if e.depth == len(e.stack) {
+		e.stack = append(e.stack, stackEntry{acc: newAccumulator(e.net.HiddenSize)})
+	}
+
+	entry := &e.stack[e.depth]
+	entry.pos = pos
+
+	if e.depth == 0 {
+		e.net.Refresh(entry.acc, pos)
+	} else {
+		parent := &e.stack[e.depth-1]
+
+		copy(entry.acc[piece.White], parent.acc[piece.White])
+		copy(entry.acc[piece.Black], parent.acc[piece.Black])
+
+		e.update(entry.acc, parent.pos, pos)
+	}
+
+	e.depth++
+}
+
+// Pop discards the position on top of the stack.
+func (e *Evaluator) Pop() {
+	e.depth--
+	e.stack[e.depth].pos = nil
+}
+
+// Accumulator returns the accumulator of the position on top of the stack.
+func (e *Evaluator) Accumulator() Accumulator {
+	return e.stack[e.depth-1].acc
+}
+
+// update applies the difference between two positions to the accumulator. Deriving the changed
+// features from the boards rather than the move means that castling, en passant and promotions
+// need no special handling.
+func (e *Evaluator) update(acc Accumulator, from, to *position.Position) {
+	for p := piece.Wp; p <= piece.Bk; p++ {
+		removed := from.Occupancy[p] &^ to.Occupancy[p]
+		added := to.Occupancy[p] &^ from.Occupancy[p]
+
+		for removed != 0 {
+			square := bb.LSBIndex(removed)
+			removed = bb.ClearBit(removed, square)
+
+			e.net.removeFeature(acc, p, square)
+		}
+
+		for added != 0 {
+			square := bb.LSBIndex(added)
+			added = bb.ClearBit(added, square)
+
+			e.net.addFeature(acc, p, square)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Command gen writes the bootstrap network embedded in the nnue package.
+//
+// The network reproduces the material values and piece-square tables of the hand-crafted
+// evaluator, averaged between midgame and endgame. Each side's accumulator dedicates one hidden
+// neuron to each of its own piece types and one to each of the opponent's, and the output layer
+// takes the difference, so the network starts out playing roughly like a material-and-position
+// evaluator until a trained network is available.
+package main
+
+import (
+	"flag"
+	"log"
+	"math"
+	"os"
+
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/nnue"
+)
+
+const hiddenSize = 16
+
+// divisors scale each piece type's values down so that the sum over a full set of those pieces
+// fits within the clipped range of the accumulator.
+var divisors = [6]float64{9, 4, 4, 5, 5, 1}
+
+// kingBias keeps the king neurons positive, since the king's piece-square values can be negative.
+const kingBias = 100
+
+func main() {
+	output := flag.String("o", "default.nnue", "path to write the network to")
+	flag.Parse()
+
+	net := &nnue.Network{
+		HiddenSize:     hiddenSize,
+		FeatureWeights: make([]int16, nnue.NumFeatures*hiddenSize),
+		FeatureBias:    make([]int16, hiddenSize),
+		OutputWeights:  make([]int16, 2*hiddenSize),
+	}
+
+	weights := eval.DefaultWeights
+
+	for pieceType := range 6 {
+		for square := range 64 {
+			// Features are seen from the perspective side's point of view, as if it were white. The
+			// piece-square tables are written from white's point of view too, so the opponent's
+			// pieces need flipping back to their own.
+			own := value(weights, pieceType, square)
+			enemy := value(weights, pieceType, square^56)
+
+			ownFeature := pieceType*64 + square
+			enemyFeature := 384 + pieceType*64 + square
+
+			net.FeatureWeights[ownFeature*hiddenSize+pieceType] = quantise(own / divisors[pieceType])
+			net.FeatureWeights[enemyFeature*hiddenSize+6+pieceType] = quantise(enemy / divisors[pieceType])
+		}
+
+		// The output is (sum * Scale) / (QA * QB), and each of the two perspectives contributes
+		// half of the final score.
+		outputWeight := quantise(divisors[pieceType] * nnue.QA * nnue.QB / nnue.Scale / 2)
+
+		net.OutputWeights[pieceType] = outputWeight
+		net.OutputWeights[6+pieceType] = -outputWeight
+		net.OutputWeights[hiddenSize+pieceType] = -outputWeight
+		net.OutputWeights[hiddenSize+6+pieceType] = outputWeight
+	}
+
+	net.FeatureBias[5] = kingBias
+	net.FeatureBias[11] = kingBias
+
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := net.WriteTo(file); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := file.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func value(weights eval.Weights, pieceType, square int) float64 {
+	material := weights.Material[pieceType]
+	pst := weights.PST[pieceType][square]
+
+	return float64(material.MG+material.EG+pst.MG+pst.EG) / 2
+}
+
+func quantise(value float64) int16 {
+	return int16(math.Round(value))
+}
@@ -0,0 +1,145 @@
+// Package nnue implements an efficiently updatable neural network evaluator.
+//
+// The network has a single hidden layer with 768 inputs, one for each combination of piece colour,
+// piece type and square. Inputs are seen from the point of view of each side in turn, so that
+// every position keeps two accumulators, one per side. The accumulators are clipped to [0, QA],
+// concatenated with the side to move's first and combined by the output layer into a single score.
+//
+// All weights are stored as quantised int16 values, and nothing here relies on SIMD hardware.
+package nnue
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+//go:generate go run ./gen -o default.nnue
+
+const (
+	// NumFeatures is the size of the input layer: two colours, six piece types, 64 squares.
+	NumFeatures = 768
+	// QA is the quantisation factor of the accumulator. Accumulator values are clipped to [0, QA].
+	QA = 255
+	// QB is the quantisation factor of the output weights.
+	QB = 64
+	// Scale converts the network's output into centipawns.
+	Scale = 400
+)
+
+// fileMagic identifies a network file, and fileVersion its layout.
+const (
+	fileMagic   = "NNUE"
+	fileVersion = 1
+)
+
+// Network holds the quantised weights of a network.
+//
+// A network file is little-endian and laid out as follows: the four bytes "NNUE", then uint32
+// values for the format version, the number of input features and the hidden layer size H. These
+// are followed by the int16 feature weights (768 rows of H values), the int16 hidden biases (H
+// values), the int16 output weights (2H values, side to move first) and finally the int32 output
+// bias.
+type Network struct {
+	HiddenSize     int
+	FeatureWeights []int16
+	FeatureBias    []int16
+	OutputWeights  []int16
+	OutputBias     int32
+}
+
+//go:embed default.nnue
+var defaultNetworkData []byte
+
+// DefaultNetwork returns the network embedded in the binary. It is a bootstrap network generated
+// from the material values and piece-square tables of the hand-crafted evaluator, and should be
+// replaced by a trained network using LoadNetworkFile.
+var DefaultNetwork = sync.OnceValue(func() *Network {
+	net, err := LoadNetwork(bytes.NewReader(defaultNetworkData))
+	if err != nil {
+		panic(fmt.Sprintf("failed to load embedded network: %v", err))
+	}
+
+	return net
+})
+
+// LoadNetworkFile reads a network from the file at the given path.
+func LoadNetworkFile(path string) (*Network, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network file: %w", err)
+	}
+	defer file.Close()
+
+	return LoadNetwork(file)
+}
+
+// LoadNetwork reads a network in the format described on Network.
+func LoadNetwork(r io.Reader) (*Network, error) {
+	var header struct {
+		Magic      [4]byte
+		Version    uint32
+		Features   uint32
+		HiddenSize uint32
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read network header: %w", err)
+	}
+
+	if string(header.Magic[:]) != fileMagic {
+		return nil, errors.New("not a network file")
+	}
+
+	if header.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported network version %d", header.Version)
+	}
+
+	if header.Features != NumFeatures {
+		return nil, fmt.Errorf("expected %d input features, got %d", NumFeatures, header.Features)
+	}
+
+	if header.HiddenSize == 0 || header.HiddenSize > 1<<16 {
+		return nil, fmt.Errorf("invalid hidden layer size %d", header.HiddenSize)
+	}
+
+	hidden := int(header.HiddenSize)
+
+	net := &Network{
+		HiddenSize:     hidden,
+		FeatureWeights: make([]int16, NumFeatures*hidden),
+		FeatureBias:    make([]int16, hidden),
+		OutputWeights:  make([]int16, 2*hidden),
+	}
+
+	for _, field := range []any{net.FeatureWeights, net.FeatureBias, net.OutputWeights, &net.OutputBias} {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read network weights: %w", err)
+		}
+	}
+
+	return net, nil
+}
+
+// WriteTo writes the network in the format read by LoadNetwork.
+func (n *Network) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(fileMagic)
+
+	for _, field := range []any{
+		uint32(fileVersion), uint32(NumFeatures), uint32(n.HiddenSize),
+		n.FeatureWeights, n.FeatureBias, n.OutputWeights, n.OutputBias,
+	} {
+		if err := binary.Write(&buf, binary.LittleEndian, field); err != nil {
+			return 0, fmt.Errorf("failed to encode network: %w", err)
+		}
+	}
+
+	return buf.WriteTo(w)
+}
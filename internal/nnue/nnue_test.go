@@ -0,0 +1,199 @@
+package nnue_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/eval"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/nnue"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+var _ eval.Incremental = (*nnue.Evaluator)(nil)
+
+func TestIncrementalUpdatesMatchFullRefresh(t *testing.T) {
+	t.Parallel()
+
+	// Positions with castling rights, en passant and promotions available, so that every kind of
+	// move gets played at some point.
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+
+	net := randomNetwork(rand.New(rand.NewSource(1)), 32)
+
+	for i, fen := range fens {
+		root, err := position.NewPositionFromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rng := rand.New(rand.NewSource(int64(i)))
+
+		for range 20 {
+			evaluator := nnue.NewEvaluator(net)
+			evaluator.Push(root)
+
+			line := []*position.Position{root}
+
+			for range 60 {
+				pos := line[len(line)-1]
+
+				// Occasionally back up a move, to check that unmaking restores the accumulator.
+				if len(line) > 1 && rng.Intn(4) == 0 {
+					evaluator.Pop()
+					line = line[:len(line)-1]
+					checkAccumulator(t, net, evaluator, line[len(line)-1])
+
+					continue
+				}
+
+				moves := movegen.GetLegalMoves(pos)
+				if len(moves) == 0 {
+					break
+				}
+
+				child := movegen.MakeMove(pos, moves[rng.Intn(len(moves))], false)
+				evaluator.Push(child)
+				line = append(line, child)
+
+				checkAccumulator(t, net, evaluator, child)
+			}
+		}
+	}
+}
+
+func checkAccumulator(t *testing.T, net *nnue.Network, evaluator *nnue.Evaluator, pos *position.Position) {
+	t.Helper()
+
+	want := nnue.Accumulator{make([]int16, net.HiddenSize), make([]int16, net.HiddenSize)}
+	net.Refresh(want, pos)
+
+	got := evaluator.Accumulator()
+
+	if !slices.Equal(got[0], want[0]) || !slices.Equal(got[1], want[1]) {
+		t.Fatalf("incremental accumulator differs from a full refresh")
+	}
+
+	if got, want := evaluator.Evaluate(pos), nnue.NewEvaluator(net).Evaluate(pos); got != want {
+		t.Fatalf("incremental evaluation %d, full refresh %d", got, want)
+	}
+}
+
+func TestNetworkRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	net := randomNetwork(rand.New(rand.NewSource(2)), 8)
+
+	var buf bytes.Buffer
+
+	if _, err := net.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := nnue.LoadNetwork(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.HiddenSize != net.HiddenSize ||
+		!slices.Equal(loaded.FeatureWeights, net.FeatureWeights) ||
+		!slices.Equal(loaded.FeatureBias, net.FeatureBias) ||
+		!slices.Equal(loaded.OutputWeights, net.OutputWeights) ||
+		loaded.OutputBias != net.OutputBias {
+		t.Error("loaded network differs from the one written")
+	}
+}
+
+func TestLoadNetworkRejectsBadInput(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	if _, err := randomNetwork(rand.New(rand.NewSource(3)), 4).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	if _, err := nnue.LoadNetwork(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("expected an error for a truncated network")
+	}
+
+	corrupt := slices.Clone(data)
+	corrupt[0] = 'X'
+
+	if _, err := nnue.LoadNetwork(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected an error for a bad magic number")
+	}
+}
+
+func TestDefaultNetwork(t *testing.T) {
+	t.Parallel()
+
+	evaluator := nnue.NewEvaluator(nnue.DefaultNetwork())
+
+	start, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if score := evaluator.Evaluate(start); score < -20 || score > 20 {
+		t.Errorf("starting position scored %d, expected roughly level", score)
+	}
+
+	up, err := position.NewPositionFromFEN("rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if score := evaluator.Evaluate(up); score < 800 {
+		t.Errorf("white a queen up scored %d", score)
+	}
+
+	up.WhiteToMove = false
+
+	if score := evaluator.Evaluate(up); score > -800 {
+		t.Errorf("black a queen down scored %d", score)
+	}
+}
+
+func randomNetwork(rng *rand.Rand, hiddenSize int) *nnue.Network {
+	net := &nnue.Network{
+		HiddenSize:     hiddenSize,
+		FeatureWeights: make([]int16, nnue.NumFeatures*hiddenSize),
+		FeatureBias:    make([]int16, hiddenSize),
+		OutputWeights:  make([]int16, 2*hiddenSize),
+		OutputBias:     rng.Int31n(1000) - 500,
+	}
+
+	for i := range net.FeatureWeights {
+		net.FeatureWeights[i] = int16(rng.Intn(64) - 32)
+	}
+
+	for i := range net.FeatureBias {
+		net.FeatureBias[i] = int16(rng.Intn(256))
+	}
+
+	for i := range net.OutputWeights {
+		net.OutputWeights[i] = int16(rng.Intn(256) - 128)
+	}
+
+	return net
+}
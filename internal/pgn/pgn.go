@@ -0,0 +1,202 @@
+// Package pgn reads and writes games in Portable Game Notation.
+//
+// Games are read one at a time from a stream, so files of any size can be processed. Every move is
+// replayed as it is read, so a game that Reader.Next returns is known to be legal, variations
+// included. Comments, numeric annotation glyphs and the command annotations that tools embed in
+// comments, such as [%clk 0:03:12] and [%eval 0.25], are kept with the move they follow.
+package pgn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// Results that end a game's move text.
+const (
+	WhiteWins = "1-0"
+	BlackWins = "0-1"
+	Drawn     = "1/2-1/2"
+	Unknown   = "*"
+)
+
+// Common numeric annotation glyphs, which are also what the suffixes "!", "?", "!!", "??", "!?"
+// and "?!" are read as.
+const (
+	NAGGood        = 1
+	NAGMistake     = 2
+	NAGBrilliant   = 3
+	NAGBlunder     = 4
+	NAGInteresting = 5
+	NAGDubious     = 6
+)
+
+// rosterTags are the seven tags every exported game has, in the order they're written.
+var rosterTags = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// rosterDefaults are the values written for roster tags a game doesn't have.
+var rosterDefaults = map[string]string{"Date": "????.??.??", "Result": Unknown}
+
+// Tag is a tag pair, such as [White "Carlsen, Magnus"].
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Game is a game with its tags and moves.
+type Game struct {
+	// Tags are in the order they were read.
+	Tags []Tag
+	// Comment is the comment before the first move, if any.
+	Comment string
+	// Moves is the main line.
+	Moves []*Move
+	// Result is the termination marker at the end of the move text, one of the result constants.
+	Result string
+}
+
+// Move is a move of the main line or of a variation, with its annotations.
+type Move struct {
+	Move move.Move
+	// NAGs are the numeric annotation glyphs that follow the move.
+	NAGs []int
+	// CommentBefore is the comment before the move, which only occurs at the start of a
+	// variation, and Comment the comment after it. Command annotations are taken out of both.
+	CommentBefore string
+	Comment       string
+	Commands      []Command
+	// Variations are alternatives to this move, played from the position before it.
+	Variations [][]*Move
+}
+
+// Command is a command annotation such as [%clk 0:03:12], which has the name "clk" and the value
+// "0:03:12".
+type Command struct {
+	Name  string
+	Value string
+}
+
+// Tag returns the value of a tag, or "" if the game doesn't have it.
+func (g *Game) Tag(name string) string {
+	for _, tag := range g.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+
+	return ""
+}
+
+// SetTag sets the value of a tag, adding it if the game doesn't have it yet.
+func (g *Game) SetTag(name, value string) {
+	for i := range g.Tags {
+		if g.Tags[i].Name == name {
+			g.Tags[i].Value = value
+
+			return
+		}
+	}
+
+	g.Tags = append(g.Tags, Tag{Name: name, Value: value})
+}
+
+// StartPosition returns the position the game starts from, which is given by the FEN tag if the
+// game has one and the standard starting position otherwise.
+func (g *Game) StartPosition() (*position.Position, error) {
+	fen := g.Tag("FEN")
+	if fen == "" {
+		return position.NewPosition()
+	}
+
+	pos, err := position.NewPositionFromFEN(fen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FEN tag: %w", err)
+	}
+
+	return pos, nil
+}
+
+// MainLine returns the moves of the main line.
+func (g *Game) MainLine() []move.Move {
+	ret := make([]move.Move, len(g.Moves))
+	for i, m := range g.Moves {
+		ret[i] = m.Move
+	}
+
+	return ret
+}
+
+// Command returns the value of a command annotation, and false if the move doesn't have it.
+func (m *Move) Command(name string) (string, bool) {
+	for _, c := range m.Commands {
+		if c.Name == name {
+			return c.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Clock returns the time left on the mover's clock after the move, from a [%clk] annotation.
+func (m *Move) Clock() (time.Duration, bool) {
+	value, ok := m.Command("clk")
+	if !ok {
+		return 0, false
+	}
+
+	var ret time.Duration
+
+	parts := strings.Split(value, ":")
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+
+		unit := time.Second
+		for range len(parts) - 1 - i {
+			unit *= 60
+		}
+
+		ret += time.Duration(n * float64(unit))
+	}
+
+	return ret, true
+}
+
+// Eval returns the evaluation from an [%eval] annotation, from white's point of view. It is either
+// a score in centipawns, or, if mate is non-zero, the number of moves to mate, negative if black
+// is mating.
+func (m *Move) Eval() (centipawns, mate int, ok bool) {
+	value, ok := m.Command("eval")
+	if !ok {
+		return 0, 0, false
+	}
+
+	// Some tools follow the score with the search depth, as in "0.25,22".
+	value, _, _ = strings.Cut(value, ",")
+
+	if strings.HasPrefix(value, "#") {
+		n, err := strconv.Atoi(value[1:])
+		if err != nil || n == 0 {
+			return 0, 0, false
+		}
+
+		return 0, n, true
+	}
+
+	pawns, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	if pawns < 0 {
+		return int(pawns*100 - 0.5), 0, true
+	}
+
+	return int(pawns*100 + 0.5), 0, true
+}
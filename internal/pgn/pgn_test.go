@@ -0,0 +1,373 @@
+package pgn_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/pgn"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+const annotated = `[Event "Casual game"]
+[Site "London"]
+[Date "1851.06.21"]
+[Round "?"]
+[White "Anderssen, Adolf"]
+[Black "Kieseritzky, Lionel"]
+[Result "1-0"]
+[Annotator "A \"quoted\" name"]
+
+{The Immortal Game.} 1. e4 e5 2. f4 exf4 3. Bc4 Qh4+ 4. Kf1 b5?! 5. Bxb5 Nf6
+6. Nf3 Qh6 7. d3 Nh5 8. Nh4 Qg5 9. Nf5 c6 10. g4 Nf6 11. Rg1! cxb5 12. h4 Qg6
+13. h5 Qg5 14. Qf3 Ng8 15. Bxf4 Qf6 16. Nc3 Bc5 17. Nd5 Qxb2 18. Bd6 $1
+(18. Be3 {is also good} Qxa1+ 19. Ke2 (19. Kg2)) 18... Bxg1 ; the rook goes
+19. e5 Qxa1+ 20. Ke2 Na6 21. Nxg7+ Kd8 22. Qf6+ Nxf6 23. Be7# 1-0
+`
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	r := pgn.NewReader(strings.NewReader(annotated))
+
+	g, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := g.Tag("White"); got != "Anderssen, Adolf" {
+		t.Errorf("got White %q", got)
+	}
+
+	if got := g.Tag("Annotator"); got != `A "quoted" name` {
+		t.Errorf("got Annotator %q", got)
+	}
+
+	if g.Result != pgn.WhiteWins || g.Comment != "The Immortal Game." {
+		t.Errorf("got result %q and comment %q", g.Result, g.Comment)
+	}
+
+	if got := len(g.Moves); got != 45 {
+		t.Fatalf("got %d moves, want 45", got)
+	}
+
+	if got := g.Moves[7].NAGs; len(got) != 1 || got[0] != pgn.NAGDubious {
+		t.Errorf("got NAGs %v for 4... b5?!", got)
+	}
+
+	bd6 := g.Moves[34]
+	if bd6.Move.String() != "f4d6" || len(bd6.NAGs) != 1 || bd6.NAGs[0] != pgn.NAGGood {
+		t.Errorf("got %v with NAGs %v for 18. Bd6 $1", bd6.Move, bd6.NAGs)
+	}
+
+	if len(bd6.Variations) != 1 || len(bd6.Variations[0]) != 3 {
+		t.Fatalf("got variations %v for 18. Bd6", bd6.Variations)
+	}
+
+	be3 := bd6.Variations[0][0]
+	if be3.Move.String() != "f4e3" || be3.Comment != "is also good" {
+		t.Errorf("got %v {%s} starting the variation", be3.Move, be3.Comment)
+	}
+
+	if ke2 := bd6.Variations[0][2]; len(ke2.Variations) != 1 || ke2.Variations[0][0].Move.String() != "f1g2" {
+		t.Errorf("got nested variations %v", ke2.Variations)
+	}
+
+	if got := g.Moves[35].Comment; got != "the rook goes" {
+		t.Errorf("got comment %q for 18... Bxg1", got)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("got %v after the last game, want EOF", err)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	t.Parallel()
+
+	text := `1. e4 { [%eval 0.25] [%clk 0:05:12.5] } 1... e5 {[%eval #-3,30] Ouch [%clk 1:00:00]}
+2. Nf3 {[%eval -1.3]} *`
+
+	g, err := pgn.NewReader(strings.NewReader(text)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cp, mate int
+		clock    time.Duration
+		comment  string
+	}{
+		{cp: 25, clock: 5*time.Minute + 12500*time.Millisecond},
+		{mate: -3, clock: time.Hour, comment: "Ouch"},
+		{cp: -130},
+	}
+
+	for i, tt := range tests {
+		m := g.Moves[i]
+
+		cp, mate, ok := m.Eval()
+		if !ok || cp != tt.cp || mate != tt.mate {
+			t.Errorf("move %d: got eval %d, mate %d, ok %v", i, cp, mate, ok)
+		}
+
+		clock, ok := m.Clock()
+		if clock != tt.clock || ok != (tt.clock != 0) {
+			t.Errorf("move %d: got clock %v, ok %v", i, clock, ok)
+		}
+
+		if m.Comment != tt.comment {
+			t.Errorf("move %d: got comment %q", i, m.Comment)
+		}
+	}
+
+	if g.Result != pgn.Unknown {
+		t.Errorf("got result %q", g.Result)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	g, err := pgn.NewReader(strings.NewReader(annotated)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	for _, line := range lines {
+		if len(line) > 80 {
+			t.Errorf("line is %d characters: %s", len(line), line)
+		}
+	}
+
+	wantTags := []string{"[Event ", "[Site ", "[Date ", "[Round ", "[White ", "[Black ", "[Result ", "[Annotator "}
+	for i, want := range wantTags {
+		if !strings.HasPrefix(lines[i], want) {
+			t.Errorf("line %d is %q, want the %s tag", i, lines[i], want)
+		}
+	}
+
+	for _, want := range []string{
+		`[Annotator "A \"quoted\" name"]`,
+		"{The Immortal Game.} 1. e4",
+		"4. Kf1 b5 $6 5. Bxb5",
+		"18. Bd6 $1 (18. Be3 {is also good} 18... Qxa1+ 19. Ke2 (19. Kg2)) 18... Bxg1",
+		"23. Be7# 1-0",
+	} {
+		if !strings.Contains(strings.Join(lines, " "), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	again, err := pgn.NewReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(again.MainLine()) != fmt.Sprint(g.MainLine()) {
+		t.Errorf("got %v after writing and reading, want %v", again.MainLine(), g.MainLine())
+	}
+}
+
+// TestWriteFromPosition checks that a game from a set-up position is written with the SetUp tag
+// next to FEN, whether or not the game it was read from had one.
+func TestWriteFromPosition(t *testing.T) {
+	t.Parallel()
+
+	want := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "1/2-1/2"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 40"]
+[Annotator "me"]
+
+40... Kd7 41. e4 1/2-1/2
+
+`
+
+	for _, text := range []string{
+		`[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 40"]
+[Annotator "me"]
+
+40... Kd7 41. e4 1/2-1/2`,
+		`[Annotator "me"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 40"]
+[SetUp "1"]
+
+40... Kd7 41. e4 1/2-1/2`,
+	} {
+		g, err := pgn.NewReader(strings.NewReader(text)).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := g.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != want {
+			t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+		}
+	}
+}
+
+// TestWriteAnnotations checks that annotations that can't be written as they are, such as an empty
+// variation or a comment with a closing brace, still give a game that can be read back.
+func TestWriteAnnotations(t *testing.T) {
+	t.Parallel()
+
+	g, err := pgn.NewReader(strings.NewReader("1. e4 e5 *")).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.Comment = "a } brace"
+	g.Moves[0].Variations = [][]*pgn.Move{{}}
+	g.Moves[1].Comment = "closes} early"
+	g.Moves[1].Commands = []pgn.Command{{Name: "clk", Value: "0:01:00}"}}
+
+	var buf bytes.Buffer
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "{a brace} 1. e4 e5 {[%clk 0:01:00] closes early} *"; !strings.Contains(buf.String(), want) {
+		t.Errorf("output doesn't contain %q:\n%s", want, buf.String())
+	}
+
+	again, err := pgn.NewReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(again.MainLine()) != fmt.Sprint(g.MainLine()) {
+		t.Errorf("got %v after writing and reading, want %v", again.MainLine(), g.MainLine())
+	}
+}
+
+// TestErrors checks that a bad game is reported and skipped without losing the games after it.
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	text := `[Event "Good"]
+
+1.e4 e5 2.Nf3 *
+
+[Event "Illegal move"]
+
+1. e4 e5 2. Ke3 Nc6 1-0
+
+[Event "Bad variation"]
+
+1. e4 (1. d4 d5 0-1
+
+[Event "No result"]
+
+1. d4 d5
+
+[Event "Unterminated comment"]
+
+1. e4 {never closed`
+
+	r := pgn.NewReader(strings.NewReader(text))
+
+	tests := []struct {
+		event   string
+		moves   int
+		wantErr string
+	}{
+		{event: "Good", moves: 3},
+		{wantErr: "game 2 at line 7"},
+		{wantErr: "game 3 at line 11"},
+		{event: "No result", moves: 2},
+		{wantErr: "unterminated comment"},
+	}
+
+	for _, tt := range tests {
+		g, err := r.Next()
+
+		if tt.wantErr != "" {
+			var gameErr *pgn.GameError
+			if !errors.As(err, &gameErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want a game error with %q", err, tt.wantErr)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g.Tag("Event") != tt.event || len(g.Moves) != tt.moves {
+			t.Errorf("got %q with %d moves, want %q with %d", g.Tag("Event"), len(g.Moves), tt.event, tt.moves)
+		}
+	}
+
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("got %v after the last game, want EOF", err)
+	}
+}
+
+// TestStream reads many games from a stream that is never held in memory all at once.
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	const games = 500
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		for range games {
+			if _, err := io.WriteString(pw, annotated+"\n"); err != nil {
+				break
+			}
+		}
+
+		pw.Close()
+	}()
+
+	r := pgn.NewReader(pr)
+	n := 0
+
+	for {
+		_, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n++
+	}
+
+	if n != games {
+		t.Errorf("read %d games, want %d", n, games)
+	}
+}
@@ -0,0 +1,505 @@
+package pgn
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenTag
+	tokenSymbol
+	tokenMoveNumber
+	tokenResult
+	tokenComment
+	tokenNAG
+	tokenOpen
+	tokenClose
+)
+
+// token is a token of a PGN file. For tags, text is the name and value the value.
+type token struct {
+	kind  tokenKind
+	text  string
+	value string
+}
+
+// suffixes are the move suffix annotations and the glyphs they stand for.
+var suffixes = map[string]int{
+	"!":  NAGGood,
+	"?":  NAGMistake,
+	"!!": NAGBrilliant,
+	"??": NAGBlunder,
+	"!?": NAGInteresting,
+	"?!": NAGDubious,
+}
+
+// commandPattern matches a command annotation inside a comment.
+var commandPattern = regexp.MustCompile(`\[%(\w+)\s*([^\]]*)\]`)
+
+// moveNumberPattern matches a move number with its dots, which may be written without a space
+// before the move, as in "1.e4".
+var moveNumberPattern = regexp.MustCompile(`^[0-9]+\.+`)
+
+// Reader reads games from a PGN stream one at a time.
+type Reader struct {
+	r *bufio.Reader
+	// line is the current line number, last the last rune read and before the one before it, so
+	// that a rune can be unread.
+	line   int
+	last   rune
+	before rune
+	// peeked is a token that was read but not used.
+	peeked *token
+	// games is the number of games started, for error messages.
+	games int
+	err   error
+}
+
+// GameError is the error Reader.Next returns for a game that couldn't be read and was skipped. Any
+// other error means the stream itself failed, and there is no point reading on.
+type GameError struct {
+	// Game is the number of the game in the stream, counting from 1, and Line the line the
+	// problem was found on.
+	Game int
+	Line int
+	Err  error
+}
+
+func (e *GameError) Error() string {
+	return fmt.Sprintf("failed to read game %d at line %d: %v", e.Game, e.Line, e.Err)
+}
+
+func (e *GameError) Unwrap() error {
+	return e.Err
+}
+
+// NewReader returns a reader of the games in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 1<<16), line: 1, last: '\n'}
+}
+
+// Next returns the next game, or io.EOF once there are no more. A game that can't be read, because
+// the text is malformed or a move is illegal, is skipped and a *GameError saying where it went
+// wrong is returned; calling Next again carries on with the following game.
+func (r *Reader) Next() (*Game, error) {
+	tok, err := r.next()
+	if err == nil && tok.kind == tokenEOF {
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		return nil, io.EOF
+	}
+
+	r.games++
+
+	if err != nil {
+		return r.fail(err)
+	}
+
+	g := &Game{Result: Unknown}
+
+	for tok.kind == tokenTag {
+		g.Tags = append(g.Tags, Tag{Name: tok.text, Value: tok.value})
+
+		if tok, err = r.next(); err != nil {
+			return r.fail(err)
+		}
+	}
+
+	r.peeked = &tok
+
+	pos, err := g.StartPosition()
+	if err != nil {
+		return r.fail(err)
+	}
+
+	if g.Moves, err = r.moves(g, pos, 0); err != nil {
+		return r.fail(err)
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to read game %d: %w", r.games, r.err)
+	}
+
+	return g, nil
+}
+
+// fail skips the rest of the current game and returns an error saying where it went wrong.
+func (r *Reader) fail(err error) (*Game, error) {
+	line := r.line
+
+	for {
+		tok, tokErr := r.next()
+		if tokErr != nil {
+			continue
+		}
+
+		if tok.kind == tokenTag {
+			r.peeked = &tok
+
+			break
+		}
+
+		if tok.kind == tokenEOF || tok.kind == tokenResult {
+			break
+		}
+	}
+
+	return nil, &GameError{Game: r.games, Line: line, Err: err}
+}
+
+// moves reads a line of moves played from pos, up to the end of the game or, in a variation, the
+// closing parenthesis.
+func (r *Reader) moves(g *Game, pos *position.Position, depth int) ([]*Move, error) {
+	var (
+		line   []*Move
+		prev   *position.Position
+		before string
+	)
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+
+		var last *Move
+		if len(line) > 0 {
+			last = line[len(line)-1]
+		}
+
+		switch tok.kind {
+		case tokenEOF, tokenTag:
+			if depth > 0 {
+				return nil, errors.New("unterminated variation")
+			}
+
+			// The game has no result, and may be followed by the next one.
+			if tok.kind == tokenTag {
+				r.peeked = &tok
+			}
+
+			return line, nil
+		case tokenResult:
+			if depth > 0 {
+				return nil, fmt.Errorf("result %s inside a variation", tok.text)
+			}
+
+			g.Result = tok.text
+
+			return line, nil
+		case tokenMoveNumber:
+		case tokenComment:
+			switch {
+			case last != nil:
+				text, commands := parseComment(tok.text)
+				last.Comment = join(last.Comment, text)
+				last.Commands = append(last.Commands, commands...)
+			case depth == 0:
+				g.Comment = join(g.Comment, collapse(tok.text))
+			default:
+				before = join(before, collapse(tok.text))
+			}
+		case tokenNAG:
+			nag, err := strconv.Atoi(tok.text)
+			if err != nil || last == nil {
+				return nil, fmt.Errorf("unexpected annotation $%s", tok.text)
+			}
+
+			last.NAGs = append(last.NAGs, nag)
+		case tokenOpen:
+			if last == nil {
+				return nil, errors.New("variation before the first move")
+			}
+
+			variation, err := r.moves(g, prev, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(variation) > 0 {
+				last.Variations = append(last.Variations, variation)
+			}
+		case tokenClose:
+			if depth == 0 {
+				return nil, errors.New("unexpected )")
+			}
+
+			return line, nil
+		case tokenSymbol:
+			san, nags := splitSuffix(tok.text)
+
+			if san == "" {
+				if last == nil {
+					return nil, fmt.Errorf("unexpected annotation %s", tok.text)
+				}
+
+				last.NAGs = append(last.NAGs, nags...)
+
+				continue
+			}
+
+			m, err := movegen.ParseSAN(pos, san)
+			if err != nil {
+				return nil, err
+			}
+
+			next := &Move{Move: m, NAGs: nags}
+			if last == nil {
+				next.CommentBefore = before
+			}
+
+			line = append(line, next)
+			prev, pos = pos, movegen.MakeMove(pos, m, false)
+		}
+	}
+}
+
+// splitSuffix splits a suffix annotation such as "!?" from the end of a move.
+func splitSuffix(s string) (string, []int) {
+	san := strings.TrimRight(s, "!?")
+
+	if nag, ok := suffixes[s[len(san):]]; ok {
+		return san, []int{nag}
+	}
+
+	return san, nil
+}
+
+// parseComment takes the command annotations out of a comment.
+func parseComment(s string) (string, []Command) {
+	var commands []Command
+
+	for _, match := range commandPattern.FindAllStringSubmatch(s, -1) {
+		commands = append(commands, Command{Name: match[1], Value: strings.TrimSpace(match[2])})
+	}
+
+	return collapse(commandPattern.ReplaceAllString(s, " ")), commands
+}
+
+// collapse replaces each run of white space in a comment with a single space, since comments are
+// rewrapped when they're written.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func join(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+
+	return a + " " + b
+}
+
+// next returns the next token.
+func (r *Reader) next() (token, error) {
+	if r.peeked != nil {
+		tok := *r.peeked
+		r.peeked = nil
+
+		return tok, nil
+	}
+
+	for {
+		lineStart := r.last == '\n'
+
+		c, ok := r.readRune()
+		if !ok {
+			return token{kind: tokenEOF}, nil
+		}
+
+		switch {
+		case unicode.IsSpace(c):
+		case c == '%' && lineStart:
+			// An escaped line, which is ignored.
+			r.readUntil('\n')
+		case c == ';':
+			text, _ := r.readUntil('\n')
+
+			return token{kind: tokenComment, text: text}, nil
+		case c == '{':
+			text, ok := r.readUntil('}')
+			if !ok {
+				return token{}, errors.New("unterminated comment")
+			}
+
+			return token{kind: tokenComment, text: text}, nil
+		case c == '[':
+			return r.readTag()
+		case c == '(':
+			return token{kind: tokenOpen}, nil
+		case c == ')':
+			return token{kind: tokenClose}, nil
+		case c == '*':
+			return token{kind: tokenResult, text: Unknown}, nil
+		case c == '$':
+			return token{kind: tokenNAG, text: r.readWhile(isDigit)}, nil
+		case isSymbol(c):
+			r.unreadRune()
+
+			return r.readSymbol(), nil
+		default:
+			return token{}, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+}
+
+// readSymbol reads a move, move number or result.
+func (r *Reader) readSymbol() token {
+	s := r.readWhile(isSymbol)
+
+	switch s {
+	case WhiteWins, BlackWins, Drawn:
+		return token{kind: tokenResult, text: s}
+	case "e.p.":
+		return token{kind: tokenMoveNumber, text: s}
+	}
+
+	if number := moveNumberPattern.FindString(s); number != "" {
+		if number == s {
+			return token{kind: tokenMoveNumber, text: s}
+		}
+
+		s = s[len(number):]
+	}
+
+	return token{kind: tokenSymbol, text: s}
+}
+
+// readTag reads a tag pair after its opening bracket.
+func (r *Reader) readTag() (token, error) {
+	r.readWhile(isBlank)
+
+	name := r.readWhile(isSymbol)
+	if name == "" {
+		return token{}, errors.New("tag without a name")
+	}
+
+	r.readWhile(isBlank)
+
+	if c, ok := r.readRune(); !ok || c != '"' {
+		return token{}, fmt.Errorf("tag %s has no value", name)
+	}
+
+	var value strings.Builder
+
+	for {
+		c, ok := r.readRune()
+		if !ok || c == '\n' {
+			return token{}, fmt.Errorf("tag %s has an unterminated value", name)
+		}
+
+		if c == '"' {
+			break
+		}
+
+		if c == '\\' {
+			if c, ok = r.readRune(); !ok {
+				return token{}, fmt.Errorf("tag %s has an unterminated value", name)
+			}
+		}
+
+		value.WriteRune(c)
+	}
+
+	r.readWhile(isBlank)
+
+	if c, ok := r.readRune(); !ok || c != ']' {
+		return token{}, fmt.Errorf("tag %s is not closed", name)
+	}
+
+	return token{kind: tokenTag, text: name, value: value.String()}, nil
+}
+
+// readUntil reads up to and including a delimiter, and returns what came before it. It returns
+// false if the stream ended first.
+func (r *Reader) readUntil(delim rune) (string, bool) {
+	var ret strings.Builder
+
+	for {
+		c, ok := r.readRune()
+		if !ok {
+			return ret.String(), false
+		}
+
+		if c == delim {
+			return ret.String(), true
+		}
+
+		ret.WriteRune(c)
+	}
+}
+
+// readWhile reads runes for as long as they satisfy f.
+func (r *Reader) readWhile(f func(rune) bool) string {
+	var ret strings.Builder
+
+	for {
+		c, ok := r.readRune()
+		if !ok {
+			return ret.String()
+		}
+
+		if !f(c) {
+			r.unreadRune()
+
+			return ret.String()
+		}
+
+		ret.WriteRune(c)
+	}
+}
+
+func (r *Reader) readRune() (rune, bool) {
+	c, _, err := r.r.ReadRune()
+	if err != nil {
+		if !errors.Is(err, io.EOF) && r.err == nil {
+			r.err = err
+		}
+
+		return 0, false
+	}
+
+	if c == '\n' {
+		r.line++
+	}
+
+	r.before, r.last = r.last, c
+
+	return c, true
+}
+
+func (r *Reader) unreadRune() {
+	if r.last == '\n' {
+		r.line--
+	}
+
+	r.last = r.before
+	_ = r.r.UnreadRune()
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isBlank(c rune) bool {
+	return c == ' ' || c == '\t'
+}
+
+// isSymbol reports whether a rune can be part of a move, move number, result or tag name.
+func isSymbol(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_+#=:-/.!?", c))
+}
@@ -0,0 +1,206 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// lineWidth is the longest line written.
+const lineWidth = 80
+
+// WriteTo writes the game in export format: the seven tag roster in its standard order, SetUp and
+// FEN for a game that doesn't start from the standard position, and the other tags, then the move
+// text in standard algebraic notation wrapped at 80 columns, and a blank line to separate it from
+// the next game.
+func (g *Game) WriteTo(w io.Writer) (int64, error) {
+	pos, err := g.StartPosition()
+	if err != nil {
+		return 0, err
+	}
+
+	result := g.Result
+	if result == "" {
+		result = Unknown
+	}
+
+	bw := bufio.NewWriter(w)
+	counter := &countingWriter{w: bw}
+
+	for _, name := range rosterTags {
+		value := g.Tag(name)
+
+		switch {
+		case name == "Result":
+			value = result
+		case value == "":
+			value = rosterDefaults[name]
+			if value == "" {
+				value = "?"
+			}
+		}
+
+		writeTag(counter, name, value)
+	}
+
+	// A game from a set-up position needs the SetUp tag as well as FEN, and the two go straight
+	// after the roster.
+	fen := g.Tag("FEN")
+	if fen != "" {
+		writeTag(counter, "SetUp", "1")
+		writeTag(counter, "FEN", fen)
+	}
+
+	for _, tag := range g.Tags {
+		if isRosterTag(tag.Name) || (fen != "" && (tag.Name == "SetUp" || tag.Name == "FEN")) {
+			continue
+		}
+
+		writeTag(counter, tag.Name, tag.Value)
+	}
+
+	fmt.Fprintln(counter)
+
+	var words []string
+	if g.Comment != "" {
+		words = append(words, commentWords(g.Comment, nil)...)
+	}
+
+	words = appendLine(words, pos, g.Moves, int(pos.FullMoveNumber), true)
+	words = append(words, result)
+
+	width := 0
+
+	for _, word := range words {
+		switch {
+		case width == 0:
+		case width+1+len(word) > lineWidth:
+			fmt.Fprintln(counter)
+
+			width = 0
+		default:
+			fmt.Fprint(counter, " ")
+
+			width++
+		}
+
+		fmt.Fprint(counter, word)
+
+		width += len(word)
+	}
+
+	fmt.Fprint(counter, "\n\n")
+
+	if err := bw.Flush(); err != nil {
+		return counter.n, fmt.Errorf("failed to write game: %w", err)
+	}
+
+	return counter.n, nil
+}
+
+// appendLine appends the words of a line of moves played from pos. Black's moves are numbered when
+// they start the line or follow a comment or variation.
+func appendLine(words []string, pos *position.Position, line []*Move, number int, numberBlack bool) []string {
+	for _, m := range line {
+		if m.CommentBefore != "" {
+			words = append(words, commentWords(m.CommentBefore, nil)...)
+			numberBlack = true
+		}
+
+		switch {
+		case pos.WhiteToMove:
+			words = append(words, fmt.Sprintf("%d.", number))
+		case numberBlack:
+			words = append(words, fmt.Sprintf("%d...", number))
+		}
+
+		words = append(words, movegen.SAN(pos, m.Move))
+		numberBlack = false
+
+		for _, nag := range m.NAGs {
+			words = append(words, fmt.Sprintf("$%d", nag))
+		}
+
+		if m.Comment != "" || len(m.Commands) > 0 {
+			words = append(words, commentWords(m.Comment, m.Commands)...)
+			numberBlack = true
+		}
+
+		for _, variation := range m.Variations {
+			// An empty variation has nothing to write, and "()" isn't valid move text.
+			if len(variation) == 0 {
+				continue
+			}
+
+			start := len(words)
+			words = appendLine(words, pos, variation, number, true)
+			words[start] = "(" + words[start]
+			words[len(words)-1] += ")"
+			numberBlack = true
+		}
+
+		if !pos.WhiteToMove {
+			number++
+		}
+
+		pos = movegen.MakeMove(pos, m.Move, false)
+	}
+
+	return words
+}
+
+// commentWords returns the words of a comment, with its command annotations first. A comment can't
+// contain a closing brace, so any are dropped.
+func commentWords(text string, commands []Command) []string {
+	var words []string
+
+	for _, c := range commands {
+		words = append(words, strings.Fields(stripBraces(fmt.Sprintf("[%%%s %s]", c.Name, c.Value)))...)
+	}
+
+	words = append(words, strings.Fields(stripBraces(text))...)
+	if len(words) == 0 {
+		return []string{"{}"}
+	}
+
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+
+	return words
+}
+
+func stripBraces(text string) string {
+	return strings.ReplaceAll(text, "}", "")
+}
+
+func writeTag(w io.Writer, name, value string) {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	fmt.Fprintf(w, "[%s \"%s\"]\n", name, value)
+}
+
+func isRosterTag(name string) bool {
+	for _, tag := range rosterTags {
+		if tag == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,380 @@
+// Package polyglot reads opening books in the Polyglot format, the .bin files most engines and GUIs
+// share.
+//
+// A book is a sorted array of 16-byte big-endian entries: the position's key, a move, a weight and
+// four bytes of learning data that are ignored here. Keys are Zobrist hashes computed with
+// Polyglot's own set of random numbers, so they have nothing to do with any hashing the engine
+// does internally. A position has one entry per book move, and the entries are found by binary
+// search, so a book is never read into memory.
+package polyglot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sort"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+const entrySize = 16
+
+// Offsets into random64 of the keys that aren't for pieces.
+const (
+	castlingOffset  = 768
+	enPassantOffset = 772
+	turnOffset      = 780
+)
+
+// Entry is a single book entry.
+type Entry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// BookMove is a legal move found in the book, with its weight.
+type BookMove struct {
+	Move   move.Move
+	Weight uint16
+}
+
+// Book is an open Polyglot book. Lookups are safe for concurrent use.
+type Book struct {
+	file    *os.File
+	entries int64
+}
+
+// Open opens the book at the given path.
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open book: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, fmt.Errorf("failed to open book: %w", err)
+	}
+
+	if info.Size()%entrySize != 0 {
+		f.Close()
+
+		return nil, fmt.Errorf("%s is not a Polyglot book: its size isn't a multiple of %d bytes", path, entrySize)
+	}
+
+	return &Book{file: f, entries: info.Size() / entrySize}, nil
+}
+
+// Close closes the book's file.
+func (b *Book) Close() error {
+	return b.file.Close()
+}
+
+// Len returns the number of entries in the book.
+func (b *Book) Len() int {
+	return int(b.entries)
+}
+
+// Entries returns the book's entries for the position, in the order they appear in the book.
+func (b *Book) Entries(pos *position.Position) ([]Entry, error) {
+	key := Key(pos)
+
+	var readErr error
+
+	first := sort.Search(int(b.entries), func(i int) bool {
+		e, err := b.entry(int64(i))
+		if err != nil {
+			readErr = err
+
+			return true
+		}
+
+		return e.Key >= key
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	var ret []Entry
+
+	for i := int64(first); i < b.entries; i++ {
+		e, err := b.entry(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Key != key {
+			break
+		}
+
+		ret = append(ret, e)
+	}
+
+	return ret, nil
+}
+
+// Moves returns the legal moves the book has for the position, highest weight first. Entries whose
+// moves aren't legal, which only happens when two positions' keys collide, are left out.
+func (b *Book) Moves(pos *position.Position) ([]BookMove, error) {
+	entries, err := b.Entries(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []BookMove
+
+	for _, e := range entries {
+		if m, ok := DecodeMove(pos, e.Move); ok {
+			ret = append(ret, BookMove{Move: m, Weight: e.Weight})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Weight > ret[j].Weight
+	})
+
+	return ret, nil
+}
+
+// Pick chooses a book move for the position: the one with the highest weight if best is set, or
+// otherwise one at random, with each move's chance of being picked in proportion to its weight.
+// Moves with a weight of zero are never picked. It reports false if the book has no move.
+func (b *Book) Pick(pos *position.Position, best bool) (move.Move, bool, error) {
+	moves, err := b.Moves(pos)
+	if err != nil {
+		return 0, false, err
+	}
+
+	total := 0
+	for _, m := range moves {
+		total += int(m.Weight)
+	}
+
+	if total == 0 {
+		return 0, false, nil
+	}
+
+	if best {
+		return moves[0].Move, true, nil
+	}
+
+	n := rand.IntN(total)
+
+	for _, m := range moves {
+		if n -= int(m.Weight); n < 0 {
+			return m.Move, true, nil
+		}
+	}
+
+	return 0, false, errors.New("weights changed while picking a move")
+}
+
+func (b *Book) entry(i int64) (Entry, error) {
+	var buf [entrySize]byte
+
+	if _, err := b.file.ReadAt(buf[:], i*entrySize); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return Entry{}, fmt.Errorf("failed to read book entry %d: %w", i, err)
+	}
+
+	return Entry{
+		Key:    binary.BigEndian.Uint64(buf[0:8]),
+		Move:   binary.BigEndian.Uint16(buf[8:10]),
+		Weight: binary.BigEndian.Uint16(buf[10:12]),
+		Learn:  binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+// Write writes a book of the given entries. They are sorted first, by key and then by decreasing
+// weight, as readers expect.
+func Write(w io.Writer, entries []Entry) error {
+	sorted := append([]Entry(nil), entries...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Key != sorted[j].Key {
+			return sorted[i].Key < sorted[j].Key
+		}
+
+		return sorted[i].Weight > sorted[j].Weight
+	})
+
+	bw := bufio.NewWriter(w)
+
+	for _, e := range sorted {
+		var buf [entrySize]byte
+
+		binary.BigEndian.PutUint64(buf[0:8], e.Key)
+		binary.BigEndian.PutUint16(buf[8:10], e.Move)
+		binary.BigEndian.PutUint16(buf[10:12], e.Weight)
+		binary.BigEndian.PutUint32(buf[12:16], e.Learn)
+
+		if _, err := bw.Write(buf[:]); err != nil {
+			return fmt.Errorf("failed to write book: %w", err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write book: %w", err)
+	}
+
+	return nil
+}
+
+// Key returns the Polyglot key of the position. As in Polyglot, the en passant square only counts
+// when a pawn of the side to move could capture onto it.
+func Key(pos *position.Position) uint64 {
+	var ret uint64
+
+	for p := piece.Wp; p <= piece.Bk; p++ {
+		kind := pieceKind(p)
+
+		for board := pos.Occupancy[p]; board != 0; board = bb.ClearBit(board, bb.LSBIndex(board)) {
+			s := bb.LSBIndex(board)
+			ret ^= random64[64*kind+8*(s.Rank()-1)+s.File()-1]
+		}
+	}
+
+	for i, right := range []uint8{8, 4, 2, 1} {
+		if pos.CastlingRights&right != 0 {
+			ret ^= random64[castlingOffset+i]
+		}
+	}
+
+	if canCaptureEnPassant(pos) {
+		ret ^= random64[enPassantOffset+pos.EnPassantSquare.File()-1]
+	}
+
+	if pos.WhiteToMove {
+		ret ^= random64[turnOffset]
+	}
+
+	return ret
+}
+
+// pieceKind returns Polyglot's number for a piece: black pawn 0, white pawn 1, black knight 2 and
+// so on.
+func pieceKind(p piece.Piece) int {
+	if p >= piece.Bp {
+		return 2 * int(p-piece.Bp)
+	}
+
+	return 2*int(p-piece.Wp) + 1
+}
+
+// canCaptureEnPassant reports whether the side to move has a pawn next to the one that has just
+// moved two squares.
+func canCaptureEnPassant(pos *position.Position) bool {
+	target := pos.EnPassantSquare
+	if target == sq.NoSquare {
+		return false
+	}
+
+	// The pawn that moved is one rank further on from the en passant square.
+	pawn, capturer := target-8, piece.Bp
+	if pos.WhiteToMove {
+		pawn, capturer = target+8, piece.Wp
+	}
+
+	for _, df := range []int{-1, 1} {
+		file := pawn.File() + df
+		if file < 1 || file > 8 {
+			continue
+		}
+
+		if bb.GetBit(pos.Occupancy[capturer], sq.Square(int(pawn)+df)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DecodeMove returns the legal move in the position that a Polyglot move stands for. Polyglot
+// writes castling as the king capturing its own rook, so e1h1 is white castling kingside. It
+// reports false if the move isn't legal.
+func DecodeMove(pos *position.Position, raw uint16) (move.Move, bool) {
+	source := polyglotSquare(int(raw>>6) & 0x3f)
+	target := polyglotSquare(int(raw) & 0x3f)
+	promotion := int(raw>>12) & 0x7
+
+	if p := pos.PieceAt(source); p == piece.Wk || p == piece.Bk {
+		switch {
+		case source == sq.E1 && target == sq.H1, source == sq.E8 && target == sq.H8:
+			target = source + 2
+		case source == sq.E1 && target == sq.A1, source == sq.E8 && target == sq.A8:
+			target = source - 2
+		}
+	}
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if m.Source() != source || m.Target() != target {
+			continue
+		}
+
+		if promotionKind(m.PromotionPiece()) == promotion {
+			return m, true
+		}
+	}
+
+	return 0, false
+}
+
+// EncodeMove returns the Polyglot encoding of a move.
+func EncodeMove(m move.Move) uint16 {
+	source, target := m.Source(), m.Target()
+
+	if m.IsCastling() {
+		switch target {
+		case sq.G1, sq.G8:
+			target++
+		case sq.C1, sq.C8:
+			target -= 2
+		}
+	}
+
+	return uint16(promotionKind(m.PromotionPiece())<<12 | squareIndex(source)<<6 | squareIndex(target))
+}
+
+// promotionKind returns Polyglot's number for a promotion piece: 0 for none, then knight, bishop,
+// rook and queen.
+func promotionKind(p piece.Piece) int {
+	switch p {
+	case piece.Wn, piece.Bn:
+		return 1
+	case piece.Wb, piece.Bb:
+		return 2
+	case piece.Wr, piece.Br:
+		return 3
+	case piece.Wq, piece.Bq:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// polyglotSquare converts a square numbered from a1 = 0 to h8 = 63, as Polyglot numbers them.
+func polyglotSquare(i int) sq.Square {
+	return sq.Square((7-i/8)*8 + i%8)
+}
+
+// squareIndex is the inverse of polyglotSquare.
+func squareIndex(s sq.Square) int {
+	return 8*(s.Rank()-1) + s.File() - 1
+}
@@ -0,0 +1,260 @@
+package polyglot_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/polyglot"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// The keys from the Polyglot book format specification.
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fen  string
+		want uint64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 0x463b96181691fc9c},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 0x823c9b50fd114196},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", 0x0756b94461c50fb0},
+		{"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", 0x662fafb965db29d4},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", 0x22a48b5a8e47ff78},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3", 0x652a607ca3f242c1},
+		{"rnbq1bnr/ppp1pkpp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR w - - 0 4", 0x00fdd303c946bdd9},
+		{"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3", 0x3c8123ea7b067637},
+		{"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4", 0x5c3f9b829b279560},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := polyglot.Key(pos); got != tt.want {
+			t.Errorf("Key(%s) = %016x, want %016x", tt.fen, got, tt.want)
+		}
+	}
+}
+
+func TestMoveEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fen  string
+		raw  uint16
+		want string
+	}{
+		// e2e4
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 12<<6 | 28, "e2e4"},
+		// e1h1 and e1a1, castling
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", 4<<6 | 7, "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", 4<<6 | 0, "e1c1"},
+		// e8h8 and e8a8
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", 60<<6 | 63, "e8g8"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", 60<<6 | 56, "e8c8"},
+		// b7b8 promoting to a knight, and to a queen
+		{"7k/1P6/8/8/8/8/8/K7 w - - 0 1", 1<<12 | 49<<6 | 57, "b7b8N"},
+		{"7k/1P6/8/8/8/8/8/K7 w - - 0 1", 4<<12 | 49<<6 | 57, "b7b8Q"},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, ok := polyglot.DecodeMove(pos, tt.raw)
+		if !ok {
+			t.Errorf("DecodeMove(%s, %#x) found no move", tt.fen, tt.raw)
+
+			continue
+		}
+
+		if m.String() != tt.want {
+			t.Errorf("DecodeMove(%s, %#x) = %s, want %s", tt.fen, tt.raw, m, tt.want)
+		}
+
+		if got := polyglot.EncodeMove(m); got != tt.raw {
+			t.Errorf("EncodeMove(%s) = %#x, want %#x", m, got, tt.raw)
+		}
+	}
+
+	pos, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// e2e5 isn't legal.
+	if m, ok := polyglot.DecodeMove(pos, 12<<6|36); ok {
+		t.Errorf("DecodeMove(e2e5) = %s, want no move", m)
+	}
+}
+
+// writeBook writes a book of the given entries.
+func writeBook(t *testing.T, entries []polyglot.Entry) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := polyglot.Write(f, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func findMove(t *testing.T, pos *position.Position, s string) move.Move {
+	t.Helper()
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		if m.String() == s {
+			return m
+		}
+	}
+
+	t.Fatalf("%s is not legal", s)
+
+	return 0
+}
+
+func TestBook(t *testing.T) {
+	t.Parallel()
+
+	start, err := position.NewPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e4 := findMove(t, start, "e2e4")
+	afterE4 := movegen.MakeMove(start, e4, false)
+
+	entry := func(pos *position.Position, m move.Move, weight uint16) polyglot.Entry {
+		return polyglot.Entry{Key: polyglot.Key(pos), Move: polyglot.EncodeMove(m), Weight: weight}
+	}
+
+	entries := []polyglot.Entry{
+		entry(start, findMove(t, start, "g1f3"), 0),
+		entry(start, findMove(t, start, "d2d4"), 10),
+		entry(afterE4, findMove(t, afterE4, "c7c5"), 5),
+		entry(start, e4, 30),
+	}
+
+	// Fill the book out with other positions so that the search has some work to do.
+	for i := range uint64(200) {
+		entries = append(entries, polyglot.Entry{Key: i * 0x0123456789abcdef, Move: polyglot.EncodeMove(e4), Weight: 1})
+	}
+
+	book, err := polyglot.Open(writeBook(t, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+
+	if got := book.Len(); got != len(entries) {
+		t.Errorf("Len() = %d, want %d", got, len(entries))
+	}
+
+	moves, err := book.Moves(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range moves {
+		got = append(got, m.Move.String())
+	}
+
+	if want := []string{"e2e4", "d2d4", "g1f3"}; !equal(got, want) {
+		t.Errorf("Moves() = %v, want %v", got, want)
+	}
+
+	// Write sorts the entries of a position by decreasing weight.
+	raw, err := book.Entries(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(raw) != 3 || raw[0].Weight != 30 || raw[1].Weight != 10 || raw[2].Weight != 0 {
+		t.Errorf("Entries() = %v, want weights 30, 10, 0", raw)
+	}
+
+	if m, ok, err := book.Pick(start, true); err != nil || !ok || m != e4 {
+		t.Errorf("Pick(best) = %v, %v, %v, want e2e4", m, ok, err)
+	}
+
+	counts := make(map[string]int)
+
+	for range 400 {
+		m, ok, err := book.Pick(start, false)
+		if err != nil || !ok {
+			t.Fatalf("Pick() = %v, %v, %v", m, ok, err)
+		}
+
+		counts[m.String()]++
+	}
+
+	// e2e4 should come up three times as often as d2d4, and g1f3 not at all.
+	if counts["g1f3"] != 0 || counts["e2e4"] < 200 || counts["d2d4"] < 50 {
+		t.Errorf("Pick() chose %v", counts)
+	}
+
+	if m, ok, err := book.Pick(afterE4, false); err != nil || !ok || m.String() != "c7c5" {
+		t.Errorf("Pick(after e4) = %v, %v, %v, want c7c5", m, ok, err)
+	}
+
+	afterD4 := movegen.MakeMove(start, findMove(t, start, "d2d4"), false)
+	if _, ok, err := book.Pick(afterD4, false); err != nil || ok {
+		t.Errorf("Pick(after d4) = %v, %v, want no move", ok, err)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := os.WriteFile(path, make([]byte, 20), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := polyglot.Open(path); err == nil {
+		t.Error("Open() succeeded on a file of the wrong size")
+	}
+
+	if _, err := polyglot.Open(filepath.Join(t.TempDir(), "missing.bin")); err == nil {
+		t.Error("Open() succeeded on a missing file")
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,65 @@
+package position
+
+import (
+	"fmt"
+	"strings"
+)
+
+// knightPlacements are the squares of the two knights among the five back rank squares left once
+// the bishops and queen are placed, in the order of the standard Chess960 numbering.
+var knightPlacements = [10][2]int{
+	{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4},
+}
+
+// NewChess960Position returns the Chess960 starting position with the given number, from 0 to 959,
+// in the standard numbering, in which 518 is the starting position of standard chess.
+func NewChess960Position(index int) (*Position, error) {
+	if index < 0 || index >= 960 {
+		return nil, fmt.Errorf("Chess960 position number must be from 0 to 959, got %d", index)
+	}
+
+	var rank [8]byte
+
+	n := index
+
+	// One bishop on each colour: the light-squared one on b, d, f or h, and the dark-squared one on
+	// a, c, e or g.
+	rank[2*(n%4)+1] = 'b'
+	n /= 4
+	rank[2*(n%4)] = 'b'
+	n /= 4
+
+	// The queen, then the knights, then a rook, the king and a rook fill the empty squares in turn.
+	placeOnEmpty(&rank, n%6, 'q')
+	n /= 6
+
+	knights := knightPlacements[n]
+	placeOnEmpty(&rank, knights[1], 'n')
+	placeOnEmpty(&rank, knights[0], 'n')
+
+	for _, p := range []byte{'r', 'k', 'r'} {
+		placeOnEmpty(&rank, 0, p)
+	}
+
+	black := string(rank[:])
+	fen := fmt.Sprintf("%s/pppppppp/8/8/8/8/PPPPPPPP/%s w KQkq - 0 1", black, strings.ToUpper(black))
+
+	return NewPositionFromFEN(fen)
+}
+
+// placeOnEmpty puts a piece on the nth empty square of the rank, counting from 0.
+func placeOnEmpty(rank *[8]byte, n int, p byte) {
+	for i := range rank {
+		if rank[i] != 0 {
+			continue
+		}
+
+		if n == 0 {
+			rank[i] = p
+
+			return
+		}
+
+		n--
+	}
+}
@@ -0,0 +1,96 @@
+package position
+
+import (
+	"fmt"
+	"strings"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// pocketOrder is the order the pieces in hand are written in, which is the order most GUIs use.
+var pocketOrder = []piece.Piece{
+	piece.Wq, piece.Wr, piece.Wb, piece.Wn, piece.Wp,
+	piece.Bq, piece.Br, piece.Bb, piece.Bn, piece.Bp,
+}
+
+// splitPocket splits the board of a Crazyhouse FEN from the pieces in hand, which follow it either
+// in brackets or as a ninth rank.
+func splitPocket(board string) (string, string) {
+	if i := strings.IndexByte(board, '['); i >= 0 {
+		return board[:i], strings.TrimSuffix(board[i+1:], "]")
+	}
+
+	if strings.Count(board, "/") == 8 {
+		i := strings.LastIndexByte(board, '/')
+
+		return board[:i], board[i+1:]
+	}
+
+	return board, ""
+}
+
+// parsePocket parses the pieces in hand, such as "QNpp", into the number of each piece held.
+func parsePocket(pocket string) ([piece.Bk + 1]uint8, error) {
+	var ret [piece.Bk + 1]uint8
+
+	for _, c := range pocket {
+		found := false
+
+		for _, p := range pocketOrder {
+			if p.String() == string(c) {
+				ret[p]++
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return ret, fmt.Errorf("invalid piece in hand %q", c)
+		}
+	}
+
+	return ret, nil
+}
+
+// parsePromoted returns the board with the tildes marking promoted pieces taken out, along with the
+// squares of those pieces.
+func parsePromoted(board string) (string, bb.Bitboard) {
+	var (
+		sb       strings.Builder
+		promoted bb.Bitboard
+		square   sq.Square
+	)
+
+	for _, c := range board {
+		switch {
+		case c == '~':
+			if square > 0 {
+				promoted = bb.SetBit(promoted, square-1)
+			}
+
+			continue
+		case c >= '1' && c <= '8':
+			square += sq.Square(c - '0')
+		case c != '/':
+			square++
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String(), promoted
+}
+
+// pocketString returns the pieces in hand as they are written in a FEN, white's first.
+func (p *Position) pocketString() string {
+	var sb strings.Builder
+
+	for _, pc := range pocketOrder {
+		sb.WriteString(strings.Repeat(pc.String(), int(p.Pockets[pc])))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,119 @@
+package position
+
+import (
+	"math/rand/v2"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// Random numbers the key of a position is made from, XORed together for each feature it has. They
+// come from a fixed seed, so a position has the same key every time the program runs.
+var (
+	pieceKeys    [piece.Bk + 1][64]uint64
+	castlingKeys [4][64]uint64
+	enPassantKey [64]uint64
+	blackKey     uint64
+	variantKeys  [256]uint64
+	checkKeys    [2][256]uint64
+	pocketKeys   [piece.Bk + 1][256]uint64
+	promotedKeys [64]uint64
+)
+
+func init() {
+	r := rand.New(rand.NewPCG(0x6368657373, 0x656e67696e65))
+
+	for p := piece.Wp; p <= piece.Bk; p++ {
+		for s := range pieceKeys[p] {
+			pieceKeys[p][s] = r.Uint64()
+		}
+	}
+
+	for i := range castlingKeys {
+		for s := range castlingKeys[i] {
+			castlingKeys[i][s] = r.Uint64()
+		}
+	}
+
+	for s := range enPassantKey {
+		enPassantKey[s] = r.Uint64()
+	}
+
+	blackKey = r.Uint64()
+
+	// Standard chess has no key of its own, so its positions have the same keys as they would
+	// if variants didn't exist.
+	for v := 1; v < len(variantKeys); v++ {
+		variantKeys[v] = r.Uint64()
+	}
+
+	// Nor does having given no checks.
+	for side := range checkKeys {
+		for n := 1; n < len(checkKeys[side]); n++ {
+			checkKeys[side][n] = r.Uint64()
+		}
+	}
+
+	// Nor does having none of a piece in hand.
+	for p := piece.Wp; p <= piece.Bk; p++ {
+		for n := 1; n < len(pocketKeys[p]); n++ {
+			pocketKeys[p][n] = r.Uint64()
+		}
+	}
+
+	for s := range promotedKeys {
+		promotedKeys[s] = r.Uint64()
+	}
+}
+
+// Key returns a Zobrist hash of the position: the pieces, the side to move, the castling rights and
+// the squares of their rooks, the en passant square, the variant, in Three-check the checks given,
+// and in Crazyhouse the pieces in hand and which pieces on the board were promoted. Two positions
+// that are the same for the purposes of repetition have the same key, and two that differ almost
+// certainly have different ones. The move counters aren't part of it.
+func (p *Position) Key() uint64 {
+	var ret uint64
+
+	for pc := piece.Wp; pc <= piece.Bk; pc++ {
+		for board := p.Occupancy[pc]; board != 0; {
+			s := bb.LSBIndex(board)
+			board = bb.ClearBit(board, s)
+
+			ret ^= pieceKeys[pc][s]
+		}
+	}
+
+	if !p.WhiteToMove {
+		ret ^= blackKey
+	}
+
+	for i, right := range CastlingBits {
+		if p.CastlingRights&right != 0 {
+			ret ^= castlingKeys[i][p.CastlingRooks[i]]
+		}
+	}
+
+	if p.EnPassantSquare != sq.NoSquare {
+		ret ^= enPassantKey[p.EnPassantSquare]
+	}
+
+	ret ^= variantKeys[p.Variant]
+
+	if p.Variant == ThreeCheck {
+		ret ^= checkKeys[0][p.Checks[0]] ^ checkKeys[1][p.Checks[1]]
+	}
+
+	for pc, n := range p.Pockets {
+		ret ^= pocketKeys[pc][n]
+	}
+
+	for board := p.Promoted; board != 0; {
+		s := bb.LSBIndex(board)
+		board = bb.ClearBit(board, s)
+
+		ret ^= promotedKeys[s]
+	}
+
+	return ret
+}
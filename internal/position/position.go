@@ -5,6 +5,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"unicode"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
 	"github.com/samwestmoreland/chessengine/internal/piece"
@@ -13,14 +14,34 @@ import (
 )
 
 type Position struct {
-	Occupancy       []bb.Bitboard // Pieces of both colours
-	WhiteToMove     bool
-	CastlingRights  uint8
+	Occupancy      [piece.Ba + 1]bb.Bitboard // Pieces of both colours
+	WhiteToMove    bool
+	CastlingRights uint8
+	// CastlingRooks are the squares of the rooks the castling rights are for, in the order of
+	// CastlingBits. In standard chess they're always h1, a1, h8 and a8, but in Chess960 the rooks
+	// can start on any file.
+	CastlingRooks   [4]sq.Square
 	EnPassantSquare sq.Square
 	HalfMoveClock   uint8
 	FullMoveNumber  uint8
+	// Variant is the set of rules the game is played by.
+	Variant Variant
+	// Checks are the number of checks given by white and by black, which only count in
+	// Three-check.
+	Checks [2]uint8
+	// Pockets are the number of each piece held in hand in Crazyhouse, indexed by piece.
+	Pockets [piece.Bk + 1]uint8
+	// Promoted are the squares of the pieces that were promoted from pawns, in Crazyhouse.
+	Promoted bb.Bitboard
 }
 
+// CastlingBits are the bits of CastlingRights: white kingside, white queenside, black kingside
+// and black queenside.
+var CastlingBits = [4]uint8{8, 4, 2, 1}
+
+// standardCastlingRooks are the squares of the castling rooks in standard chess.
+var standardCastlingRooks = [4]sq.Square{sq.H1, sq.A1, sq.H8, sq.A8}
+
 func NewPosition() (*Position, error) {
 	pos, err := NewPositionFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
 	if err != nil {
@@ -30,8 +51,20 @@ func NewPosition() (*Position, error) {
 	return pos, nil
 }
 
+// NewPositionFromFEN parses a position in Forsyth-Edwards Notation. The halfmove clock and fullmove
+// number may be left out, as they often are in EPD files and hand-written FENs, in which case they
+// default to 0 and 1. Chess960 castling rights can be given as in Shredder-FEN or X-FEN.
 func NewPositionFromFEN(fen string) (*Position, error) {
-	parts := strings.Split(fen, " ")
+	return NewVariantPositionFromFEN(fen, Standard)
+}
+
+// NewVariantPositionFromFEN parses a position of the given variant in Forsyth-Edwards Notation.
+// Three-check positions may have the number of checks each side has left to give after the en
+// passant square, as in "3+3"; if they don't, no checks have been given. Crazyhouse positions have
+// the pieces in hand after the board, either in brackets as in "RNBQKBNR[Qp]" or as a ninth rank as
+// in "RNBQKBNR/Qp", and promoted pieces are followed by a tilde, as in "Q~".
+func NewVariantPositionFromFEN(fen string, variant Variant) (*Position, error) {
+	parts := strings.Fields(fen)
 	// parts[0]: position string
 	// parts[1]: turn to move
 	// parts[2]: castling rights
@@ -39,11 +72,47 @@ func NewPositionFromFEN(fen string) (*Position, error) {
 	// parts[4]: halfmove clock
 	// parts[5]: fullmove number
 
-	if len(parts) != 6 {
-		return nil, fmt.Errorf("FEN must have 6 parts, got %d", len(parts))
+	var checks [2]uint8
+
+	if variant == ThreeCheck && len(parts) > 4 && strings.Contains(parts[4], "+") {
+		var err error
+
+		checks, err = parseChecks(parts[4])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse checks: %w", err)
+		}
+
+		parts = append(parts[:4], parts[5:]...)
+	}
+
+	if len(parts) < 4 || len(parts) > 6 {
+		return nil, fmt.Errorf("FEN must have between 4 and 6 parts, got %d", len(parts))
 	}
 
-	occ, err := parsePositionString(parts[0])
+	parts = append(parts, []string{"0", "1"}[len(parts)-4:]...)
+
+	board := parts[0]
+
+	var (
+		pockets  [piece.Bk + 1]uint8
+		promoted bb.Bitboard
+	)
+
+	if variant == Crazyhouse {
+		var pocket string
+
+		board, pocket = splitPocket(board)
+
+		var err error
+
+		if pockets, err = parsePocket(pocket); err != nil {
+			return nil, fmt.Errorf("failed to parse pieces in hand: %w", err)
+		}
+
+		board, promoted = parsePromoted(board)
+	}
+
+	occ, err := parsePositionString(board)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse position string: %w", err)
 	}
@@ -53,7 +122,7 @@ func NewPositionFromFEN(fen string) (*Position, error) {
 		return nil, fmt.Errorf("failed to parse side to move: %w", err)
 	}
 
-	castlingRights, err := parseCastlingRights(parts[2])
+	castlingRights, castlingRooks, err := parseCastlingRights(parts[2], occ)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse castling rights: %w", err)
 	}
@@ -77,12 +146,76 @@ func NewPositionFromFEN(fen string) (*Position, error) {
 		Occupancy:       occ,
 		WhiteToMove:     whiteToMove,
 		CastlingRights:  castlingRights,
+		CastlingRooks:   castlingRooks,
 		EnPassantSquare: enpassant,
 		HalfMoveClock:   byte(halfMoveClock),
 		FullMoveNumber:  byte(fullMoveNumber),
+		Variant:         variant,
+		Checks:          checks,
+		Pockets:         pockets,
+		Promoted:        promoted,
 	}, nil
 }
 
+// FEN returns the position in Forsyth-Edwards Notation.
+func (p *Position) FEN() string {
+	var sb strings.Builder
+
+	for rank := range 8 {
+		empty := 0
+
+		for file := range 8 {
+			pc := p.PieceAt(sq.Square(rank*8 + file))
+			if pc == piece.NoPiece {
+				empty++
+
+				continue
+			}
+
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+
+			sb.WriteString(pc.String())
+
+			if bb.GetBit(p.Promoted, sq.Square(rank*8+file)) {
+				sb.WriteByte('~')
+			}
+		}
+
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+
+		if rank < 7 {
+			sb.WriteByte('/')
+		}
+	}
+
+	if p.Variant == Crazyhouse {
+		sb.WriteString("[" + p.pocketString() + "]")
+	}
+
+	castling := p.castlingRightsString()
+	if castling == "" {
+		castling = "-"
+	}
+
+	side := "w"
+	if !p.WhiteToMove {
+		side = "b"
+	}
+
+	ret := fmt.Sprintf("%s %s %s %s", sb.String(), side, castling, p.EnPassantSquare)
+
+	if p.Variant == ThreeCheck {
+		ret += fmt.Sprintf(" %d+%d", maxChecks-p.Checks[0], maxChecks-p.Checks[1])
+	}
+
+	return fmt.Sprintf("%s %d %d", ret, p.HalfMoveClock, p.FullMoveNumber)
+}
+
 func parseSideToMove(side string) (bool, error) {
 	if side == "w" {
 		return true, nil
@@ -110,8 +243,8 @@ func parseEnPassantSquare(square string) (sq.Square, error) {
 	return squareInt, nil
 }
 
-func parsePositionString(posStr string) ([]bb.Bitboard, error) {
-	occ := make([]bb.Bitboard, 15)
+func parsePositionString(posStr string) ([piece.Ba + 1]bb.Bitboard, error) {
+	var occ [piece.Ba + 1]bb.Bitboard
 
 	// Map pieces to their indices and colour bitboards
 	pieceMap := map[rune]struct {
@@ -153,43 +286,121 @@ func parsePositionString(posStr string) ([]bb.Bitboard, error) {
 	}
 
 	if square != 64 {
-		return nil, fmt.Errorf("expected 64 squares, got %d", square)
+		return occ, fmt.Errorf("expected 64 squares, got %d", square)
 	}
 
 	return occ, nil
 }
 
-// parseCastlingRights parses a string of castling rights into a uint8
-// 1000: K
-// 0100: Q
-// 0010: k
-// 0001: q
-func parseCastlingRights(castlingRights string) (uint8, error) {
+// parseCastlingRights parses the castling rights of a FEN, returning them with the squares of the
+// rooks they are for. As well as the standard KQkq, the files of the rooks can be given, as in
+// Shredder-FEN's HAha; X-FEN mixes the two, using a file only when the rook isn't the outermost
+// on its side of the king.
+//
+// A K or Q with no rook to match is taken to mean the rook on the h or a file, for positions
+// that aren't quite legal.
+func parseCastlingRights(castlingRights string, occ [piece.Ba + 1]bb.Bitboard) (uint8, [4]sq.Square, error) {
 	expectedLength := 4
 
+	rooks := standardCastlingRooks
+
 	if len(castlingRights) > expectedLength {
-		return 0, fmt.Errorf("expected castling rights to be %d characters, got %d", expectedLength, len(castlingRights))
+		return 0, rooks, fmt.Errorf("expected castling rights to be %d characters, got %d", expectedLength, len(castlingRights))
+	}
+
+	if castlingRights == "-" {
+		return 0, rooks, nil
 	}
 
 	var ret uint8
 
-	if strings.Contains(castlingRights, "K") {
-		ret |= 8
+	for _, c := range castlingRights {
+		white := unicode.IsUpper(c)
+
+		first, rook, king := 0, piece.Wr, piece.Wk
+		if !white {
+			first, rook, king = 2, piece.Br, piece.Bk
+		}
+
+		backRank := backRankStart(white)
+		kingFile := kingFileOn(occ[king], backRank)
+
+		var index int
+
+		switch unicode.ToUpper(c) {
+		case 'K':
+			index = first
+			rooks[index] = outermostRook(occ[rook], backRank, kingFile, true, standardCastlingRooks[index])
+		case 'Q':
+			index = first + 1
+			rooks[index] = outermostRook(occ[rook], backRank, kingFile, false, standardCastlingRooks[index])
+		case 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H':
+			file := int(unicode.ToUpper(c) - 'A')
+			square := backRank + sq.Square(file)
+
+			if kingFile < 0 || !bb.GetBit(occ[rook], square) {
+				return 0, rooks, fmt.Errorf("no king and rook to castle with for %q", c)
+			}
+
+			index = first
+			if file < kingFile {
+				index++
+			}
+
+			rooks[index] = square
+		default:
+			return 0, rooks, fmt.Errorf("invalid castling right %q", c)
+		}
+
+		ret |= CastlingBits[index]
 	}
 
-	if strings.Contains(castlingRights, "Q") {
-		ret |= 4
+	return ret, rooks, nil
+}
+
+// backRankStart returns the a-file square of a side's back rank.
+func backRankStart(white bool) sq.Square {
+	if white {
+		return sq.A1
 	}
 
-	if strings.Contains(castlingRights, "k") {
-		ret |= 2
+	return sq.A8
+}
+
+// kingFileOn returns the file of the king on a back rank, counting from 0, or -1 if it isn't there.
+func kingFileOn(kings bb.Bitboard, backRank sq.Square) int {
+	for file := range 8 {
+		if bb.GetBit(kings, backRank+sq.Square(file)) {
+			return file
+		}
 	}
 
-	if strings.Contains(castlingRights, "q") {
-		ret |= 1
+	return -1
+}
+
+// outermostRook returns the square of the rook furthest from the king on one side of it, or def if
+// there is no rook or no king.
+func outermostRook(rooks bb.Bitboard, backRank sq.Square, kingFile int, kingside bool, def sq.Square) sq.Square {
+	if kingFile < 0 {
+		return def
 	}
 
-	return ret, nil
+	for i := range 8 {
+		file := i
+		if kingside {
+			file = 7 - i
+		}
+
+		if kingside && file <= kingFile || !kingside && file >= kingFile {
+			break
+		}
+
+		if bb.GetBit(rooks, backRank+sq.Square(file)) {
+			return backRank + sq.Square(file)
+		}
+	}
+
+	return def
 }
 
 func (p *Position) Print(output io.Writer) {
@@ -218,22 +429,16 @@ func (p *Position) Print(output io.Writer) {
 	}
 
 	utils.WriteOrDie(fmt.Sprintf("\nside to move: %s\n", sideToString(p.WhiteToMove)), output)
-	utils.WriteOrDie(fmt.Sprintf("castling rights: %s\n", castlingRightsToString(p.CastlingRights)), output)
+	utils.WriteOrDie(fmt.Sprintf("castling rights: %s\n", p.castlingRightsString()), output)
 	utils.WriteOrDie(fmt.Sprintf("en passant square: %s\n", sq.Stringify(p.EnPassantSquare)), output)
 }
 
+// Copy returns a copy of the position. A Position holds no references, so a plain assignment copies
+// it as well, which lets a copy be kept on the stack.
 func (p *Position) Copy() *Position {
-	newOccupancy := make([]bb.Bitboard, len(p.Occupancy))
-	copy(newOccupancy, p.Occupancy)
+	ret := *p
 
-	return &Position{
-		Occupancy:       newOccupancy,
-		WhiteToMove:     p.WhiteToMove,
-		CastlingRights:  p.CastlingRights,
-		EnPassantSquare: p.EnPassantSquare,
-		HalfMoveClock:   p.HalfMoveClock,
-		FullMoveNumber:  p.FullMoveNumber,
-	}
+	return &ret
 }
 
 func (p *Position) MakeMove(source, target sq.Square, movePiece piece.Piece) *Position {
@@ -247,8 +452,19 @@ func (p *Position) MakeMove(source, target sq.Square, movePiece piece.Piece) *Po
 	return ret
 }
 
+// PieceAt returns the piece on the given square, or NoPiece if the square is empty.
+func (p *Position) PieceAt(square sq.Square) piece.Piece {
+	for i := piece.Wp; i <= piece.Bk; i++ {
+		if bb.GetBit(p.Occupancy[i], square) {
+			return i
+		}
+	}
+
+	return piece.NoPiece
+}
+
 func (p *Position) ClearSquare(square sq.Square) {
-	for i := piece.Wp; i < piece.Bk; i++ {
+	for i := piece.Wp; i <= piece.Bk; i++ {
 		if bb.GetBit(p.Occupancy[i], square) {
 			p.Occupancy[i] = bb.ClearBit(p.Occupancy[i], square)
 
@@ -291,23 +507,42 @@ func sideToString(whiteToMove bool) string {
 	return "black"
 }
 
-func castlingRightsToString(castlingRights uint8) string {
+// castlingRightsString returns the castling rights as in X-FEN: KQkq for the outermost rook on each
+// side of the king, which is all that standard chess needs, and the rook's file otherwise.
+func (p *Position) castlingRightsString() string {
 	sb := strings.Builder{}
 
-	if castlingRights&8 == 8 {
-		sb.WriteString("K")
-	}
+	for i, bit := range CastlingBits {
+		if p.CastlingRights&bit == 0 {
+			continue
+		}
 
-	if castlingRights&4 == 4 {
-		sb.WriteString("Q")
-	}
+		white, kingside := i < 2, i%2 == 0
 
-	if castlingRights&2 == 2 {
-		sb.WriteString("k")
-	}
+		rook, king := piece.Wr, piece.Wk
+		if !white {
+			rook, king = piece.Br, piece.Bk
+		}
+
+		backRank := backRankStart(white)
+		kingFile := kingFileOn(p.Occupancy[king], backRank)
+
+		var c rune
+
+		switch outer := outermostRook(p.Occupancy[rook], backRank, kingFile, kingside, p.CastlingRooks[i]); {
+		case outer != p.CastlingRooks[i]:
+			c = rune('A' + p.CastlingRooks[i].File() - 1)
+		case kingside:
+			c = 'K'
+		default:
+			c = 'Q'
+		}
+
+		if !white {
+			c = unicode.ToLower(c)
+		}
 
-	if castlingRights&1 == 1 {
-		sb.WriteString("q")
+		sb.WriteRune(c)
 	}
 
 	return sb.String()
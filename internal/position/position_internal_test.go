@@ -3,11 +3,20 @@ package position
 import (
 	"strings"
 	"testing"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
 )
 
 func TestParseCastlingRights(t *testing.T) {
 	t.Parallel()
 
+	occ, err := parsePositionString("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	tests := []struct {
 		input  string
 		output uint8
@@ -22,13 +31,15 @@ func TestParseCastlingRights(t *testing.T) {
 		{"KQk", 14},
 		{"KQkq", 15},
 		{"-", 0},
+		{"HAha", 15},
+		{"Ha", 9},
 	}
 
 	for _, test := range tests {
 		t.Run(test.input, func(t *testing.T) {
 			t.Parallel()
 
-			result, err := parseCastlingRights(test.input)
+			result, rooks, err := parseCastlingRights(test.input, occ)
 			if err != nil {
 				t.Error(err)
 			}
@@ -36,10 +47,113 @@ func TestParseCastlingRights(t *testing.T) {
 			if result != test.output {
 				t.Errorf("Expected %d, got %d", test.output, result)
 			}
+
+			if rooks != standardCastlingRooks {
+				t.Errorf("Expected rooks on %v, got %v", standardCastlingRooks, rooks)
+			}
+		})
+	}
+
+	for _, input := range []string{"X", "KQkqK", "Bb"} {
+		if _, _, err := parseCastlingRights(input, occ); err == nil {
+			t.Errorf("%q accepted", input)
+		}
+	}
+}
+
+func TestChess960CastlingRights(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		fen   string
+		rooks [4]sq.Square
+		want  string
+	}{
+		{
+			name:  "Shredder-FEN",
+			fen:   "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+			rooks: [4]sq.Square{sq.H1, sq.F1, sq.H8, sq.F8},
+			want:  "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9",
+		},
+		{
+			name:  "X-FEN",
+			fen:   "qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w KQkq - 1 9",
+			rooks: [4]sq.Square{sq.H1, sq.E1, sq.H8, sq.E8},
+			want:  "qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w KQkq - 1 9",
+		},
+		{
+			// Two rooks on the queenside, of which the inner one can castle.
+			name:  "X-FEN with a file",
+			fen:   "rr2k3/8/8/8/8/8/8/RR2K3 w Bb - 0 1",
+			rooks: [4]sq.Square{sq.H1, sq.B1, sq.H8, sq.B8},
+			want:  "rr2k3/8/8/8/8/8/8/RR2K3 w Bb - 0 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pos, err := NewPositionFromFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pos.CastlingRooks != tt.rooks {
+				t.Errorf("got rooks on %v, want %v", pos.CastlingRooks, tt.rooks)
+			}
+
+			if got := pos.FEN(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
 		})
 	}
 }
 
+func TestNewChess960Position(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"},
+		{518, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{959, "rkrnnqbb/pppppppp/8/8/8/8/PPPPPPPP/RKRNNQBB w KQkq - 0 1"},
+	}
+
+	for _, tt := range tests {
+		pos, err := NewChess960Position(tt.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := pos.FEN(); got != tt.want {
+			t.Errorf("position %d is %s, want %s", tt.index, got, tt.want)
+		}
+	}
+
+	seen := make(map[string]bool)
+
+	for i := range 960 {
+		pos, err := NewChess960Position(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen[pos.FEN()] = true
+	}
+
+	if len(seen) != 960 {
+		t.Errorf("got %d different positions, want 960", len(seen))
+	}
+
+	if _, err := NewChess960Position(960); err == nil {
+		t.Error("position 960 accepted")
+	}
+}
+
 func TestNewPositionFromFEN(t *testing.T) {
 	t.Parallel()
 
@@ -78,6 +192,27 @@ func TestNewPositionFromFEN(t *testing.T) {
 			true,
 			"FEN must have",
 		},
+		{
+			"missing clocks",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -",
+			false,
+			false,
+			"",
+		},
+		{
+			"repeated spaces",
+			"  rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR  w KQkq   - 0 1 ",
+			false,
+			false,
+			"",
+		},
+		{
+			"missing en passant square",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq",
+			false,
+			true,
+			"FEN must have",
+		},
 		{
 			"too many squares",
 			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNB3KBNR w KQkq - 0 1",
@@ -121,3 +256,226 @@ func TestNewPositionFromFEN(t *testing.T) {
 		})
 	}
 }
+
+func TestFEN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fen  string
+		want string
+	}{
+		{
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		},
+		{
+			"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+			"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+		},
+		{"8/8/8/8/8/1k6/8/K6r b - - 12 57", "8/8/8/8/8/1k6/8/K6r b - - 12 57"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Kq -", "r3k2r/8/8/8/8/8/8/R3K2R w Kq - 0 1"},
+	}
+
+	for _, tt := range tests {
+		pos, err := NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := pos.FEN(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestVariantFEN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		variant Variant
+		fen     string
+		want    string
+		checks  [2]uint8
+	}{
+		{
+			ThreeCheck,
+			"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 2+3 0 2",
+			"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 2+3 0 2",
+			[2]uint8{1, 0},
+		},
+		{
+			ThreeCheck,
+			"4k3/8/8/8/8/8/8/4K3 b - - 1+1",
+			"4k3/8/8/8/8/8/8/4K3 b - - 1+1 0 1",
+			[2]uint8{2, 2},
+		},
+		{
+			ThreeCheck,
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1",
+			[2]uint8{0, 0},
+		},
+		{
+			RacingKings,
+			RacingKings.StartFEN(),
+			"8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1",
+			[2]uint8{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		pos, err := NewVariantPositionFromFEN(tt.fen, tt.variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pos.Variant != tt.variant || pos.Checks != tt.checks {
+			t.Errorf("%s: got variant %s and checks %v, want %s and %v", tt.fen, pos.Variant, pos.Checks, tt.variant, tt.checks)
+		}
+
+		if got := pos.FEN(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+
+	for _, fen := range []string{
+		"4k3/8/8/8/8/8/8/4K3 w - - 4+3 0 1",
+		"4k3/8/8/8/8/8/8/4K3 w - - x+3 0 1",
+	} {
+		if _, err := NewVariantPositionFromFEN(fen, ThreeCheck); err == nil {
+			t.Errorf("%s: expected an error", fen)
+		}
+	}
+
+	// The checks only belong in Three-check FENs.
+	if _, err := NewPositionFromFEN("4k3/8/8/8/8/8/8/4K3 w - - 3+3 0 1"); err == nil {
+		t.Error("expected an error for checks in a standard FEN")
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range Variants {
+		got, err := ParseVariant(strings.ToUpper(v.String()))
+		if err != nil || got != v {
+			t.Errorf("ParseVariant(%s) = %s, %v", v, got, err)
+		}
+	}
+
+	if _, err := ParseVariant("crazyhouse960"); err == nil {
+		t.Error("expected an error for an unknown variant")
+	}
+}
+
+func TestCrazyhouseFEN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fen      string
+		want     string
+		pockets  map[piece.Piece]uint8
+		promoted []sq.Square
+	}{
+		{
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1",
+			nil,
+			nil,
+		},
+		{
+			"r1bk3r/ppp2ppp/2n5/8/8/8/PPP2PPP/R1B1K2R[QNpp] b KQ - 0 12",
+			"r1bk3r/ppp2ppp/2n5/8/8/8/PPP2PPP/R1B1K2R[QNpp] b KQ - 0 12",
+			map[piece.Piece]uint8{piece.Wq: 1, piece.Wn: 1, piece.Bp: 2},
+			nil,
+		},
+		{
+			"4Q~3/k7/8/8/8/8/8/4K2q~/pNQ w - - 0 40",
+			"4Q~3/k7/8/8/8/8/8/4K2q~[QNp] w - - 0 40",
+			map[piece.Piece]uint8{piece.Wq: 1, piece.Wn: 1, piece.Bp: 1},
+			[]sq.Square{sq.E8, sq.H1},
+		},
+	}
+
+	for _, tt := range tests {
+		pos, err := NewVariantPositionFromFEN(tt.fen, Crazyhouse)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, p := range pocketOrder {
+			if pos.Pockets[p] != tt.pockets[p] {
+				t.Errorf("%s: %d %s in hand, want %d", tt.fen, pos.Pockets[p], p, tt.pockets[p])
+			}
+		}
+
+		if want := bb.SetBits(0, tt.promoted...); pos.Promoted != want {
+			t.Errorf("%s: promoted %x, want %x", tt.fen, uint64(pos.Promoted), uint64(want))
+		}
+
+		if got := pos.FEN(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+
+	if _, err := NewVariantPositionFromFEN("4k3/8/8/8/8/8/8/4K3[Kx] w - - 0 1", Crazyhouse); err == nil {
+		t.Error("expected an error for invalid pieces in hand")
+	}
+}
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	key := func(fen string, variant Variant) uint64 {
+		t.Helper()
+
+		pos, err := NewVariantPositionFromFEN(fen, variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pos.Key()
+	}
+
+	start := key("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", Standard)
+
+	// The move counters aren't part of the key.
+	if got := key("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 5 12", Standard); got != start {
+		t.Errorf("got key %x with other move counters, want %x", got, start)
+	}
+
+	tests := []struct {
+		name    string
+		fen     string
+		variant Variant
+	}{
+		{"side to move", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1", Standard},
+		{"castling rights", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w Kkq - 0 1", Standard},
+		{"variant", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", KingOfTheHill},
+		{"three-check", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1", ThreeCheck},
+		{"white's checks", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 2+3 0 1", ThreeCheck},
+		{"black's checks", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+2 0 1", ThreeCheck},
+		{"both sides' checks", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 2+2 0 1", ThreeCheck},
+		{"pieces", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 1", Standard},
+		{"en passant", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e3 0 1", Standard},
+		{"outer castling rook", "4k3/8/8/8/8/8/8/R3K1RR w K - 0 1", Standard},
+		{"inner castling rook", "4k3/8/8/8/8/8/8/R3K1RR w G - 0 1", Standard},
+		{"crazyhouse", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1", Crazyhouse},
+		{"white's pocket", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[P] w KQkq - 0 1", Crazyhouse},
+		{"black's pocket", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[p] w KQkq - 0 1", Crazyhouse},
+		{"two in the pocket", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[PP] w KQkq - 0 1", Crazyhouse},
+		{"unpromoted piece", "4k3/1Q6/8/8/8/8/8/K7[] b - - 0 1", Crazyhouse},
+		{"promoted piece", "4k3/1Q~6/8/8/8/8/8/K7[] b - - 0 1", Crazyhouse},
+	}
+
+	seen := map[uint64]string{start: "the starting position"}
+
+	for _, tt := range tests {
+		got := key(tt.fen, tt.variant)
+		if other, ok := seen[got]; ok {
+			t.Errorf("%s: got the same key as %s", tt.name, other)
+		}
+
+		seen[got] = tt.name
+	}
+}
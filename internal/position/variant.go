@@ -0,0 +1,132 @@
+package position
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Variant is a set of rules the game is played by. The zero value is standard chess.
+type Variant uint8
+
+const (
+	Standard Variant = iota
+	// ThreeCheck is won by checkmate or by giving the third check.
+	ThreeCheck
+	// KingOfTheHill is won by checkmate or by getting the king to one of the four centre squares.
+	KingOfTheHill
+	// RacingKings is won by getting the king to the eighth rank first, from a starting position
+	// with both sides' pieces on the first two ranks. Giving check isn't allowed. If white gets
+	// there first, black has one move to get there too and draw.
+	RacingKings
+	// Crazyhouse lets a side drop the pieces it has captured back onto the board as its own, in
+	// place of a move. Promoted pieces go back to being pawns when they are captured.
+	Crazyhouse
+	// Atomic is won by checkmate or by blowing up the enemy king: a capture removes the capturing
+	// piece and every piece other than a pawn next to the square it captures on. Kings can't
+	// capture, and may stand next to each other.
+	Atomic
+	// Antichess is won by losing every piece or by being stalemated. Captures are compulsory, and
+	// the king is an ordinary piece that can be captured and that pawns can promote to.
+	Antichess
+)
+
+// maxChecks is the number of checks that wins a game of Three-check.
+const maxChecks = 3
+
+// Variants are the supported variants, in the order they are listed in the UCI_Variant option.
+var Variants = []Variant{Standard, ThreeCheck, KingOfTheHill, RacingKings, Crazyhouse, Atomic, Antichess}
+
+// variantNames are the names of the variants in the UCI_Variant option, as most engines and GUIs
+// that support variants spell them.
+var variantNames = [...]string{
+	Standard:      "chess",
+	ThreeCheck:    "3check",
+	KingOfTheHill: "kingofthehill",
+	RacingKings:   "racingkings",
+	Crazyhouse:    "crazyhouse",
+	Atomic:        "atomic",
+	Antichess:     "antichess",
+}
+
+var startFENs = [...]string{
+	Standard:      "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	ThreeCheck:    "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1",
+	KingOfTheHill: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	RacingKings:   "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1",
+	Crazyhouse:    "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1",
+	Atomic:        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	Antichess:     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w - - 0 1",
+}
+
+func (v Variant) String() string {
+	if int(v) >= len(variantNames) {
+		return fmt.Sprintf("Variant(%d)", v)
+	}
+
+	return variantNames[v]
+}
+
+// ParseVariant returns the variant with the given UCI_Variant name, ignoring case. "standard" is
+// also accepted for standard chess.
+func ParseVariant(name string) (Variant, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "standard" {
+		return Standard, nil
+	}
+
+	for _, v := range Variants {
+		if variantNames[v] == name {
+			return v, nil
+		}
+	}
+
+	return Standard, fmt.Errorf("unknown variant %q", name)
+}
+
+// StartFEN returns the starting position of the variant.
+func (v Variant) StartFEN() string {
+	return startFENs[v]
+}
+
+// NewVariantPosition returns the starting position of the given variant.
+func NewVariantPosition(variant Variant) (*Position, error) {
+	pos, err := NewVariantPositionFromFEN(variant.StartFEN(), variant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new %s position: %w", variant, err)
+	}
+
+	return pos, nil
+}
+
+// parseChecks parses the number of checks white and black each have left to give in Three-check,
+// such as "3+2", and returns the number of checks each has given.
+func parseChecks(s string) ([2]uint8, error) {
+	var ret [2]uint8
+
+	white, black, ok := strings.Cut(s, "+")
+	if !ok {
+		return ret, fmt.Errorf("expected checks as <white>+<black>, got %q", s)
+	}
+
+	for i, field := range []string{white, black} {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 || n > maxChecks {
+			return ret, fmt.Errorf("invalid number of checks %q", field)
+		}
+
+		ret[i] = uint8(maxChecks - n)
+	}
+
+	return ret, nil
+}
+
+// ChecksToWin returns the number of checks the given side, white if white is set, still has to
+// give to win a game of Three-check.
+func (p *Position) ChecksToWin(white bool) int {
+	if white {
+		return maxChecks - int(p.Checks[0])
+	}
+
+	return maxChecks - int(p.Checks[1])
+}
@@ -0,0 +1,294 @@
+package syzygy
+
+import "sort"
+
+// The tables in this file map piece placements to table indices, following the scheme used by the
+// Syzygy generator. Squares here are numbered the way the tables expect, with a1 as 0 and h8 as
+// 63, which is the squares package numbering flipped vertically.
+
+const (
+	maxPieces = 7
+
+	// Piece codes as stored in the table files: white pawn to king are 1 to 6 and black pawn to
+	// king are 9 to 14, so that bit 3 is the colour.
+	tbPawn = 1
+	tbKing = 6
+)
+
+var (
+	// mapPawns maps the squares a2 to h7 to 0..47, ordered so that the pawn with the highest value
+	// is the one nearest the a- or h-file and, within a file, nearest the second rank.
+	mapPawns [64]int
+	// mapB1H1H7 maps the squares below the a1-h8 diagonal to 0..27.
+	mapB1H1H7 [64]int
+	// mapA1D1D4 maps the squares in the a1-d1-d4 triangle to 0..9, with the diagonal last.
+	mapA1D1D4 [64]int
+	// mapKK maps the 462 legal placements of two kings, the first in the a1-d1-d4 triangle, to
+	// 0..461.
+	mapKK [10][64]int
+
+	// binomial[k][n] is the number of ways to choose k of n elements.
+	binomial [maxPieces][64]uint64
+	// leadPawnIdx[n][s] is the index of n leading pawns with the first on s, and leadPawnsSize[n][f]
+	// the number of such indices when the first is on file f.
+	leadPawnIdx   [6][64]uint64
+	leadPawnsSize [6][4]uint64
+)
+
+func init() {
+	code := 0
+
+	for s := range 64 {
+		if offA1H8(s) < 0 {
+			mapB1H1H7[s] = code
+			code++
+		}
+	}
+
+	var diagonal []int
+
+	code = 0
+
+	for s := 0; s <= 27; s++ {
+		switch {
+		case offA1H8(s) < 0 && s%8 <= 3:
+			mapA1D1D4[s] = code
+			code++
+		case offA1H8(s) == 0 && s%8 <= 3:
+			diagonal = append(diagonal, s)
+		}
+	}
+
+	for _, s := range diagonal {
+		mapA1D1D4[s] = code
+		code++
+	}
+
+	type placement struct{ idx, square int }
+
+	var bothOnDiagonal []placement
+
+	code = 0
+
+	for idx := range 10 {
+		for s1 := 0; s1 <= 27; s1++ {
+			// b1 is the only square mapped to 0; every square outside the triangle is 0 as well.
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) {
+				continue
+			}
+
+			for s2 := range 64 {
+				switch {
+				case distance(s1, s2) <= 1:
+					// Illegal: the kings would be touching.
+				case offA1H8(s1) == 0 && offA1H8(s2) > 0:
+					// Mirrored into the lower half of the board.
+				case offA1H8(s1) == 0 && offA1H8(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, placement{idx, s2})
+				default:
+					mapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+
+	for _, p := range bothOnDiagonal {
+		mapKK[p.idx][p.square] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+
+	for n := 1; n < 64; n++ {
+		for k := 0; k < maxPieces && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+
+	for leadPawns := 1; leadPawns <= 5; leadPawns++ {
+		for file := range 4 {
+			var idx uint64
+
+			for rank := 1; rank <= 6; rank++ {
+				s := rank*8 + file
+
+				if leadPawns == 1 {
+					mapPawns[s] = available
+					available--
+					mapPawns[s^7] = available
+					available--
+				}
+
+				leadPawnIdx[leadPawns][s] = idx
+				idx += binomial[leadPawns-1][mapPawns[s]]
+			}
+
+			leadPawnsSize[leadPawns][file] = idx
+		}
+	}
+}
+
+// offA1H8 is positive above the a1-h8 diagonal, zero on it and negative below it.
+func offA1H8(s int) int {
+	return s/8 - s%8
+}
+
+func distance(a, b int) int {
+	return max(abs(a/8-b/8), abs(a%8-b%8))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// encode returns the index of a placement within the table described by d. squares and pieces
+// must already be oriented for the table, with the leading pawns, if any, first. The pieces are
+// reordered to match the table's piece sequence and the squares are mirrored as the encoding
+// requires, so both slices are modified.
+func encode(t *table, d *pairsData, squares []int, pieces []int, leadPawns int) uint64 {
+	size := len(squares)
+
+	for i := leadPawns; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+
+				break
+			}
+		}
+	}
+
+	// Mirror so that the leading piece is on files a to d.
+	if squares[0]%8 > 3 {
+		for i := range squares {
+			squares[i] ^= 7
+		}
+	}
+
+	var idx uint64
+
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawns][squares[0]]
+
+		others := squares[1:leadPawns]
+		sort.SliceStable(others, func(i, j int) bool {
+			return mapPawns[others[i]] < mapPawns[others[j]]
+		})
+
+		for i := 1; i < leadPawns; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		idx = encodePieces(t, d, squares)
+	}
+
+	idx *= d.groupIdx[0]
+
+	// Each remaining group is encoded as a combination of the squares not taken by earlier groups.
+	// Pawns on both sides means the second group is pawns, which can't stand on the first or last
+	// ranks.
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	start := d.groupLen[0]
+
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sort.Ints(group)
+
+		var n uint64
+
+		for i, s := range group {
+			adjust := 0
+
+			for _, earlier := range squares[:start] {
+				if s > earlier {
+					adjust++
+				}
+			}
+
+			offset := 0
+			if remainingPawns {
+				offset = 8
+			}
+
+			n += binomial[i+1][s-adjust-offset]
+		}
+
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+
+	return idx
+}
+
+// encodePieces encodes the leading group of a table without pawns: either three unique pieces
+// together, or just the two kings.
+func encodePieces(t *table, d *pairsData, squares []int) uint64 {
+	// Mirror so that the leading piece is on ranks 1 to 4.
+	if squares[0]/8 > 3 {
+		for i := range squares {
+			squares[i] ^= 56
+		}
+	}
+
+	// Mirror along the a1-h8 diagonal so that the first piece of the leading group which is off
+	// the diagonal is below it.
+	for i := range d.groupLen[0] {
+		if offA1H8(squares[i]) == 0 {
+			continue
+		}
+
+		if offA1H8(squares[i]) > 0 {
+			for j := i; j < len(squares); j++ {
+				squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+			}
+		}
+
+		break
+	}
+
+	if !t.hasUniquePieces {
+		return uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+	}
+
+	adjust1 := 0
+	if squares[1] > squares[0] {
+		adjust1 = 1
+	}
+
+	adjust2 := 0
+	if squares[2] > squares[0] {
+		adjust2++
+	}
+
+	if squares[2] > squares[1] {
+		adjust2++
+	}
+
+	switch {
+	case offA1H8(squares[0]) != 0:
+		return uint64((mapA1D1D4[squares[0]]*63+squares[1]-adjust1)*62 + squares[2] - adjust2)
+	case offA1H8(squares[1]) != 0:
+		return uint64((6*63+(squares[0]/8)*28+mapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+	case offA1H8(squares[2]) != 0:
+		return uint64(6*63*62 + 4*28*62 + (squares[0]/8)*7*28 + (squares[1]/8-adjust1)*28 +
+			mapB1H1H7[squares[2]])
+	default:
+		return uint64(6*63*62 + 4*28*62 + 4*7*28 + (squares[0]/8)*7*6 + (squares[1]/8-adjust1)*6 +
+			(squares[2]/8 - adjust2))
+	}
+}
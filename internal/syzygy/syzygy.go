@@ -0,0 +1,540 @@
+// Package syzygy probes Syzygy endgame tablebases. WDL tables (.rtbw) give the result of a
+// position with perfect play, taking the fifty-move rule into account, and DTZ tables (.rtbz) give
+// the distance to the next capture or pawn move that keeps that result, which is what is needed to
+// actually convert a win.
+//
+// The tables don't store every position correctly. Positions where the side to move has a winning
+// capture, for example, hold whatever value compressed best, so probes first resolve captures with
+// a small search, in the same way as the reference implementation.
+package syzygy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/move"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+)
+
+// WDL is the result of a position from the side to move's point of view. Cursed wins and blessed
+// losses are wins and losses that the fifty-move rule turns into draws.
+type WDL int
+
+const (
+	Loss        WDL = -2
+	BlessedLoss WDL = -1
+	Draw        WDL = 0
+	CursedWin   WDL = 1
+	Win         WDL = 2
+)
+
+func (w WDL) String() string {
+	switch w {
+	case Loss:
+		return "loss"
+	case BlessedLoss:
+		return "blessed loss"
+	case Draw:
+		return "draw"
+	case CursedWin:
+		return "cursed win"
+	case Win:
+		return "win"
+	default:
+		return fmt.Sprintf("WDL(%d)", int(w))
+	}
+}
+
+// Tablebases is a set of tables found on disk. Files are only read when they are first probed.
+// Probing is safe for concurrent use.
+type Tablebases struct {
+	// Tables are stored under the material signature of both orientations, so KRvK is found for
+	// both "KRvK" and "KvKR".
+	tables    [2]map[string]*table
+	maxPieces int
+}
+
+var tableName = regexp.MustCompile(`^K[QRBNP]*vK[QRBNP]*$`)
+
+// Open looks for tables in the given directories, which are separated as in the PATH environment
+// variable. A WDL table is required for a position to be probed; its DTZ table is optional.
+func Open(paths string) (*Tablebases, error) {
+	ret := &Tablebases{
+		tables: [2]map[string]*table{make(map[string]*table), make(map[string]*table)},
+	}
+
+	for _, dir := range filepath.SplitList(paths) {
+		if dir == "" {
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tablebase directory: %w", err)
+		}
+
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			name := strings.TrimSuffix(entry.Name(), ext)
+
+			typ := wdlTable
+
+			switch ext {
+			case ".rtbw":
+			case ".rtbz":
+				typ = dtzTable
+			default:
+				continue
+			}
+
+			if !tableName.MatchString(name) || len(name)-1 > maxPieces {
+				continue
+			}
+
+			if _, ok := ret.tables[typ][name]; ok {
+				continue
+			}
+
+			t := newTable(typ, name, filepath.Join(dir, entry.Name()))
+
+			white, black, _ := strings.Cut(name, "v")
+			ret.tables[typ][name] = t
+			ret.tables[typ][black+"v"+white] = t
+
+			if typ == wdlTable {
+				ret.maxPieces = max(ret.maxPieces, t.pieceCount)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// MaxPieces returns the number of pieces, kings included, in the largest WDL table found.
+func (tb *Tablebases) MaxPieces() int {
+	return tb.maxPieces
+}
+
+// Covers reports whether the position can be probed: it must be standard chess, with no castling
+// rights and no more pieces than the largest table. Whether the table for its exact material is present is only found
+// out by probing.
+func (tb *Tablebases) Covers(pos *position.Position) bool {
+	return pos.Variant == position.Standard && pos.CastlingRights == 0 && pieceCount(pos) <= tb.maxPieces
+}
+
+// ProbeWDL returns the result of the position. It reports false if the position isn't covered or
+// a table it needs is missing or unreadable.
+func (tb *Tablebases) ProbeWDL(pos *position.Position) (WDL, bool) {
+	if !tb.Covers(pos) {
+		return Draw, false
+	}
+
+	wdl, state := tb.search(pos, false)
+
+	return wdl, state != probeFail
+}
+
+// ProbeDTZ returns the distance to zeroing of the position in plies: the number of plies to the
+// next capture or pawn move for the winning side to keep the win, or for the losing side to delay
+// the loss. It is positive for wins and negative for losses, and 0 for draws. Cursed wins and
+// blessed losses are counted past 100, so a value with an absolute size over 100 is a draw under
+// the fifty-move rule. A return value of 1 or -1 means the side to move is mated or wins straight
+// away with a zeroing move.
+func (tb *Tablebases) ProbeDTZ(pos *position.Position) (int, bool) {
+	if !tb.Covers(pos) {
+		return 0, false
+	}
+
+	dtz, state := tb.probeDTZ(pos)
+
+	return dtz, state != probeFail
+}
+
+// RootMove is a legal move at the root ranked by the tablebases.
+type RootMove struct {
+	Move move.Move
+	// DTZ is the distance to zeroing after playing the move, counted from the root.
+	DTZ int
+	// Rank orders the moves: 1000 for a win that will be reached within the fifty-move rule, lower
+	// positive values for wins that may not be, 0 for draws and negative values for losses, with
+	// -1000 for a loss that will happen regardless.
+	Rank int
+}
+
+// RankRootMoves probes every legal move from the position, taking into account how far the
+// fifty-move counter has already run. The moves are returned best first, with winning moves of the
+// same rank ordered by increasing distance to zeroing, so that playing the first move always makes
+// progress.
+func (tb *Tablebases) RankRootMoves(pos *position.Position) ([]RootMove, bool) {
+	if !tb.Covers(pos) {
+		return nil, false
+	}
+
+	halfMoves := int(pos.HalfMoveClock)
+
+	var ret []RootMove
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		child := movegen.MakeMove(pos, m, false)
+
+		var dtz int
+
+		if child.HalfMoveClock == 0 {
+			wdl, state := tb.search(child, false)
+			if state == probeFail {
+				return nil, false
+			}
+
+			dtz = dtzBeforeZeroing(-wdl)
+		} else {
+			childDTZ, state := tb.probeDTZ(child)
+			if state == probeFail {
+				return nil, false
+			}
+
+			dtz = -childDTZ
+
+			switch {
+			case dtz > 0:
+				dtz++
+			case dtz < 0:
+				dtz--
+			}
+		}
+
+		// A mating move is a distance of one.
+		if dtz == 2 && movegen.InCheck(child) && len(movegen.GetLegalMoves(child)) == 0 {
+			dtz = 1
+		}
+
+		rank := 0
+
+		switch {
+		case dtz > 0 && dtz+halfMoves <= 99:
+			rank = 1000
+		case dtz > 0:
+			rank = 1000 - (dtz + halfMoves)
+		case dtz < 0 && -dtz*2+halfMoves < 100:
+			rank = -1000
+		case dtz < 0:
+			rank = -1000 + (-dtz + halfMoves)
+		}
+
+		ret = append(ret, RootMove{Move: m, DTZ: dtz, Rank: rank})
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Rank != ret[j].Rank {
+			return ret[i].Rank > ret[j].Rank
+		}
+
+		return ret[i].Rank > 0 && ret[i].DTZ < ret[j].DTZ
+	})
+
+	return ret, true
+}
+
+type probeState int
+
+const (
+	probeFail probeState = iota
+	probeOK
+	// probeChangeSTM means a DTZ table only holds the other side to move.
+	probeChangeSTM
+	// probeZeroingBestMove means the best move is a capture or pawn move, so the table's value
+	// for the position can't be trusted.
+	probeZeroingBestMove
+)
+
+// search resolves captures, and pawn moves if checkZeroing is set, before probing the WDL table,
+// since the table holds arbitrary values for positions where such a move is best.
+func (tb *Tablebases) search(pos *position.Position, checkZeroing bool) (WDL, probeState) {
+	best := Loss
+	moves := movegen.GetLegalMoves(pos)
+	count := 0
+
+	for _, m := range moves {
+		if !isCapture(m) && (!checkZeroing || !isPawnMove(m)) {
+			continue
+		}
+
+		count++
+
+		value, state := tb.search(movegen.MakeMove(pos, m, false), false)
+		if state == probeFail {
+			return Draw, probeFail
+		}
+
+		if value = -value; value > best {
+			best = value
+
+			if value >= Win {
+				return value, probeZeroingBestMove
+			}
+		}
+	}
+
+	// If every legal move has been searched, the table isn't needed, and might be wrong: it knows
+	// nothing about en passant, for one.
+	noMoreMoves := count > 0 && count == len(moves)
+
+	value := best
+
+	if !noMoreMoves {
+		stored, state := tb.probeTable(pos, wdlTable, Draw)
+		if state == probeFail {
+			return Draw, probeFail
+		}
+
+		value = WDL(stored)
+	}
+
+	if best >= value {
+		if best > Draw || noMoreMoves {
+			return best, probeZeroingBestMove
+		}
+
+		return best, probeOK
+	}
+
+	return value, probeOK
+}
+
+func (tb *Tablebases) probeDTZ(pos *position.Position) (int, probeState) {
+	wdl, state := tb.search(pos, true)
+	if state == probeFail || wdl == Draw {
+		return 0, state
+	}
+
+	if state == probeZeroingBestMove {
+		return dtzBeforeZeroing(wdl), probeOK
+	}
+
+	dtz, state := tb.probeTable(pos, dtzTable, wdl)
+	if state == probeFail {
+		return 0, probeFail
+	}
+
+	if state != probeChangeSTM {
+		if wdl == BlessedLoss || wdl == CursedWin {
+			dtz += 100
+		}
+
+		return dtz * sign(int(wdl)), probeOK
+	}
+
+	// The table holds the other side to move, so look one move ahead for the move that reaches
+	// the result soonest.
+	best := 0xFFFF
+
+	for _, m := range movegen.GetLegalMoves(pos) {
+		child := movegen.MakeMove(pos, m, false)
+		zeroing := isCapture(m) || isPawnMove(m)
+
+		var dtz int
+
+		if zeroing {
+			// The distance after a zeroing move restarts, so what matters is the result.
+			childWDL, childState := tb.search(child, false)
+			if childState == probeFail {
+				return 0, probeFail
+			}
+
+			dtz = -dtzBeforeZeroing(childWDL)
+		} else {
+			childDTZ, childState := tb.probeDTZ(child)
+			if childState == probeFail {
+				return 0, probeFail
+			}
+
+			dtz = -childDTZ
+		}
+
+		if dtz == 1 && movegen.InCheck(child) && len(movegen.GetLegalMoves(child)) == 0 {
+			best = 1
+		}
+
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+
+		if dtz < best && sign(dtz) == sign(int(wdl)) {
+			best = dtz
+		}
+	}
+
+	// With no legal moves, the side to move is mated.
+	if best == 0xFFFF {
+		return -1, probeOK
+	}
+
+	return best, probeOK
+}
+
+// probeTable looks the position up in a single table. For DTZ tables, wdl must be the result of
+// the position.
+func (tb *Tablebases) probeTable(pos *position.Position, typ tableType, wdl WDL) (int, probeState) {
+	if pieceCount(pos) == 2 {
+		return int(Draw), probeOK
+	}
+
+	signature := endgame.Signature(pos)
+
+	t, ok := tb.tables[typ][signature]
+	if !ok || t.load() != nil {
+		return 0, probeFail
+	}
+
+	d, stm, file, idx := t.index(pos, signature)
+
+	// DTZ tables only store one side to move.
+	if typ == dtzTable && int(d.flags&flagSTM) != stm && (!t.symmetric || t.hasPawns) {
+		return 0, probeChangeSTM
+	}
+
+	value, err := t.decompress(d, idx)
+	if err != nil {
+		return 0, probeFail
+	}
+
+	if typ == wdlTable {
+		return value - 2, probeOK
+	}
+
+	dtz, err := t.mapDTZ(file, value, wdl)
+	if err != nil {
+		return 0, probeFail
+	}
+
+	return dtz, probeOK
+}
+
+// index finds the part of the table that holds a position, given its material signature, along
+// with the side to move and file of the leading pawn that the part is for and the position's
+// index within it.
+func (t *table) index(pos *position.Position, signature string) (*pairsData, int, int, uint64) {
+	// Tables are stored with the stronger side as white, and symmetric tables only with white to
+	// move, so anything else is probed with the colours swapped and the board flipped.
+	flip := signature != t.name || (t.symmetric && !pos.WhiteToMove)
+
+	flipColour, flipSquares := 0, 0
+	if flip {
+		flipColour, flipSquares = 8, 56
+	}
+
+	stm := 0
+	if pos.WhiteToMove == flip {
+		stm = 1
+	}
+
+	squares := make([]int, 0, maxPieces)
+	pieces := make([]int, 0, maxPieces)
+
+	for p := piece.Wp; p <= piece.Bk; p++ {
+		occupancy := pos.Occupancy[p]
+
+		for occupancy != 0 {
+			square := bb.LSBIndex(occupancy)
+			occupancy = bb.ClearBit(occupancy, square)
+
+			squares = append(squares, int(square)^56^flipSquares)
+			pieces = append(pieces, tbPiece(p)^flipColour)
+		}
+	}
+
+	d, file, idx := t.locate(squares, pieces, stm)
+
+	return d, stm, file, idx
+}
+
+// locate finds the part of the table a placement belongs to and its index there. squares are
+// numbered from a1 and pieces use the table's codes, both already flipped for the table if
+// necessary. Both slices are reordered.
+func (t *table) locate(squares, pieces []int, stm int) (*pairsData, int, uint64) {
+	leadPawns, file := 0, 0
+
+	if t.hasPawns {
+		// The leading pawns come first. Of those, the one most towards the edge of the board, and
+		// then towards its own side, comes first of all and picks the part of the table to use.
+		lead := t.get(0, 0).pieces[0]
+
+		for i := range pieces {
+			if pieces[i] == lead {
+				pieces[i], pieces[leadPawns] = pieces[leadPawns], pieces[i]
+				squares[i], squares[leadPawns] = squares[leadPawns], squares[i]
+				leadPawns++
+			}
+		}
+
+		for i := 1; i < leadPawns; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[0]] {
+				squares[0], squares[i] = squares[i], squares[0]
+			}
+		}
+
+		file = squares[0] % 8
+		if file > 3 {
+			file = 7 - file
+		}
+	}
+
+	d := t.get(stm, file)
+
+	return d, file, encode(t, d, squares, pieces, leadPawns)
+}
+
+// dtzBeforeZeroing is the distance to zeroing of a position whose best move zeroes the counter.
+func dtzBeforeZeroing(wdl WDL) int {
+	switch wdl {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// tbPiece converts a piece to the code used in the table files.
+func tbPiece(p piece.Piece) int {
+	if p >= piece.Bp {
+		return int(p-piece.Bp) + tbPawn + 8
+	}
+
+	return int(p-piece.Wp) + tbPawn
+}
+
+func isCapture(m move.Move) bool {
+	return m.IsCapture() || m.IsEnPassant()
+}
+
+func isPawnMove(m move.Move) bool {
+	return m.Piece() == piece.Wp || m.Piece() == piece.Bp
+}
+
+func pieceCount(pos *position.Position) int {
+	return bb.CountBits(pos.Occupancy[piece.Wa] | pos.Occupancy[piece.Ba])
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,284 @@
+package syzygy
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIndexTables(t *testing.T) {
+	t.Parallel()
+
+	highest := 0
+
+	for idx := range mapKK {
+		for _, code := range mapKK[idx] {
+			highest = max(highest, code)
+		}
+	}
+
+	if highest != 461 {
+		t.Errorf("highest king pair code is %d, want 461", highest)
+	}
+
+	if got := mapB1H1H7[55]; got != 27 {
+		t.Errorf("h7 maps to %d, want 27", got)
+	}
+
+	if got := binomial[3][62]; got != 37820 {
+		t.Errorf("62 choose 3 is %d, want 37820", got)
+	}
+
+	if got := mapPawns[8]; got != 47 {
+		t.Errorf("a2 maps to %d, want 47", got)
+	}
+}
+
+// placement is a set of pieces, in the table codes, on squares numbered from a1.
+type placement struct {
+	squares []int
+	pieces  []int
+}
+
+func (p placement) legal() bool {
+	var kings []int
+
+	seen := make(map[int]bool)
+
+	for i, s := range p.squares {
+		if seen[s] {
+			return false
+		}
+
+		seen[s] = true
+
+		switch p.pieces[i] & 7 {
+		case tbPawn:
+			if s < 8 || s >= 56 {
+				return false
+			}
+		case tbKing:
+			kings = append(kings, s)
+		}
+	}
+
+	return distance(kings[0], kings[1]) > 1
+}
+
+func (p placement) transform(fn func(int) int) placement {
+	ret := placement{pieces: append([]int(nil), p.pieces...)}
+
+	for _, s := range p.squares {
+		ret.squares = append(ret.squares, fn(s))
+	}
+
+	return ret
+}
+
+func (p placement) index(tb *table) (uint64, uint64) {
+	squares := append([]int(nil), p.squares...)
+	pieces := append([]int(nil), p.pieces...)
+
+	d, _, idx := tb.locate(squares, pieces, 0)
+
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+
+	return idx, d.groupIdx[n]
+}
+
+// symmetric reports whether the table's encoding can give different indices to a placement and its
+// mirror images. Only the leading group is used to pick the orientation, so this happens when
+// there are several leading pawns, or when the leading pieces all stand on one long diagonal.
+func (p placement) symmetric(tb *table) bool {
+	d := tb.get(0, 0)
+
+	if tb.hasPawns {
+		return d.groupLen[0] > 1
+	}
+
+	onA1H8, onA8H1 := true, true
+
+	for _, s := range p.squares[:d.groupLen[0]] {
+		onA1H8 = onA1H8 && s/8 == s%8
+		onA8H1 = onA8H1 && s/8+s%8 == 7
+	}
+
+	return onA1H8 || onA8H1
+}
+
+// TestEncoding checks that every legal placement has an index inside its table, and that
+// placements which are mirror images of each other share an index where the encoding can tell.
+func TestEncoding(t *testing.T) {
+	t.Parallel()
+
+	const (
+		wp = 1
+		wn = 2
+		wr = 4
+		wq = 5
+		wk = 6
+		bp = 9
+		bn = 10
+		bk = 14
+	)
+
+	tests := []struct {
+		name   string
+		pieces []int
+		order  [2]int
+	}{
+		{"KQvK", []int{wq, wk, bk}, [2]int{0, 0xF}},
+		{"KRRvK", []int{wk, bk, wr, wr}, [2]int{0, 0xF}},
+		{"KRvKN", []int{wr, wk, bn, bk}, [2]int{0, 0xF}},
+		{"KPvK", []int{wp, wk, bk}, [2]int{0, 0xF}},
+		{"KPPvK", []int{wp, wp, wk, bk}, [2]int{0, 0xF}},
+		{"KPvKP", []int{wp, bp, wk, bk}, [2]int{0, 1}},
+		{"KNvKP", []int{bp, wn, wk, bk}, [2]int{0, 0xF}},
+	}
+
+	flips := []func(int) int{
+		func(s int) int { return s ^ 7 },
+		func(s int) int { return s ^ 56 },
+		func(s int) int { return ((s >> 3) | (s << 3)) & 63 },
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tb := newTable(wdlTable, tt.name, "")
+
+			for file := range 4 {
+				d := tb.get(0, file)
+				copy(d.pieces[:], tt.pieces)
+				tb.setGroups(d, tt.order, file)
+			}
+
+			rng := rand.New(rand.NewSource(1))
+
+			for range 20000 {
+				p := placement{pieces: tt.pieces}
+				for range tt.pieces {
+					p.squares = append(p.squares, rng.Intn(64))
+				}
+
+				if !p.legal() {
+					continue
+				}
+
+				idx, size := p.index(tb)
+				if idx >= size {
+					t.Fatalf("placement %v has index %d in a table of size %d", p.squares, idx, size)
+				}
+
+				if p.symmetric(tb) {
+					continue
+				}
+
+				for i, flip := range flips {
+					// Tables with pawns can only be mirrored left to right.
+					if tb.hasPawns && i > 0 {
+						break
+					}
+
+					mirrored := p.transform(flip)
+					if got, _ := mirrored.index(tb); got != idx {
+						t.Fatalf("placement %v has index %d, but its mirror image %v has index %d",
+							p.squares, idx, mirrored.squares, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCompressRoundTrip compresses values with plenty of repeated runs, so that they are paired
+// up, and checks that every one of them decompresses to what went in.
+func TestCompressRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(1))
+	phrases := [][]int{{0}, {1, 1, 1, 1}, {2, 0, 2}, {3, 1}, {4, 4, 0, 1, 2}}
+
+	var values []int
+
+	for len(values) < 200000 {
+		phrase := phrases[rng.Intn(len(phrases))]
+		for range rng.Intn(20) + 1 {
+			values = append(values, phrase...)
+		}
+
+		// Indices with no value take the one before them.
+		if rng.Intn(10) == 0 {
+			values = append(values, -1, -1)
+		}
+	}
+
+	p, err := compress(values, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &table{buf: slices.Concat(p.sizes, p.sparseIndex, p.blockLengths)}
+	tb.buf = append(pad(tb.buf, 64), p.blocks...)
+
+	d := &pairsData{}
+	d.groupLen[0] = 1
+	d.groupIdx[1] = uint64(len(values))
+
+	if d.sparseIndex, err = tb.setSizes(d, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	d.blockLength = d.sparseIndex + d.sparseIndexSize*6
+	d.data = (d.blockLength + d.blockLengthSize*2 + 0x3F) &^ 0x3F
+
+	if !slices.ContainsFunc(d.symLen, func(n int) bool { return n > 0 }) {
+		t.Fatal("no pairs were made")
+	}
+
+	want := 0
+
+	for idx, v := range values {
+		if v >= 0 {
+			want = v
+		}
+
+		got, err := tb.decompress(d, uint64(idx))
+		if err != nil {
+			t.Fatalf("index %d: %v", idx, err)
+		}
+
+		if got != want {
+			t.Fatalf("index %d decompressed to %d, want %d", idx, got, want)
+		}
+	}
+}
+
+// TestTestdataHasPairs checks that the checked in tables are compressed with pairs, so that the
+// probing tests go through the code which expands them.
+func TestTestdataHasPairs(t *testing.T) {
+	t.Parallel()
+
+	for typ, file := range []string{"KQvKR.rtbw", "KQvKR.rtbz"} {
+		tb := newTable(tableType(typ), "KQvKR", filepath.Join("testdata", file))
+
+		if err := tb.load(); err != nil {
+			t.Fatal(err)
+		}
+
+		paired := false
+
+		for stm := range tb.items {
+			paired = paired || slices.ContainsFunc(tb.items[stm][0].symLen, func(n int) bool { return n > 0 })
+		}
+
+		if !paired {
+			t.Errorf("%s has no pairs", tb.path)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package syzygy_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/dtm"
+	"github.com/samwestmoreland/chessengine/internal/endgame"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+	"github.com/samwestmoreland/chessengine/internal/syzygy"
+)
+
+func TestMain(m *testing.M) {
+	if err := movegen.Initialise(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// openTestdata opens the tables in testdata, failing the test unless the given tables are there.
+func openTestdata(t *testing.T, names ...string) *syzygy.Tablebases {
+	t.Helper()
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join("testdata", name)); err != nil {
+			t.Fatalf("%s not found in testdata: %v", name, err)
+		}
+	}
+
+	tb, err := syzygy.Open("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tb
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz", "KRPvKR.rtbw", "notes.txt", "KXvK.rtbw"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tb, err := syzygy.Open(dir + string(os.PathListSeparator) + t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tb.MaxPieces(); got != 5 {
+		t.Errorf("max pieces %d, want 5", got)
+	}
+
+	// The files are empty, so probing them fails rather than panicking.
+	pos, err := position.NewPositionFromFEN("4k3/8/8/8/8/8/8/4K2Q w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tb.ProbeWDL(pos); ok {
+		t.Error("probing an empty file succeeded")
+	}
+
+	if _, err := syzygy.Open(filepath.Join(dir, "missing")); err == nil {
+		t.Error("opening a missing directory succeeded")
+	}
+}
+
+func TestProbeWDL(t *testing.T) {
+	t.Parallel()
+
+	tb := openTestdata(t, "KQvK.rtbw", "KPvK.rtbw", "KRvK.rtbw")
+
+	tests := []struct {
+		fen  string
+		want syzygy.WDL
+	}{
+		{"4k3/8/8/8/8/8/8/4K2Q w - - 0 1", syzygy.Win},
+		{"4k3/8/8/8/8/8/8/4K2Q b - - 0 1", syzygy.Loss},
+		{"4k3/8/8/8/8/8/8/4K2q w - - 0 1", syzygy.Loss},
+		{"8/8/8/8/8/8/1k6/Kq6 w - - 0 1", syzygy.Draw}, // the king takes the queen
+		{"8/8/8/8/8/4k3/4P3/4K3 w - - 0 1", syzygy.Draw},
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", syzygy.Win},
+		{"8/8/8/8/8/4k3/4p3/6K1 w - - 0 1", syzygy.Loss}, // black's pawn queens
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", syzygy.Draw},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := tb.ProbeWDL(pos)
+		if !ok {
+			t.Errorf("%s: probe failed", tt.fen)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.fen, got, tt.want)
+		}
+	}
+}
+
+// TestKPKAgreesWithBitbase compares the KPvK table with the bitbase the evaluator generates itself.
+func TestKPKAgreesWithBitbase(t *testing.T) {
+	t.Parallel()
+
+	tb := openTestdata(t, "KPvK.rtbw")
+
+	rng := rand.New(rand.NewSource(1))
+
+	for range 2000 {
+		whiteKing := sq.Square(byte(rng.Intn(64)))
+		blackKing := sq.Square(byte(rng.Intn(64)))
+		pawn := sq.Square(byte(8 + rng.Intn(48)))
+		whiteToMove := rng.Intn(2) == 0
+
+		pos := kpk(whiteKing, pawn, blackKing, whiteToMove)
+		if pos == nil {
+			continue
+		}
+
+		wdl, ok := tb.ProbeWDL(pos)
+		if !ok {
+			t.Fatalf("probe failed for %v %v %v", whiteKing, pawn, blackKing)
+		}
+
+		// The table scores the side to move, so a win for white is a loss for black.
+		whiteWins := wdl == syzygy.Win
+		if !whiteToMove {
+			whiteWins = wdl == syzygy.Loss
+		}
+
+		want := endgame.ProbeKPK(whiteToMove, whiteKing, pawn, blackKing)
+		if whiteWins != want {
+			t.Errorf("K%v P%v k%v white to move %v: tablebase %v, bitbase win %v",
+				whiteKing, pawn, blackKing, whiteToMove, wdl, want)
+		}
+	}
+}
+
+// kpk builds a KPvK position, or returns nil if it would be illegal.
+func kpk(whiteKing, pawn, blackKing sq.Square, whiteToMove bool) *position.Position {
+	if whiteKing == blackKing || whiteKing == pawn || blackKing == pawn {
+		return nil
+	}
+
+	side := "w"
+	if !whiteToMove {
+		side = "b"
+	}
+
+	board := []rune(strings.Repeat(".", 64))
+	board[whiteKing] = 'K'
+	board[blackKing] = 'k'
+	board[pawn] = 'P'
+
+	var fen strings.Builder
+
+	for row := range 8 {
+		empty := 0
+
+		for _, c := range board[row*8 : row*8+8] {
+			if c == '.' {
+				empty++
+
+				continue
+			}
+
+			if empty > 0 {
+				fen.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+
+			fen.WriteRune(c)
+		}
+
+		if empty > 0 {
+			fen.WriteByte(byte('0' + empty))
+		}
+
+		if row < 7 {
+			fen.WriteByte('/')
+		}
+	}
+
+	pos, err := position.NewPositionFromFEN(fen.String() + " " + side + " - - 0 1")
+	if err != nil {
+		return nil
+	}
+
+	// The side not to move can't be in check.
+	mover := pos.Copy()
+	mover.WhiteToMove = !mover.WhiteToMove
+
+	if movegen.InCheck(mover) {
+		return nil
+	}
+
+	return pos
+}
+
+func TestRankRootMoves(t *testing.T) {
+	t.Parallel()
+
+	tb := openTestdata(t, "KQvK.rtbw", "KQvK.rtbz")
+
+	// Qg8 and Qa7 are both mate.
+	pos, err := position.NewPositionFromFEN("k7/8/1K6/8/8/8/8/6Q1 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moves, ok := tb.RankRootMoves(pos)
+	if !ok {
+		t.Fatal("probe failed")
+	}
+
+	if got := moves[0].Move.String(); (got != "g1g8" && got != "g1a7") || moves[0].DTZ != 1 || moves[0].Rank != 1000 {
+		t.Errorf("best move %s with DTZ %d and rank %d, want a mate with DTZ 1 and rank 1000",
+			got, moves[0].DTZ, moves[0].Rank)
+	}
+
+	dtz, ok := tb.ProbeDTZ(pos)
+	if !ok || dtz != 1 {
+		t.Errorf("DTZ %d (ok %v), want 1", dtz, ok)
+	}
+}
+
+// TestProbeKQvKR checks the 4-piece table on positions whose results can be worked out by hand.
+func TestProbeKQvKR(t *testing.T) {
+	t.Parallel()
+
+	tb := openTestdata(t, "KQvKR.rtbw", "KQvKR.rtbz", "KQvK.rtbw", "KRvK.rtbw")
+
+	tests := []struct {
+		name string
+		fen  string
+		wdl  syzygy.WDL
+		dtz  int
+	}{
+		{"queen takes the rook", "4k3/8/8/8/8/8/r7/Q3K3 w - - 0 1", syzygy.Win, 1},
+		{"rook takes the queen", "4k3/8/8/8/8/8/r7/Q3K3 b - - 0 1", syzygy.Win, 1},
+		{"rook takes the queen and is taken back", "k1r5/8/8/8/8/2Q5/1K6/8 b - - 0 1", syzygy.Draw, 0},
+		{"mate in one", "7k/8/5K2/8/8/8/6Q1/r7 w - - 0 1", syzygy.Win, 1},
+		{"mate in one along the back rank", "3k4/2r5/3K4/7Q/8/8/8/8 w - - 0 1", syzygy.Win, 1},
+	}
+
+	for _, tt := range tests {
+		pos, err := position.NewPositionFromFEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wdl, ok := tb.ProbeWDL(pos)
+		if !ok || wdl != tt.wdl {
+			t.Errorf("%s: WDL %v (ok %v), want %v", tt.name, wdl, ok, tt.wdl)
+		}
+
+		dtz, ok := tb.ProbeDTZ(pos)
+		if !ok || dtz != tt.dtz {
+			t.Errorf("%s: DTZ %d (ok %v), want %d", tt.name, dtz, ok, tt.dtz)
+		}
+	}
+
+	// With black to move, the mate can't be stopped for good, and the rook is eventually lost.
+	pos, err := position.NewPositionFromFEN("7k/8/5K2/8/8/8/6Q1/r7 b - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wdl, ok := tb.ProbeWDL(pos); !ok || wdl != syzygy.Loss {
+		t.Errorf("black to move: WDL %v (ok %v), want a loss", wdl, ok)
+	}
+
+	if dtz, ok := tb.ProbeDTZ(pos); !ok || dtz >= 0 {
+		t.Errorf("black to move: DTZ %d (ok %v), want a loss", dtz, ok)
+	}
+}
+
+// TestWrite checks that writing KPvK from the engine's own distance-to-mate tables reproduces the
+// files in testdata.
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	gen := dtm.NewGenerator()
+
+	if _, err := gen.Generate("KPvK"); err != nil {
+		t.Fatal(err)
+	}
+
+	result := func(pos *position.Position) (syzygy.WDL, error) {
+		if bb.CountBits(pos.Occupancy[piece.Wa]|pos.Occupancy[piece.Ba]) == 2 {
+			return syzygy.Draw, nil
+		}
+
+		table, err := gen.Generate(endgame.Signature(pos))
+		if err != nil {
+			return syzygy.Draw, err
+		}
+
+		r, _ := table.Probe(pos)
+
+		return syzygy.WDL(2 * r.Outcome), nil
+	}
+
+	for name, write := range map[string]func(io.Writer, string, syzygy.ResultFunc) error{
+		"KPvK.rtbw": syzygy.WriteWDL,
+		"KPvK.rtbz": syzygy.WriteDTZ,
+	} {
+		var buf bytes.Buffer
+
+		if err := write(&buf, "KPvK", result); err != nil {
+			t.Fatal(err)
+		}
+
+		want, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: wrote %d bytes that differ from the %d in testdata", name, buf.Len(), len(want))
+		}
+	}
+}
+
+// TestTruncated checks that probing tables cut short fails rather than reading past their end.
+func TestTruncated(t *testing.T) {
+	t.Parallel()
+
+	pos, err := position.NewPositionFromFEN("4k3/8/8/8/8/8/8/4K2Q w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for size := 0; size < len(data); size += 1 + size/16 {
+			dir := t.TempDir()
+
+			if err := os.WriteFile(filepath.Join(dir, name), data[:size], 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			// A WDL table is always needed, so the DTZ table is only probed with a good one.
+			if name != "KQvK.rtbw" {
+				if err := os.Link(filepath.Join("testdata", "KQvK.rtbw"), filepath.Join(dir, "KQvK.rtbw")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tb, err := syzygy.Open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, ok := tb.ProbeDTZ(pos)
+			if name == "KQvK.rtbw" {
+				_, ok = tb.ProbeWDL(pos)
+			}
+
+			if ok {
+				t.Errorf("%s cut to %d bytes probed successfully", name, size)
+			}
+		}
+	}
+}
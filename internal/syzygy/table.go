@@ -0,0 +1,706 @@
+package syzygy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type tableType int
+
+const (
+	wdlTable tableType = iota
+	dtzTable
+)
+
+var magics = [2][4]byte{
+	wdlTable: {0x71, 0xE8, 0x23, 0x5D},
+	dtzTable: {0xD7, 0x66, 0x0C, 0xA5},
+}
+
+// Flags stored with each table. All but singleValue only apply to DTZ tables.
+const (
+	flagSTM         = 1
+	flagMapped      = 2
+	flagWinPlies    = 4
+	flagLossPlies   = 8
+	flagWide        = 16
+	flagSingleValue = 128
+)
+
+var errCorrupt = errors.New("corrupt tablebase file")
+
+// pairsData is the information needed to decompress one part of a table. Tables are split by side
+// to move, for WDL tables, and by the file of the leading pawn, for tables with pawns. Offsets
+// are into the table's data.
+type pairsData struct {
+	flags     uint8
+	minSymLen int
+	maxSymLen int
+	numBlocks int
+	blockSize int
+	span      int
+
+	lowestSym       int // offset of the lowest symbol of each length
+	btree           int // offset of the pair each symbol expands to
+	blockLength     int // offset of the number of values in each block, minus one
+	blockLengthSize int
+	sparseIndex     int // offset of the entries pointing into blockLength
+	sparseIndexSize int
+	data            int // offset of the compressed blocks
+
+	// base64[l] is the lowest symbol of length minSymLen+l, padded to 64 bits.
+	base64 []uint64
+	// symLen[s] is the number of values, minus one, that symbol s expands to.
+	symLen []int
+
+	// pieces is the order pieces are encoded in, which defines the groups. groupLen is the number
+	// of pieces in each group, terminated by a zero, and groupIdx is the factor each group's index
+	// is multiplied by; the entry after the last group is the size of the table.
+	pieces   [maxPieces]int
+	groupLen [maxPieces + 1]int
+	groupIdx [maxPieces + 1]uint64
+
+	// mapIdx locates the value maps of a DTZ table for wins, losses, cursed wins and blessed
+	// losses, and mapLen is the number of values in each.
+	mapIdx [4]int
+	mapLen [4]int
+}
+
+// table is a single WDL or DTZ file. Its header is read the first time it is probed.
+type table struct {
+	typ  tableType
+	name string
+	path string
+
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	// symmetric is set when both sides have the same material, in which case only white to move is
+	// stored.
+	symmetric bool
+	// pawnCount is the number of pawns of the leading side and of the other side. The leading side
+	// is the one with fewer pawns, as long as it has any.
+	pawnCount [2]int
+
+	once  sync.Once
+	err   error
+	buf   []byte
+	items [2][4]pairsData
+	// dtzMap is the offset of the value maps of a DTZ table.
+	dtzMap int
+}
+
+func newTable(typ tableType, name, path string) *table {
+	ret := &table{typ: typ, name: name, path: path}
+
+	white, black, _ := strings.Cut(name, "v")
+	ret.pieceCount = len(white) + len(black)
+	ret.symmetric = white == black
+
+	for _, side := range []string{white, black} {
+		for _, c := range "QRBNP" {
+			if strings.Count(side, string(c)) == 1 {
+				ret.hasUniquePieces = true
+			}
+		}
+	}
+
+	whitePawns, blackPawns := strings.Count(white, "P"), strings.Count(black, "P")
+	ret.hasPawns = whitePawns+blackPawns > 0
+
+	if blackPawns == 0 || (whitePawns > 0 && blackPawns >= whitePawns) {
+		ret.pawnCount = [2]int{whitePawns, blackPawns}
+	} else {
+		ret.pawnCount = [2]int{blackPawns, whitePawns}
+	}
+
+	return ret
+}
+
+func (t *table) get(stm, file int) *pairsData {
+	if t.typ == dtzTable {
+		stm = 0
+	}
+
+	if !t.hasPawns {
+		file = 0
+	}
+
+	return &t.items[stm][file]
+}
+
+// load reads and parses the file the first time it is called, and returns any error on every call.
+func (t *table) load() error {
+	t.once.Do(func() {
+		buf, err := os.ReadFile(t.path)
+		if err != nil {
+			t.err = fmt.Errorf("failed to read tablebase: %w", err)
+
+			return
+		}
+
+		if len(buf) < 5 || !bytes.Equal(buf[:4], magics[t.typ][:]) {
+			t.err = fmt.Errorf("%s: %w: bad magic", t.path, errCorrupt)
+
+			return
+		}
+
+		t.buf = buf
+
+		if err := t.parse(); err != nil {
+			t.err = fmt.Errorf("%s: %w", t.path, err)
+		}
+	})
+
+	return t.err
+}
+
+// parse reads the table header, working out where every part of the table lives. Every offset is
+// checked against the size of the file, so that probing never reads outside it.
+func (t *table) parse() error {
+	const hasPawns = 2
+
+	data := 4
+	flags := t.buf[data]
+	data++
+
+	if (flags&hasPawns != 0) != t.hasPawns {
+		return fmt.Errorf("%w: header doesn't match %s", errCorrupt, t.name)
+	}
+
+	sides := 1
+	if t.typ == wdlTable && !t.symmetric {
+		sides = 2
+	}
+
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = 3
+	}
+
+	bothPawns := t.hasPawns && t.pawnCount[1] > 0
+
+	for file := 0; file <= maxFile; file++ {
+		if !t.fits(data, t.pieceCount+2) {
+			return fmt.Errorf("%w: truncated", errCorrupt)
+		}
+
+		order := [2][2]int{{int(t.buf[data] & 0xF), 0xF}, {int(t.buf[data] >> 4), 0xF}}
+		if bothPawns {
+			order[0][1] = int(t.buf[data+1] & 0xF)
+			order[1][1] = int(t.buf[data+1] >> 4)
+			data++
+		}
+
+		data++
+
+		for k := range t.pieceCount {
+			for i := range sides {
+				if i == 0 {
+					t.get(i, file).pieces[k] = int(t.buf[data] & 0xF)
+				} else {
+					t.get(i, file).pieces[k] = int(t.buf[data] >> 4)
+				}
+			}
+
+			data++
+		}
+
+		for i := range sides {
+			if err := t.setGroups(t.get(i, file), order[i], file); err != nil {
+				return err
+			}
+		}
+	}
+
+	data += data & 1
+
+	for file := 0; file <= maxFile; file++ {
+		for i := range sides {
+			var err error
+
+			if data, err = t.setSizes(t.get(i, file), data); err != nil {
+				return err
+			}
+		}
+	}
+
+	if t.typ == dtzTable {
+		var err error
+
+		if data, err = t.setDTZMap(data, maxFile); err != nil {
+			return err
+		}
+	}
+
+	for file := 0; file <= maxFile; file++ {
+		for i := range sides {
+			d := t.get(i, file)
+			d.sparseIndex = data
+			data += d.sparseIndexSize * 6
+		}
+	}
+
+	for file := 0; file <= maxFile; file++ {
+		for i := range sides {
+			d := t.get(i, file)
+			d.blockLength = data
+			data += d.blockLengthSize * 2
+		}
+	}
+
+	for file := 0; file <= maxFile; file++ {
+		for i := range sides {
+			data = (data + 0x3F) &^ 0x3F
+
+			d := t.get(i, file)
+			d.data = data
+			data += d.numBlocks * d.blockSize
+		}
+	}
+
+	if data > len(t.buf) {
+		return fmt.Errorf("%w: truncated", errCorrupt)
+	}
+
+	return nil
+}
+
+// setGroups splits the pieces into the groups they are encoded in and works out the factor for
+// each group. Pieces of the same type and colour form a group, except for the leading group, which
+// holds the leading pawns, or three unique pieces, or the two kings when there aren't enough unique
+// pieces. order gives the position of the leading group and, with pawns on both sides, of the
+// remaining pawns in the encoding; the other groups follow in sequence.
+func (t *table) setGroups(d *pairsData, order [2]int, file int) error {
+	pieces := slices.Clone(d.pieces[:t.pieceCount])
+	slices.Sort(pieces)
+
+	if !slices.Equal(pieces, t.pieceCodes()) {
+		return fmt.Errorf("%w: pieces don't match %s", errCorrupt, t.name)
+	}
+
+	firstLen := 2
+
+	switch {
+	case t.hasPawns:
+		firstLen = 0
+	case t.hasUniquePieces:
+		firstLen = 3
+	}
+
+	n := 0
+	d.groupLen[0] = 1
+
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+
+	n++
+	d.groupLen[n] = 0
+
+	bothPawns := t.hasPawns && t.pawnCount[1] > 0
+
+	if t.hasPawns && d.pieces[0]&7 != tbPawn {
+		return fmt.Errorf("%w: %s doesn't start with a pawn", errCorrupt, t.name)
+	}
+
+	if order[0] >= n || (bothPawns && order[1] >= n) || (!bothPawns && order[1] != 0xF) {
+		return fmt.Errorf("%w: bad piece order", errCorrupt)
+	}
+
+	next := 1
+	freeSquares := 64 - d.groupLen[0]
+
+	if bothPawns {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+
+	idx := uint64(1)
+
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch k {
+		case order[0]:
+			d.groupIdx[0] = idx
+
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case order[1]:
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+
+	d.groupIdx[n] = idx
+
+	return nil
+}
+
+// pieceCodes returns the codes of the table's pieces in increasing order.
+func (t *table) pieceCodes() []int {
+	white, black, _ := strings.Cut(t.name, "v")
+
+	var ret []int
+
+	for i, side := range []string{white, black} {
+		for _, c := range side {
+			ret = append(ret, strings.IndexRune("PNBRQK", c)+tbPawn+8*i)
+		}
+	}
+
+	slices.Sort(ret)
+
+	return ret
+}
+
+// setSizes reads the Huffman code and block layout of one part of the table.
+func (t *table) setSizes(d *pairsData, data int) (int, error) {
+	if !t.fits(data, 2) {
+		return 0, fmt.Errorf("%w: truncated", errCorrupt)
+	}
+
+	d.flags = t.buf[data]
+	data++
+
+	if d.flags&flagSingleValue == 0 && !t.fits(data, 9) {
+		return 0, fmt.Errorf("%w: truncated", errCorrupt)
+	}
+
+	if d.flags&flagSingleValue != 0 {
+		// The single value is kept in minSymLen.
+		d.minSymLen = int(t.buf[data])
+
+		return data + 1, nil
+	}
+
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+
+	tbSize := d.groupIdx[n]
+
+	d.blockSize = 1 << t.buf[data]
+	d.span = 1 << t.buf[data+1]
+	d.sparseIndexSize = int((tbSize + uint64(d.span) - 1) / uint64(d.span))
+	padding := int(t.buf[data+2])
+	d.numBlocks = int(binary.LittleEndian.Uint32(t.buf[data+3:]))
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen = int(t.buf[data+7])
+	d.minSymLen = int(t.buf[data+8])
+	data += 9
+
+	// Codes are read 32 bits at a time, so none can be longer than that.
+	if t.buf[data-9] > 30 || t.buf[data-8] > 30 || d.minSymLen == 0 || d.minSymLen > d.maxSymLen ||
+		d.maxSymLen > 32 {
+		return 0, fmt.Errorf("%w: bad block layout or code lengths", errCorrupt)
+	}
+
+	if !t.fits(data, (d.maxSymLen-d.minSymLen+1)*2+2) {
+		return 0, fmt.Errorf("%w: truncated", errCorrupt)
+	}
+
+	d.lowestSym = data
+	d.base64 = make([]uint64, d.maxSymLen-d.minSymLen+1)
+
+	// Longer codes have lower values, so base64 is decreasing. Each entry is derived from the next
+	// one and the lowest symbols of the two lengths.
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(t.lowestSym(d, i)) - uint64(t.lowestSym(d, i+1))) / 2
+	}
+
+	for i := range d.base64 {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+
+	data += len(d.base64) * 2
+
+	numSyms := int(binary.LittleEndian.Uint16(t.buf[data:]))
+	data += 2
+	d.btree = data
+
+	if !t.fits(data, numSyms*3) {
+		return 0, fmt.Errorf("%w: truncated", errCorrupt)
+	}
+
+	// Every symbol a pair expands to must be defined, and so must the lowest symbol of every
+	// length, for decompress to stay within the table.
+	for sym := range numSyms {
+		if right := t.right(d, sym); right != 0xFFF && (right >= numSyms || t.left(d, sym) >= numSyms) {
+			return 0, fmt.Errorf("%w: bad symbol %d", errCorrupt, sym)
+		}
+	}
+
+	for i := range d.base64 {
+		if t.lowestSym(d, i) > numSyms {
+			return 0, fmt.Errorf("%w: bad symbol lengths", errCorrupt)
+		}
+	}
+
+	d.symLen = make([]int, numSyms)
+
+	visited := make([]bool, numSyms)
+
+	for sym := range numSyms {
+		if !visited[sym] {
+			d.symLen[sym] = t.setSymLen(d, sym, visited)
+		}
+	}
+
+	// A pair expands to more values than either of its halves, unless the pairs form a loop, which
+	// would never finish expanding.
+	for sym := range numSyms {
+		if right := t.right(d, sym); right != 0xFFF &&
+			(d.symLen[sym] <= d.symLen[right] || d.symLen[sym] <= d.symLen[t.left(d, sym)]) {
+			return 0, fmt.Errorf("%w: symbol %d expands to itself", errCorrupt, sym)
+		}
+	}
+
+	return data + numSyms*3 + numSyms&1, nil
+}
+
+// setSymLen works out how many values a symbol expands to by following the pairs it is built
+// from. The compression replaces frequent pairs of symbols with new symbols, recursively, so
+// every symbol is either a leaf holding a value or a pair of other symbols.
+func (t *table) setSymLen(d *pairsData, sym int, visited []bool) int {
+	visited[sym] = true
+
+	right := t.right(d, sym)
+	if right == 0xFFF {
+		return 0
+	}
+
+	left := t.left(d, sym)
+
+	if !visited[left] {
+		d.symLen[left] = t.setSymLen(d, left, visited)
+	}
+
+	if !visited[right] {
+		d.symLen[right] = t.setSymLen(d, right, visited)
+	}
+
+	return d.symLen[left] + d.symLen[right] + 1
+}
+
+// setDTZMap records where the value maps of a DTZ table are. DTZ values are stored as their rank
+// in order of frequency, separately for each result, and the maps translate them back.
+func (t *table) setDTZMap(data, maxFile int) (int, error) {
+	t.dtzMap = data
+
+	for file := 0; file <= maxFile; file++ {
+		d := t.get(0, file)
+		if d.flags&flagMapped == 0 {
+			continue
+		}
+
+		if d.flags&flagWide != 0 {
+			data += data & 1
+
+			for i := range 4 {
+				if !t.fits(data, 2) {
+					return 0, fmt.Errorf("%w: truncated", errCorrupt)
+				}
+
+				d.mapIdx[i] = (data-t.dtzMap)/2 + 1
+				d.mapLen[i] = int(binary.LittleEndian.Uint16(t.buf[data:]))
+				data += 2*d.mapLen[i] + 2
+			}
+		} else {
+			for i := range 4 {
+				if !t.fits(data, 1) {
+					return 0, fmt.Errorf("%w: truncated", errCorrupt)
+				}
+
+				d.mapIdx[i] = data - t.dtzMap + 1
+				d.mapLen[i] = int(t.buf[data])
+				data += d.mapLen[i] + 1
+			}
+		}
+	}
+
+	return data + data&1, nil
+}
+
+// fits reports whether n bytes from the given offset are within the file.
+func (t *table) fits(offset, n int) bool {
+	return offset >= 0 && n >= 0 && offset+n <= len(t.buf)
+}
+
+func (t *table) lowestSym(d *pairsData, length int) int {
+	return int(binary.LittleEndian.Uint16(t.buf[d.lowestSym+2*length:]))
+}
+
+// left and right return the two symbols a symbol expands to. Each entry is three bytes holding two
+// 12-bit symbols; for a leaf, left is the value and right is 0xFFF.
+func (t *table) left(d *pairsData, sym int) int {
+	lr := t.buf[d.btree+3*sym:]
+
+	return int(lr[1]&0xF)<<8 | int(lr[0])
+}
+
+func (t *table) right(d *pairsData, sym int) int {
+	lr := t.buf[d.btree+3*sym:]
+
+	return int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// decompress returns the value stored at the given index, which must be within the table. The
+// blocks and symbols found along the way come from the file, so they are checked.
+func (t *table) decompress(d *pairsData, idx uint64) (int, error) {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen, nil
+	}
+
+	// Blocks hold a variable number of values, so the sparse index gives the block and offset of
+	// every span-th value, and blockLength is walked from there.
+	k := idx / uint64(d.span)
+	entry := t.buf[d.sparseIndex+6*int(k):]
+
+	block := int(binary.LittleEndian.Uint32(entry))
+	offset := int(binary.LittleEndian.Uint16(entry[4:]))
+	offset += int(idx%uint64(d.span)) - d.span/2
+
+	if block >= d.numBlocks {
+		return 0, fmt.Errorf("%w: bad sparse index", errCorrupt)
+	}
+
+	blockLength := func(b int) int {
+		return int(binary.LittleEndian.Uint16(t.buf[d.blockLength+2*b:]))
+	}
+
+	for offset < 0 && block > 0 {
+		block--
+		offset += blockLength(block) + 1
+	}
+
+	for block < d.numBlocks && offset > blockLength(block) {
+		offset -= blockLength(block) + 1
+		block++
+	}
+
+	if offset < 0 || block >= d.numBlocks {
+		return 0, fmt.Errorf("%w: bad sparse index", errCorrupt)
+	}
+
+	// Read the block's canonical Huffman codes until reaching the symbol that covers the offset.
+	ptr := d.data + block*d.blockSize
+	buf64 := uint64(t.uint32At(ptr))<<32 | uint64(t.uint32At(ptr+4))
+	ptr += 8
+	bufSize := 64
+
+	var sym int
+
+	for {
+		length := 0
+		for buf64 < d.base64[length] {
+			length++
+		}
+
+		sym = int((buf64-d.base64[length])>>(64-length-d.minSymLen)) + t.lowestSym(d, length)
+		if sym >= len(d.symLen) {
+			return 0, fmt.Errorf("%w: bad symbol %d", errCorrupt, sym)
+		}
+
+		if offset < d.symLen[sym]+1 {
+			break
+		}
+
+		offset -= d.symLen[sym] + 1
+		length += d.minSymLen
+		buf64 <<= length
+		bufSize -= length
+
+		if bufSize <= 32 {
+			bufSize += 32
+			buf64 |= uint64(t.uint32At(ptr)) << (64 - bufSize)
+			ptr += 4
+		}
+	}
+
+	// Expand the symbol's pairs until reaching the leaf holding the value.
+	for d.symLen[sym] != 0 {
+		left := t.left(d, sym)
+
+		if offset < d.symLen[left]+1 {
+			sym = left
+		} else {
+			offset -= d.symLen[left] + 1
+			sym = t.right(d, sym)
+		}
+	}
+
+	return t.left(d, sym), nil
+}
+
+// uint32At reads the big-endian value at the given offset. The Huffman decoder reads ahead of the
+// codes it needs, which can take it past the end of the last block, so bytes beyond the end of the
+// file read as zero.
+func (t *table) uint32At(offset int) uint32 {
+	if t.fits(offset, 4) {
+		return binary.BigEndian.Uint32(t.buf[offset:])
+	}
+
+	var b [4]byte
+
+	if offset < len(t.buf) {
+		copy(b[:], t.buf[offset:])
+	}
+
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// mapDTZ turns a stored DTZ value into a number of plies, given the WDL result of the position.
+func (t *table) mapDTZ(file, value int, wdl WDL) (int, error) {
+	// The maps are ordered win, loss, cursed win, blessed loss.
+	wdlMap := [5]int{1, 3, 0, 2, 0}
+
+	d := t.get(0, file)
+
+	if d.flags&flagMapped != 0 {
+		m := wdlMap[wdl+2]
+		if value >= d.mapLen[m] {
+			return 0, fmt.Errorf("%w: value %d is not in the map", errCorrupt, value)
+		}
+
+		idx := d.mapIdx[m]
+
+		if d.flags&flagWide != 0 {
+			value = int(binary.LittleEndian.Uint16(t.buf[t.dtzMap+2*(idx+value):]))
+		} else {
+			value = int(t.buf[t.dtzMap+idx+value])
+		}
+	}
+
+	// Values are stored in moves unless the table says they are in plies.
+	if (wdl == Win && d.flags&flagWinPlies == 0) || (wdl == Loss && d.flags&flagLossPlies == 0) ||
+		wdl == CursedWin || wdl == BlessedLoss {
+		value *= 2
+	}
+
+	return value + 1, nil
+}
@@ -0,0 +1,896 @@
+package syzygy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	"github.com/samwestmoreland/chessengine/internal/movegen"
+	"github.com/samwestmoreland/chessengine/internal/piece"
+	"github.com/samwestmoreland/chessengine/internal/position"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// The layout of the blocks written: 64 bytes each, with an entry in the sparse index for every
+// 256 values.
+const (
+	writeBlockBits = 6
+	writeSpanBits  = 8
+)
+
+// ResultFunc gives the result of a position with perfect play, from the side to move's point of
+// view.
+type ResultFunc func(pos *position.Position) (WDL, error)
+
+// WriteWDL writes the WDL table of an ending, named as its file is, such as KQvK. The result of
+// every legal position in the ending comes from result.
+//
+// Values are compressed the way the official generator compresses them, by pairing up symbols and
+// Huffman coding the result, though not as well, so the files are larger than the official ones
+// but probe the same.
+func WriteWDL(w io.Writer, name string, result ResultFunc) error {
+	tw, err := newTableWriter(wdlTable, name)
+	if err != nil {
+		return err
+	}
+
+	err = tw.positions(func(pos *position.Position, stm, file int, idx uint64) error {
+		wdl, err := result(pos)
+		if err != nil {
+			return err
+		}
+
+		tw.values[stm][file][idx] = int(wdl) + 2
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.write(w, 0)
+}
+
+// WriteDTZ writes the DTZ table of an ending. The distance to zeroing of every position is worked
+// out from the results given by result, which must cover the endings that captures and promotions
+// lead to as well as the ending itself. Only positions with white to move are stored, with
+// distances counted exactly in plies.
+//
+// The fifty-move rule isn't taken into account, so no win is ever cursed and no loss blessed.
+func WriteDTZ(w io.Writer, name string, result ResultFunc) error {
+	tw, err := newTableWriter(dtzTable, name)
+	if err != nil {
+		return err
+	}
+
+	dtz, err := tw.solveDTZ(result)
+	if err != nil {
+		return err
+	}
+
+	for file, values := range dtz[0] {
+		for idx, value := range values {
+			if value != 0 {
+				tw.values[0][file][idx] = abs(int(value)) - 1
+			}
+		}
+	}
+
+	return tw.write(w, flagWinPlies|flagLossPlies)
+}
+
+// tableWriter collects the value of every index of a table before it's compressed and written.
+type tableWriter struct {
+	t       *table
+	sides   int
+	maxFile int
+	order   [2]int
+	// values holds the value of each index, by side to move and file of the leading pawn, or -1
+	// if no legal position has that index.
+	values [2][4][]int
+}
+
+func newTableWriter(typ tableType, name string) (*tableWriter, error) {
+	if !tableName.MatchString(name) || len(name)-1 > maxPieces {
+		return nil, fmt.Errorf("invalid table name %q", name)
+	}
+
+	t := newTable(typ, name, "")
+	tw := &tableWriter{t: t, sides: 1, order: [2]int{0, 0xF}}
+
+	if typ == wdlTable && !t.symmetric {
+		tw.sides = 2
+	}
+
+	if t.hasPawns {
+		tw.maxFile = 3
+
+		if t.pawnCount[1] > 0 {
+			tw.order[1] = 1
+		}
+	}
+
+	pieces := tw.pieceOrder()
+
+	for stm := range tw.sides {
+		for file := 0; file <= tw.maxFile; file++ {
+			d := t.get(stm, file)
+			copy(d.pieces[:], pieces)
+
+			if err := t.setGroups(d, tw.order, file); err != nil {
+				return nil, err
+			}
+
+			tw.values[stm][file] = make([]int, tableSize(d))
+
+			for i := range tw.values[stm][file] {
+				tw.values[stm][file][i] = -1
+			}
+		}
+	}
+
+	return tw, nil
+}
+
+// pieceOrder returns the order the pieces are encoded in. With pawns, the leading pawns come first,
+// then the other side's pawns. Without, the kings come first, followed by a unique piece if there
+// is one, so that the leading group is either the two kings or three unique pieces.
+func (tw *tableWriter) pieceOrder() []int {
+	t := tw.t
+	codes := t.pieceCodes()
+
+	count := func(code int) int {
+		n := 0
+
+		for _, c := range codes {
+			if c == code {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	rank := func(code int) int {
+		switch {
+		case !t.hasPawns && code&7 == tbKing:
+			return 0
+		case !t.hasPawns && count(code) == 1:
+			return 1
+		case t.hasPawns && code&7 == tbPawn && count(code) == t.pawnCount[0]:
+			// With the same number of pawns on both sides, white's lead.
+			if count(code^8) == count(code) && code&8 != 0 {
+				return 1
+			}
+
+			return 0
+		case t.hasPawns && code&7 == tbPawn:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.SliceStable(codes, func(i, j int) bool {
+		if rank(codes[i]) != rank(codes[j]) {
+			return rank(codes[i]) < rank(codes[j])
+		}
+
+		return codes[i] < codes[j]
+	})
+
+	return codes
+}
+
+// tableSize returns the number of indices in a part of a table.
+func tableSize(d *pairsData) uint64 {
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+
+	return d.groupIdx[n]
+}
+
+// positions calls fn with every legal position of the ending, with either side to move, along with
+// where it's stored in the table. Positions that are the same once mirrored are found more than
+// once.
+func (tw *tableWriter) positions(fn func(pos *position.Position, stm, file int, idx uint64) error) error {
+	t := tw.t
+	codes := t.pieceCodes()
+	squares := make([]int, len(codes))
+
+	var place func(i int, occupied bb.Bitboard) error
+
+	place = func(i int, occupied bb.Bitboard) error {
+		if i == len(codes) {
+			for _, whiteToMove := range []bool{true, false} {
+				pos := tw.position(codes, squares, whiteToMove)
+				if pos == nil {
+					continue
+				}
+
+				_, stm, file, idx := t.index(pos, t.name)
+
+				if err := fn(pos, stm, file, idx); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		for s := range 64 {
+			if occupied&(1<<s) != 0 || (codes[i]&7 == tbPawn && (s < 8 || s >= 56)) {
+				continue
+			}
+
+			squares[i] = s
+
+			if err := place(i+1, occupied|1<<s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return place(0, 0)
+}
+
+// position builds the position with pieces of the given codes on the given squares, numbered from
+// a1 as in the tables, or returns nil if the side not to move would be in check.
+func (tw *tableWriter) position(codes, squares []int, whiteToMove bool) *position.Position {
+	pos := &position.Position{
+		WhiteToMove:     whiteToMove,
+		EnPassantSquare: sq.NoSquare,
+		FullMoveNumber:  1,
+	}
+
+	for i, code := range codes {
+		p := piece.Piece(code&7-tbPawn) + piece.Wp
+		if code&8 != 0 {
+			p += piece.Bp - piece.Wp
+		}
+
+		pos.PlacePiece(sq.Square(byte(squares[i]^56)), p)
+	}
+
+	king := pos.Occupancy[piece.Bk]
+	if !whiteToMove {
+		king = pos.Occupancy[piece.Wk]
+	}
+
+	if movegen.SquareAttacked(pos, bb.LSBIndex(king), whiteToMove) {
+		return nil
+	}
+
+	return pos
+}
+
+// dtzEntry is a won or lost position whose distance to zeroing hasn't been found yet.
+type dtzEntry struct {
+	pos  *position.Position
+	slot dtzSlot
+	// children are where the positions reached by moves that don't zero the counter are stored,
+	// counting only losses for the opponent if the position is a win. They're found the first time
+	// the position is looked at, along with whether it has a move that zeroes the counter.
+	children []dtzSlot
+	zeroing  bool
+}
+
+// dtzSlot is where a position is stored while the DTZ table is solved.
+type dtzSlot struct {
+	stm, file int
+	idx       uint64
+}
+
+// dtzSolver holds the results and distances to zeroing of the positions in an ending, by side to
+// move, file of the leading pawn and index. Draws and unused indices have a distance of 0.
+type dtzSolver struct {
+	tw     *tableWriter
+	result ResultFunc
+	wdl    [2][4][]WDL
+	dtz    [2][4][]int16
+}
+
+// solveDTZ works out the distance to zeroing of every position in the ending, as ProbeDTZ returns
+// it.
+//
+// Distances are found in increasing order, one ply at a time. A win is decided at n plies once one
+// of its moves reaches a loss decided at n-1, and a loss once all of its moves that don't zero the
+// counter reach decided wins.
+func (tw *tableWriter) solveDTZ(result ResultFunc) ([2][4][]int16, error) {
+	s := &dtzSolver{tw: tw, result: result}
+
+	for stm := range 2 {
+		for file := 0; file <= tw.maxFile; file++ {
+			size := len(tw.values[0][file])
+			s.dtz[stm][file] = make([]int16, size)
+			s.wdl[stm][file] = make([]WDL, size)
+		}
+	}
+
+	var (
+		pending []dtzEntry
+		seen    [2][4][]bool
+	)
+
+	for stm := range 2 {
+		for file := 0; file <= tw.maxFile; file++ {
+			seen[stm][file] = make([]bool, len(s.dtz[stm][file]))
+		}
+	}
+
+	err := tw.positions(func(pos *position.Position, stm, file int, idx uint64) error {
+		// Positions that are the same once mirrored share an index, and only need solving once.
+		if seen[stm][file][idx] {
+			return nil
+		}
+
+		seen[stm][file][idx] = true
+
+		value, err := result(pos)
+		if err != nil {
+			return err
+		}
+
+		s.wdl[stm][file][idx] = value
+
+		if value != Draw {
+			pending = append(pending, dtzEntry{pos: pos, slot: dtzSlot{stm, file, idx}})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return s.dtz, err
+	}
+
+	type update struct {
+		slot  dtzSlot
+		value int16
+	}
+
+	for first := true; len(pending) > 0; first = false {
+		var (
+			updates []update
+			next    []dtzEntry
+		)
+
+		for i := range pending {
+			e := &pending[i]
+
+			if first {
+				value, err := s.prepare(e)
+				if err != nil {
+					return s.dtz, err
+				}
+
+				if value != 0 {
+					updates = append(updates, update{e.slot, value})
+
+					continue
+				}
+			} else if value := s.decide(e); value != 0 {
+				updates = append(updates, update{e.slot, value})
+
+				continue
+			}
+
+			next = append(next, *e)
+		}
+
+		if len(updates) == 0 {
+			return s.dtz, fmt.Errorf("%s: %d positions can't reach their result", tw.t.name, len(pending))
+		}
+
+		for _, u := range updates {
+			s.dtz[u.slot.stm][u.slot.file][u.slot.idx] = u.value
+		}
+
+		pending = next
+	}
+
+	return s.dtz, nil
+}
+
+// prepare finds the moves of a position, and returns its distance to zeroing if that is 1 or -1:
+// a win with a zeroing move or mate, or a loss with no moves that don't zero the counter.
+func (s *dtzSolver) prepare(e *dtzEntry) (int16, error) {
+	win := s.wdlAt(e.slot) > Draw
+
+	for _, m := range movegen.GetLegalMoves(e.pos) {
+		child := movegen.MakeMove(e.pos, m, false)
+
+		if isCapture(m) || isPawnMove(m) {
+			value, err := s.result(child)
+			if err != nil {
+				return 0, err
+			}
+
+			if win && value < Draw {
+				return 1, nil
+			}
+
+			e.zeroing = true
+
+			continue
+		}
+
+		_, stm, file, idx := s.tw.t.index(child, s.tw.t.name)
+		slot := dtzSlot{stm, file, idx}
+
+		if win && s.wdlAt(slot) >= Draw {
+			continue
+		}
+
+		if win && movegen.InCheck(child) && len(movegen.GetLegalMoves(child)) == 0 {
+			return 1, nil
+		}
+
+		e.children = append(e.children, slot)
+	}
+
+	if !win && len(e.children) == 0 {
+		return -1, nil
+	}
+
+	return 0, nil
+}
+
+// decide returns the distance to zeroing of a position if it can be decided from the positions
+// decided so far, or 0 if it can't be yet.
+func (s *dtzSolver) decide(e *dtzEntry) int16 {
+	if s.wdlAt(e.slot) > Draw {
+		// The first loss found is the quickest, as they're decided in order.
+		for _, c := range e.children {
+			if dtz := s.dtzAt(c); dtz != 0 {
+				return -dtz + 1
+			}
+		}
+
+		return 0
+	}
+
+	var longest int16
+
+	if e.zeroing {
+		longest = 1
+	}
+
+	for _, c := range e.children {
+		dtz := s.dtzAt(c)
+		if dtz == 0 {
+			return 0
+		}
+
+		longest = max(longest, dtz+1)
+	}
+
+	return -longest
+}
+
+func (s *dtzSolver) wdlAt(slot dtzSlot) WDL {
+	return s.wdl[slot.stm][slot.file][slot.idx]
+}
+
+func (s *dtzSolver) dtzAt(slot dtzSlot) int16 {
+	return s.dtz[slot.stm][slot.file][slot.idx]
+}
+
+// write compresses the values and writes the table, giving each part the given flags.
+func (tw *tableWriter) write(w io.Writer, flags uint8) error {
+	t := tw.t
+
+	var parts []*writtenPart
+
+	for file := 0; file <= tw.maxFile; file++ {
+		for stm := range tw.sides {
+			p, err := compress(tw.values[stm][file], flags)
+			if err != nil {
+				return fmt.Errorf("failed to compress %s: %w", t.name, err)
+			}
+
+			parts = append(parts, p)
+		}
+	}
+
+	var header []byte
+
+	header = append(header, magics[t.typ][:]...)
+
+	var tableFlags byte
+	if tw.sides == 2 {
+		tableFlags |= 1
+	}
+
+	if t.hasPawns {
+		tableFlags |= 2
+	}
+
+	header = append(header, tableFlags)
+
+	for file := 0; file <= tw.maxFile; file++ {
+		header = append(header, byte(tw.order[0]|tw.order[0]<<4))
+		if t.hasPawns && t.pawnCount[1] > 0 {
+			header = append(header, byte(tw.order[1]|tw.order[1]<<4))
+		}
+
+		d0, d1 := t.get(0, file), t.get(tw.sides-1, file)
+
+		for k := range t.pieceCount {
+			header = append(header, byte(d0.pieces[k]|d1.pieces[k]<<4))
+		}
+	}
+
+	header = pad(header, 2)
+
+	for _, p := range parts {
+		header = append(header, p.sizes...)
+	}
+
+	if t.typ == dtzTable {
+		header = pad(header, 2)
+	}
+
+	for _, p := range parts {
+		header = append(header, p.sparseIndex...)
+	}
+
+	for _, p := range parts {
+		header = append(header, p.blockLengths...)
+	}
+
+	for _, p := range parts {
+		header = pad(header, 64)
+		header = append(header, p.blocks...)
+	}
+
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.Write(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", t.name, err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", t.name, err)
+	}
+
+	return nil
+}
+
+func pad(buf []byte, align int) []byte {
+	for len(buf)%align != 0 {
+		buf = append(buf, 0)
+	}
+
+	return buf
+}
+
+// writtenPart is one part of a table, compressed.
+type writtenPart struct {
+	sizes        []byte
+	sparseIndex  []byte
+	blockLengths []byte
+	blocks       []byte
+}
+
+// The limits of the compression done by compress. There can be no more symbols than fit in 12
+// bits, less the one that marks a leaf, and pairs that occur fewer than minPairCount times aren't
+// worth the space their entries take. A block holds at most maxBlockValues values, so that its
+// count of values and the offsets into it in the sparse index fit in 16 bits, and a symbol stands
+// for at most maxSymbolValues, so that a block is never left mostly empty to keep under the limit.
+const (
+	maxSymbols      = 0xFFF
+	minPairCount    = 8
+	maxBlockValues  = 1<<16 - 1<<writeSpanBits
+	maxSymbolValues = 1024
+)
+
+// symbol is one of the symbols values are compressed into: either a leaf holding a value, or a
+// pair of two other symbols, which stands for the values of both, one after the other.
+type symbol struct {
+	// left and right are the symbols of a pair. A leaf has its value in left and -1 in right.
+	left, right int
+	// values is the number of values the symbol stands for.
+	values int
+}
+
+// compress codes the values of one part of a table as the official generator does: the most
+// frequent pair of adjacent symbols is repeatedly replaced by a new symbol, and the symbols left
+// are then Huffman coded. Indices with no value, marked -1, take the value before them, which
+// makes runs that pair up well.
+func compress(values []int, flags uint8) (*writtenPart, error) {
+	filled := slices.Clone(values)
+
+	last := 0
+
+	for _, v := range filled {
+		if v >= 0 {
+			last = v
+
+			break
+		}
+	}
+
+	single := true
+
+	for i, v := range filled {
+		if v < 0 {
+			filled[i] = last
+		}
+
+		single = single && filled[i] == filled[0]
+		last = filled[i]
+	}
+
+	if single && last < 256 {
+		return &writtenPart{sizes: []byte{flags | flagSingleValue, byte(last)}}, nil
+	}
+
+	seq, symbols, err := pairUp(filled)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(symbols) == 1 {
+		// A code needs two symbols, so add one that's never used.
+		symbols = append(symbols, symbol{left: symbols[0].left + 1, right: -1, values: 1})
+	}
+
+	// Every symbol needs a code, including the ones only used within pairs, so those count as
+	// occurring once.
+	weights := make([]int, len(symbols))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	for _, s := range seq {
+		weights[s]++
+	}
+
+	lengths := huffmanLengths(weights)
+
+	// Symbols are numbered from the longest codes to the shortest, and codes are assigned so that
+	// longer codes have lower values, which is the order the reader expects.
+	order := make([]int, len(symbols))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return lengths[order[i]] > lengths[order[j]]
+	})
+
+	number := make([]int, len(symbols))
+	for n, s := range order {
+		number[s] = n
+	}
+
+	minLen, maxLen := lengths[order[len(order)-1]], lengths[order[0]]
+	if maxLen > 32 {
+		return nil, fmt.Errorf("code of %d bits is too long", maxLen)
+	}
+
+	count := make([]int, maxLen+2)
+	for _, l := range lengths {
+		count[l]++
+	}
+
+	lowestSym := make([]int, maxLen+2)
+	base := make([]uint64, maxLen+2)
+
+	for l := maxLen - 1; l >= minLen; l-- {
+		lowestSym[l] = lowestSym[l+1] + count[l+1]
+		base[l] = (base[l+1] + uint64(count[l+1])) / 2
+	}
+
+	codes := make([]uint64, len(symbols))
+	for s := range symbols {
+		l := lengths[s]
+		codes[s] = base[l] + uint64(number[s]-lowestSym[l])
+	}
+
+	// Pack the codes into blocks, starting a new block whenever the next code doesn't fit.
+	const blockSize = 1 << writeBlockBits
+
+	var (
+		blocks       []byte
+		block        []byte
+		bits         int
+		blockLengths = []int{0}
+		firstOfBlock = []int{0}
+		next         int
+	)
+
+	for _, s := range seq {
+		if bits+lengths[s] > blockSize*8 || blockLengths[len(blockLengths)-1]+symbols[s].values > maxBlockValues {
+			blocks = append(blocks, block...)
+			blocks = append(blocks, make([]byte, blockSize-len(block))...)
+			block, bits = nil, 0
+
+			blockLengths = append(blockLengths, 0)
+			firstOfBlock = append(firstOfBlock, next)
+		}
+
+		for b := lengths[s] - 1; b >= 0; b-- {
+			if bits%8 == 0 {
+				block = append(block, 0)
+			}
+
+			if codes[s]>>b&1 != 0 {
+				block[bits/8] |= 0x80 >> (bits % 8)
+			}
+
+			bits++
+		}
+
+		blockLengths[len(blockLengths)-1] += symbols[s].values
+		next += symbols[s].values
+	}
+
+	blocks = append(blocks, block...)
+	blocks = append(blocks, make([]byte, blockSize-len(block))...)
+
+	ret := &writtenPart{}
+
+	ret.sizes = append(ret.sizes, flags, writeBlockBits, writeSpanBits, 0)
+	ret.sizes = binary.LittleEndian.AppendUint32(ret.sizes, uint32(len(blockLengths)))
+	ret.sizes = append(ret.sizes, byte(maxLen), byte(minLen))
+
+	for l := minLen; l <= maxLen; l++ {
+		ret.sizes = binary.LittleEndian.AppendUint16(ret.sizes, uint16(lowestSym[l]))
+	}
+
+	ret.sizes = binary.LittleEndian.AppendUint16(ret.sizes, uint16(len(symbols)))
+
+	for _, s := range order {
+		// A leaf is its value, and 0xFFF in place of a second symbol.
+		left, right := symbols[s].left, 0xFFF
+		if symbols[s].right >= 0 {
+			left, right = number[symbols[s].left], number[symbols[s].right]
+		}
+
+		ret.sizes = append(ret.sizes, byte(left), byte(left>>8)|byte(right<<4), byte(right>>4))
+	}
+
+	ret.sizes = pad(ret.sizes, 2)
+
+	for _, n := range blockLengths {
+		ret.blockLengths = binary.LittleEndian.AppendUint16(ret.blockLengths, uint16(n-1))
+	}
+
+	// Each entry of the sparse index gives the block holding the first value of its span, and that
+	// value's offset in the block plus half a span, which is where the reader counts from.
+	const span = 1 << writeSpanBits
+
+	b := 0
+
+	for first := 0; first < len(filled); first += span {
+		for b+1 < len(firstOfBlock) && firstOfBlock[b+1] <= first {
+			b++
+		}
+
+		ret.sparseIndex = binary.LittleEndian.AppendUint32(ret.sparseIndex, uint32(b))
+		ret.sparseIndex = binary.LittleEndian.AppendUint16(ret.sparseIndex, uint16(first-firstOfBlock[b]+span/2))
+	}
+
+	ret.blocks = blocks
+
+	return ret, nil
+}
+
+// pairUp turns the values into a sequence of symbols, starting with a leaf for each value and
+// replacing the most frequent pair of adjacent symbols with a new symbol until no pair is frequent
+// enough or there's no room for more symbols. Ties go to the lowest pair, so the same values always
+// give the same symbols.
+func pairUp(values []int) ([]int, []symbol, error) {
+	var symbols []symbol
+
+	leaves := make(map[int]int)
+	seq := make([]int, len(values))
+
+	for i, v := range values {
+		if v > 0xFFE {
+			return nil, nil, fmt.Errorf("value %d is too large to store", v)
+		}
+
+		leaf, ok := leaves[v]
+		if !ok {
+			leaf = len(symbols)
+			leaves[v] = leaf
+			symbols = append(symbols, symbol{left: v, right: -1, values: 1})
+		}
+
+		seq[i] = leaf
+	}
+
+	for len(symbols) < maxSymbols {
+		counts := make(map[[2]int]int)
+
+		for i := 0; i+1 < len(seq); i++ {
+			a, b := seq[i], seq[i+1]
+			if symbols[a].values+symbols[b].values > maxSymbolValues {
+				continue
+			}
+
+			counts[[2]int{a, b}]++
+
+			// A run of one symbol holds half as many pairs of it as it has adjacent pairs.
+			if a == b && i+2 < len(seq) && seq[i+2] == a {
+				i++
+			}
+		}
+
+		var (
+			best      [2]int
+			bestCount int
+		)
+
+		for pair, n := range counts {
+			if n > bestCount || (n == bestCount && (pair[0] < best[0] || (pair[0] == best[0] && pair[1] < best[1]))) {
+				best, bestCount = pair, n
+			}
+		}
+
+		if bestCount < minPairCount {
+			break
+		}
+
+		pair := len(symbols)
+		symbols = append(symbols, symbol{
+			left:   best[0],
+			right:  best[1],
+			values: symbols[best[0]].values + symbols[best[1]].values,
+		})
+
+		out := seq[:0]
+
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == best[0] && seq[i+1] == best[1] {
+				out = append(out, pair)
+				i++
+			} else {
+				out = append(out, seq[i])
+			}
+		}
+
+		seq = out
+	}
+
+	return seq, symbols, nil
+}
+
+// huffmanLengths returns the length of the Huffman code of each symbol, given how often each
+// occurs.
+func huffmanLengths(weights []int) []int {
+	type node struct {
+		weight  int
+		symbols []int
+	}
+
+	nodes := make([]node, 0, len(weights))
+	for s, w := range weights {
+		nodes = append(nodes, node{w, []int{s}})
+	}
+
+	lengths := make([]int, len(weights))
+
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+		merged := node{nodes[0].weight + nodes[1].weight, append(slices.Clone(nodes[0].symbols), nodes[1].symbols...)}
+		for _, s := range merged.symbols {
+			lengths[s]++
+		}
+
+		nodes = append([]node{merged}, nodes[2:]...)
+	}
+
+	return lengths
+}
@@ -1,47 +1,43 @@
 package tables
 
 import (
-	"log"
-	"strconv"
+	"errors"
+	"fmt"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
 	sq "github.com/samwestmoreland/chessengine/internal/squares"
-	"github.com/samwestmoreland/chessengine/magic"
 )
 
-func populateBishopAttackTables(data magic.BishopData) [64][]bb.Bitboard {
-	var attacks [64][]bb.Bitboard
-
-	for square := range uint8(64) {
-		// Get magic data for this square
-		magicNum, err := strconv.ParseUint(data.Magics[square].Magic, 16, 64)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		shift := data.Magics[square].Shift
-
-		// Create slice big enough for all possible indices
-		tableSize := 1 << (64 - shift)
-		attacks[square] = make([]bb.Bitboard, tableSize)
+// populateBishopAttackTables fills in the bishop attacks of the attack table, in the same way as
+// populateRookAttackTables does for rooks.
+func populateBishopAttackTables(magics *[64]Magic, attacks []bb.Bitboard, filled []bool) error {
+	var errs []error
 
+	for square := range sq.Square(64) {
 		// Populate this square's table with all possible attack patterns
-		mask := MaskBishopAttacks(sq.Square(square))
+		mask := MaskBishopAttacks(square)
 		numBlockers := bb.CountBits(mask) // how many relevant squares
 
 		// For each possible blocker configuration...
 		for i := range 1 << numBlockers {
 			blockers := bb.SetOccupancy(i, mask)
-			// Calculate actual moves for this blocker pattern
-			moves := BishopAttacksOnTheFly(sq.Square(square), blockers)
-			// Calculate index using magic
-			index := (uint64(blockers) * magicNum) >> shift
-			// Store moves at this index
-			attacks[square][index] = moves
+			moves := BishopAttacksOnTheFly(square, blockers)
+
+			// Store the actual moves for this blocker pattern at the index the magic hashes it to,
+			// unless another pattern, of this square or another, has already put other moves there
+			index := magics[square].index(blockers)
+			if filled[index] && attacks[index] != moves {
+				errs = append(errs, fmt.Errorf("magic for bishop on %s hashes blockers %016x to a slot holding other attacks",
+					sq.Stringify(square), uint64(blockers)))
+
+				break
+			}
+
+			attacks[index], filled[index] = moves, true
 		}
 	}
 
-	return attacks
+	return errors.Join(errs...)
 }
 
 func MaskBishopAttacks(square sq.Square) bb.Bitboard {
@@ -2,13 +2,10 @@ package tables
 
 import (
 	"bytes"
-	"encoding/json"
-	"strconv"
 	"testing"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
 	sq "github.com/samwestmoreland/chessengine/internal/squares"
-	"github.com/samwestmoreland/chessengine/magic"
 )
 
 var bishopTestCases = map[sq.Square]uint64{
@@ -68,13 +65,11 @@ func TestBishopAttacksOnTheFly(t *testing.T) {
 func TestLookupTableGivesCorrectMovesForBishop(t *testing.T) {
 	t.Parallel()
 
-	var data magic.Data
-	if err := json.Unmarshal(magic.JSONData, &data); err != nil {
-		panic(err)
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		t.Fatal(err)
 	}
 
-	table := populateBishopAttackTables(data.Bishop)
-
 	testCases := []struct {
 		square        sq.Square
 		blockers      bb.Bitboard
@@ -113,19 +108,7 @@ func TestLookupTableGivesCorrectMovesForBishop(t *testing.T) {
 	}
 
 	for _, tt := range testCases {
-		magicNum, err := strconv.ParseUint(data.Bishop.Magics[tt.square].Magic, 16, 64)
-		if err != nil {
-			panic(err)
-		}
-
-		mask, err := strconv.ParseUint(data.Bishop.Magics[tt.square].Mask, 16, 64)
-		if err != nil {
-			panic(err)
-		}
-
-		shift := data.Bishop.Magics[tt.square].Shift
-		index := (uint64(tt.blockers) & mask * magicNum) >> shift
-		moves := table[tt.square][index]
+		moves := table.BishopAttacks(tt.square, tt.blockers)
 
 		if uint64(moves) != tt.expectedMoves {
 			var buf bytes.Buffer
@@ -148,3 +131,39 @@ func TestLookupTableGivesCorrectMovesForBishop(t *testing.T) {
 		}
 	}
 }
+
+func TestBishopMagicMasks(t *testing.T) {
+	t.Parallel()
+
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		t.Fatal(err)
+	}
+
+	for square := range sq.Square(64) {
+		if got, want := table.Bishops[square].Mask, MaskBishopAttacks(square); got != want {
+			t.Errorf("mask for %s is %x, want %x", sq.Stringify(square), uint64(got), uint64(want))
+		}
+	}
+}
+
+func BenchmarkBishopAttacks(b *testing.B) {
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		b.Fatal(err)
+	}
+
+	blockers := bb.SetBits(0, sq.B6, sq.D7, sq.F4, sq.C3, sq.G2)
+
+	var attacks bb.Bitboard
+
+	b.ResetTimer()
+
+	for i := range b.N {
+		attacks |= table.BishopAttacks(sq.Square(i%64), blockers)
+	}
+
+	if attacks == 0 {
+		b.Fatal("no attacks")
+	}
+}
@@ -0,0 +1,49 @@
+package tables
+
+import (
+	"math/bits"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// hyperbola works out slider attacks with hyperbola quintessence. Along a line through a square,
+// the blockers less twice the square clear the squares up to the first blocker above it, and
+// doing the same with every bit reversed does so below it. Only the lines through each square are
+// stored.
+type hyperbola struct {
+	// The file, rank, diagonal and anti-diagonal through each square, without the square itself.
+	file, rank, diagonal, antiDiagonal [64]bb.Bitboard
+}
+
+func newHyperbola() *hyperbola {
+	var ret hyperbola
+
+	for square := range sq.Square(64) {
+		ret.file[square] = ray(square, rookDirections[0]) | ray(square, rookDirections[2])
+		ret.rank[square] = ray(square, rookDirections[1]) | ray(square, rookDirections[3])
+		ret.diagonal[square] = ray(square, bishopDirections[0]) | ray(square, bishopDirections[3])
+		ret.antiDiagonal[square] = ray(square, bishopDirections[1]) | ray(square, bishopDirections[2])
+	}
+
+	return &ret
+}
+
+func (h *hyperbola) BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return lineAttacks(h.diagonal[square], square, occupancy) | lineAttacks(h.antiDiagonal[square], square, occupancy)
+}
+
+func (h *hyperbola) RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return lineAttacks(h.file[square], square, occupancy) | lineAttacks(h.rank[square], square, occupancy)
+}
+
+// lineAttacks returns the attacks of a slider on a square along the given line through it.
+func lineAttacks(line bb.Bitboard, square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	blockers := uint64(occupancy & line)
+	slider := uint64(1) << square
+
+	forward := blockers - 2*slider
+	reverse := bits.Reverse64(bits.Reverse64(blockers) - 2*bits.Reverse64(slider))
+
+	return bb.Bitboard(forward^reverse) & line
+}
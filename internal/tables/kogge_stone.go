@@ -0,0 +1,39 @@
+package tables
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// koggeStone works out slider attacks with Kogge-Stone fills, which need no tables: the slider is
+// smeared along each direction through the empty squares, one, two and then four steps at a time,
+// and the attacks are the fill moved one more step.
+type koggeStone struct{}
+
+func (koggeStone) BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return koggeStoneAttacks(&bishopDirections, square, occupancy)
+}
+
+func (koggeStone) RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return koggeStoneAttacks(&rookDirections, square, occupancy)
+}
+
+func koggeStoneAttacks(dirs *[4]direction, square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	var ret bb.Bitboard
+
+	for _, dir := range dirs {
+		// The squares the fill can pass through: the empty ones it can reach without wrapping.
+		empty := ^occupancy &^ dir.wrap
+		fill := bb.SetBit(0, square)
+
+		fill |= empty & shift(fill, dir.step)
+		empty &= shift(empty, dir.step)
+		fill |= empty & shift(fill, 2*dir.step)
+		empty &= shift(empty, 2*dir.step)
+		fill |= empty & shift(fill, 4*dir.step)
+
+		ret |= shift(fill, dir.step) &^ dir.wrap
+	}
+
+	return ret
+}
@@ -0,0 +1,74 @@
+package tables
+
+import (
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// pextTables works out slider attacks with tables indexed by the bits of the occupancy on the
+// squares of the mask, packed together, which is what the PEXT instruction computes. The index is
+// exact, so unlike a magic there's no number to search for, but without the instruction it has to
+// be worked out a bit at a time.
+type pextTables struct {
+	rooks, bishops [64]pextEntry
+	attacks        []bb.Bitboard
+}
+
+type pextEntry struct {
+	mask   bb.Bitboard
+	offset int
+}
+
+func newPextTables() *pextTables {
+	var ret pextTables
+
+	for square := range sq.Square(64) {
+		ret.rooks[square] = ret.add(square, MaskRookAttacks(square), RookAttacksOnTheFly)
+	}
+
+	for square := range sq.Square(64) {
+		ret.bishops[square] = ret.add(square, MaskBishopAttacks(square), BishopAttacksOnTheFly)
+	}
+
+	return &ret
+}
+
+// add appends a square's part of the table, giving the attacks for every configuration of blockers
+// on its mask.
+func (p *pextTables) add(square sq.Square, mask bb.Bitboard, attacks func(sq.Square, bb.Bitboard) bb.Bitboard) pextEntry {
+	ret := pextEntry{mask: mask, offset: len(p.attacks)}
+
+	for i := range 1 << bb.CountBits(mask) {
+		// SetOccupancy spreads the bits of i over the mask, lowest first, which pext undoes.
+		p.attacks = append(p.attacks, attacks(square, bb.SetOccupancy(i, mask)))
+	}
+
+	return ret
+}
+
+func (p *pextTables) BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	entry := &p.bishops[square]
+
+	return p.attacks[entry.offset+int(pext(uint64(occupancy), uint64(entry.mask)))]
+}
+
+func (p *pextTables) RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	entry := &p.rooks[square]
+
+	return p.attacks[entry.offset+int(pext(uint64(occupancy), uint64(entry.mask)))]
+}
+
+// pext returns the bits of x on the set bits of the mask, packed into the low bits of the result.
+func pext(x, mask uint64) uint64 {
+	var ret uint64
+
+	for bit := uint64(1); mask != 0; bit <<= 1 {
+		if x&mask&-mask != 0 {
+			ret |= bit
+		}
+
+		mask &= mask - 1
+	}
+
+	return ret
+}
@@ -0,0 +1,69 @@
+package tables
+
+import (
+	"math/bits"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// rays works out slider attacks the classical way, with the ray from every square in every
+// direction. The attacks in a direction are the ray, less the part of it beyond the first blocker:
+// the lowest square of the blockers for a direction with a positive step, and the highest for a
+// negative one.
+type rays struct {
+	rook, bishop [4][64]bb.Bitboard
+}
+
+func newRays() *rays {
+	var ret rays
+
+	for square := range sq.Square(64) {
+		for i := range 4 {
+			ret.rook[i][square] = ray(square, rookDirections[i])
+			ret.bishop[i][square] = ray(square, bishopDirections[i])
+		}
+	}
+
+	return &ret
+}
+
+// ray returns the squares from a square to the edge of the board in a direction.
+func ray(square sq.Square, dir direction) bb.Bitboard {
+	var ret bb.Bitboard
+
+	for b := shift(bb.SetBit(0, square), dir.step) &^ dir.wrap; b != 0; b = shift(b, dir.step) &^ dir.wrap {
+		ret |= b
+	}
+
+	return ret
+}
+
+func (r *rays) BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return rayAttacks(&r.bishop, square, occupancy)
+}
+
+func (r *rays) RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return rayAttacks(&r.rook, square, occupancy)
+}
+
+func rayAttacks(rays *[4][64]bb.Bitboard, square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	var ret bb.Bitboard
+
+	for i := range rays {
+		attacks := rays[i][square]
+
+		if blockers := attacks & occupancy; blockers != 0 {
+			first := bits.TrailingZeros64(uint64(blockers))
+			if i >= 2 {
+				first = 63 - bits.LeadingZeros64(uint64(blockers))
+			}
+
+			attacks &^= rays[i][first]
+		}
+
+		ret |= attacks
+	}
+
+	return ret
+}
@@ -1,50 +1,50 @@
 package tables
 
 import (
-	"strconv"
+	"errors"
+	"fmt"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
 	sq "github.com/samwestmoreland/chessengine/internal/squares"
-	"github.com/samwestmoreland/chessengine/magic"
 )
 
-// populateRookAttackTables generates a lookup table for rook attacks. Each square on the board has
-// its own hash table, which can be indexed into by hashing the blocker configuration like so:
+// populateRookAttackTables fills in the rook attacks of the attack table. Each square has its own
+// part of the table, which is indexed into by hashing the blocker configuration like so:
 //
 // index = (blockerConfig * magicNumber) >> someShift
 //
-// where magicNumber is a magic number that has been pre-calculated and stored in the magic_data
-// directory, and someShift is a bit shift that has also been pre-calculated and is stored alongside
-// the magic number.
-func populateRookAttackTables(data magic.RookData) [64][]bb.Bitboard {
-	var attacks [64][]bb.Bitboard
-
-	for square := range 64 {
-		// Get magic data for this square
-		magicNum, _ := strconv.ParseUint(data.Magics[square].Magic, 16, 64)
-		shift := data.Magics[square].Shift
-
-		// Create slice big enough for all possible indices
-		tableSize := 1 << (64 - shift)
-		attacks[square] = make([]bb.Bitboard, tableSize)
-
+// where magicNumber is a magic number that has been pre-calculated and stored in the magic
+// package, and someShift is a bit shift that has also been pre-calculated and is stored alongside
+// the magic number. Slots are marked in filled as they're written, and it's an error for a magic to
+// hash two blocker configurations with different attacks to the same slot.
+func populateRookAttackTables(magics *[64]Magic, attacks []bb.Bitboard, filled []bool) error {
+	var errs []error
+
+	for square := range sq.Square(64) {
 		// Populate this square's table with all possible attack patterns
-		mask := MaskRookAttacks(sq.Square(byte(square)))
+		mask := MaskRookAttacks(square)
 		numBlockers := bb.CountBits(mask) // how many relevant squares
 
 		// For each possible blocker configuration...
 		for i := range 1 << numBlockers {
 			blockers := bb.SetOccupancy(i, mask)
-			// Calculate actual moves for this blocker pattern
-			moves := RookAttacksOnTheFly(sq.Square(byte(square)), blockers)
-			// Calculate index using magic
-			index := (uint64(blockers) * magicNum) >> shift
-			// Store moves at this index
-			attacks[square][index] = moves
+			moves := RookAttacksOnTheFly(square, blockers)
+
+			// Store the actual moves for this blocker pattern at the index the magic hashes it to,
+			// unless another pattern, of this square or another, has already put other moves there
+			index := magics[square].index(blockers)
+			if filled[index] && attacks[index] != moves {
+				errs = append(errs, fmt.Errorf("magic for rook on %s hashes blockers %016x to a slot holding other attacks",
+					sq.Stringify(square), uint64(blockers)))
+
+				break
+			}
+
+			attacks[index], filled[index] = moves, true
 		}
 	}
 
-	return attacks
+	return errors.Join(errs...)
 }
 
 // MaskRookAttacks generates a bitmask for all possible squares that a rook can attack from a given
@@ -2,14 +2,11 @@ package tables
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"strconv"
 	"testing"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
 	sq "github.com/samwestmoreland/chessengine/internal/squares"
-	"github.com/samwestmoreland/chessengine/magic"
 )
 
 func TestMaskRookAttacks(t *testing.T) {
@@ -79,13 +76,11 @@ func TestRookAttacksOnTheFly(t *testing.T) {
 func TestLookupTableGivesCorrectMovesForRook(t *testing.T) {
 	t.Parallel()
 
-	var data magic.Data
-	if err := json.Unmarshal(magic.JSONData, &data); err != nil {
-		panic(err)
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		t.Fatal(err)
 	}
 
-	table := populateRookAttackTables(data.Rook)
-
 	testCases := []struct {
 		square        sq.Square
 		blockers      bb.Bitboard
@@ -124,19 +119,7 @@ func TestLookupTableGivesCorrectMovesForRook(t *testing.T) {
 	}
 
 	for _, tt := range testCases {
-		magicNum, err := strconv.ParseUint(data.Rook.Magics[tt.square].Magic, 16, 64)
-		if err != nil {
-			panic(err)
-		}
-
-		mask, err := strconv.ParseUint(data.Rook.Magics[tt.square].Mask, 16, 64)
-		if err != nil {
-			panic(err)
-		}
-
-		shift := data.Rook.Magics[tt.square].Shift
-		index := (uint64(tt.blockers) & mask * magicNum) >> shift
-		moves := table[tt.square][index]
+		moves := table.RookAttacks(tt.square, tt.blockers)
 
 		if uint64(moves) != tt.expectedMoves {
 			var buf bytes.Buffer
@@ -156,3 +139,39 @@ func TestLookupTableGivesCorrectMovesForRook(t *testing.T) {
 		}
 	}
 }
+
+func TestRookMagicMasks(t *testing.T) {
+	t.Parallel()
+
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		t.Fatal(err)
+	}
+
+	for square := range sq.Square(64) {
+		if got, want := table.Rooks[square].Mask, MaskRookAttacks(square); got != want {
+			t.Errorf("mask for %s is %x, want %x", sq.Stringify(square), uint64(got), uint64(want))
+		}
+	}
+}
+
+func BenchmarkRookAttacks(b *testing.B) {
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		b.Fatal(err)
+	}
+
+	blockers := bb.SetBits(0, sq.B6, sq.D7, sq.F4, sq.C3, sq.G2)
+
+	var attacks bb.Bitboard
+
+	b.ResetTimer()
+
+	for i := range b.N {
+		attacks |= table.RookAttacks(sq.Square(i%64), blockers)
+	}
+
+	if attacks == 0 {
+		b.Fatal("no attacks")
+	}
+}
@@ -0,0 +1,78 @@
+package tables
+
+import (
+	"fmt"
+	"strings"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+// SliderAttacks works out the squares attacked by a rook or bishop on a square, given the
+// occupancy of the board. The magic tables of a Lookup are the fastest way of doing it; the other
+// implementations are there to compare against them and to fall back on without the tables.
+type SliderAttacks interface {
+	BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard
+	RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard
+}
+
+// SliderAttacksEnv is the environment variable that names the implementation of SliderAttacks for
+// the move generator to use, one of SliderBackends. The magic tables are used if it isn't set.
+const SliderAttacksEnv = "CHESSENGINE_SLIDERS"
+
+// SliderBackends are the names of the implementations of SliderAttacks that NewSliderAttacks makes.
+var SliderBackends = []string{"magic", "rays", "kogge-stone", "hyperbola", "pext"}
+
+// NewSliderAttacks returns the named implementation of SliderAttacks: "magic" (or "") for the magic
+// tables of the lookup, which must already be initialised, "rays" for scanning along each ray to
+// the first blocker, "kogge-stone" for Kogge-Stone fills, which need no tables at all, "hyperbola"
+// for hyperbola quintessence, or "pext" for tables indexed by extracting the bits of the mask from
+// the occupancy, as the PEXT instruction does.
+func NewSliderAttacks(backend string, lookup *Lookup) (SliderAttacks, error) {
+	switch backend {
+	case "", "magic":
+		return lookup, nil
+	case "rays":
+		return newRays(), nil
+	case "kogge-stone":
+		return koggeStone{}, nil
+	case "hyperbola":
+		return newHyperbola(), nil
+	case "pext":
+		return newPextTables(), nil
+	default:
+		return nil, fmt.Errorf("unknown slider attacks %q, want one of %s", backend, strings.Join(SliderBackends, ", "))
+	}
+}
+
+// Masks of the files on the edges of the board, for shifting bitboards east and west without
+// wrapping around.
+const (
+	fileA bb.Bitboard = 0x0101010101010101
+	fileH bb.Bitboard = fileA << 7
+)
+
+// shift moves every square of a bitboard by the given number of squares, towards the first rank if
+// it's positive and towards the eighth if it's negative.
+func shift(b bb.Bitboard, squares int) bb.Bitboard {
+	if squares < 0 {
+		return b >> -squares
+	}
+
+	return b << squares
+}
+
+// direction is one of the eight directions a slider moves in: the number of squares a step in it
+// adds to the square, and the file a step can't land on without having wrapped around the edge of
+// the board.
+type direction struct {
+	step int
+	wrap bb.Bitboard
+}
+
+// The directions of the rook, then those of the bishop. The steps of the first half of each are
+// positive, towards the first rank or the h file.
+var (
+	rookDirections   = [4]direction{{8, 0}, {1, fileA}, {-8, 0}, {-1, fileH}}
+	bishopDirections = [4]direction{{9, fileA}, {7, fileH}, {-7, fileA}, {-9, fileH}}
+)
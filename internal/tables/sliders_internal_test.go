@@ -0,0 +1,99 @@
+package tables
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
+	sq "github.com/samwestmoreland/chessengine/internal/squares"
+)
+
+func newSliderBackends(tb testing.TB) map[string]SliderAttacks {
+	tb.Helper()
+
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err != nil {
+		tb.Fatal(err)
+	}
+
+	ret := make(map[string]SliderAttacks)
+
+	for _, backend := range SliderBackends {
+		sliders, err := NewSliderAttacks(backend, &table)
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		ret[backend] = sliders
+	}
+
+	return ret
+}
+
+func TestSliderBackendsAgree(t *testing.T) {
+	t.Parallel()
+
+	backends := newSliderBackends(t)
+	random := rand.New(rand.NewPCG(1, 2))
+
+	for range 2000 {
+		// Boards of every density, from nearly empty to nearly full.
+		occupancy := bb.Bitboard(random.Uint64())
+		for range random.IntN(4) {
+			occupancy &= bb.Bitboard(random.Uint64())
+		}
+
+		for square := range sq.Square(64) {
+			wantBishop := BishopAttacksOnTheFly(square, occupancy&MaskBishopAttacks(square))
+			wantRook := RookAttacksOnTheFly(square, occupancy&MaskRookAttacks(square))
+
+			for name, sliders := range backends {
+				if got := sliders.BishopAttacks(square, occupancy); got != wantBishop {
+					t.Fatalf("%s: bishop on %s with occupancy %016x attacks %016x, want %016x",
+						name, sq.Stringify(square), uint64(occupancy), uint64(got), uint64(wantBishop))
+				}
+
+				if got := sliders.RookAttacks(square, occupancy); got != wantRook {
+					t.Fatalf("%s: rook on %s with occupancy %016x attacks %016x, want %016x",
+						name, sq.Stringify(square), uint64(occupancy), uint64(got), uint64(wantRook))
+				}
+			}
+		}
+	}
+}
+
+func TestUnknownSliderBackend(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewSliderAttacks("bogus", &Lookup{}); err == nil {
+		t.Error("made slider attacks for an unknown backend")
+	}
+}
+
+func BenchmarkSliderAttacks(b *testing.B) {
+	backends := newSliderBackends(b)
+
+	random := rand.New(rand.NewPCG(1, 2))
+
+	var occupancies [1024]bb.Bitboard
+	for i := range occupancies {
+		occupancies[i] = bb.Bitboard(random.Uint64() & random.Uint64())
+	}
+
+	for _, backend := range SliderBackends {
+		sliders := backends[backend]
+
+		b.Run(backend, func(b *testing.B) {
+			var attacks bb.Bitboard
+
+			for i := range b.N {
+				occupancy := occupancies[i%len(occupancies)]
+				attacks |= sliders.RookAttacks(sq.Square(i%64), occupancy) | sliders.BishopAttacks(sq.Square(i%64), occupancy)
+			}
+
+			if attacks == 0 {
+				b.Fatal("no attacks")
+			}
+		})
+	}
+}
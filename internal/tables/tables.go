@@ -2,7 +2,10 @@ package tables
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
 
 	bb "github.com/samwestmoreland/chessengine/internal/bitboard"
@@ -10,58 +13,189 @@ import (
 	"github.com/samwestmoreland/chessengine/magic"
 )
 
-var data magic.Data
-
 type Lookup struct {
 	Pawns   [2][64]bb.Bitboard
 	Knights [64]bb.Bitboard
 	Kings   [64]bb.Bitboard
-	Bishops [64][]bb.Bitboard
-	Rooks   [64][]bb.Bitboard
+	// Bishops and Rooks are the magic entries of each square, which index into Sliders.
+	Bishops [64]Magic
+	Rooks   [64]Magic
+	// Sliders are the attacks of a rook or bishop on every square for every configuration of
+	// blockers, in one contiguous table shared by both pieces. Each square's part of it starts at
+	// the offset of its magic entry, and the parts may overlap where their entries agree.
+	Sliders []bb.Bitboard
+}
+
+// Magic is the magic bitboard entry of a square, decoded once from the hex strings of magics.json.
+// Multiplying the blockers on the squares of the mask by the magic number and shifting the
+// product right gives the index of their attacks in the square's part of the table, which starts
+// at the offset.
+type Magic struct {
+	Mask   bb.Bitboard
+	Magic  uint64
+	Shift  uint8
+	Offset uint32
 }
 
+// index returns the index into the attack table of the attacks for the given blockers.
+func (m *Magic) index(blockers bb.Bitboard) uint32 {
+	return m.Offset + uint32((uint64(blockers&m.Mask)*m.Magic)>>m.Shift)
+}
+
+// MagicsFileEnv is the environment variable that names a magics file for InitialiseLookupTables to
+// use instead of the one built in, so that a newly generated set can be tried out without
+// rebuilding.
+const MagicsFileEnv = "CHESSENGINE_MAGICS"
+
+// InitialiseLookupTables fills in the attack tables of every piece. The magics come from the file
+// named by MagicsFileEnv if it's set, and from magic.JSONData otherwise. They're checked as the
+// tables are filled in, so that a bad magic gives an error rather than wrong attacks.
 func InitialiseLookupTables(table *Lookup) error {
-	if err := json.Unmarshal(magic.JSONData, &data); err != nil {
-		return fmt.Errorf("failed to unmarshal magic data: %w", err)
+	data, err := loadMagics()
+	if err != nil {
+		return err
 	}
 
+	if err := checkSchema(data.Metadata.Version); err != nil {
+		return err
+	}
+
+	InitialiseLeaperTables(table)
+
+	return table.populateSliders(&data)
+}
+
+// InitialiseLeaperTables fills in the attack tables of pawns, knights and kings, leaving the magic
+// slider tables empty for when another implementation of slider attacks is used.
+func InitialiseLeaperTables(table *Lookup) {
 	table.Pawns = populatePawnAttackTables()
 	table.Knights = populateKnightAttackTables()
 	table.Kings = populateKingAttackTables()
-	table.Bishops = populateBishopAttackTables(data.Bishop)
-	table.Rooks = populateRookAttackTables(data.Rook)
+}
 
-	return nil
+// loadMagics returns the magic data that InitialiseLookupTables uses.
+func loadMagics() (magic.Data, error) {
+	var ret magic.Data
+
+	jsonData := magic.JSONData
+
+	if path := os.Getenv(MagicsFileEnv); path != "" {
+		var err error
+
+		jsonData, err = os.ReadFile(path)
+		if err != nil {
+			return ret, fmt.Errorf("failed to read magics from %s: %w", MagicsFileEnv, err)
+		}
+	}
+
+	if err := json.Unmarshal(jsonData, &ret); err != nil {
+		return ret, fmt.Errorf("failed to unmarshal magic data: %w", err)
+	}
+
+	return ret, nil
 }
 
-func GetBishopLookupIndex(square sq.Square, blockers bb.Bitboard) bb.Bitboard {
-	magicNum, err := strconv.ParseUint(data.Bishop.Magics[square].Magic, 16, 64)
-	if err != nil {
-		panic(err)
+// populateSliders decodes the rook and bishop magics and fills in the table of slider attacks.
+func (l *Lookup) populateSliders(data *magic.Data) error {
+	rooks, rookEnd, rookErr := decodeMagics(data.Rook.Magics, MaskRookAttacks)
+	if rookErr != nil {
+		rookErr = fmt.Errorf("failed to decode rook magics: %w", rookErr)
 	}
 
-	mask, err := strconv.ParseUint(data.Bishop.Magics[square].Mask, 16, 64)
-	if err != nil {
-		panic(err)
+	bishops, bishopEnd, bishopErr := decodeMagics(data.Bishop.Magics, MaskBishopAttacks)
+	if bishopErr != nil {
+		bishopErr = fmt.Errorf("failed to decode bishop magics: %w", bishopErr)
+	}
+
+	if err := errors.Join(rookErr, bishopErr); err != nil {
+		return err
 	}
 
-	shift := data.Bishop.Magics[square].Shift
+	l.Rooks = rooks
+	l.Bishops = bishops
+	l.Sliders = make([]bb.Bitboard, max(rookEnd, bishopEnd))
 
-	return bb.Bitboard((uint64(blockers) & mask * magicNum) >> shift)
+	filled := make([]bool, len(l.Sliders))
+
+	return errors.Join(
+		populateRookAttackTables(&l.Rooks, l.Sliders, filled),
+		populateBishopAttackTables(&l.Bishops, l.Sliders, filled),
+	)
+}
+
+// BishopAttacks returns the squares attacked by a bishop on the given square, given the occupancy
+// of the board.
+func (l *Lookup) BishopAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return l.Sliders[l.Bishops[square].index(occupancy)]
+}
+
+// RookAttacks returns the squares attacked by a rook on the given square, given the occupancy of
+// the board.
+func (l *Lookup) RookAttacks(square sq.Square, occupancy bb.Bitboard) bb.Bitboard {
+	return l.Sliders[l.Rooks[square].index(occupancy)]
+}
+
+// decodeMagics decodes the magic entries of the 64 squares, checking that each is for its square,
+// has the mask the given function gives for it, and has a shift that leaves no more index bits than
+// the mask has bits. It also returns the size of attack table needed to hold every square's part
+// of it.
+func decodeMagics(entries []magic.Entry, maskFor func(sq.Square) bb.Bitboard) ([64]Magic, uint32, error) {
+	var (
+		ret  [64]Magic
+		end  uint32
+		errs []error
+	)
+
+	if len(entries) != len(ret) {
+		return ret, 0, fmt.Errorf("expected %d magics, got %d", len(ret), len(entries))
+	}
+
+	for square, entry := range entries {
+		if err := decodeMagic(entry, sq.Square(byte(square)), maskFor, &ret[square]); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		end = max(end, ret[square].Offset+1<<(64-ret[square].Shift))
+	}
+
+	return ret, end, errors.Join(errs...)
 }
 
-func GetRookLookupIndex(square sq.Square, blockers bb.Bitboard) bb.Bitboard {
-	magicNum, err := strconv.ParseUint(data.Rook.Magics[square].Magic, 16, 64)
+func decodeMagic(entry magic.Entry, square sq.Square, maskFor func(sq.Square) bb.Bitboard, ret *Magic) error {
+	if entry.Square != sq.Stringify(square) {
+		return fmt.Errorf("expected the magic for %s, got %q", sq.Stringify(square), entry.Square)
+	}
+
+	magicNum, err := strconv.ParseUint(entry.Magic, 16, 64)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to parse magic for %s: %w", entry.Square, err)
 	}
 
-	mask, err := strconv.ParseUint(data.Rook.Magics[square].Mask, 16, 64)
+	mask, err := strconv.ParseUint(entry.Mask, 16, 64)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to parse mask for %s: %w", entry.Square, err)
+	}
+
+	if want := maskFor(square); bb.Bitboard(mask) != want {
+		return fmt.Errorf("mask for %s is %016x, want %016x", entry.Square, mask, uint64(want))
 	}
 
-	shift := data.Rook.Magics[square].Shift
+	if entry.Shift < 64-bb.CountBits(bb.Bitboard(mask)) || entry.Shift >= 64 {
+		return fmt.Errorf("invalid shift %d for %s", entry.Shift, entry.Square)
+	}
+
+	if entry.Offset < 0 || entry.Offset > math.MaxUint32>>1 {
+		return fmt.Errorf("invalid offset %d for %s", entry.Offset, entry.Square)
+	}
 
-	return bb.Bitboard((uint64(blockers) & mask * magicNum) >> shift)
+	*ret = Magic{
+		Mask:   bb.Bitboard(mask),
+		Magic:  magicNum,
+		Shift:  uint8(entry.Shift),
+		Offset: uint32(entry.Offset),
+	}
+
+	return nil
 }
@@ -0,0 +1,47 @@
+package tables
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/samwestmoreland/chessengine/magic"
+)
+
+// VerifyMagics checks magic data the way InitialiseLookupTables does, and more thoroughly: its
+// schema version must be magic.SchemaVersion, every entry must be for its square with the right
+// mask and a sensible shift, and every configuration of blockers on every square must hash to a
+// slot holding its attacks. If version isn't empty, the data's version must match it too. It
+// returns every problem it finds.
+func VerifyMagics(data *magic.Data, version string) error {
+	var errs []error
+
+	if err := checkSchema(data.Metadata.Version); err != nil {
+		errs = append(errs, err)
+	}
+
+	if version != "" && data.Metadata.Version != version {
+		errs = append(errs, fmt.Errorf("version is %s, want %s", data.Metadata.Version, version))
+	}
+
+	var table Lookup
+	if err := table.populateSliders(data); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkSchema returns an error unless the version of magic data has the major version of the
+// schema this package reads.
+func checkSchema(version string) error {
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return fmt.Errorf("failed to parse magics version %q: %w", version, err)
+	}
+
+	if major != magic.SchemaVersion {
+		return fmt.Errorf("magics version %s has schema version %d, want %d", version, major, magic.SchemaVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package tables
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samwestmoreland/chessengine/magic"
+)
+
+func builtInMagics(t *testing.T) magic.Data {
+	t.Helper()
+
+	var ret magic.Data
+	if err := json.Unmarshal(magic.JSONData, &ret); err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func TestVerifyMagics(t *testing.T) {
+	t.Parallel()
+
+	data := builtInMagics(t)
+
+	if err := VerifyMagics(&data, strings.TrimSpace(magic.VersionString)); err != nil {
+		t.Errorf("built-in magics failed to verify: %v", err)
+	}
+}
+
+func TestVerifyMagicsFindsProblems(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		version string
+		corrupt func(data *magic.Data)
+		want    string
+	}{
+		{"bad magic", "", func(data *magic.Data) {
+			data.Rook.Magics[28].Magic = "0000000000000001"
+		}, "magic for rook on e5 hashes blockers"},
+		{"wrong mask", "", func(data *magic.Data) {
+			data.Bishop.Magics[0].Mask = "0000000000000003"
+		}, "mask for a8 is 0000000000000003"},
+		{"wrong square", "", func(data *magic.Data) {
+			data.Rook.Magics[1] = data.Rook.Magics[2]
+		}, "expected the magic for b8"},
+		{"shift too small", "", func(data *magic.Data) {
+			data.Rook.Magics[0].Shift = 40
+		}, "invalid shift 40 for a8"},
+		{"overlapping tables disagree", "", func(data *magic.Data) {
+			data.Bishop.Magics[0].Offset = data.Rook.Magics[0].Offset
+		}, "magic for bishop on a8"},
+		{"old schema", "", func(data *magic.Data) {
+			data.Metadata.Version = "1.0.1"
+		}, "schema version 1, want 2"},
+		{"wrong version", "2.0.1", func(*magic.Data) {}, "want 2.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := builtInMagics(t)
+			tt.corrupt(&data)
+
+			err := VerifyMagics(&data, tt.version)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // t.Setenv can't be used in parallel tests.
+func TestMagicsFileEnv(t *testing.T) {
+	data := builtInMagics(t)
+	data.Rook.Magics[28].Magic = "0000000000000001"
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "magics.json")
+	if err := os.WriteFile(path, jsonData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(MagicsFileEnv, path)
+
+	var table Lookup
+	if err := InitialiseLookupTables(&table); err == nil {
+		t.Error("initialised lookup tables from a file with a bad magic")
+	}
+
+	if err := os.WriteFile(path, magic.JSONData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitialiseLookupTables(&table); err != nil {
+		t.Errorf("failed to initialise lookup tables from a copy of the built-in magics: %v", err)
+	}
+}
@@ -4,11 +4,18 @@ import (
 	_ "embed"
 )
 
+// SchemaVersion is the major version of the layout of magics.json that these types describe. Data
+// whose version has a different major version can't be read with them.
+const SchemaVersion = 2
+
 type Entry struct {
 	Square string `json:"square"`
 	Magic  string `json:"magic"` // as hex string
 	Shift  int    `json:"shift"`
 	Mask   string `json:"mask"` // as hex string
+	// Offset is the index of the square's part of the attack table, which is shared by the squares
+	// of both pieces. The parts of different squares may overlap where their entries agree.
+	Offset int `json:"offset"`
 }
 
 type Data struct {
@@ -28,6 +35,8 @@ type BishopData struct {
 }
 
 type Metadata struct {
+	// TotalTableSize is the size of the table shared by both pieces. It's less than the sum of the
+	// pieces' sizes when the tables of their squares overlap.
 	TotalTableSize string `json:"total_table_size"`
 	Generated      string `json:"generated"`
 	Version        string `json:"version"`